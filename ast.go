@@ -38,8 +38,10 @@ type Literal struct {
 
 type BasicLit struct {
 	Node
-	Number *string `  @Number`
-	String *string `| @String`
+	Number  *string `  @Number`
+	Heredoc *string `| @Heredoc`
+	String  *string `| @String`
+	Bytes   *string `| @Bytes`
 }
 
 type CompositeLit struct {
@@ -60,12 +62,15 @@ type ObjectLit struct {
 
 type KeyValueExpr struct {
 	Node
-	Key   Expr `@@ ":"`
-	Value Expr `@@`
+	Spread *Expr `( "..." @@`
+	Key    Expr  `| @@ ":"`
+	Value  Expr  `@@ )`
 }
 
 type Expr struct {
 	Node
+	// Spread is allowed only for elements of arrays and arguments of calls.
+	Spread     bool        `@"..."?`
 	UnaryExpr  UnaryExpr   `@@`
 	BinaryExpr *BinaryExpr `@@?`
 }
@@ -79,7 +84,7 @@ type BinaryExpr struct {
 
 type UnaryExpr struct {
 	Node
-	UnaryOp *string `@("-" | "not")?`
+	UnaryOp *string `@("-" | "not" | "await")?`
 	Operand Operand `@@`
 }
 
@@ -108,6 +113,7 @@ type BlockExpr struct {
 
 type FuncExpr struct {
 	Node
+	Async bool         `@"async"?`
 	Args  *List[Ident] `"|" EOL* @@? EOL* "|" FuncSign`
 	Block *BlockStmt   `( @@`
 	Expr  *Expr        `| @@ )`
@@ -147,16 +153,20 @@ type Stmt struct {
 	If       *IfStmt       `( @@`
 	For      *ForStmt      `| @@`
 	While    *WhileStmt    `| @@`
+	DoWhile  *DoWhileStmt  `| @@`
+	Loop     *LoopStmt     `| @@`
 	Return   *ReturnStmt   `| @@`
 	Continue *ContinueStmt `| @@`
 	Break    *BreakStmt    `| @@`
+	Yield    *YieldStmt    `| @@`
 	Using    *UsingStmt    `| @@`
 	Expr     *ExprStmt     `| @@ )`
 }
 
 type ExprStmt struct {
 	Node
-	IsPub       *string `@"pub"?`
+	IsPub       *string `( @"pub"`
+	IsLet       *string `| @"let" )?`
 	X           Expr    `@@`
 	AugmentedOp *string `( @OpBinaryArith? `
 	AssignX     *Expr   `  "=" @@ )?`
@@ -180,12 +190,25 @@ type ForStmt struct {
 	IdentList *List[Ident] `"for" (@@ "in")?`
 	OverX     Expr         `@@`
 	Block     BlockStmt    `@@`
+	ElseBlock *BlockStmt   `( "else" @@ )?`
 }
 
 type WhileStmt struct {
 	Node
+	Cond      Expr       `"while" @@`
+	Block     BlockStmt  `@@`
+	ElseBlock *BlockStmt `( "else" @@ )?`
+}
+
+type DoWhileStmt struct {
+	Node
+	Block BlockStmt `"do" @@`
 	Cond  Expr      `"while" @@`
-	Block BlockStmt `@@`
+}
+
+type LoopStmt struct {
+	Node
+	Block BlockStmt `"loop" @@`
 }
 
 type ReturnStmt struct {
@@ -203,10 +226,46 @@ type BreakStmt struct {
 	Key struct{} `"break"`
 }
 
+type YieldStmt struct {
+	Node
+	X Expr `"yield" @@`
+}
+
 type UsingStmt struct {
 	Node
-	Name  Ident  `"using" @@`
-	Alias *Ident `("as" @@)?`
+	List []*UsingSpec `"using" @@ ("," @@)*`
+}
+
+// UsingSpec is the package of the using statement.
+type UsingSpec struct {
+	Node
+	Name Ident `@@`
+	// Path is the rest of the dotted package name, e.g. http of net.http.
+	Path  []Ident `("." @@)*`
+	Alias *Ident  `("as" @@)?`
+}
+
+// Package returns the dotted name of the package.
+func (s *UsingSpec) Package() string {
+	name := s.Name.Name
+	for _, ident := range s.Path {
+		name += "." + ident.Name
+	}
+
+	return name
+}
+
+// Binding returns the variable name of the package: the alias or the last
+// element of the package name.
+func (s *UsingSpec) Binding() string {
+	switch {
+	case s.Alias != nil:
+		return s.Alias.Name
+	case len(s.Path) > 0:
+		return s.Path[len(s.Path)-1].Name
+	}
+
+	return s.Name.Name
 }
 
 type ProgramFile struct {
@@ -121,6 +121,18 @@ func TestBasicLit(t *testing.T) {
 				String: ptr("\"hello\nworld\""),
 			},
 		},
+		{
+			Code: `"""say "hi" now"""`,
+			Expected: BasicLit{
+				Heredoc: ptr(`"""say "hi" now"""`),
+			},
+		},
+		{
+			Code: `b"\x00ab"`,
+			Expected: BasicLit{
+				Bytes: ptr(`b"\x00ab"`),
+			},
+		},
 		{
 			Code:      `hello`,
 			IsInvalid: true,
@@ -435,6 +447,28 @@ func TestStmt(t *testing.T) {
 				},
 			},
 		},
+		{
+			Code: `let a = 1`,
+			Expected: ProgramFile{
+				List: &[]*Stmt{
+					{
+						Expr: &ExprStmt{
+							IsLet: ptr("let"),
+							X: Expr{UnaryExpr: UnaryExpr{Operand: Operand{
+								Name: &Ident{Name: "a"},
+							}}},
+							AssignX: &Expr{
+								UnaryExpr: UnaryExpr{Operand: Operand{Literal: &Literal{
+									Basic: &BasicLit{
+										Number: ptr("1"),
+									},
+								}}},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			Code: `
 			if a < b {
@@ -626,10 +660,34 @@ func TestStmt(t *testing.T) {
 		},
 		{
 			Code: `using iter as it`,
-			Expected: ProgramFile{List: &[]*Stmt{&Stmt{Using: &UsingStmt{
+			Expected: ProgramFile{List: &[]*Stmt{&Stmt{Using: &UsingStmt{List: []*UsingSpec{{
 				Name:  Ident{Name: "iter"},
 				Alias: &Ident{Name: "it"},
-			}}}},
+			}}}}}},
+		},
+		{
+			Code: `using net.http as http`,
+			Expected: ProgramFile{List: &[]*Stmt{&Stmt{Using: &UsingStmt{List: []*UsingSpec{{
+				Name:  Ident{Name: "net"},
+				Path:  []Ident{{Name: "http"}},
+				Alias: &Ident{Name: "http"},
+			}}}}}},
+		},
+		{
+			Code:      `using net.`,
+			IsInvalid: true,
+		},
+		{
+			Code: `using iter, funcs as f, net.http`,
+			Expected: ProgramFile{List: &[]*Stmt{&Stmt{Using: &UsingStmt{List: []*UsingSpec{
+				{Name: Ident{Name: "iter"}},
+				{Name: Ident{Name: "funcs"}, Alias: &Ident{Name: "f"}},
+				{Name: Ident{Name: "net"}, Path: []Ident{{Name: "http"}}},
+			}}}}},
+		},
+		{
+			Code:      `using iter,`,
+			IsInvalid: true,
 		},
 	}
 
@@ -646,6 +704,21 @@ func TestStmt(t *testing.T) {
 	}
 }
 
+// FuzzParse checks that the lexer and the parser return errors instead of
+// panicking, parse errors must carry the position.
+func FuzzParse(f *testing.F) {
+	for _, src := range seedSources(f) {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		_, err := parser.ParseString("main.ela", src)
+		if err != nil && newParseError(err).Pos.Filename != "main.ela" {
+			t.Fatalf("parse error without position: %s", err)
+		}
+	})
+}
+
 func isEq(t *testing.T, x, y any, caseNum int) {
 	var xb, yb bytes.Buffer
 	require.NoError(t, json.NewEncoder(&xb).Encode(x), caseNum)
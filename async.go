@@ -0,0 +1,308 @@
+package easylang
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+var errDeadlock = errors.New("await: deadlock, async calls are waiting for each other")
+
+// eventLoop runs calls of async functions. Each call is a task running in its
+// own goroutine, but control is handed over explicitly, so only one task or
+// the top level code runs at a time. Waits of the loop are stopped by the
+// interrupt of the machine.
+type eventLoop struct {
+	ready     []*task
+	waiting   []*task
+	current   *task
+	interrupt *variant.Interrupt
+	// err fails awaits of tasks unwound by cancel.
+	err error
+}
+
+// task is a single call of an async function.
+type task struct {
+	fn      *variant.Func
+	args    variant.Args
+	scopes  []*VarScope
+	frames  []*frame
+	promise *variant.Promise
+	awaits  *variant.Promise
+	depth   *callDepth
+	calls   int
+	started bool
+	resume  chan struct{}
+	pause   chan struct{}
+}
+
+func (t *task) run() {
+	<-t.resume
+
+	v, err := t.fn.Call(t.args)
+	if err != nil {
+		t.promise.Reject(err)
+	} else {
+		t.promise.Resolve(v)
+	}
+
+	t.pause <- struct{}{}
+}
+
+// suspend hands control back to the loop until the task is resumed.
+func (t *task) suspend() {
+	t.pause <- struct{}{}
+	<-t.resume
+}
+
+// spawn schedules the call of fn. The call starts once the loop runs. While
+// the task runs, the scopes of fn have the given frames and calls of the task
+// are counted by depth.
+func (l *eventLoop) spawn(fn *variant.Func, args variant.Args, scopes []*VarScope, frames []*frame, depth *callDepth) *variant.Promise {
+	t := &task{
+		fn:      fn,
+		args:    args,
+		scopes:  scopes,
+		frames:  frames,
+		depth:   depth,
+		promise: variant.NewPromise(),
+		resume:  make(chan struct{}),
+		pause:   make(chan struct{}),
+	}
+	l.ready = append(l.ready, t)
+	return t.promise
+}
+
+// await returns the result of the promise. The current task is suspended
+// until the promise is settled, the top level code runs the loop instead.
+// Without the loop await just blocks.
+func (l *eventLoop) await(p *variant.Promise) (variant.Iface, error) {
+	if l == nil {
+		return p.Wait()
+	}
+
+	if t := l.current; t != nil {
+		if !p.Settled() && l.err == nil {
+			t.awaits = p
+			l.waiting = append(l.waiting, t)
+			t.suspend()
+		}
+
+		if l.err != nil {
+			return nil, l.err
+		}
+
+		return p.Wait()
+	}
+
+	if err := l.run(p); err != nil {
+		return nil, err
+	}
+
+	return p.Wait()
+}
+
+// run runs tasks until p is settled or, if p is nil, until all tasks are
+// finished.
+func (l *eventLoop) run(p *variant.Promise) error {
+	for p == nil || !p.Settled() {
+		l.wake()
+		if len(l.ready) == 0 {
+			if len(l.waiting) == 0 && p == nil {
+				return nil
+			}
+
+			if err := l.block(p); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		t := l.ready[0]
+		l.ready = l.ready[1:]
+		l.step(t)
+	}
+
+	return nil
+}
+
+// step runs the task until it is finished or awaits. Calls of the task are
+// counted only while it runs, so tasks awaiting at the same time do not add
+// up to the call depth limit.
+func (l *eventLoop) step(t *task) {
+	if !t.started {
+		t.started = true
+		go t.run()
+	}
+
+	l.current = t
+	frames := activate(t.scopes, t.frames)
+	base := t.depth.count()
+	t.depth.add(t.calls)
+	t.resume <- struct{}{}
+	<-t.pause
+	t.calls = t.depth.count() - base
+	t.depth.add(-t.calls)
+	t.frames = activate(t.scopes, frames)
+	l.current = nil
+}
+
+// wake moves waiting tasks with settled promises to ready ones.
+func (l *eventLoop) wake() {
+	waiting := l.waiting[:0]
+	for _, t := range l.waiting {
+		if t.awaits.Settled() {
+			t.awaits = nil
+			l.ready = append(l.ready, t)
+			continue
+		}
+
+		waiting = append(waiting, t)
+	}
+
+	clear(l.waiting[len(waiting):])
+	l.waiting = waiting
+}
+
+// block waits until p or any promise awaited by tasks is settled. If all of
+// them are promises of waiting tasks, nothing can ever be settled. The wait
+// fails when the interrupt stops the script.
+func (l *eventLoop) block(p *variant.Promise) error {
+	awaited := make([]*variant.Promise, 0, len(l.waiting)+1)
+	if p != nil {
+		awaited = append(awaited, p)
+	}
+
+	pending := make(map[*variant.Promise]struct{}, len(l.waiting))
+	for _, t := range l.waiting {
+		awaited = append(awaited, t.awaits)
+		pending[t.promise] = struct{}{}
+	}
+
+	deadlock := true
+	cases := make([]reflect.SelectCase, 0, len(awaited))
+	for _, p := range awaited {
+		if _, ok := pending[p]; !ok {
+			deadlock = false
+		}
+
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(p.Done()),
+		})
+	}
+
+	if deadlock {
+		return errDeadlock
+	}
+
+	done, stop := l.interrupt.Done()
+	defer stop()
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(done),
+	})
+
+	if chosen, _, _ := reflect.Select(cases); chosen == len(cases)-1 {
+		return l.interrupt.Check()
+	}
+
+	return nil
+}
+
+// cancel unwinds tasks left by the run failed with err. Started tasks are
+// resumed with their awaits failing with err, so their goroutines exit, and
+// promises of tasks not started yet are rejected.
+func (l *eventLoop) cancel(err error) {
+	if l == nil {
+		return
+	}
+
+	l.err = err
+	defer func() { l.err = nil }()
+	for len(l.ready) > 0 || len(l.waiting) > 0 {
+		tasks := append(l.ready, l.waiting...)
+		l.ready, l.waiting = nil, nil
+		for _, t := range tasks {
+			t.awaits = nil
+			if !t.started {
+				t.promise.Reject(err)
+				continue
+			}
+
+			l.step(t)
+		}
+	}
+}
+
+type AsyncFuncCodeGen struct {
+	exprGen *ExprCodeGen
+}
+
+// CodeGen compiles the function returning a promise of its result. Like the
+// generator, the task switches frames of all scopes of the body, so calls
+// awaiting at the same time do not overwrite variables of each other.
+func (c *AsyncFuncCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
+	body := *node
+	body.Async = false
+
+	vars := c.exprGen.vars
+	var inner []*VarScope
+	eval, err := (&FuncExprCodeGen{exprGen: c.exprGen.withVars(vars.collecting(&inner))}).CodeGen(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	loop := c.exprGen.loop
+	depth := c.exprGen.depth
+	all := append(slices.Clone(vars.Locals), inner...)
+
+	// settled runs fn in place. It is used outside of the loop, e.g. by
+	// parallel workers.
+	settled := func(fn *variant.Func) *variant.Func {
+		return variant.NewFunc(fn.Idents(), func(args variant.Args) (variant.Iface, error) {
+			p := variant.NewPromise()
+			if v, err := fn.Call(args); err != nil {
+				p.Reject(err)
+			} else {
+				p.Resolve(v)
+			}
+
+			return p, nil
+		})
+	}
+
+	return evaler(func() (variant.Iface, error) {
+		v, err := eval.Eval()
+		if err != nil {
+			return nil, err
+		}
+
+		fn := variant.MustCast[*variant.Func](v)
+		fork := func() *variant.Func {
+			return settled(fn.Fork())
+		}
+
+		if loop == nil {
+			return settled(fn).WithFork(fork), nil
+		}
+
+		return variant.NewFunc(fn.Idents(), func(args variant.Args) (variant.Iface, error) {
+			if len(args) != len(fn.Idents()) {
+				return nil, fmt.Errorf("expected arguments %d, got %d", len(fn.Idents()), len(args))
+			}
+
+			// fn activates frames it captured and its own one when called
+			frames := make([]*frame, len(all))
+			for i := range frames {
+				frames[i] = &frame{}
+			}
+
+			return loop.spawn(fn, args, all, frames, depth), nil
+		}).WithFork(fork), nil
+	}), nil
+}
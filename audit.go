@@ -0,0 +1,62 @@
+package easylang
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// maxArgSummary is the max number of characters of argument summaries.
+const maxArgSummary = 64
+
+// HostCall describes the call of a builtin or package function.
+type HostCall struct {
+	// Name is the qualified function name, e.g. "builtin.print".
+	Name     string
+	Args     []string
+	Duration time.Duration
+	Err      error
+}
+
+// AuditHandler receives calls of builtin and package functions.
+type AuditHandler func(call HostCall)
+
+func summarize(v variant.Iface) string {
+	s := v.String()
+	if v.Type() == variant.TypeString {
+		s = `"` + s + `"`
+	}
+
+	if utf8.RuneCountInString(s) <= maxArgSummary {
+		return s
+	}
+
+	return string([]rune(s)[:maxArgSummary]) + "..."
+}
+
+// wrap makes the function of the package report its calls to the handler.
+func (h AuditHandler) wrap(pkg, name string, obj variant.Iface) variant.Iface {
+	fn, ok := obj.(*variant.Func)
+	if !ok {
+		return obj
+	}
+
+	qualname := pkg + "." + name
+	return variant.NewFunc(fn.Idents(), func(args variant.Args) (variant.Iface, error) {
+		summaries := make([]string, 0, len(args))
+		for _, arg := range args {
+			summaries = append(summaries, summarize(arg))
+		}
+
+		start := time.Now()
+		res, err := fn.Call(args)
+		h(HostCall{
+			Name:     qualname,
+			Args:     summaries,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+		return res, err
+	})
+}
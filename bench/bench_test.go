@@ -0,0 +1,138 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hikitani/easylang"
+)
+
+// compile returns the program of src on the new machine, the machine output
+// is discarded.
+func compile(b *testing.B, src string) easylang.StmtInvoker {
+	b.Helper()
+
+	vm := easylang.New()
+	vm.SetOutput(discard{})
+	program, err := vm.Compile("bench.ela", strings.NewReader(src))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return program
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func run(b *testing.B, src string) {
+	program := compile(b, src)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := program.Invoke(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkArithmeticLoop(b *testing.B) {
+	run(b, `
+		sum = 0
+		for i in range(1000) {
+			sum = sum + i * 2 - i % 7
+		}
+	`)
+}
+
+func BenchmarkStringBuilding(b *testing.B) {
+	run(b, `
+		s = ""
+		for i in range(200) {
+			s = s + str(i) + ","
+		}
+	`)
+}
+
+func BenchmarkObjectAccess(b *testing.B) {
+	run(b, `
+		obj = {"foo": 1, "bar": {"baz": 2}, 3: "qux"}
+		sum = 0
+		for i in range(200) {
+			sum = sum + obj.foo + obj.bar.baz + obj["bar", "baz"]
+			obj.foo = i
+		}
+	`)
+}
+
+func BenchmarkPropertyRead(b *testing.B) {
+	run(b, `
+		cfg = {"size": {"w": 3, "h": 4}, "scale": 2}
+		area = 0
+		for i in range(500) {
+			area = area + cfg.size.w * cfg.size.h * cfg.scale
+		}
+	`)
+}
+
+func BenchmarkArrayBuilding(b *testing.B) {
+	run(b, `
+		arr = []
+		for i in range(1000) {
+			arr = arr + [i]
+		}
+		half = slice(arr, 0, 500) + slice(arr, 500)
+	`)
+}
+
+func BenchmarkFuncCalls(b *testing.B) {
+	run(b, `
+		fib = none
+		fib = |n| => {
+			if n < 2 {
+				return n
+			}
+
+			return fib(n - 1) + fib(n - 2)
+		}
+		x = fib(15)
+	`)
+}
+
+// BenchmarkImports measures compiling the script with imports, which are
+// parsed and compiled again by every compile.
+func BenchmarkImports(b *testing.B) {
+	fsys := fstest.MapFS{
+		"lib/math.ela": &fstest.MapFile{Data: []byte(`
+			pub square = |x| => x * x
+			pub cube = |x| => x * square(x)
+		`)},
+		"lib/text.ela": &fstest.MapFile{Data: []byte(`
+			pub join = |a, b| => a + " " + b
+		`)},
+	}
+
+	src := `
+		math = import "lib/math.ela"
+		text = import "lib/text.ela"
+		x = text.join(str(math.cube(3)), "done")
+	`
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm := easylang.New()
+		vm.SetFS(fsys)
+		program, err := vm.Compile("bench.ela", strings.NewReader(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := program.Invoke(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+#!/bin/sh
+# Compares benchmarks of the working tree against the baseline revision and
+# fails when any benchmark is slower by more than the threshold.
+#
+#   bench/compare.sh [base-ref] [threshold-percent]
+#
+# The base defaults to HEAD and the threshold to 10. COUNT sets the number
+# of runs of every benchmark, 5 by default. benchstat is used for the report
+# when it is on PATH.
+set -eu
+
+base=${1:-HEAD}
+threshold=${2:-10}
+count=${COUNT:-5}
+root=$(git rev-parse --show-toplevel)
+tmp=$(mktemp -d)
+trap 'git -C "$root" worktree remove --force "$tmp/base" >/dev/null 2>&1; rm -rf "$tmp"' EXIT
+
+git -C "$root" worktree add --detach --quiet "$tmp/base" "$base"
+if [ ! -d "$tmp/base/bench" ]; then
+	echo "compare: $base has no bench package" >&2
+	exit 2
+fi
+
+(cd "$tmp/base" && go test -run '^$' -bench . -benchmem -count "$count" ./bench) > "$tmp/old.txt"
+(cd "$root" && go test -run '^$' -bench . -benchmem -count "$count" ./bench) > "$tmp/new.txt"
+
+if command -v benchstat >/dev/null 2>&1; then
+	benchstat "$tmp/old.txt" "$tmp/new.txt"
+fi
+
+# mean ns/op of every benchmark, the -N suffix of GOMAXPROCS is dropped
+awk -v threshold="$threshold" '
+	/^Benchmark/ {
+		name = $1
+		sub(/-[0-9]+$/, "", name)
+		for (i = 2; i < NF; i++) {
+			if ($(i + 1) == "ns/op") {
+				sum[FILENAME, name] += $i
+				n[FILENAME, name]++
+			}
+		}
+		names[name] = 1
+		files[FILENAME] = 1
+	}
+	END {
+		for (f in files) {
+			if (f ~ /old\.txt$/) old = f
+			else cur = f
+		}
+
+		failed = 0
+		for (name in names) {
+			if (!n[old, name] || !n[cur, name]) {
+				printf "%-32s missing in %s\n", name, n[old, name] ? "new" : "base"
+				continue
+			}
+
+			o = sum[old, name] / n[old, name]
+			c = sum[cur, name] / n[cur, name]
+			delta = (c - o) / o * 100
+			mark = ""
+			if (delta > threshold) {
+				mark = "  REGRESSION"
+				failed = 1
+			}
+			printf "%-32s %14.0f -> %14.0f ns/op %+7.1f%%%s\n", name, o, c, delta, mark
+		}
+		exit failed
+	}
+' "$tmp/old.txt" "$tmp/new.txt"
@@ -0,0 +1,4 @@
+// Package bench holds benchmarks of typical scripts: arithmetic loops,
+// string building, object access, function calls and imports. Run
+// compare.sh to compare the tree against the baseline revision.
+package bench
@@ -0,0 +1,81 @@
+package easylang
+
+import (
+	"sync/atomic"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// callSite holds the position of the last function call, so that host
+// functions can report where in the script they were called from.
+type callSite struct {
+	pos atomic.Pointer[lexer.Position]
+}
+
+func (s *callSite) set(pos *lexer.Position) {
+	if s != nil {
+		s.pos.Store(pos)
+	}
+}
+
+// Caller returns the file name and the line of the last call.
+func (s *callSite) Caller() (file string, line int) {
+	pos := s.pos.Load()
+	if pos == nil {
+		return "", 0
+	}
+
+	return pos.Filename, pos.Line
+}
+
+// callDepth counts nested calls of script functions, so runaway recursion
+// fails with *RecursionError before the Go stack overflows. Calls running
+// on other goroutines, e.g. forks and async calls, count on their own.
+type callDepth struct {
+	n   int
+	max int
+}
+
+func (d *callDepth) enter() error {
+	if d == nil {
+		return nil
+	}
+
+	if d.max > 0 && d.n >= d.max {
+		return &RecursionError{Depth: d.max}
+	}
+
+	d.n++
+	return nil
+}
+
+func (d *callDepth) leave() {
+	if d != nil {
+		d.n--
+	}
+}
+
+// count returns the number of running calls.
+func (d *callDepth) count() int {
+	if d == nil {
+		return 0
+	}
+
+	return d.n
+}
+
+// add adds n running calls, e.g. of the task resumed by the event loop.
+func (d *callDepth) add(n int) {
+	if d != nil {
+		d.n += n
+	}
+}
+
+// fork returns the counter of calls running on another goroutine.
+func (d *callDepth) fork() *callDepth {
+	if d == nil {
+		return nil
+	}
+
+	return &callDepth{max: d.max}
+}
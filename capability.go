@@ -0,0 +1,28 @@
+package easylang
+
+// Capability allows scripts to reach outside of the machine, e.g. to run
+// external commands. Capabilities are not granted by default.
+type Capability string
+
+const (
+	// CapabilityExec allows running commands with the exec package.
+	CapabilityExec Capability = "exec"
+)
+
+// packageCapabilities are capabilities needed by packages.
+var packageCapabilities = map[string]Capability{
+	"exec": CapabilityExec,
+}
+
+// Grant gives the capabilities to scripts of the machine.
+func (m *Machine) Grant(caps ...Capability) {
+	for _, c := range caps {
+		m.caps[c] = struct{}{}
+	}
+}
+
+// Granted reports whether the capability is given to scripts.
+func (m *Machine) Granted(c Capability) bool {
+	_, ok := m.caps[c]
+	return ok
+}
@@ -5,16 +5,18 @@ import (
 	"fmt"
 	"io/fs"
 	"math/big"
-	"os"
-	"path/filepath"
+	"path"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/hikitani/easylang/lexer"
+	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/iter"
 	"github.com/hikitani/easylang/packages/registry"
 	"github.com/hikitani/easylang/variant"
-	"golang.org/x/mod/module"
 )
 
 var (
@@ -43,6 +45,55 @@ func evaler(fn func() (variant.Iface, error)) ExprEvaler {
 	return &exprCodeFunc{fn: fn}
 }
 
+type constEvaler struct {
+	v variant.Iface
+}
+
+func (c *constEvaler) Eval() (variant.Iface, error) {
+	return c.v, nil
+}
+
+func constant(v variant.Iface) ExprEvaler {
+	return &constEvaler{v: v}
+}
+
+// constValue reports the value of eval if it is known at compile time.
+func constValue(eval ExprEvaler) (variant.Iface, bool) {
+	c, ok := eval.(*constEvaler)
+	if !ok {
+		return nil, false
+	}
+
+	return c.v, true
+}
+
+// foldConst evaluates eval at compile time when all of its operands are
+// constant, so the expression costs nothing at runtime.
+func foldConst(eval ExprEvaler, operands ...ExprEvaler) (ExprEvaler, error) {
+	for _, operand := range operands {
+		if _, ok := constValue(operand); !ok {
+			return eval, nil
+		}
+	}
+
+	v, err := eval.Eval()
+	if err != nil {
+		var at *posError
+		if errors.As(err, &at) {
+			return nil, compileErrorf(at.pos, "constant expression: %w", err)
+		}
+
+		return nil, fmt.Errorf("constant expression: %w", err)
+	}
+
+	// arrays and objects can be changed, so every run needs its own
+	if t := v.Type(); t == variant.TypeArray || t == variant.TypeObject {
+		return eval, nil
+	}
+
+	return constant(v), nil
+}
+
 type StmtInvoker interface {
 	Invoke() error
 }
@@ -59,104 +110,285 @@ func invoker(fn func() error) StmtInvoker {
 	return &stmtInvokerFunc{fn: fn}
 }
 
-type BasicLitCodeGen struct{}
+type nopInvoker struct{}
+
+func (nopInvoker) Invoke() error {
+	return nil
+}
+
+func isNop(invoker StmtInvoker) bool {
+	_, ok := invoker.(nopInvoker)
+	return ok
+}
+
+// isTerminating reports whether control never passes to the statement
+// following stmt.
+func isTerminating(stmt *Stmt) bool {
+	return stmt.Return != nil || stmt.Break != nil || stmt.Continue != nil ||
+		stmt.Loop != nil && !breaks(&stmt.Loop.Block)
+}
+
+// breaks reports whether the block has break statements leaving the loop
+// the block belongs to.
+func breaks(block *BlockStmt) bool {
+	if block == nil || block.List == nil {
+		return false
+	}
+
+	for _, stmt := range *block.List {
+		switch {
+		case stmt == nil:
+		case stmt.Break != nil:
+			return true
+		case stmt.If != nil:
+			for ifStmt := stmt.If; ifStmt != nil; ifStmt = ifStmt.ElseIf {
+				if breaks(&ifStmt.Block) || breaks(ifStmt.ElseBlock) {
+					return true
+				}
+			}
+		case stmt.For != nil:
+			if breaks(stmt.For.ElseBlock) {
+				return true
+			}
+		case stmt.While != nil:
+			if breaks(stmt.While.ElseBlock) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// BasicLitCodeGen compiles literals. Numbers are exact (see variant.NewRat)
+// when exact is set.
+type BasicLitCodeGen struct {
+	exact bool
+}
 
 func (ec *BasicLitCodeGen) CodeGen(node *BasicLit) (ExprEvaler, error) {
 	if v := node.Number; v != nil {
 		num := &big.Float{}
 		_, _, err := num.Parse(*v, 0)
 		if err != nil {
-			return nil, fmt.Errorf("bad parser: failed to parse number, %w", err)
+			return nil, compileErrorf(node.Pos, "bad parser: failed to parse number, %w", err)
+		}
+
+		if ec.exact && !num.IsInf() {
+			r, ok := new(big.Rat).SetString(*v)
+			if !ok {
+				return nil, compileErrorf(node.Pos, "bad parser: failed to parse number '%s' as fraction", *v)
+			}
+
+			return constant(variant.NewRat(r)), nil
+		}
+
+		lit := variant.NewNum(num)
+		if n, acc := num.Int64(); acc == big.Exact {
+			lit = variant.Int(int(n))
+		}
+
+		return constant(lit), nil
+	}
+
+	if v := node.Heredoc; v != nil {
+		body := strings.TrimSuffix(strings.TrimPrefix(*v, `"""`), `"""`)
+		// dedent keeps escapes, so they are checked in the source to report
+		// the exact position
+		if _, err := unescape(body); err != nil {
+			return nil, literalError(node, *v, len(`"""`), err)
+		}
+
+		s, err := unescape(dedent(body))
+		if err != nil {
+			return nil, compileError(node.Pos, err)
+		}
+
+		return constant(variant.NewString(string(s))), nil
+	}
+
+	if v := node.String; v != nil {
+		s, err := unescape(strings.TrimSuffix(strings.TrimPrefix(*v, `"`), `"`))
+		if err != nil {
+			return nil, literalError(node, *v, len(`"`), err)
+		}
+
+		return constant(variant.NewString(string(s))), nil
+	}
+
+	if v := node.Bytes; v != nil {
+		bs, err := unescape(strings.TrimSuffix(strings.TrimPrefix(*v, `b"`), `"`))
+		if err != nil {
+			return nil, literalError(node, *v, len(`b"`), err)
 		}
 
+		// byte arrays are mutable, so every evaluation gets its own copy
 		return evaler(func() (variant.Iface, error) {
-			return variant.NewNum(num), nil
+			return variant.Bytes(slices.Clone(bs)), nil
 		}), nil
 	}
 
-	if v := node.String; v != nil {
-		s := strings.Trim(*v, `"`)
-
-		runes := make([]rune, 0, len(s))
-		var atEsc bool
-		jump := 0
-		for i, ch := range s {
-			if jump > 0 {
-				jump--
-				continue
+	return nil, compileErrorf(node.Pos, "unknown basic literal (expected string, bytes or number)")
+}
+
+// escapeError is the invalid escape sequence starting at the byte offset of
+// the literal body.
+type escapeError struct {
+	at  int
+	msg string
+}
+
+func (e *escapeError) Error() string {
+	return "bad string literal: " + e.msg
+}
+
+// literalError positions the escape error at the backslash of the literal
+// lit, which body starts after prefix bytes.
+func literalError(node *BasicLit, lit string, prefix int, err error) error {
+	var eerr *escapeError
+	if !errors.As(err, &eerr) || node.Pos.Line == 0 {
+		return err
+	}
+
+	pos := node.Pos
+	pos.Advance(lit[:prefix+eerr.at])
+	return compileError(pos, err)
+}
+
+// unescape replaces escape sequences of the string literal with characters.
+// Byte escapes \xNN produce a single byte instead of a character.
+func unescape(s string) ([]byte, error) {
+	buf := make([]byte, 0, len(s))
+	esc := -1
+	jump := 0
+	for i, ch := range s {
+		if jump > 0 {
+			jump--
+			continue
+		}
+
+		if ch == '\\' && esc < 0 {
+			if lenAfter(s, i) < 1 {
+				return nil, &escapeError{at: i, msg: "backslash not escaped"}
 			}
+			esc = i
+			continue
+		}
 
-			if ch == '\\' {
-				if lenAfter(s, i) < 1 {
-					return nil, errors.New("bad string literal: backslash not escaped")
-				}
-				atEsc = true
-				continue
+		if esc < 0 {
+			buf = utf8.AppendRune(buf, ch)
+			continue
+		}
+
+		switch ch {
+		case 'x':
+			if lenAfter(s, i) < 2 {
+				return nil, &escapeError{at: esc, msg: "invalid \\x byte, expected 2 hex digits (\\x00)"}
 			}
+			jump = 2
 
-			if !atEsc {
-				runes = append(runes, ch)
-				continue
+			v, err := strconv.ParseUint(s[i+1:i+1+jump], 16, 8)
+			if err != nil {
+				return nil, &escapeError{at: esc, msg: "invalid \\x byte, expected 2 hex digits (\\x00)"}
 			}
 
-			switch ch {
-			case 'u':
-				if lenAfter(s, i) < 4 {
-					return nil, errors.New("bad string literal: invalid \\u char, expected 4 bytes (\\u0000)")
-				}
-				jump = 4
+			buf = append(buf, byte(v))
+		case 'u':
+			if lenAfter(s, i) < 4 {
+				return nil, &escapeError{at: esc, msg: "invalid \\u char, expected 4 hex digits (\\u0000)"}
+			}
+			jump = 4
 
-				sub := s[i+1 : (i+1)+jump]
-				v, err := strconv.ParseUint(sub, 16, 32)
-				if err != nil {
-					return nil, fmt.Errorf("bad string literal: illegal char in escape sequence: %w", err)
-				}
+			v, err := strconv.ParseUint(s[i+1:i+1+jump], 16, 32)
+			if err != nil {
+				return nil, &escapeError{at: esc, msg: "invalid \\u char, expected 4 hex digits (\\u0000)"}
+			}
 
-				runes = append(runes, rune(v))
-			case 'U':
-				if lenAfter(s, i) < 8 {
-					return nil, errors.New("bad string literal: invalid \\U char, expected 8 bytes (\\U00000000)")
-				}
-				jump = 8
+			buf = utf8.AppendRune(buf, rune(v))
+		case 'U':
+			if lenAfter(s, i) < 8 {
+				return nil, &escapeError{at: esc, msg: "invalid \\U char, expected 8 hex digits (\\U00000000)"}
+			}
+			jump = 8
 
-				sub := s[i+1 : (i+1)+jump]
-				v, err := strconv.ParseUint(sub, 16, 32)
-				if err != nil {
-					return nil, fmt.Errorf("bad string literal: illegal char in escape sequence: %w", err)
-				}
+			v, err := strconv.ParseUint(s[i+1:i+1+jump], 16, 32)
+			if err != nil {
+				return nil, &escapeError{at: esc, msg: "invalid \\U char, expected 8 hex digits (\\U00000000)"}
+			}
 
-				runes = append(runes, rune(v))
-			case 'a':
-				runes = append(runes, '\a')
-			case 'b':
-				runes = append(runes, '\b')
-			case 'f':
-				runes = append(runes, '\f')
-			case 'n':
-				runes = append(runes, '\n')
-			case 'r':
-				runes = append(runes, '\r')
-			case 't':
-				runes = append(runes, '\t')
-			case 'v':
-				runes = append(runes, '\v')
-			case '\\':
-				runes = append(runes, '\\')
-			case '\'':
-				runes = append(runes, '\'')
-			case '"':
-				runes = append(runes, '"')
-			}
-
-			atEsc = false
+			buf = utf8.AppendRune(buf, rune(v))
+		case '0':
+			buf = append(buf, 0)
+		case 'a':
+			buf = append(buf, '\a')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case '\\':
+			buf = append(buf, '\\')
+		case '\'':
+			buf = append(buf, '\'')
+		case '"':
+			buf = append(buf, '"')
+		default:
+			return nil, &escapeError{at: esc, msg: fmt.Sprintf("unknown escape sequence \\%c", ch)}
 		}
 
-		return evaler(func() (variant.Iface, error) {
-			return variant.NewString(string(runes)), nil
-		}), nil
+		esc = -1
+	}
+
+	return buf, nil
+}
+
+// dedent prepares the heredoc body: the line break after the opening quotes
+// is dropped, line breaks are normalized to \n and the common indentation
+// of lines is removed. Text right after the opening quotes is kept as is.
+// The line of the closing quotes is counted in the indentation, then it is
+// left empty.
+func dedent(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	if len(lines) == 1 {
+		return s
+	}
+
+	first := 1
+	if strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+		first = 0
+	}
+
+	indent := -1
+	for i := first; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" && i != len(lines)-1 {
+			continue
+		}
+
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	for i := first; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = lines[i][indent:]
+		}
 	}
 
-	return nil, errors.New("unknown basic literal (expected string or number)")
+	return strings.Join(lines, "\n")
 }
 
 type CompositeLitCodeGen struct {
@@ -178,17 +410,19 @@ func (c *CompositeLitCodeGen) CodeGen(node *CompositeLit) (ExprEvaler, error) {
 		}
 
 		evals := make([]ExprEvaler, 0, len(elems.X))
+		spreads := make([]bool, 0, len(elems.X))
 		for i, elExpr := range elems.X {
 			if elExpr == nil {
-				return nil, fmt.Errorf("bad array literal: invalid expression on %d position", i+1)
+				return nil, compileErrorf(lit.Pos, "bad array literal: invalid expression on %d position", i+1)
 			}
 
-			el, err := c.exprGen.CodeGen(elExpr)
+			el, err := c.exprGen.elemCodeGen(elExpr)
 			if err != nil {
-				return nil, fmt.Errorf("bad array literal on %d position: %w", i+1, err)
+				return nil, err
 			}
 
 			evals = append(evals, el)
+			spreads = append(spreads, elExpr.Spread)
 		}
 
 		return evaler(func() (variant.Iface, error) {
@@ -198,7 +432,17 @@ func (c *CompositeLitCodeGen) CodeGen(node *CompositeLit) (ExprEvaler, error) {
 				if err != nil {
 					return nil, fmt.Errorf("cannot evaluate expression of element %d of array: %w", i+1, err)
 				}
-				arr.Append(v)
+
+				if !spreads[i] {
+					arr.Append(v)
+					continue
+				}
+
+				spread, err := spreadArray(v, "array")
+				if err != nil {
+					return nil, errorAt(elems.X[i].Pos, fmt.Errorf("bad element %d of array: %w", i+1, err))
+				}
+				arr.Append(spread...)
 			}
 
 			return arr, nil
@@ -217,20 +461,31 @@ func (c *CompositeLitCodeGen) CodeGen(node *CompositeLit) (ExprEvaler, error) {
 			}), nil
 		}
 
+		// spread items have no key evaler
 		kvEvals := make([][2]ExprEvaler, 0, len(items.X))
 		for i, kv := range items.X {
 			if kv == nil {
-				return nil, fmt.Errorf("bad object literal: invalid item expression on %d position", i+1)
+				return nil, compileErrorf(node.ObjectLit.Pos, "bad object literal: invalid item expression on %d position", i+1)
+			}
+
+			if kv.Spread != nil {
+				valEval, err := c.exprGen.CodeGen(kv.Spread)
+				if err != nil {
+					return nil, err
+				}
+
+				kvEvals = append(kvEvals, [2]ExprEvaler{nil, valEval})
+				continue
 			}
 
 			keyEval, err := c.exprGen.CodeGen(&kv.Key)
 			if err != nil {
-				return nil, fmt.Errorf("bad object literal: invalid key expression on position %d: %w", i+1, err)
+				return nil, err
 			}
 
 			valEval, err := c.exprGen.CodeGen(&kv.Value)
 			if err != nil {
-				return nil, fmt.Errorf("bad object literal: invalid value expression on position %d: %w", i+1, err)
+				return nil, err
 			}
 
 			kvEvals = append(kvEvals, [2]ExprEvaler{keyEval, valEval})
@@ -240,6 +495,22 @@ func (c *CompositeLitCodeGen) CodeGen(node *CompositeLit) (ExprEvaler, error) {
 			keys, vals := make([]variant.Iface, 0, len(kvEvals)), make([]variant.Iface, 0, len(kvEvals))
 			for i, kv := range kvEvals {
 				keyEval, valEval := kv[0], kv[1]
+				if keyEval == nil {
+					v, err := valEval.Eval()
+					if err != nil {
+						return nil, fmt.Errorf("cannot evaluate spread expression on position %d: %w", i+1, err)
+					}
+
+					obj, ok := v.(*variant.Object)
+					if !ok {
+						return nil, errorAt(items.X[i].Pos, fmt.Errorf("bad object literal: cannot spread %s into object (expected object)", v.Type()))
+					}
+
+					objKeys, objVals := obj.Items()
+					keys, vals = append(keys, objKeys...), append(vals, objVals...)
+					continue
+				}
+
 				key, err := keyEval.Eval()
 				if err != nil {
 					return nil, fmt.Errorf("cannot evaluate expression of key on position %d: %w", i+1, err)
@@ -254,11 +525,16 @@ func (c *CompositeLitCodeGen) CodeGen(node *CompositeLit) (ExprEvaler, error) {
 				vals = append(vals, val)
 			}
 
-			return variant.MustNewObject(keys, vals), nil
+			obj, err := variant.NewObject(keys, vals)
+			if err != nil {
+				return nil, errorAt(node.Pos, fmt.Errorf("bad object literal: %w", err))
+			}
+
+			return obj, nil
 		}), nil
 	}
 
-	return nil, errors.New("unknown composite literal (expected array or object)")
+	return nil, compileErrorf(node.Pos, "unknown composite literal (expected array or object)")
 }
 
 type OperandCodeGen struct {
@@ -271,21 +547,13 @@ func (c *OperandCodeGen) CodeGen(node *Operand) (eval ExprEvaler, err error) {
 		vars := c.exprGen.vars.WithScope()
 		vars.ParentBlockScope = vars.LastScope()
 		eval, err = (&FuncExprCodeGen{
-			exprGen: &ExprCodeGen{
-				vars:     vars,
-				register: c.exprGen.register,
-				imports:  c.exprGen.imports,
-			},
+			exprGen: c.exprGen.withVars(vars),
 		}).CodeGen(node.Func)
 	case node.Block != nil:
 		vars := c.exprGen.vars.WithScope()
 		vars.ParentBlockScope = vars.LastScope()
 		eval, err = (&BlockExprCodeGen{
-			exprGen: &ExprCodeGen{
-				vars:     vars,
-				register: c.exprGen.register,
-				imports:  c.exprGen.imports,
-			},
+			exprGen: c.exprGen.withVars(vars),
 		}).CodeGen(node.Block)
 	case node.Import != nil:
 		eval, err = (&ImportExprCodeGen{
@@ -295,11 +563,11 @@ func (c *OperandCodeGen) CodeGen(node *Operand) (eval ExprEvaler, err error) {
 		lit := node.Literal
 		switch {
 		case lit.Basic != nil:
-			eval, err = (&BasicLitCodeGen{}).CodeGen(lit.Basic)
+			eval, err = (&BasicLitCodeGen{exact: c.exprGen.exact}).CodeGen(lit.Basic)
 		case lit.Composite != nil:
 			eval, err = (&CompositeLitCodeGen{exprGen: c.exprGen}).CodeGen(lit.Composite)
 		default:
-			return nil, errors.New("bad literal: invalid expression (expected basic or composit literal)")
+			return nil, compileErrorf(lit.Pos, "bad literal: invalid expression (expected basic or composit literal)")
 		}
 	case node.ParenExpr != nil:
 		eval, err = c.exprGen.CodeGen(node.ParenExpr)
@@ -309,33 +577,31 @@ func (c *OperandCodeGen) CodeGen(node *Operand) (eval ExprEvaler, err error) {
 		if lexer.IsConstValue(name) {
 			switch name {
 			case lexer.ConstValueNone:
-				return evaler(func() (variant.Iface, error) {
-					return variant.NewNone(), nil
-				}), nil
+				eval = constant(variant.NewNone())
 			case lexer.ConstValueTrue:
-				return evaler(func() (variant.Iface, error) {
-					return variant.NewBool(true), nil
-				}), nil
+				eval = constant(variant.NewBool(true))
 			case lexer.ConstValueFalse:
-				return evaler(func() (variant.Iface, error) {
-					return variant.NewBool(false), nil
-				}), nil
+				eval = constant(variant.NewBool(false))
 			case lexer.ConstValueInf:
-				return evaler(func() (variant.Iface, error) {
-					return variant.NewNum(new(big.Float).SetInf(false)), nil
-				}), nil
+				eval = constant(variant.Inf())
+			default:
+				return nil, compileErrorf(node.Name.Pos, "unknown const value %s", name)
 			}
 
-			return nil, fmt.Errorf("unknown const value %s", name)
+			break
 		}
 
 		if lexer.IsKeyword(name) {
-			return nil, fmt.Errorf("bad variable: name %s is keyword", name)
+			return nil, compileErrorf(node.Name.Pos, "bad variable: name %s is keyword", name)
 		}
 
 		scope, reg, ok := c.exprGen.vars.LookupRegister(name)
 		if !ok {
-			return nil, fmt.Errorf("variable %s not defined", name)
+			return nil, compileErrorf(node.Name.Pos, "variable %s not defined", name)
+		}
+
+		if scope == c.exprGen.vars.Global {
+			c.exprGen.refs.addGlobal(name)
 		}
 
 		eval = evaler(func() (variant.Iface, error) {
@@ -347,7 +613,7 @@ func (c *OperandCodeGen) CodeGen(node *Operand) (eval ExprEvaler, err error) {
 			return v, nil
 		})
 	default:
-		return nil, errors.New("unknown operand (expected literal, block, func, ident or parent expression)")
+		return nil, compileErrorf(node.Pos, "unknown operand (expected literal, block, func, ident or parent expression)")
 	}
 
 	if err != nil {
@@ -364,7 +630,7 @@ func (c *OperandCodeGen) CodeGen(node *Operand) (eval ExprEvaler, err error) {
 			prevEval: eval,
 		}).CodeGen(node.PX)
 		if err != nil {
-			return nil, fmt.Errorf("bad operand: %w", err)
+			return nil, err
 		}
 	}
 
@@ -391,78 +657,28 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 		}
 
 		idxEvals := make([]ExprEvaler, 0, len(args.X))
-		for i, expr := range args.X {
+		for _, expr := range args.X {
 			idxEval, err := c.exprGen.CodeGen(expr)
 			if err != nil {
-				return nil, fmt.Errorf("bad primary expression: index at %d position is invalid: %w", i+1, err)
+				return nil, err
 			}
 
 			idxEvals = append(idxEvals, idxEval)
 		}
 
+		pos := node.IndexExpr.Pos
 		eval = evaler(func() (variant.Iface, error) {
 			prev, err := c.prevEval.Eval()
 			if err != nil {
 				return nil, err
 			}
 
-			switch prev.Type() {
-			case variant.TypeArray:
-				if len(idxEvals) != 1 {
-					return nil, fmt.Errorf("array indexator must have 1 argument")
-				}
-				arr := variant.MustCast[*variant.Array](prev)
-
-				idxEval := idxEvals[0]
-				idx, err := idxEval.Eval()
-				if err != nil {
-					return nil, fmt.Errorf("cannot evaluate index: %w", err)
-				}
-
-				if idx.Type() != variant.TypeNum {
-					return nil, fmt.Errorf("index must be number, got %s", idx.Type())
-				}
-
-				num, err := variant.MustCast[*variant.Num](idx).AsInt64()
-				if err != nil {
-					return nil, fmt.Errorf("cannot to represent number as unsigned integer: %w", err)
-				}
-
-				val, err := arr.Get(num)
-				if err != nil {
-					return nil, fmt.Errorf("cannot get array element: %w", err)
-				}
-
-				return val, nil
-			case variant.TypeObject:
-				obj := variant.MustCast[*variant.Object](prev)
-				var res variant.Iface
-				for i, idxEval := range idxEvals {
-					idx, err := idxEval.Eval()
-					if err != nil {
-						return nil, fmt.Errorf("cannot evaluate index: %w", err)
-					}
-
-					v, err := obj.Get(idx)
-					if err != nil {
-						return nil, fmt.Errorf("cannot get value by index %d: %w", i, err)
-					}
-
-					if i != len(idxEvals)-1 {
-						if v.Type() != variant.TypeObject {
-							return nil, fmt.Errorf("value at index %d unsupports indexator (expected object, got %s)", i, v.Type())
-						}
-
-						obj = variant.MustCast[*variant.Object](v)
-					} else {
-						res = v
-					}
-				}
-
-				return res, nil
+			v, err := indexValue(prev, idxEvals)
+			if err != nil {
+				return nil, errorAt(pos, err)
 			}
 
-			return nil, fmt.Errorf("unsupported indexator for %s", prev.Type())
+			return v, nil
 		})
 	case node.CallExpr != nil:
 		nextNode = node.CallExpr.PX
@@ -471,14 +687,17 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 			args = &List[Expr]{}
 		}
 
+		pos := &node.CallExpr.Pos
 		argEvals := make([]ExprEvaler, 0, len(args.X))
-		for i, expr := range args.X {
-			argEval, err := c.exprGen.CodeGen(expr)
+		spreads := make([]bool, 0, len(args.X))
+		for _, expr := range args.X {
+			argEval, err := c.exprGen.elemCodeGen(expr)
 			if err != nil {
-				return nil, fmt.Errorf("bad primary expression: argument at %d position is invalid: %w", i+1, err)
+				return nil, err
 			}
 
 			argEvals = append(argEvals, argEval)
+			spreads = append(spreads, expr.Spread)
 		}
 
 		eval = evaler(func() (variant.Iface, error) {
@@ -487,22 +706,50 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 				return nil, err
 			}
 
-			if prev.Type() != variant.TypeFunc {
-				return nil, fmt.Errorf("unsupported caller expression for %s (expected func)", prev.Type())
+			fn, ok := prev.(variant.Caller)
+			var self variant.Iface
+			if !ok {
+				if fn, ok = objectHook(prev, "__call"); !ok {
+					return nil, errorAt(*pos, fmt.Errorf("unsupported caller expression for %s (expected func)", prev.Type()))
+				}
+
+				self = prev
+			}
+
+			args := make([]variant.Iface, 0, len(argEvals)+1)
+			if self != nil {
+				args = append(args, self)
 			}
 
-			fn := variant.MustCast[*variant.Func](prev)
-			args := make([]variant.Iface, 0, len(argEvals))
 			for i, argEval := range argEvals {
 				arg, err := argEval.Eval()
 				if err != nil {
 					return nil, fmt.Errorf("cannot evaluate argument at %d position: %w", i+1, err)
 				}
 
-				args = append(args, arg)
+				if !spreads[i] {
+					args = append(args, arg)
+					continue
+				}
+
+				elems, err := spreadArray(arg, "arguments")
+				if err != nil {
+					return nil, errorAt(*pos, fmt.Errorf("bad argument at %d position: %w", i+1, err))
+				}
+				args = append(args, elems...)
 			}
 
-			return fn.Call(args)
+			if err := c.exprGen.interrupt.Check(); err != nil {
+				return nil, err
+			}
+
+			c.exprGen.calls.set(pos)
+			v, err := fn.Call(args)
+			if err != nil {
+				return nil, errorAt(*pos, err)
+			}
+
+			return v, nil
 		})
 	case node.SelectorExpr != nil:
 		nextNode = node.SelectorExpr.PX
@@ -522,9 +769,9 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 
 				val = variant.NewString(sel.Ident.Name)
 			case sel.String != nil:
-				strEval, err := (&BasicLitCodeGen{}).CodeGen(&BasicLit{String: sel.String})
+				strEval, err := (&BasicLitCodeGen{}).CodeGen(&BasicLit{Node: sel.Node, String: sel.String})
 				if err != nil {
-					return nil, fmt.Errorf("bad primary expression: selector at %d position is invalid: %w", i+1, err)
+					return nil, err
 				}
 
 				res, err := strEval.Eval()
@@ -538,39 +785,49 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 			selVars = append(selVars, val)
 		}
 
+		caches := make([]*variant.PropCache, 0, len(selVars))
+		for i, sel := range selVars {
+			key, err := variant.NewKey(sel)
+			if err != nil {
+				return nil, compileErrorf(sels[i].Pos, "bad primary expression: %w", err)
+			}
+
+			caches = append(caches, variant.NewPropCache(key))
+		}
+
 		eval = evaler(func() (variant.Iface, error) {
 			prev, err := c.prevEval.Eval()
 			if err != nil {
 				return nil, err
 			}
 
-			if prev.Type() != variant.TypeObject {
-				return nil, fmt.Errorf("unsupported selector for %s (expected object)", prev.Type())
+			if _, ok := prev.(variant.Indexer); !ok && prev.Type() != variant.TypeObject {
+				return nil, errorAt(sels[0].Pos, fmt.Errorf("unsupported selector for %s (expected object)", prev.Type()))
 			}
 
-			obj := variant.MustCast[*variant.Object](prev)
-			var res variant.Iface
+			res := prev
 			for i, sel := range selVars {
-				v, err := obj.Get(sel)
-				if err != nil {
-					return nil, fmt.Errorf("cannot get value by %s: %w", selVars[i], err)
+				var v variant.Iface
+				switch cur := res.(type) {
+				case *variant.Object:
+					v, err = caches[i].Get(cur)
+				case variant.Indexer:
+					v, err = cur.Index(sel)
+				default:
+					return nil, errorAt(sels[i].Pos, fmt.Errorf("unsupported selector %s for %s (expected object)", selVars[i], res.Type()))
 				}
 
-				if i != len(selVars)-1 {
-					if v.Type() != variant.TypeObject {
-						return nil, fmt.Errorf("unsupported selector %s for %s (expected object)", selVars[i+1], v.Type())
-					}
-
-					obj = variant.MustCast[*variant.Object](v)
-				} else {
-					res = v
+				if err != nil {
+					return nil, errorAt(sels[i].Pos, fmt.Errorf("cannot get value by %s: %w", selVars[i], err))
 				}
+
+				res = v
 			}
 
 			return res, nil
 		})
 	default:
-		return nil, fmt.Errorf("unknown primary expression: expected selector, indexator or caller")
+		return nil, compileErrorf(node.Pos, "unknown primary expression: expected selector, indexator or caller")
 	}
 
 	if nextNode != nil {
@@ -580,67 +837,210 @@ func (c *PrimaryExprCodeGen) CodeGen(node *PrimaryExpr) (eval ExprEvaler, _ erro
 			prevEval: eval,
 		}).CodeGen(nextNode)
 		if err != nil {
-			return nil, fmt.Errorf("bad primary expression: %w", err)
+			return nil, err
 		}
 	}
 
 	return eval, nil
 }
 
-type UnaryExprCodeGen struct {
-	exprGen *ExprCodeGen
-}
+// indexValue evaluates the indexator of prev.
+func indexValue(prev variant.Iface, idxEvals []ExprEvaler) (variant.Iface, error) {
+	switch prev.Type() {
+	case variant.TypeArray:
+		if len(idxEvals) != 1 {
+			return nil, fmt.Errorf("array indexator must have 1 argument")
+		}
+		arr := variant.MustCast[*variant.Array](prev)
 
-func (c *UnaryExprCodeGen) CodeGen(node *UnaryExpr) (ExprEvaler, error) {
-	operandEval, err := (&OperandCodeGen{exprGen: c.exprGen}).CodeGen(&node.Operand)
-	if err != nil {
-		return nil, err
-	}
+		idxEval := idxEvals[0]
+		idx, err := idxEval.Eval()
+		if err != nil {
+			return nil, fmt.Errorf("cannot evaluate index: %w", err)
+		}
 
-	if node.UnaryOp == nil {
-		return operandEval, nil
-	}
+		if idx.Type() != variant.TypeNum {
+			return nil, fmt.Errorf("index must be number, got %s", idx.Type())
+		}
 
-	op := *node.UnaryOp
-	switch op {
-	case "-":
-		return evaler(func() (variant.Iface, error) {
-			v, err := operandEval.Eval()
-			if err != nil {
-				return nil, err
-			}
+		num, err := variant.MustCast[*variant.Num](idx).AsInt64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot to represent number as unsigned integer: %w", err)
+		}
 
-			if v.Type() != variant.TypeNum {
-				return nil, fmt.Errorf("%s doesn't support unary operator '-' (expected number)", v.Type())
-			}
+		val, err := arr.Get(num)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get array element: %w", err)
+		}
 
-			num := variant.MustCast[*variant.Num](v)
-			return num.Neg(), nil
-		}), nil
-	case "not":
-		return evaler(func() (variant.Iface, error) {
-			v, err := operandEval.Eval()
-			if err != nil {
-				return nil, err
-			}
+		return val, nil
+	case variant.TypeString:
+		if len(idxEvals) != 1 {
+			return nil, fmt.Errorf("string indexator must have 1 argument")
+		}
 
-			if v.Type() != variant.TypeBool {
-				return nil, fmt.Errorf("%s doesn't support unary operator 'not' (expected bool)", v.Type())
-			}
+		idx, err := idxEvals[0].Eval()
+		if err != nil {
+			return nil, fmt.Errorf("cannot evaluate index: %w", err)
+		}
 
-			b := variant.MustCast[*variant.Bool](v)
-			return variant.NewBool(!b.Bool()), nil
-		}), nil
-	}
+		if idx.Type() != variant.TypeNum {
+			return nil, fmt.Errorf("index must be number, got %s", idx.Type())
+		}
 
-	return nil, fmt.Errorf("unsupported unary operator %s", op)
-}
+		num, err := variant.MustCast[*variant.Num](idx).AsInt64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot to represent number as integer: %w", err)
+		}
 
-type FuncExprCodeGen struct {
+		ch, err := variant.MustCast[*variant.String](prev).Get(num)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get string character: %w", err)
+		}
+
+		return ch, nil
+	case variant.TypeObject:
+		if fn, ok := objectHook(prev, "__index"); ok {
+			args := variant.Args{prev}
+			for _, idxEval := range idxEvals {
+				idx, err := idxEval.Eval()
+				if err != nil {
+					return nil, fmt.Errorf("cannot evaluate index: %w", err)
+				}
+
+				args = append(args, idx)
+			}
+
+			return fn.Call(args)
+		}
+
+		obj := variant.MustCast[*variant.Object](prev)
+		var res variant.Iface
+		for i, idxEval := range idxEvals {
+			idx, err := idxEval.Eval()
+			if err != nil {
+				return nil, fmt.Errorf("cannot evaluate index: %w", err)
+			}
+
+			v, err := obj.Get(idx)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get value by index %d: %w", i, err)
+			}
+
+			if i != len(idxEvals)-1 {
+				if v.Type() != variant.TypeObject {
+					return nil, fmt.Errorf("value at index %d unsupports indexator (expected object, got %s)", i, v.Type())
+				}
+
+				obj = variant.MustCast[*variant.Object](v)
+			} else {
+				res = v
+			}
+		}
+
+		return res, nil
+	}
+
+	if idxr, ok := prev.(variant.Indexer); ok {
+		if len(idxEvals) != 1 {
+			return nil, fmt.Errorf("%s indexator must have 1 argument", prev.Type())
+		}
+
+		idx, err := idxEvals[0].Eval()
+		if err != nil {
+			return nil, fmt.Errorf("cannot evaluate index: %w", err)
+		}
+
+		return idxr.Index(idx)
+	}
+
+	return nil, fmt.Errorf("unsupported indexator for %s", prev.Type())
+}
+
+type UnaryExprCodeGen struct {
+	exprGen *ExprCodeGen
+}
+
+func (c *UnaryExprCodeGen) CodeGen(node *UnaryExpr) (ExprEvaler, error) {
+	operandEval, err := (&OperandCodeGen{exprGen: c.exprGen}).CodeGen(&node.Operand)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.UnaryOp == nil {
+		return operandEval, nil
+	}
+
+	var eval ExprEvaler
+	op := *node.UnaryOp
+	switch op {
+	case "-":
+		eval = evaler(func() (variant.Iface, error) {
+			v, err := operandEval.Eval()
+			if err != nil {
+				return nil, err
+			}
+
+			if d, ok := v.(*variant.Decimal); ok {
+				return d.Neg(), nil
+			}
+
+			if v.Type() != variant.TypeNum {
+				return nil, errorAt(node.Pos, fmt.Errorf("%s doesn't support unary operator '-' (expected number or decimal)", v.Type()))
+			}
+
+			num := variant.MustCast[*variant.Num](v)
+			return num.Neg(), nil
+		})
+	case "not":
+		eval = evaler(func() (variant.Iface, error) {
+			v, err := operandEval.Eval()
+			if err != nil {
+				return nil, err
+			}
+
+			if v.Type() != variant.TypeBool {
+				return nil, errorAt(node.Pos, fmt.Errorf("%s doesn't support unary operator 'not' (expected bool)", v.Type()))
+			}
+
+			b := variant.MustCast[*variant.Bool](v)
+			return variant.NewBool(!b.Bool()), nil
+		})
+	case "await":
+		loop := c.exprGen.loop
+		eval = evaler(func() (variant.Iface, error) {
+			v, err := operandEval.Eval()
+			if err != nil {
+				return nil, err
+			}
+
+			if v.Type() != variant.TypePromise {
+				return nil, errorAt(node.Pos, fmt.Errorf("%s doesn't support unary operator 'await' (expected promise)", v.Type()))
+			}
+
+			res, err := loop.await(variant.MustCast[*variant.Promise](v))
+			if err != nil {
+				return nil, errorAt(node.Pos, err)
+			}
+
+			return res, nil
+		})
+	default:
+		return nil, compileErrorf(node.Pos, "unsupported unary operator %s", op)
+	}
+
+	return foldConst(eval, operandEval)
+}
+
+type FuncExprCodeGen struct {
 	exprGen *ExprCodeGen
 }
 
 func (c *FuncExprCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
+	if node.Async {
+		return (&AsyncFuncCodeGen{exprGen: c.exprGen}).CodeGen(node)
+	}
+
 	args := node.Args
 	if args == nil {
 		args = &List[Ident]{}
@@ -652,7 +1052,7 @@ func (c *FuncExprCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
 	}
 
 	if len(args.X) != len(uniq) {
-		return nil, errors.New("bad function: argument names must be unique")
+		return nil, compileErrorf(node.Pos, "bad function: argument names must be unique")
 	}
 
 	type ScopeAndReg struct {
@@ -662,7 +1062,9 @@ func (c *FuncExprCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
 	regs := func(vars *Vars) []ScopeAndReg {
 		var res []ScopeAndReg
 		for _, arg := range args.X {
-			scope, reg := vars.Register(arg.Name)
+			// arguments always belong to the own scope of the function
+			scope := vars.LastScope()
+			reg := scope.Register(arg.Name)
 			res = append(res, ScopeAndReg{
 				Scope: scope,
 				Reg:   reg,
@@ -685,41 +1087,115 @@ func (c *FuncExprCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
 		}
 	}
 
-	var argIdents []string
+	// not nil even without parameters, nil idents mark host functions
+	argIdents := []string{}
 	for _, arg := range args.X {
 		argIdents = append(argIdents, arg.Name)
 	}
 
+	// fork compiles the function again with isolated variables, so the copy
+	// can run concurrently with the original. The copy runs outside of the
+	// event loop.
+	fork := func() *variant.Func {
+		exprGen := c.exprGen.withVars(c.exprGen.vars.isolated())
+		exprGen.warn = nil
+		exprGen.loop = nil
+		// the copy does not run within runs of the machine, so its
+		// dropped generators are closed only by the copy itself
+		exprGen.gens = &coroutines{running: 1}
+		exprGen.refs = nil
+		exprGen.depth = c.exprGen.depth.fork()
+		eval, err := (&FuncExprCodeGen{exprGen: exprGen}).CodeGen(node)
+		if err != nil {
+			panic("fork function: " + err.Error())
+		}
+
+		fn, err := eval.Eval()
+		if err != nil {
+			panic("fork function: " + err.Error())
+		}
+
+		return variant.MustCast[*variant.Func](fn)
+	}
+
 	switch {
 	case node.Expr != nil:
 		vars := c.exprGen.vars
 		prefn := prefngen(regs(vars))
 
-		eval, err := c.exprGen.CodeGen(node.Expr)
+		exprGen := c.exprGen.withVars(vars)
+		exprGen.gen = nil
+		eval, err := exprGen.CodeGen(node.Expr)
 		if err != nil {
-			return nil, fmt.Errorf("bad function: invalid expression: %w", err)
+			return nil, err
 		}
 
+		depth := c.exprGen.depth
+		scopes := slices.Clone(vars.Locals)
 		return evaler(func() (variant.Iface, error) {
+			cl := newClosure(scopes)
 			return variant.NewFunc(argIdents, func(vargs variant.Args) (variant.Iface, error) {
+				if err := depth.enter(); err != nil {
+					return nil, err
+				}
+				defer depth.leave()
+
+				defer activate(scopes, cl.enter())
 				if err := prefn(vargs); err != nil {
 					return nil, err
 				}
 
 				return eval.Eval()
-			}), nil
+			}).WithInterrupt(c.exprGen.interrupt).WithFork(fork), nil
 		}), nil
 	case node.Block != nil:
 		vars := c.exprGen.vars
 		prefn := prefngen(regs(vars))
 
-		invoker, err := (&BlockStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.Block)
+		var inner []*VarScope
+		exprGen := c.exprGen.withVars(vars.collecting(&inner))
+		exprGen.gen = &generator{coroutines: c.exprGen.gens}
+		invoker, err := (&BlockStmtCodeGen{exprGen: exprGen}).CodeGen(node.Block)
 		if err != nil {
-			return nil, fmt.Errorf("bad function: invalid block statement: %w", err)
+			return nil, err
+		}
+
+		// scopes of the body are switched by the enclosing collector too,
+		// e.g. of the async function
+		if vars.created != nil {
+			*vars.created = append(*vars.created, inner...)
+		}
+
+		scopes := slices.Clone(vars.Locals)
+		if gen := exprGen.gen; gen.used {
+			// the body runs between calls of next, so frames of all its
+			// scopes are switched by the iterator
+			all := append(slices.Clone(scopes), inner...)
+			return evaler(func() (variant.Iface, error) {
+				cl := newClosure(scopes)
+				return variant.NewFunc(argIdents, func(vargs variant.Args) (variant.Iface, error) {
+					frames := cl.startFrames(all)
+					prev := activate(all, frames)
+					defer activate(all, prev)
+					if err := prefn(vargs); err != nil {
+						return nil, err
+					}
+
+					return gen.newIterator(invoker, all, frames), nil
+				}).WithInterrupt(c.exprGen.interrupt).WithFork(fork), nil
+			}), nil
 		}
 
+		depth := c.exprGen.depth
 		return evaler(func() (variant.Iface, error) {
+			cl := newClosure(scopes)
 			return variant.NewFunc(argIdents, func(vargs variant.Args) (variant.Iface, error) {
+				if err := depth.enter(); err != nil {
+					return nil, err
+				}
+				defer depth.leave()
+
+				defer activate(scopes, cl.enter())
 				if err := prefn(vargs); err != nil {
 					return nil, err
 				}
@@ -730,11 +1206,11 @@ func (c *FuncExprCodeGen) CodeGen(node *FuncExpr) (ExprEvaler, error) {
 				}
 
 				return vars.LastScope().GetReturn(), nil
-			}), nil
+			}).WithInterrupt(c.exprGen.interrupt).WithFork(fork), nil
 		}), nil
 	}
 
-	return nil, fmt.Errorf("bad function expression")
+	return nil, compileErrorf(node.Pos, "bad function expression")
 }
 
 type BlockExprCodeGen struct {
@@ -746,10 +1222,12 @@ func (c *BlockExprCodeGen) CodeGen(node *BlockExpr) (ExprEvaler, error) {
 
 	invoker, err := (&BlockStmtCodeGen{exprGen: c.exprGen}).CodeGen(&node.Block)
 	if err != nil {
-		return nil, fmt.Errorf("bad block expression: invalid block statement: %w", err)
+		return nil, err
 	}
 
+	scope := vars.LastScope()
 	return evaler(func() (variant.Iface, error) {
+		defer scope.leave(scope.enter())
 		err := invoker.Invoke()
 		if err != nil && !errors.Is(err, ErrStmtFinished) {
 			return nil, err
@@ -760,8 +1238,13 @@ func (c *BlockExprCodeGen) CodeGen(node *BlockExpr) (ExprEvaler, error) {
 }
 
 type importsInfo struct {
-	From          fs.FS
+	From fs.FS
+	// Resolver finds imported files, FSResolver of From when it is nil.
+	Resolver ImportResolver
+	// Path is the canonical path of the compiled file.
+	Path          string
 	ImportedPaths map[string]struct{}
+	Builtins      packages.Iface
 }
 
 type ImportExprCodeGen struct {
@@ -773,7 +1256,7 @@ func (c *ImportExprCodeGen) CodeGen(node *ImportExpr) (ExprEvaler, error) {
 		Operand: Operand{Literal: &Literal{Basic: &BasicLit{String: &node.Path}}},
 	}})
 	if err != nil {
-		return nil, fmt.Errorf("invalid path: %s", err)
+		return nil, compileErrorf(node.Pos, "invalid path: %s", err)
 	}
 
 	pathVal, err := pathExpr.Eval()
@@ -783,55 +1266,60 @@ func (c *ImportExprCodeGen) CodeGen(node *ImportExpr) (ExprEvaler, error) {
 
 	pathStr := variant.MustCast[*variant.String](pathVal).String()
 	if pathStr == "" {
-		return nil, errors.New("invalid path: must be non empty")
-	}
-
-	toCheck := filepath.FromSlash(pathStr)
-
-	if len(toCheck) >= 2 && toCheck[0] == '.' && toCheck[1] == os.PathSeparator {
-		toCheck = toCheck[2:]
-	}
-
-	if err := module.CheckFilePath(toCheck); err != nil {
-		return nil, fmt.Errorf("invalid path: %s", err)
+		return nil, compileErrorf(node.Pos, "invalid path: must be non empty")
 	}
 
 	imports := c.exprGen.imports
-	if _, ok := imports.ImportedPaths[toCheck]; ok {
-		return nil, errors.New("import cycle not allowed")
+	resolver := imports.Resolver
+	if resolver == nil {
+		resolver = FSResolver(imports.From)
 	}
-	imports.ImportedPaths[toCheck] = struct{}{}
 
-	f, err := imports.From.Open(toCheck)
-	if errors.Is(err, fs.ErrNotExist) {
-		return nil, fmt.Errorf("file '%s' does not exist", pathStr)
-	} else if err != nil {
-		return nil, err
-	} else if s, err := f.Stat(); err != nil {
-		return nil, err
-	} else if !s.Mode().IsRegular() {
-		return nil, fmt.Errorf("path '%s' does not point to a file", pathStr)
+	f, name, err := resolver.Resolve(imports.Path, pathStr)
+	if err != nil {
+		return nil, &ImportError{Path: pathStr, Err: err}
 	}
 	defer f.Close()
 
-	ast, err := parser.Parse(filepath.Base(toCheck), f)
+	if _, ok := imports.ImportedPaths[name]; ok {
+		return nil, &ImportError{Path: pathStr, Err: errors.New("import cycle not allowed")}
+	}
+	imports.ImportedPaths[name] = struct{}{}
+	c.exprGen.refs.addImport(name)
+
+	ast, err := parser.Parse(path.Base(name), f)
 	if err != nil {
-		return nil, fmt.Errorf("parse: %w", err)
+		return nil, &ImportError{Path: pathStr, Err: newParseError(err)}
 	}
 
 	vars := NewVars()
+	if imports.Builtins != nil {
+		vars = NewVarsWith(imports.Builtins)
+	}
+
+	imports.Path = name
 	invoker, err := (&Program{
-		vars:     vars,
-		register: c.exprGen.register,
-		imports:  c.exprGen.imports,
+		vars:      vars,
+		register:  c.exprGen.register,
+		imports:   imports,
+		warn:      c.exprGen.warn,
+		calls:     c.exprGen.calls,
+		depth:     c.exprGen.depth,
+		interrupt: c.exprGen.interrupt,
+		loop:      c.exprGen.loop,
+		gens:      c.exprGen.gens,
+		exact:     c.exprGen.exact,
+		numeric:   c.exprGen.numeric,
+		strict:    c.exprGen.strict,
+		refs:      c.exprGen.refs.imported(),
 	}).CodeGen(ast)
 	if err != nil {
-		return nil, fmt.Errorf("cannot import: %w", err)
+		return nil, &ImportError{Path: pathStr, Err: err}
 	}
 
 	return evaler(func() (variant.Iface, error) {
 		if err := invoker.Invoke(); err != nil {
-			return nil, fmt.Errorf("cannot import '%s': %w", pathStr, err)
+			return nil, &ImportError{Path: pathStr, Err: err}
 		}
 
 		return vars.Published(), nil
@@ -839,12 +1327,71 @@ func (c *ImportExprCodeGen) CodeGen(node *ImportExpr) (ExprEvaler, error) {
 }
 
 type ExprCodeGen struct {
-	vars     *Vars
-	register *registry.Registry
-	imports  importsInfo
+	vars      *Vars
+	register  *registry.Registry
+	imports   importsInfo
+	warn      WarnHandler
+	calls     *callSite
+	depth     *callDepth
+	interrupt *variant.Interrupt
+	loop      *eventLoop
+	gens      *coroutines
+	gen       *generator
+	exact     bool
+	numeric   NumericPolicy
+	strict    bool
+	refs      *references
+}
+
+func (c *ExprCodeGen) withVars(vars *Vars) *ExprCodeGen {
+	child := *c
+	child.vars = vars
+	return &child
+}
+
+// interruptible makes the loop body check the interrupt before each run.
+func (c *ExprCodeGen) interruptible(body StmtInvoker) StmtInvoker {
+	interrupt := c.interrupt
+	if interrupt == nil {
+		return body
+	}
+
+	return invoker(func() error {
+		if err := interrupt.Check(); err != nil {
+			return err
+		}
+
+		return body.Invoke()
+	})
+}
+
+// elemCodeGen compiles the element of the array literal or the argument of
+// the call, which may be spread.
+func (c *ExprCodeGen) elemCodeGen(node *Expr) (ExprEvaler, error) {
+	if !node.Spread {
+		return c.CodeGen(node)
+	}
+
+	x := *node
+	x.Spread = false
+	return c.CodeGen(&x)
+}
+
+// spreadArray returns elements of the spread value, e.g. a of f(...a).
+func spreadArray(v variant.Iface, into string) ([]variant.Iface, error) {
+	arr, ok := v.(*variant.Array)
+	if !ok {
+		return nil, fmt.Errorf("cannot spread %s into %s (expected array)", v.Type(), into)
+	}
+
+	return arr.Elems(), nil
 }
 
 func (c *ExprCodeGen) CodeGen(node *Expr) (ExprEvaler, error) {
+	if node.Spread {
+		return nil, compileErrorf(node.Pos, "spread is allowed only in array literals and call arguments")
+	}
+
 	unaryEval, err := (&UnaryExprCodeGen{exprGen: c}).CodeGen(&node.UnaryExpr)
 	if err != nil {
 		return nil, err
@@ -855,24 +1402,31 @@ func (c *ExprCodeGen) CodeGen(node *Expr) (ExprEvaler, error) {
 	}
 
 	type opinfo struct {
-		op      string
+		op      opcode
 		prior   int
 		origPos int
+		node    *BinaryExpr
 	}
 	var ops []opinfo
 	evals := []ExprEvaler{unaryEval}
 	binExpr := node.BinaryExpr
 
 	for i := 0; binExpr != nil; i++ {
+		op, err := opcodeOf(binExpr.Op)
+		if err != nil {
+			return nil, compileErrorf(binExpr.Pos, "bad binary expression: %w", err)
+		}
+
 		ops = append(ops, opinfo{
-			op:      binExpr.Op,
+			op:      op,
 			prior:   lexer.MustOperatorPriority(binExpr.Op),
 			origPos: i,
+			node:    binExpr,
 		})
 
 		eval, err := (&UnaryExprCodeGen{exprGen: c}).CodeGen(&binExpr.X)
 		if err != nil {
-			return nil, fmt.Errorf("bad operand at %s position", binExpr.X.GetPos())
+			return nil, err
 		}
 		evals = append(evals, eval)
 		binExpr = binExpr.Next
@@ -882,6 +1436,8 @@ func (c *ExprCodeGen) CodeGen(node *Expr) (ExprEvaler, error) {
 		return ops[i].prior > ops[j].prior
 	})
 
+	numeric := c.numeric
+
 	getVal := func(eval ExprEvaler, stack *[]variant.Iface) (val variant.Iface, err error) {
 		if eval == nil {
 			// front := (*stack)[0]
@@ -900,12 +1456,12 @@ func (c *ExprCodeGen) CodeGen(node *Expr) (ExprEvaler, error) {
 	}
 
 	stackCap := (len(ops) + 1) / 2
-	stack := make([]variant.Iface, 0, stackCap)
-	evalMask := make([]bool, len(evals))
-	var leval, reval ExprEvaler
-	return evaler(func() (variant.Iface, error) {
-		clear(evalMask)
-		stack = stack[:0]
+	eval := evaler(func() (variant.Iface, error) {
+		// the state is local to the evaluation, since operands may call
+		// the function containing the expression again
+		stack := make([]variant.Iface, 0, stackCap)
+		evalMask := make([]bool, len(evals))
+		var leval, reval ExprEvaler
 
 		for _, opinfo := range ops {
 			i := opinfo.origPos
@@ -933,207 +1489,399 @@ func (c *ExprCodeGen) CodeGen(node *Expr) (ExprEvaler, error) {
 				return nil, err
 			}
 
-			res, err := evalBinary(opinfo.op, lval, rval)
+			res, err := evalBinary(opinfo.op, lval, rval, numeric)
 			if err != nil {
-				return nil, err
+				return nil, errorAt(opinfo.node.Pos, err)
 			}
 
 			stack = append(stack, res)
 		}
 
 		return stack[0], nil
-	}), nil
+	})
+
+	return foldConst(eval, evals...)
 }
 
-func evalBinary(op string, lval, rval variant.Iface) (variant.Iface, error) {
-	if op == "+" && rval.Type() == variant.TypeString && lval.Type() == variant.TypeString {
-		rs, ls := variant.MustCast[*variant.String](rval), variant.MustCast[*variant.String](lval)
-		return variant.NewString(ls.String() + rs.String()), nil
+// evalHostBinary dispatches the operator to host variants implementing
+// variant.BinaryOperator. It reports false if none of them supports it.
+func evalHostBinary(op opcode, lval, rval variant.Iface) (variant.Iface, bool, error) {
+	if binop, ok := lval.(variant.BinaryOperator); ok {
+		v, err := binop.BinaryOp(op.String(), rval, false)
+		if !errors.Is(err, variant.ErrUnsupportedOp) {
+			return v, true, err
+		}
 	}
 
-	if op == "+" && rval.Type() == variant.TypeArray && lval.Type() == variant.TypeArray {
-		rs, ls := variant.MustCast[*variant.Array](rval), variant.MustCast[*variant.Array](lval)
-		return ls.Concat(rs), nil
+	if binop, ok := rval.(variant.BinaryOperator); ok {
+		v, err := binop.BinaryOp(op.String(), lval, true)
+		if !errors.Is(err, variant.ErrUnsupportedOp) {
+			return v, true, err
+		}
 	}
 
-	if lexer.IsCmpOp(op) {
-		if rval.Type() != lval.Type() {
-			return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
-		}
+	return nil, false, nil
+}
 
-		b := false
-		switch op {
-		case "==":
-			b = variant.DeepEqual(lval, rval)
-		case "!=":
-			b = !variant.DeepEqual(lval, rval)
-		case "<", "<=", ">", ">=":
-			if rval.Type() != variant.TypeNum {
-				return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
-			}
+// binaryHooks maps operators to object keys of functions overloading them.
+// The second key is used when the object is the right operand.
+var binaryHooks = [opEnd][2]string{
+	opAdd: {"__add", "__radd"},
+	opSub: {"__sub", "__rsub"},
+	opMul: {"__mul", "__rmul"},
+	opDiv: {"__div", "__rdiv"},
+	opMod: {"__mod", "__rmod"},
+	opEq:  {"__eq", "__eq"},
+	opNe:  {"__ne", "__ne"},
+	opLt:  {"__lt", "__gt"},
+	opLe:  {"__le", "__ge"},
+	opGt:  {"__gt", "__lt"},
+	opGe:  {"__ge", "__le"},
+}
 
-			lnum, rnum := variant.MustCast[*variant.Num](lval), variant.MustCast[*variant.Num](rval)
+// objectHook returns the function stored by the special key of the object.
+func objectHook(v variant.Iface, name string) (variant.Caller, bool) {
+	obj, ok := v.(*variant.Object)
+	if !ok || obj.Len() == 0 {
+		return nil, false
+	}
 
-			switch op {
-			case "<":
-				b = lnum.LessThan(rnum)
-			case "<=":
-				b = lnum.LessOrEqualTo(rnum)
-			case ">":
-				b = lnum.GreaterThan(rnum)
-			case ">=":
-				b = lnum.GreaterOrEqualTo(rnum)
-			default:
-				panic("unreachable")
-			}
-		default:
-			return nil, fmt.Errorf("unknown operation '%s %s %s'", lval.Type(), op, rval.Type())
-		}
+	hook, err := obj.Get(variant.NewString(name))
+	if err != nil {
+		return nil, false
+	}
+
+	fn, ok := hook.(*variant.Func)
+	return fn, ok
+}
 
-		return variant.NewBool(b), nil
+// evalObjectBinary calls the function overloading the operator for objects,
+// e.g. {"__add": |self, other| => ...}. The object is passed as the first
+// argument. It reports false if the operator is not overloaded.
+func evalObjectBinary(op opcode, lval, rval variant.Iface) (variant.Iface, bool, error) {
+	hooks := binaryHooks[op]
+	if hooks[0] == "" {
+		return nil, false, nil
 	}
 
-	if lexer.IsArithOp(op) {
-		if rval.Type() != variant.TypeNum || lval.Type() != variant.TypeNum {
-			return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
-		}
-		rnum, lnum := variant.MustCast[*variant.Num](rval), variant.MustCast[*variant.Num](lval)
-		num := new(big.Float)
-		switch op {
-		case "+":
-			if lnum.IsInf() && rnum.IsInf() && lnum.Sign() != rnum.Sign() {
-				return nil, errors.New("op '+': addition of inf and inf with opposite signs")
-			}
-			num.Add(lnum.Value(), rnum.Value())
-		case "-":
-			if lnum.IsInf() && rnum.IsInf() && lnum.Sign() == rnum.Sign() {
-				return nil, errors.New("op '-': subtraction of inf from inf with equal signs")
-			}
-			num.Sub(lnum.Value(), rnum.Value())
-		case "/":
-			if lnum.IsZero() && rnum.IsZero() {
-				return nil, errors.New("op '/': division of zero into zero")
-			}
-			if lnum.IsInf() && rnum.IsInf() {
-				return nil, errors.New("op '/': division of inf into inf")
-			}
-			num.Quo(lnum.Value(), rnum.Value())
-		case "*":
-			if (lnum.IsZero() && rnum.IsInf()) || (lnum.IsInf() && rnum.IsZero()) {
-				return nil, errors.New("op '*': one operand is zero and the other operand an infinity")
-			}
-			num.Mul(lnum.Value(), rnum.Value())
-		case "%":
-			if rnum.Value().IsInf() {
-				return nil, errors.New("op '%': modulus with inf")
-			}
+	if fn, ok := objectHook(lval, hooks[0]); ok {
+		v, err := fn.Call(variant.Args{lval, rval})
+		return v, true, err
+	}
 
-			if rnum.IsZero() {
-				return nil, errors.New("op '%': modulus with zero")
-			}
+	if fn, ok := objectHook(rval, hooks[1]); ok {
+		v, err := fn.Call(variant.Args{rval, lval})
+		return v, true, err
+	}
 
-			if lnum.Value().IsInt() && rnum.Value().IsInt() {
-				var x, y big.Int
-				lnum.Value().Int(&x)
-				rnum.Value().Int(&y)
-				num.SetInt(x.Mod(&x, &y))
-			} else if div := new(big.Float).Quo(lnum.Value(), rnum.Value()); div.IsInf() {
-				num.Set(div)
-			} else {
-				// div = x / y
-				// x % y = x - int(div) * y
-
-				// 1. int(div)
-				divInt, _ := div.Int(nil)
-				// 2. int(div) * y
-				mul := new(big.Float).Mul(div.SetInt(divInt), rnum.Value())
-				// 3. x - int(div) * y
-				num.Sub(lnum.Value(), mul)
-
-				if lnum.Sign() < 0 {
-					if rnum.Sign() > 0 {
-						num.Add(rnum.Value(), num)
-					} else {
-						num.Add(mul.Neg(rnum.Value()), num)
-					}
-				}
-			}
-		default:
-			return nil, fmt.Errorf("unknown operation 'number %s number'", op)
-		}
+	if op != opNe {
+		return nil, false, nil
+	}
 
-		return variant.NewNum(num), nil
+	v, ok, err := evalObjectBinary(opEq, lval, rval)
+	if !ok || err != nil {
+		return nil, ok, err
 	}
 
-	if lexer.IsPredicateOp(op) {
-		if rval.Type() != variant.TypeBool || lval.Type() != variant.TypeBool {
-			return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
-		}
-		rb, lb := variant.MustCast[*variant.Bool](rval), variant.MustCast[*variant.Bool](lval)
-		var b bool
-		switch op {
-		case "and":
-			b = lb.Bool() && rb.Bool()
-		case "or":
-			b = lb.Bool() || rb.Bool()
-		default:
-			return nil, fmt.Errorf("unknown operation 'bool %s bool'", op)
-		}
-		return variant.NewBool(b), nil
+	b, isBool := v.(*variant.Bool)
+	if !isBool {
+		return nil, true, fmt.Errorf("__eq must return bool, got %s", v.Type())
 	}
 
-	return nil, fmt.Errorf("unknown operation '%s %s %s'", lval.Type(), op, rval.Type())
+	return variant.NewBool(!b.Bool()), true, nil
 }
 
-func lenAfter(s string, pos int) int {
-	return max(0, len(s)-(pos+1))
-}
+// evalBinary applies the operator to values. Division by zero and invalid
+// arithmetic operations are handled by the numeric policy.
+func evalBinary(op opcode, lval, rval variant.Iface, numeric NumericPolicy) (variant.Iface, error) {
+	if v, ok, err := evalHostBinary(op, lval, rval); ok {
+		return v, err
+	}
 
-type ContinueStmtCodeGen struct{}
+	if v, ok, err := evalObjectBinary(op, lval, rval); ok {
+		return v, err
+	}
 
-func (c *ContinueStmtCodeGen) CodeGen(node *ContinueStmt) (StmtInvoker, error) {
-	return invoker(func() error {
-		return ErrLoopContinue
-	}), nil
+	return binaryHandlers[op](op, lval, rval, numeric)
 }
 
-type BreakStmtCodeGen struct{}
+// evalAdd concatenates strings and arrays, and adds numbers.
+func evalAdd(op opcode, lval, rval variant.Iface, numeric NumericPolicy) (variant.Iface, error) {
+	if rval.Type() == variant.TypeString && lval.Type() == variant.TypeString {
+		rs, ls := variant.MustCast[*variant.String](rval), variant.MustCast[*variant.String](lval)
+		return variant.NewString(ls.String() + rs.String()), nil
+	}
 
-func (c *BreakStmtCodeGen) CodeGen(node *BreakStmt) (StmtInvoker, error) {
-	return invoker(func() error {
-		return ErrLoopBreak
-	}), nil
-}
+	if rval.Type() == variant.TypeArray && lval.Type() == variant.TypeArray {
+		rs, ls := variant.MustCast[*variant.Array](rval), variant.MustCast[*variant.Array](lval)
+		return ls.Concat(rs), nil
+	}
 
-type ReturnStmtCodeGen struct {
-	exprGen *ExprCodeGen
+	return evalArith(op, lval, rval, numeric)
 }
 
-func (c *ReturnStmtCodeGen) CodeGen(node *ReturnStmt) (StmtInvoker, error) {
-	ret := func(v variant.Iface) error {
-		c.exprGen.vars.SetReturn(v)
-		return ErrStmtFinished
-	}
-	if node.ReturnExpr == nil {
-		return invoker(func() error {
-			return ret(variant.NewNone())
-		}), nil
+func evalEquality(op opcode, lval, rval variant.Iface, _ NumericPolicy) (variant.Iface, error) {
+	if rval.Type() != lval.Type() {
+		return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
 	}
 
-	eval, err := c.exprGen.CodeGen(node.ReturnExpr)
-	if err != nil {
-		return nil, fmt.Errorf("bad return statement: %w", err)
+	eq := variant.DeepEqual(lval, rval)
+	return variant.NewBool(eq == (op == opEq)), nil
+}
+
+func evalOrder(op opcode, lval, rval variant.Iface, _ NumericPolicy) (variant.Iface, error) {
+	if rval.Type() != lval.Type() {
+		return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
 	}
 
-	return invoker(func() error {
-		v, err := eval.Eval()
+	if rval.Type() == variant.TypeString || rval.Type() == variant.TypeArray {
+		cmp, err := variant.Compare(lval, rval)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("op '%s': %w", op, err)
 		}
 
-		return ret(v)
-	}), nil
-}
+		return variant.NewBool(cmpResult(op, cmp)), nil
+	}
+
+	if rval.Type() != variant.TypeNum {
+		return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
+	}
+
+	lnum, rnum := variant.MustCast[*variant.Num](lval), variant.MustCast[*variant.Num](rval)
+
+	var b bool
+	switch op {
+	case opLt:
+		b = lnum.LessThan(rnum)
+	case opLe:
+		b = lnum.LessOrEqualTo(rnum)
+	case opGt:
+		b = lnum.GreaterThan(rnum)
+	case opGe:
+		b = lnum.GreaterOrEqualTo(rnum)
+	default:
+		panic("unreachable")
+	}
+
+	return variant.NewBool(b), nil
+}
+
+func evalArith(op opcode, lval, rval variant.Iface, numeric NumericPolicy) (variant.Iface, error) {
+	if rval.Type() != variant.TypeNum || lval.Type() != variant.TypeNum {
+		return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
+	}
+	rnum, lnum := variant.MustCast[*variant.Num](rval), variant.MustCast[*variant.Num](lval)
+	if lnum.IsNaN() || rnum.IsNaN() {
+		return variant.NaN(), nil
+	}
+
+	if v, ok := evalExact(op, lnum, rnum); ok {
+		return v, nil
+	}
+
+	// invalid reports the invalid operation by the numeric policy
+	invalid := func(msg string) (variant.Iface, error) {
+		if numeric == NumericNaN {
+			return variant.NaN(), nil
+		}
+
+		return nil, errors.New(msg)
+	}
+
+	num := new(big.Float)
+	switch op {
+	case opAdd:
+		if lnum.IsInf() && rnum.IsInf() && lnum.Sign() != rnum.Sign() {
+			return invalid("op '+': addition of inf and inf with opposite signs")
+		}
+		num.Add(lnum.Value(), rnum.Value())
+	case opSub:
+		if lnum.IsInf() && rnum.IsInf() && lnum.Sign() == rnum.Sign() {
+			return invalid("op '-': subtraction of inf from inf with equal signs")
+		}
+		num.Sub(lnum.Value(), rnum.Value())
+	case opDiv:
+		if lnum.IsZero() && rnum.IsZero() {
+			return invalid("op '/': division of zero into zero")
+		}
+		if rnum.IsZero() && numeric == NumericError {
+			return nil, errors.New("op '/': division by zero")
+		}
+		if lnum.IsInf() && rnum.IsInf() {
+			return invalid("op '/': division of inf into inf")
+		}
+		num.Quo(lnum.Value(), rnum.Value())
+	case opMul:
+		if (lnum.IsZero() && rnum.IsInf()) || (lnum.IsInf() && rnum.IsZero()) {
+			return invalid("op '*': one operand is zero and the other operand an infinity")
+		}
+		num.Mul(lnum.Value(), rnum.Value())
+	case opMod:
+		if rnum.Value().IsInf() {
+			return invalid("op '%': modulus with inf")
+		}
+
+		if rnum.IsZero() {
+			return invalid("op '%': modulus with zero")
+		}
+
+		if lnum.Value().IsInt() && rnum.Value().IsInt() {
+			var x, y big.Int
+			lnum.Value().Int(&x)
+			rnum.Value().Int(&y)
+			num.SetInt(x.Mod(&x, &y))
+		} else if div := new(big.Float).Quo(lnum.Value(), rnum.Value()); div.IsInf() {
+			num.Set(div)
+		} else {
+			// div = x / y
+			// x % y = x - int(div) * y
+
+			// 1. int(div)
+			divInt, _ := div.Int(nil)
+			// 2. int(div) * y
+			mul := new(big.Float).Mul(div.SetInt(divInt), rnum.Value())
+			// 3. x - int(div) * y
+			num.Sub(lnum.Value(), mul)
+
+			if lnum.Sign() < 0 {
+				if rnum.Sign() > 0 {
+					num.Add(rnum.Value(), num)
+				} else {
+					num.Add(mul.Neg(rnum.Value()), num)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation 'number %s number'", op)
+	}
+
+	return variant.NewNum(num), nil
+}
+
+func evalPredicate(op opcode, lval, rval variant.Iface, _ NumericPolicy) (variant.Iface, error) {
+	if rval.Type() != variant.TypeBool || lval.Type() != variant.TypeBool {
+		return nil, fmt.Errorf("unsupported operand type for %s: %s and %s", op, lval.Type(), rval.Type())
+	}
+	rb, lb := variant.MustCast[*variant.Bool](rval), variant.MustCast[*variant.Bool](lval)
+	if op == opAnd {
+		return variant.NewBool(lb.Bool() && rb.Bool()), nil
+	}
+
+	return variant.NewBool(lb.Bool() || rb.Bool()), nil
+}
+
+// cmpResult applies the ordering operator to the result of comparison.
+func cmpResult(op opcode, cmp int) bool {
+	switch op {
+	case opLt:
+		return cmp < 0
+	case opLe:
+		return cmp <= 0
+	case opGt:
+		return cmp > 0
+	case opGe:
+		return cmp >= 0
+	}
+
+	panic("unreachable")
+}
+
+// evalExact does the arithmetic on fractions when one of the numbers is
+// exact and both are finite. Division by zero is left to floats.
+func evalExact(op opcode, lnum, rnum *variant.Num) (*variant.Num, bool) {
+	if !lnum.IsExact() && !rnum.IsExact() {
+		return nil, false
+	}
+
+	x, ok := lnum.AsRat()
+	if !ok {
+		return nil, false
+	}
+
+	y, ok := rnum.AsRat()
+	if !ok {
+		return nil, false
+	}
+
+	res := new(big.Rat)
+	switch op {
+	case opAdd:
+		res.Add(x, y)
+	case opSub:
+		res.Sub(x, y)
+	case opMul:
+		res.Mul(x, y)
+	case opDiv:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+		res.Quo(x, y)
+	case opMod:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+
+		// x - |y| * floor(x / |y|), the sign follows floats
+		abs := new(big.Rat).Abs(y)
+		div := new(big.Rat).Quo(x, abs)
+		floor := new(big.Int).Div(div.Num(), div.Denom())
+		res.Sub(x, abs.Mul(abs, new(big.Rat).SetInt(floor)))
+	default:
+		return nil, false
+	}
+
+	return variant.NewRat(res), true
+}
+
+func lenAfter(s string, pos int) int {
+	return max(0, len(s)-(pos+1))
+}
+
+type ContinueStmtCodeGen struct{}
+
+func (c *ContinueStmtCodeGen) CodeGen(node *ContinueStmt) (StmtInvoker, error) {
+	return invoker(func() error {
+		return ErrLoopContinue
+	}), nil
+}
+
+type BreakStmtCodeGen struct{}
+
+func (c *BreakStmtCodeGen) CodeGen(node *BreakStmt) (StmtInvoker, error) {
+	return invoker(func() error {
+		return ErrLoopBreak
+	}), nil
+}
+
+type ReturnStmtCodeGen struct {
+	exprGen *ExprCodeGen
+}
+
+func (c *ReturnStmtCodeGen) CodeGen(node *ReturnStmt) (StmtInvoker, error) {
+	ret := func(v variant.Iface) error {
+		c.exprGen.vars.SetReturn(v)
+		return ErrStmtFinished
+	}
+	if node.ReturnExpr == nil {
+		return invoker(func() error {
+			return ret(variant.NewNone())
+		}), nil
+	}
+
+	eval, err := c.exprGen.CodeGen(node.ReturnExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoker(func() error {
+		v, err := eval.Eval()
+		if err != nil {
+			return err
+		}
+
+		return ret(v)
+	}), nil
+}
 
 type ExprStmtCodeGen struct {
 	isGlobalScope bool
@@ -1141,10 +1889,14 @@ type ExprStmtCodeGen struct {
 }
 
 func (c *ExprStmtCodeGen) CodeGen(node *ExprStmt) (StmtInvoker, error) {
+	if node.AssignX == nil && node.IsLet != nil {
+		return nil, compileErrorf(node.Pos, "let declaration must assign the value")
+	}
+
 	if node.AssignX == nil {
 		leval, err := c.exprGen.CodeGen(&node.X)
 		if err != nil {
-			return nil, fmt.Errorf("invalid lhs operand: %w", err)
+			return nil, err
 		}
 
 		return invoker(func() error {
@@ -1158,22 +1910,34 @@ func (c *ExprStmtCodeGen) CodeGen(node *ExprStmt) (StmtInvoker, error) {
 	}
 
 	if node.X.BinaryExpr != nil {
-		return nil, errors.New("lhs must be addressable")
+		return nil, compileErrorf(node.X.Pos, "lhs must be addressable")
 	}
 
 	unary := node.X.UnaryExpr
 	if unary.UnaryOp != nil {
-		return nil, fmt.Errorf("lhs must be addressable (unary operator %s disallowed)", *unary.UnaryOp)
+		return nil, compileErrorf(unary.Pos, "lhs must be addressable (unary operator %s disallowed)", *unary.UnaryOp)
+	}
+
+	if unary.Operand.PX != nil {
+		if node.IsPub != nil || node.IsLet != nil {
+			return nil, compileErrorf(node.Pos, "cannot declare element of array or object")
+		}
+
+		return c.assignElem(node)
 	}
 
 	if unary.Operand.Name == nil {
-		return nil, fmt.Errorf("lhs must be addressable")
+		return nil, compileErrorf(unary.Pos, "lhs must be addressable")
 	}
 
 	name := unary.Operand.Name.Name
 	reval, err := c.exprGen.CodeGen(node.AssignX)
 	if err != nil {
-		return nil, fmt.Errorf("invalid rhs operand: %w", err)
+		return nil, err
+	}
+
+	if err := c.checkShadow(node, name); err != nil {
+		return nil, err
 	}
 
 	var (
@@ -1182,27 +1946,40 @@ func (c *ExprStmtCodeGen) CodeGen(node *ExprStmt) (StmtInvoker, error) {
 	)
 	if node.IsPub != nil {
 		if !c.isGlobalScope {
-			return nil, errors.New("cannot publish variable in non-global scope")
+			return nil, compileErrorf(node.Pos, "cannot publish variable in non-global scope")
 		}
 
 		if node.AugmentedOp != nil {
-			return nil, errors.New("cannot use augmented operator with pub keyword")
+			return nil, compileErrorf(node.Pos, "cannot use augmented operator with pub keyword")
 		}
 
 		scope, reg, err = c.exprGen.vars.RegisterPub(name)
 		if err != nil {
-			return nil, err
+			return nil, compileError(node.Pos, err)
+		}
+	} else if node.IsLet != nil {
+		if node.AugmentedOp != nil {
+			return nil, compileErrorf(node.Pos, "cannot use augmented operator with let keyword")
 		}
+
+		scope, reg = c.exprGen.vars.Declare(name)
 	} else {
 		if _, _, ok := c.exprGen.vars.LookupRegister(name); !ok {
 			if node.AugmentedOp != nil {
-				return nil, fmt.Errorf("name '%s' is not defined", name)
+				return nil, compileErrorf(unary.Operand.Name.Pos, "name '%s' is not defined", name)
 			}
 		}
 
 		scope, reg = c.exprGen.vars.Register(name)
 	}
 
+	var augOp opcode
+	if node.AugmentedOp != nil {
+		if augOp, err = opcodeOf(*node.AugmentedOp); err != nil {
+			return nil, compileError(node.Pos, err)
+		}
+	}
+
 	return invoker(func() error {
 		v, err := reval.Eval()
 		if err != nil {
@@ -1215,7 +1992,7 @@ func (c *ExprStmtCodeGen) CodeGen(node *ExprStmt) (StmtInvoker, error) {
 				panic("unreachable")
 			}
 
-			v, err = evalBinary(*node.AugmentedOp, lval, v)
+			v, err = evalBinary(augOp, lval, v, c.exprGen.numeric)
 			if err != nil {
 				return err
 			}
@@ -1226,6 +2003,216 @@ func (c *ExprStmtCodeGen) CodeGen(node *ExprStmt) (StmtInvoker, error) {
 	}), nil
 }
 
+// checkShadow reports the assignment hiding the builtin or the package bound
+// by using for the rest of the program. It is the error in strict mode.
+func (c *ExprStmtCodeGen) checkShadow(node *ExprStmt, name string) error {
+	scope, ok := c.exprGen.vars.Lookup(name)
+	var msg string
+	if pkg := scope.r.using[name]; ok && pkg != "" {
+		msg = fmt.Sprintf("assignment to '%s' shadows package '%s'", name, pkg)
+	} else if builtins := c.exprGen.imports.Builtins; ok && scope == c.exprGen.vars.Global && builtins != nil {
+		if _, ok := builtins.Objects()[name]; ok {
+			msg = fmt.Sprintf("assignment to '%s' shadows the builtin", name)
+		}
+	}
+
+	if msg == "" {
+		return nil
+	}
+
+	if c.exprGen.strict {
+		return compileError(node.Pos, errors.New(msg))
+	}
+
+	c.exprGen.warn.warnf(node.Pos, "%s", msg)
+	return nil
+}
+
+// assignElem compiles the assignment to the element of the array, object or
+// host variant, e.g. a.b[i] = v or a.b[i] += v.
+func (c *ExprStmtCodeGen) assignElem(node *ExprStmt) (StmtInvoker, error) {
+	container, last := splitTarget(node.X.UnaryExpr.Operand)
+	containerEval, err := c.exprGen.CodeGen(&Expr{UnaryExpr: UnaryExpr{Operand: container}})
+	if err != nil {
+		return nil, err
+	}
+
+	var keyEval ExprEvaler
+	switch {
+	case last.Sel != nil && last.Sel.Ident != nil:
+		keyEval = constant(variant.NewString(last.Sel.Ident.Name))
+	case last.Sel != nil:
+		keyEval, err = (&BasicLitCodeGen{}).CodeGen(&BasicLit{Node: last.Sel.Node, String: last.Sel.String})
+	case last.Index != nil:
+		keyEval, err = c.exprGen.CodeGen(last.Index)
+	default:
+		return nil, compileErrorf(node.X.Pos, "lhs must be addressable (cannot assign to result of call)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reval, err := c.exprGen.CodeGen(node.AssignX)
+	if err != nil {
+		return nil, err
+	}
+
+	var augOp opcode
+	if node.AugmentedOp != nil {
+		if augOp, err = opcodeOf(*node.AugmentedOp); err != nil {
+			return nil, compileError(node.Pos, err)
+		}
+	}
+
+	return invoker(func() error {
+		v, err := reval.Eval()
+		if err != nil {
+			return err
+		}
+
+		container, err := containerEval.Eval()
+		if err != nil {
+			return err
+		}
+
+		key, err := keyEval.Eval()
+		if err != nil {
+			return fmt.Errorf("cannot evaluate index: %w", err)
+		}
+
+		if node.AugmentedOp != nil {
+			lval, err := elemOf(container, key)
+			if err != nil {
+				return err
+			}
+
+			v, err = evalBinary(augOp, lval, v, c.exprGen.numeric)
+			if err != nil {
+				return err
+			}
+		}
+
+		return setElem(container, key, v)
+	}), nil
+}
+
+// targetKey is the last selector or index of the assignment target.
+type targetKey struct {
+	Sel   *SelectorExprPiece
+	Index *Expr
+}
+
+// splitTarget splits the assignment target into the container and the key
+// of the element, e.g. a.b[i] into a.b and i. The AST is not modified.
+func splitTarget(operand Operand) (Operand, targetKey) {
+	link := &operand.PX
+	for {
+		px := **link
+		var next **PrimaryExpr
+		switch {
+		case px.SelectorExpr != nil:
+			sel := *px.SelectorExpr
+			px.SelectorExpr, next = &sel, &sel.PX
+		case px.IndexExpr != nil:
+			idx := *px.IndexExpr
+			px.IndexExpr, next = &idx, &idx.PX
+		case px.CallExpr != nil:
+			call := *px.CallExpr
+			px.CallExpr, next = &call, &call.PX
+		}
+		*link = &px
+
+		if *next != nil {
+			link = next
+			continue
+		}
+
+		var key targetKey
+		switch {
+		case px.SelectorExpr != nil:
+			sels := px.SelectorExpr.Sel
+			key.Sel = &sels[len(sels)-1]
+			if len(sels) > 1 {
+				px.SelectorExpr.Sel = sels[:len(sels)-1]
+				return operand, key
+			}
+		case px.IndexExpr != nil && px.IndexExpr.Index != nil:
+			// obj[a, b] indexes nested objects like obj[a][b]
+			idxs := px.IndexExpr.Index.X
+			key.Index = idxs[len(idxs)-1]
+			if len(idxs) > 1 {
+				px.IndexExpr.Index = &List[Expr]{X: idxs[:len(idxs)-1]}
+				return operand, key
+			}
+		default:
+			return operand, key
+		}
+
+		*link = nil
+		return operand, key
+	}
+}
+
+// elemOf returns the element of the array, object or host variant by key.
+func elemOf(container, key variant.Iface) (variant.Iface, error) {
+	switch v := container.(type) {
+	case *variant.Array:
+		idx, err := arrayIndex(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return v.Get(idx)
+	case *variant.Object:
+		elem, err := v.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get value by %s: %w", key, err)
+		}
+
+		return elem, nil
+	case variant.Indexer:
+		return v.Index(key)
+	}
+
+	return nil, fmt.Errorf("unsupported indexator for %s", container.Type())
+}
+
+// setElem replaces the element of the array, object or host variant by key.
+func setElem(container, key, elem variant.Iface) error {
+	switch v := container.(type) {
+	case *variant.Array:
+		idx, err := arrayIndex(key)
+		if err != nil {
+			return err
+		}
+
+		if err := v.Set(idx, elem); err != nil {
+			return fmt.Errorf("cannot set array element: %w", err)
+		}
+
+		return nil
+	case *variant.Object:
+		return v.Set(key, elem)
+	case variant.IndexSetter:
+		return v.SetIndex(key, elem)
+	}
+
+	return fmt.Errorf("%s doesn't support element assignment", container.Type())
+}
+
+func arrayIndex(key variant.Iface) (int64, error) {
+	if key.Type() != variant.TypeNum {
+		return 0, fmt.Errorf("index must be number, got %s", key.Type())
+	}
+
+	idx, err := variant.MustCast[*variant.Num](key).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("cannot to represent number as integer: %w", err)
+	}
+
+	return idx, nil
+}
+
 type StmtCodeGen struct {
 	isLoopScope   bool
 	isGlobalScope bool
@@ -1240,27 +2227,39 @@ func (c StmtCodeGen) CodeGen(node *Stmt) (invoker StmtInvoker, err error) {
 			isLoopScope: c.isLoopScope,
 		}).CodeGen(node.If)
 	case node.For != nil:
-		invoker, err = (&ForStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.For)
+		invoker, err = (&ForStmtCodeGen{
+			exprGen:     c.exprGen,
+			isLoopScope: c.isLoopScope,
+		}).CodeGen(node.For)
 	case node.While != nil:
-		invoker, err = (&WhileStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.While)
+		invoker, err = (&WhileStmtCodeGen{
+			exprGen:     c.exprGen,
+			isLoopScope: c.isLoopScope,
+		}).CodeGen(node.While)
+	case node.DoWhile != nil:
+		invoker, err = (&DoWhileStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.DoWhile)
+	case node.Loop != nil:
+		invoker, err = (&LoopStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.Loop)
 	case node.Return != nil:
 		if c.isGlobalScope {
-			return nil, errors.New("return statement cannot be used in global scope")
+			return nil, compileErrorf(node.Pos, "return statement cannot be used in global scope")
 		}
 
 		invoker, err = (&ReturnStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.Return)
 	case node.Continue != nil:
 		if !c.isLoopScope {
-			return nil, errors.New("continue statement cannot be used outside of a loop")
+			return nil, compileErrorf(node.Pos, "continue statement cannot be used outside of a loop")
 		}
 
 		invoker, err = (&ContinueStmtCodeGen{}).CodeGen(node.Continue)
 	case node.Break != nil:
 		if !c.isLoopScope {
-			return nil, errors.New("break statement cannot be used outside of a loop")
+			return nil, compileErrorf(node.Pos, "break statement cannot be used outside of a loop")
 		}
 
 		invoker, err = (&BreakStmtCodeGen{}).CodeGen(node.Break)
+	case node.Yield != nil:
+		invoker, err = (&YieldStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.Yield)
 	case node.Using != nil:
 		invoker, err = (&UsingStmtCodeGen{exprGen: c.exprGen}).CodeGen(node.Using)
 	case node.Expr != nil:
@@ -1269,7 +2268,11 @@ func (c StmtCodeGen) CodeGen(node *Stmt) (invoker StmtInvoker, err error) {
 			exprGen:       c.exprGen,
 		}).CodeGen(node.Expr)
 	default:
-		return nil, fmt.Errorf("statement not defined (expected if, for, while, assignment, return or expr statement)")
+		return nil, compileErrorf(node.Pos, "statement not defined (expected if, for, while, do while, loop, assignment, return, yield or expr statement)")
+	}
+
+	if err != nil {
+		return nil, compileError(node.Pos, err)
 	}
 
 	return
@@ -1287,9 +2290,14 @@ func (c *BlockStmtCodeGen) CodeGen(node *BlockStmt) (StmtInvoker, error) {
 	}
 
 	invokers := make([]StmtInvoker, 0, len(list))
+	stmts := make([]*Stmt, 0, len(list))
+	var (
+		terminated  bool
+		unreachable *Stmt
+	)
 	for _, stmt := range list {
 		if stmt == nil {
-			return nil, errors.New("bad block statement")
+			return nil, compileErrorf(node.Pos, "bad block statement")
 		}
 
 		invoker, err := (&StmtCodeGen{
@@ -1297,16 +2305,34 @@ func (c *BlockStmtCodeGen) CodeGen(node *BlockStmt) (StmtInvoker, error) {
 			isLoopScope: c.isLoopScope,
 		}).CodeGen(stmt)
 		if err != nil {
-			return nil, fmt.Errorf("bad statement: %w", err)
+			return nil, err
+		}
+
+		if terminated {
+			if unreachable == nil {
+				unreachable = stmt
+			}
+
+			continue
+		}
+
+		if isNop(invoker) {
+			continue
 		}
 
 		invokers = append(invokers, invoker)
+		stmts = append(stmts, stmt)
+		terminated = isTerminating(stmt)
+	}
+
+	if unreachable != nil {
+		c.exprGen.warn.warnf(unreachable.Pos, "unreachable code")
 	}
 
 	return invoker(func() error {
-		for _, invoker := range invokers {
+		for i, invoker := range invokers {
 			if err := invoker.Invoke(); err != nil {
-				return err
+				return errorAt(stmts[i].Pos, err)
 			}
 		}
 
@@ -1314,30 +2340,112 @@ func (c *BlockStmtCodeGen) CodeGen(node *BlockStmt) (StmtInvoker, error) {
 	}), nil
 }
 
+// scoped runs the body with the fresh frame of its own scope. Blocks of the
+// top level code keep the single frame like global variables.
+func scoped(vars *Vars, body StmtInvoker) StmtInvoker {
+	if isNop(body) || len(vars.Locals) == 1 {
+		return body
+	}
+
+	scope := vars.LastScope()
+	return invoker(func() error {
+		defer scope.leave(scope.enter())
+		return body.Invoke()
+	})
+}
+
+// loopElseCodeGen compiles the else block of the loop, which runs when the
+// loop finishes without break. isLoopScope is of the statement containing
+// the loop, so break and continue in the else block refer to the outer loop.
+func loopElseCodeGen(exprGen *ExprCodeGen, isLoopScope bool, node *BlockStmt) (StmtInvoker, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	vars := exprGen.vars.WithScope()
+	blkInvoker, err := (&BlockStmtCodeGen{
+		exprGen:     exprGen.withVars(vars),
+		isLoopScope: isLoopScope,
+	}).CodeGen(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return scoped(vars, blkInvoker), nil
+}
+
+// withLoopElse makes the loop run the else block unless its body breaks.
+// run runs the loop with the given body.
+func withLoopElse(run func(body StmtInvoker) error, body, elseBlk StmtInvoker) StmtInvoker {
+	if elseBlk == nil {
+		return invoker(func() error {
+			return run(body)
+		})
+	}
+
+	return invoker(func() error {
+		broken := false
+		err := run(invoker(func() error {
+			err := body.Invoke()
+			if errors.Is(err, ErrLoopBreak) {
+				broken = true
+			}
+
+			return err
+		}))
+		if err != nil || broken {
+			return err
+		}
+
+		return elseBlk.Invoke()
+	})
+}
+
 type WhileStmtCodeGen struct {
-	exprGen *ExprCodeGen
+	exprGen     *ExprCodeGen
+	isLoopScope bool
 }
 
 func (c *WhileStmtCodeGen) CodeGen(node *WhileStmt) (StmtInvoker, error) {
 	condEval, err := c.exprGen.CodeGen(&node.Cond)
 	if err != nil {
-		return nil, fmt.Errorf("invalid while condition expression: %w", err)
+		return nil, err
 	}
 
+	// like for loops, every iteration has its own frame
 	vars := c.exprGen.vars.WithScope()
+	scope := vars.LastScope()
 	blkInvoker, err := (&BlockStmtCodeGen{
-		exprGen: &ExprCodeGen{
-			vars:     vars,
-			register: c.exprGen.register,
-			imports:  c.exprGen.imports,
-		},
+		exprGen:     c.exprGen.withVars(vars),
 		isLoopScope: true,
 	}).CodeGen(&node.Block)
 	if err != nil {
-		return nil, fmt.Errorf("invalid while block statement: %w", err)
+		return nil, err
 	}
+	blkInvoker = c.exprGen.interruptible(blkInvoker)
 
-	return invoker(func() error {
+	elseInvoker, err := loopElseCodeGen(c.exprGen, c.isLoopScope, node.ElseBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond, ok := constValue(condEval); ok {
+		if cond.Type() != variant.TypeBool {
+			return nil, compileErrorf(node.Cond.Pos, "condition expression must be bool")
+		}
+
+		if !variant.MustCast[*variant.Bool](cond).Bool() {
+			c.exprGen.warn.warnf(node.Block.Pos, "unreachable code: condition is always false")
+			if elseInvoker != nil {
+				return elseInvoker, nil
+			}
+
+			return nopInvoker{}, nil
+		}
+	}
+
+	return withLoopElse(func(blkInvoker StmtInvoker) error {
+		defer scope.leave(scope.frame)
 		for {
 			cond, err := condEval.Eval()
 			if err != nil {
@@ -1345,7 +2453,7 @@ func (c *WhileStmtCodeGen) CodeGen(node *WhileStmt) (StmtInvoker, error) {
 			}
 
 			if cond.Type() != variant.TypeBool {
-				return errors.New("condition expression must be bool")
+				return errorAt(node.Cond.Pos, errors.New("condition expression must be bool"))
 			}
 
 			b := variant.MustCast[*variant.Bool](cond)
@@ -1353,6 +2461,7 @@ func (c *WhileStmtCodeGen) CodeGen(node *WhileStmt) (StmtInvoker, error) {
 				return nil
 			}
 
+			scope.renew()
 			err = blkInvoker.Invoke()
 			if errors.Is(err, ErrLoopBreak) {
 				break
@@ -1367,13 +2476,105 @@ func (c *WhileStmtCodeGen) CodeGen(node *WhileStmt) (StmtInvoker, error) {
 			}
 		}
 		return nil
+	}, blkInvoker, elseInvoker), nil
+}
+
+type LoopStmtCodeGen struct {
+	exprGen *ExprCodeGen
+}
+
+// CodeGen compiles the infinite loop, which ends only by break, return or
+// error.
+func (c *LoopStmtCodeGen) CodeGen(node *LoopStmt) (StmtInvoker, error) {
+	vars := c.exprGen.vars.WithScope()
+	scope := vars.LastScope()
+	blkInvoker, err := (&BlockStmtCodeGen{
+		exprGen:     c.exprGen.withVars(vars),
+		isLoopScope: true,
+	}).CodeGen(&node.Block)
+	if err != nil {
+		return nil, err
+	}
+	blkInvoker = c.exprGen.interruptible(blkInvoker)
+
+	return invoker(func() error {
+		defer scope.leave(scope.frame)
+		for {
+			scope.renew()
+			err := blkInvoker.Invoke()
+			if errors.Is(err, ErrLoopBreak) {
+				return nil
+			}
+
+			if err != nil && !errors.Is(err, ErrLoopContinue) {
+				return err
+			}
+		}
 	}), nil
 }
 
-type ForStmtCodeGen struct {
+type DoWhileStmtCodeGen struct {
 	exprGen *ExprCodeGen
 }
 
+// CodeGen compiles the loop checking the condition after the body, so the
+// body runs at least once. The condition doesn't see variables of the body.
+func (c *DoWhileStmtCodeGen) CodeGen(node *DoWhileStmt) (StmtInvoker, error) {
+	condEval, err := c.exprGen.CodeGen(&node.Cond)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := c.exprGen.vars.WithScope()
+	scope := vars.LastScope()
+	blkInvoker, err := (&BlockStmtCodeGen{
+		exprGen:     c.exprGen.withVars(vars),
+		isLoopScope: true,
+	}).CodeGen(&node.Block)
+	if err != nil {
+		return nil, err
+	}
+	blkInvoker = c.exprGen.interruptible(blkInvoker)
+
+	if cond, ok := constValue(condEval); ok && cond.Type() != variant.TypeBool {
+		return nil, compileErrorf(node.Cond.Pos, "condition expression must be bool")
+	}
+
+	return invoker(func() error {
+		defer scope.leave(scope.frame)
+		for {
+			scope.renew()
+			err := blkInvoker.Invoke()
+			if errors.Is(err, ErrLoopBreak) {
+				break
+			}
+
+			if err != nil && !errors.Is(err, ErrLoopContinue) {
+				return err
+			}
+
+			cond, err := condEval.Eval()
+			if err != nil {
+				return err
+			}
+
+			if cond.Type() != variant.TypeBool {
+				return errorAt(node.Cond.Pos, errors.New("condition expression must be bool"))
+			}
+
+			if !variant.MustCast[*variant.Bool](cond).Bool() {
+				break
+			}
+		}
+		return nil
+	}), nil
+}
+
+type ForStmtCodeGen struct {
+	exprGen     *ExprCodeGen
+	isLoopScope bool
+}
+
 func (c *ForStmtCodeGen) CodeGen(node *ForStmt) (StmtInvoker, error) {
 	varnames := node.IdentList
 	if varnames == nil {
@@ -1381,37 +2582,44 @@ func (c *ForStmtCodeGen) CodeGen(node *ForStmt) (StmtInvoker, error) {
 	}
 
 	if len(varnames.X) > 2 {
-		return nil, errors.New("bad for statement: expected 0, 1 or 2 variables")
+		return nil, compileErrorf(node.Pos, "bad for statement: expected 0, 1 or 2 variables")
 	}
 
 	overEval, err := c.exprGen.CodeGen(&node.OverX)
 	if err != nil {
-		return nil, fmt.Errorf("bad for statement: invalid collection expression")
+		return nil, err
 	}
 
-	iterArr := func(i int, el variant.Iface) {}
-	iterObj := func(k variant.Iface, el variant.Iface) {}
-
+	// every iteration has its own frame, so functions created by the body
+	// see variables of their iteration
 	blkVars := c.exprGen.vars.WithScope()
 	scope := blkVars.LastScope()
+
+	iterArr := func(i int, el variant.Iface) { scope.renew() }
+	iterObj := func(k variant.Iface, el variant.Iface) { scope.renew() }
+
 	switch len(varnames.X) {
 	case 0:
 	case 1:
 		r1 := scope.Register(varnames.X[0].Name)
 		iterArr = func(_ int, el variant.Iface) {
+			scope.renew()
 			scope.DefineVar(r1, el)
 		}
 		iterObj = func(k variant.Iface, _ variant.Iface) {
+			scope.renew()
 			scope.DefineVar(r1, k)
 		}
 	case 2:
 		r1 := scope.Register(varnames.X[0].Name)
 		r2 := scope.Register(varnames.X[1].Name)
 		iterArr = func(i int, el variant.Iface) {
+			scope.renew()
 			scope.DefineVar(r1, variant.Int(i))
 			scope.DefineVar(r2, el)
 		}
 		iterObj = func(k variant.Iface, el variant.Iface) {
+			scope.renew()
 			scope.DefineVar(r1, k)
 			scope.DefineVar(r2, el)
 		}
@@ -1420,23 +2628,27 @@ func (c *ForStmtCodeGen) CodeGen(node *ForStmt) (StmtInvoker, error) {
 	}
 
 	blkInvoker, err := (&BlockStmtCodeGen{
-		exprGen: &ExprCodeGen{
-			vars:     blkVars,
-			register: c.exprGen.register,
-			imports:  c.exprGen.imports,
-		},
+		exprGen:     c.exprGen.withVars(blkVars),
 		isLoopScope: true,
 	}).CodeGen(&node.Block)
 	if err != nil {
-		return nil, fmt.Errorf("bad for statement: invalid block statement: %w", err)
+		return nil, err
 	}
+	blkInvoker = c.exprGen.interruptible(blkInvoker)
 
-	return invoker(func() error {
+	elseInvoker, err := loopElseCodeGen(c.exprGen, c.isLoopScope, node.ElseBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return withLoopElse(func(blkInvoker StmtInvoker) error {
 		v, err := overEval.Eval()
 		if err != nil {
 			return err
 		}
 
+		defer scope.leave(scope.frame)
+
 		switch v.Type() {
 		case variant.TypeArray:
 			arr := variant.MustCast[*variant.Array](v)
@@ -1480,7 +2692,58 @@ func (c *ForStmtCodeGen) CodeGen(node *ForStmt) (StmtInvoker, error) {
 				panic("unreachable")
 			}
 
+		case variant.TypeString:
+			i := 0
+			for _, ch := range v.String() {
+				iterArr(i, variant.NewString(string(ch)))
+				i++
+
+				err := blkInvoker.Invoke()
+				if errors.Is(err, ErrLoopBreak) {
+					break
+				}
+
+				if errors.Is(err, ErrLoopContinue) {
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+			}
 		case variant.TypeObject:
+			if next, ok := iter.AsIterator(v); ok {
+				for i := 0; ; i++ {
+					el, err := next.Call(nil)
+					if errors.Is(err, iter.ErrStopIteration) {
+						break
+					}
+
+					if err != nil {
+						return err
+					}
+
+					iterArr(i, el)
+					err = blkInvoker.Invoke()
+					// the iterator left early is closed, so the
+					// generator does not wait for next forever
+					if errors.Is(err, ErrLoopBreak) {
+						return iter.Close(v)
+					}
+
+					if errors.Is(err, ErrLoopContinue) {
+						continue
+					}
+
+					if err != nil {
+						iter.Close(v)
+						return err
+					}
+				}
+
+				return nil
+			}
+
 			obj := variant.MustCast[*variant.Object](v)
 			if obj.Len() == 0 {
 				return nil
@@ -1503,11 +2766,40 @@ func (c *ForStmtCodeGen) CodeGen(node *ForStmt) (StmtInvoker, error) {
 				return
 			})
 		default:
-			return fmt.Errorf("%s not iterable (expected array or object)", v.Type())
+			iterable, ok := v.(variant.Iterable)
+			if !ok {
+				return errorAt(node.OverX.Pos, fmt.Errorf("%s not iterable (expected array, object or string)", v.Type()))
+			}
+
+			it := iterable.Iter()
+			for i := 0; ; i++ {
+				el, ok, err := it.Next()
+				if err != nil {
+					return err
+				}
+
+				if !ok {
+					break
+				}
+
+				iterArr(i, el)
+				err = blkInvoker.Invoke()
+				if errors.Is(err, ErrLoopBreak) {
+					break
+				}
+
+				if errors.Is(err, ErrLoopContinue) {
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		return nil
-	}), nil
+	}, blkInvoker, elseInvoker), nil
 }
 
 type IfStmtCodeGen struct {
@@ -1518,45 +2810,69 @@ type IfStmtCodeGen struct {
 func (c *IfStmtCodeGen) CodeGen(node *IfStmt) (StmtInvoker, error) {
 	condEval, err := c.exprGen.CodeGen(&node.Cond)
 	if err != nil {
-		return nil, fmt.Errorf("bad if statement: invalid condition expression: %w", err)
+		return nil, err
 	}
 
+	blkVars := c.exprGen.vars.WithScope()
 	blkInvoker, err := (&BlockStmtCodeGen{
-		exprGen: &ExprCodeGen{
-			vars:     c.exprGen.vars.WithScope(),
-			register: c.exprGen.register,
-			imports:  c.exprGen.imports,
-		},
+		exprGen:     c.exprGen.withVars(blkVars),
 		isLoopScope: c.isLoopScope,
 	}).CodeGen(&node.Block)
 	if err != nil {
-		return nil, fmt.Errorf("bad if statement: invalid block statement: %w", err)
+		return nil, err
 	}
 
+	blkInvoker = scoped(blkVars, blkInvoker)
+
 	var elseBlkInvoker, nextIfInvoker StmtInvoker
 	switch {
 	case node.ElseBlock != nil:
+		elseVars := c.exprGen.vars.WithScope()
 		elseBlkInvoker, err = (&BlockStmtCodeGen{
-			exprGen: &ExprCodeGen{
-				vars:     c.exprGen.vars.WithScope(),
-				register: c.exprGen.register,
-				imports:  c.exprGen.imports,
-			},
+			exprGen:     c.exprGen.withVars(elseVars),
 			isLoopScope: c.isLoopScope,
 		}).CodeGen(node.ElseBlock)
 		if err != nil {
-			return nil, fmt.Errorf("bad if statement: invalid else block statement: %w", err)
+			return nil, err
 		}
+		elseBlkInvoker = scoped(elseVars, elseBlkInvoker)
 	case node.ElseIf != nil:
 		nextIfInvoker, err = (&IfStmtCodeGen{
 			exprGen:     c.exprGen,
 			isLoopScope: c.isLoopScope,
 		}).CodeGen(node.ElseIf)
 		if err != nil {
-			return nil, fmt.Errorf("bad if statement: invalid else if block statement: %w", err)
+			return nil, err
 		}
 	}
 
+	if cond, ok := constValue(condEval); ok {
+		if cond.Type() != variant.TypeBool {
+			return nil, compileErrorf(node.Cond.Pos, "bad if statement: condition expression must be bool")
+		}
+
+		if variant.MustCast[*variant.Bool](cond).Bool() {
+			switch {
+			case node.ElseBlock != nil:
+				c.exprGen.warn.warnf(node.ElseBlock.Pos, "unreachable code: condition is always true")
+			case node.ElseIf != nil:
+				c.exprGen.warn.warnf(node.ElseIf.Pos, "unreachable code: condition is always true")
+			}
+
+			return blkInvoker, nil
+		}
+
+		c.exprGen.warn.warnf(node.Block.Pos, "unreachable code: condition is always false")
+		switch {
+		case elseBlkInvoker != nil:
+			return elseBlkInvoker, nil
+		case nextIfInvoker != nil:
+			return nextIfInvoker, nil
+		}
+
+		return nopInvoker{}, nil
+	}
+
 	return invoker(func() error {
 		cond, err := condEval.Eval()
 		if err != nil {
@@ -1564,7 +2880,7 @@ func (c *IfStmtCodeGen) CodeGen(node *IfStmt) (StmtInvoker, error) {
 		}
 
 		if cond.Type() != variant.TypeBool {
-			return errors.New("condition expression must be bool")
+			return errorAt(node.Cond.Pos, errors.New("condition expression must be bool"))
 		}
 
 		b := variant.MustCast[*variant.Bool](cond)
@@ -1589,26 +2905,179 @@ type UsingStmtCodeGen struct {
 }
 
 func (c *UsingStmtCodeGen) CodeGen(node *UsingStmt) (StmtInvoker, error) {
-	pkgname := node.Name.Name
-	alias := pkgname
-	if node.Alias != nil {
-		alias = node.Alias.Name
+	var invokers []StmtInvoker
+	for _, spec := range node.List {
+		invoker, err := c.codeGenSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isNop(invoker) {
+			invokers = append(invokers, invoker)
+		}
+	}
+
+	switch len(invokers) {
+	case 0:
+		return nopInvoker{}, nil
+	case 1:
+		return invokers[0], nil
+	}
+
+	return invoker(func() error {
+		for _, invoker := range invokers {
+			if err := invoker.Invoke(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}), nil
+}
+
+func (c *UsingStmtCodeGen) codeGenSpec(spec *UsingSpec) (StmtInvoker, error) {
+	pkgname := spec.Package()
+	alias := spec.Binding()
+
+	if err := c.exprGen.register.Init(pkgname); err != nil {
+		return nil, compileErrorf(spec.Pos, "package '%s': %w", pkgname, err)
 	}
 
 	pkg, ok := c.exprGen.register.Get(pkgname)
 	if !ok {
-		return nil, fmt.Errorf("package '%s' not found", pkgname)
+		return nil, compileError(spec.Pos, unknownPackageError(pkgname, c.exprGen.register.Names()))
+	}
+
+	// binding the same package again is allowed, e.g. by the next program
+	// compiled by the machine
+	if scope, ok := c.exprGen.vars.Lookup(alias); ok && scope.r.using[alias] != pkgname {
+		return nil, compileErrorf(spec.Pos, "cannot use package '%s' as '%s': variable '%s' already defined", pkgname, alias, alias)
 	}
+	c.exprGen.refs.addPackage(pkgname)
 
 	scope, reg := c.exprGen.vars.Register(alias)
-	scope.DefineVar(reg, variant.FromMap(pkg.Objects()))
-	return invoker(func() error { return nil }), nil
+	scope.r.using[alias] = pkgname
+	obj := variant.FromMap(pkg.Objects())
+	scope.DefineVar(reg, obj)
+	if scope == c.exprGen.vars.Global {
+		return nopInvoker{}, nil
+	}
+
+	// local scopes get fresh frames when run
+	return invoker(func() error {
+		scope.DefineVar(reg, obj)
+		return nil
+	}), nil
+}
+
+// unknownPackageError lists available packages and suggests the closest
+// names.
+func unknownPackageError(name string, available []string) error {
+	var similar []string
+	best := max(2, len(name)/3)
+	for _, pkg := range available {
+		switch d := editDistance(name, pkg); {
+		case d < best:
+			best, similar = d, []string{pkg}
+		case d == best:
+			similar = append(similar, pkg)
+		}
+	}
+
+	msg := fmt.Sprintf("package '%s' not found", name)
+	if len(similar) > 0 {
+		msg += fmt.Sprintf(", did you mean '%s'?", strings.Join(similar, "', '"))
+	}
+
+	return fmt.Errorf("%s (available: %s)", msg, strings.Join(available, ", "))
+}
+
+// editDistance returns the distance of strings by insertions, deletions,
+// substitutions and transpositions of adjacent characters.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2, prev, row := make([]int, len(rb)+1), make([]int, len(rb)+1), make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		prev2, prev, row = prev, row, prev2
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+		}
+	}
+
+	return row[len(rb)]
 }
 
 type Program struct {
-	vars     *Vars
-	register *registry.Registry
-	imports  importsInfo
+	vars      *Vars
+	register  *registry.Registry
+	imports   importsInfo
+	warn      WarnHandler
+	calls     *callSite
+	depth     *callDepth
+	interrupt *variant.Interrupt
+	loop      *eventLoop
+	gens      *coroutines
+	exact     bool
+	numeric   NumericPolicy
+	strict    bool
+	refs      *references
+	// value receives the value of the last statement when it is an
+	// expression, see Machine.Run.
+	value *variant.Iface
+}
+
+// codeGenStmt compiles the top level statement returning panics of the code
+// generator as *variant.PanicError.
+func (c *Program) codeGenStmt(stmt *Stmt, last bool) (_ StmtInvoker, err error) {
+	defer variant.Recover(&err)
+	exprGen := &ExprCodeGen{
+		vars:      c.vars,
+		register:  c.register,
+		imports:   c.imports,
+		warn:      c.warn,
+		calls:     c.calls,
+		depth:     c.depth,
+		interrupt: c.interrupt,
+		loop:      c.loop,
+		gens:      c.gens,
+		exact:     c.exact,
+		numeric:   c.numeric,
+		strict:    c.strict,
+		refs:      c.refs,
+	}
+
+	if last && c.value != nil && stmt.Expr != nil && stmt.Expr.AssignX == nil && stmt.Expr.IsPub == nil && stmt.Expr.IsLet == nil {
+		eval, err := exprGen.CodeGen(&stmt.Expr.X)
+		if err != nil {
+			return nil, err
+		}
+
+		value := c.value
+		return invoker(func() error {
+			v, err := eval.Eval()
+			if err != nil {
+				return err
+			}
+
+			*value = v
+			return nil
+		}), nil
+	}
+
+	return (&StmtCodeGen{exprGen: exprGen, isGlobalScope: true}).CodeGen(stmt)
 }
 
 func (c *Program) CodeGen(node *ProgramFile) (StmtInvoker, error) {
@@ -1617,27 +3086,29 @@ func (c *Program) CodeGen(node *ProgramFile) (StmtInvoker, error) {
 		stmts = &[]*Stmt{}
 	}
 
-	stmtInvokers := make([]StmtInvoker, 0, len(*stmts))
-	for _, stmt := range *stmts {
-		stmtInvoker, err := (&StmtCodeGen{
-			exprGen: &ExprCodeGen{
-				vars:     c.vars,
-				register: c.register,
-				imports:  c.imports,
-			},
-			isGlobalScope: true,
-		}).CodeGen(stmt)
+	type stmtAt struct {
+		StmtInvoker
+		node *Stmt
+	}
+
+	stmtInvokers := make([]stmtAt, 0, len(*stmts))
+	for i, stmt := range *stmts {
+		stmtInvoker, err := c.codeGenStmt(stmt, i == len(*stmts)-1)
 		if err != nil {
-			return nil, err
+			return nil, compileError(stmt.Pos, err)
 		}
 
-		stmtInvokers = append(stmtInvokers, stmtInvoker)
+		if isNop(stmtInvoker) {
+			continue
+		}
+
+		stmtInvokers = append(stmtInvokers, stmtAt{StmtInvoker: stmtInvoker, node: stmt})
 	}
 
 	return invoker(func() error {
 		for _, invoker := range stmtInvokers {
-			if err := invoker.Invoke(); err != nil {
-				return err
+			if err := safeInvoke(invoker); err != nil {
+				return runtimeError(invoker.node.Pos, err)
 			}
 		}
 
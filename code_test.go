@@ -286,7 +286,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Array_InvalidElementEval",
 			Input:          `[1 + "hello"]`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Object_Empty",
@@ -325,7 +325,7 @@ func TestExprCode(t *testing.T) {
 			Input: `{
 				1 + "2": 1,
 			}`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name: "Object_InvalidValue",
@@ -339,7 +339,7 @@ func TestExprCode(t *testing.T) {
 			Input: `{
 				"foo": 1 + "2",
 			}`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "ConstNone",
@@ -366,9 +366,9 @@ func TestExprCode(t *testing.T) {
 							"foo": 1,
 						},
 					},
-					m: map[Register]variant.Iface{
+					frame: &frame{slots: []variant.Iface{
 						1: variant.NewString("hello world"),
-					},
+					}},
 				},
 			},
 			Expected: variant.NewString("hello world"),
@@ -470,7 +470,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Primary_ArrayIndex_InvalidElemExpr",
 			Input:          `[1, 2, 3][1 + "2"]`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Primary_ArrayIndex_InvalidElemType",
@@ -497,6 +497,16 @@ func TestExprCode(t *testing.T) {
 			Input:    `{1: "hello"}[1]`,
 			Expected: variant.NewString("hello"),
 		},
+		{
+			Name:     "Primary_ObjectIndex_BoolKeys",
+			Input:    `{true: "yes", false: "no"}[false]`,
+			Expected: variant.NewString("no"),
+		},
+		{
+			Name:     "Primary_ObjectIndex_ArrayKey",
+			Input:    `{[1, 2]: "a", [2, 1]: "b"}[[2, 1]]`,
+			Expected: variant.NewString("b"),
+		},
 		{
 			Name:     "Primary_ObjectMultiIndex",
 			Input:    `{1: {"foo": "hello"}}[1, "foo"]`,
@@ -515,7 +525,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Primary_ObjectIndex_InvalidElemExpr",
 			Input:          `{1: {"foo": "hello"}}[1 + "2"]`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Primary_ObjectIndex_KeyNotFound",
@@ -535,7 +545,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Primary_Call_InvalidArgExpr",
 			Input:          `(|a| => a)(1 + "2")`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Primary_Call_InvalidLenArgs",
@@ -570,7 +580,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_CmpOp_LessInvalid_DiffType",
 			Input:          `"1" < 1`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_CmpOp_LessOrEq",
@@ -590,7 +600,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_CmpOp_LessOrEqInvalid_DiffType",
 			Input:          `"1" <= 1`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_CmpOp_Greater",
@@ -605,7 +615,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_CmpOp_GreaterInvalid_DiffType",
 			Input:          `"1" > 1`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_CmpOp_GreaterOrEq",
@@ -625,6 +635,46 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_CmpOp_GreaterOrEqInvalid_DiffType",
 			Input:          `"1" >= 1`,
+			IsCompileError: true,
+		},
+		{
+			Name:     "Binary_CmpOp_LessString",
+			Input:    `"apple" < "banana"`,
+			Expected: variant.True(),
+		},
+		{
+			Name:     "Binary_CmpOp_LessString_Prefix",
+			Input:    `"app" < "apple"`,
+			Expected: variant.True(),
+		},
+		{
+			Name:     "Binary_CmpOp_GreaterOrEqString",
+			Input:    `"b" >= "abc"`,
+			Expected: variant.True(),
+		},
+		{
+			Name:     "Binary_CmpOp_LessOrEqString_False",
+			Input:    `"é" <= "z"`,
+			Expected: variant.False(),
+		},
+		{
+			Name:     "Binary_CmpOp_LessArray",
+			Input:    `[1, "b"] < [1, "c"]`,
+			Expected: variant.True(),
+		},
+		{
+			Name:     "Binary_CmpOp_LessArray_Prefix",
+			Input:    `[1, 2] < [1, 2, 0]`,
+			Expected: variant.True(),
+		},
+		{
+			Name:     "Binary_CmpOp_GreaterOrEqArray_Nested",
+			Input:    `[[2], 0] >= [[1, 9], 9]`,
+			Expected: variant.True(),
+		},
+		{
+			Name:           "Binary_CmpOp_LessArray_DiffElemType",
+			Input:          `[1] < ["1"]`,
 			IsRuntimeError: true,
 		},
 		{
@@ -741,12 +791,12 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_CmpOp_EqInvalid_DiffType",
 			Input:          `"1" == 1`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Binary_CmpOp_NotEqInvalid_DiffType",
 			Input:          `"1" != 1`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 
 		{
@@ -778,7 +828,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Add_Invalid",
 			Input:          `inf + -inf`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_ArithOp_Sub",
@@ -798,7 +848,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Sub_Invalid",
 			Input:          `inf - inf`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_ArithOp_Quo",
@@ -833,12 +883,12 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Quo_Invalid_ZeroIntoZero",
 			Input:          `0 / 0`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Binary_ArithOp_Quo_Invalid_InfIntoInf",
 			Input:          `inf / inf`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_ArithOp_Mul",
@@ -858,7 +908,7 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Mul_Invalid_ZeroAndInf",
 			Input:          `inf * 0`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:     "Binary_ArithOp_Mod_Int",
@@ -893,12 +943,12 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Mod_Int_InvalidInf",
 			Input:          `4 % inf`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Binary_ArithOp_Mod_Int_InvalidZero",
 			Input:          `4 % 0`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name: "Binary_ArithOp_Mod_Float",
@@ -969,12 +1019,12 @@ func TestExprCode(t *testing.T) {
 		{
 			Name:           "Binary_ArithOp_Mod_Float_InvalidZero",
 			Input:          `4.123 % 0`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 		{
 			Name:           "Binary_ArithOp_Mod_Float_InvalidInf",
 			Input:          `4.123 % inf`,
-			IsRuntimeError: true,
+			IsCompileError: true,
 		},
 
 		{
@@ -1099,6 +1149,63 @@ func TestStmtCode(t *testing.T) {
 			`,
 			IsRuntimeError: true,
 		},
+		{
+			Name: "Stmt_Assign_Elem",
+			Input: `
+				a = [1, 2, 3]
+				a[0] = 10
+				a[-1] *= 2
+				o = {"x": {"y": 1}, "l": [1]}
+				o.x.y += 5
+				o["x"]["z"] = 7
+				o.l[0] -= 1
+				s = [a, o.x.y, o.x.z, o.l]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(10), variant.Int(2), variant.Int(6)}),
+				variant.Int(6), variant.Int(7),
+				variant.NewArray([]variant.Iface{variant.Int(0)}),
+			})),
+		},
+		{
+			Name: "Stmt_Assign_Elem_SharedArray",
+			Input: `
+				a = [1]
+				b = a
+				b[0] = 2
+				s = a[0]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(2)),
+		},
+		{
+			Name: "Stmt_Assign_Elem_OutOfRange",
+			Input: `
+				a = [1]
+				a[1] = 2
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Assign_Elem_String",
+			Input: `
+				a = "abc"
+				a[0] = "x"
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Assign_Elem_Call",
+			Input: `
+				f = || => 1
+				f() = 2
+			`,
+			IsCompileError: true,
+		},
+		{
+			Name:           "Stmt_Assign_Elem_Let",
+			Input:          `let a[0] = 1`,
+			IsCompileError: true,
+		},
 		{
 			Name: "Stmt_Assign_Pub",
 			Input: `
@@ -1172,6 +1279,63 @@ func TestStmtCode(t *testing.T) {
 			`,
 			IsCompileError: true,
 		},
+		{
+			Name: "Stmt_Assign_Let_Shadows",
+			Input: `
+				x = 1
+				f = || => {
+					let x = x + 10
+					x = x * 2
+					return x
+				}
+				s = [f(), x]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(22), variant.Int(1),
+			})),
+		},
+		{
+			Name: "Stmt_Assign_Let_Block",
+			Input: `
+				x = 1
+				y = block {
+					let x = 2
+					return x
+				}
+				s = [x, y]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Assign_Let_LoopClosure",
+			Input: `
+				v = 0
+				fns = []
+				for i in range(2) {
+					let v = i
+					fns = fns + [|| => v]
+				}
+				s = [v, fns[0](), fns[1]()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(0), variant.Int(1),
+			})),
+		},
+		{
+			Name:           "Stmt_Assign_Let_NoValue",
+			Input:          `let x`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Assign_Let_Augmented",
+			Input: `
+				x = 1
+				let x += 2
+			`,
+			IsCompileError: true,
+		},
 		{
 			Name: "Stmt_If_Simple",
 			Input: `
@@ -1294,346 +1458,2252 @@ func TestStmtCode(t *testing.T) {
 				is.True(variant.DeepEqual(b, variant.Int(0)))
 			},
 		},
+		// constant operands are folded at codegen, so operands taken from
+		// variables keep runtime errors of operators, indexes and calls
 		{
-			Name: "Stmt_Return_Block",
+			Name: "Stmt_Runtime_Array_InvalidElementEval",
 			Input: `
-			a = block {
-				return "hello"
-			}`,
-			ExpectedVar: expectGlobalVarOf("a", variant.NewString("hello")),
+				x = 1
+				[x + "hello"]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Return_Func",
+			Name: "Stmt_Runtime_Object_InvalidValueEval",
 			Input: `
-			a = || => {
-				return "hello"
-			}()`,
-			ExpectedVar: expectGlobalVarOf("a", variant.NewString("hello")),
+				x = 1
+				{"foo": x + "2"}
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name:           "Stmt_Return_Invalid_Global",
-			Input:          `return 1`,
-			IsCompileError: true,
+			Name: "Stmt_Runtime_Primary_ArrayIndex_InvalidElemExpr",
+			Input: `
+				x = 1
+				[1, 2, 3][x + "2"]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_While",
+			Name: "Stmt_Runtime_Primary_ArrayIndex_OutOfRange",
 			Input: `
-			i = 0
-			while i < 10 {
-				i = i + 1
-			}`,
-			ExpectedVar: expectGlobalVarOf("i", variant.Int(10)),
+				a = [1, 2, 3]
+				i = 3
+				a[i]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_While_Break",
+			Name: "Stmt_Runtime_Primary_ArrayIndex_InvalidElemType",
 			Input: `
-			i = 0
-			while true {
-				if i == 10 {
-					break
-				}
-				i = i + 1
-			}`,
-			ExpectedVar: expectGlobalVarOf("i", variant.Int(10)),
+				a = [1, 2, 3]
+				i = "1"
+				a[i]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_While_Continue",
+			Name: "Stmt_Runtime_Primary_ObjectIndex_InvalidElemExpr",
 			Input: `
-			i = 0
-			s = 0
-			while i < 10 {
-				i = i + 1
-
-				if i % 2 == 0 {
-					continue
-				}
-
-				s = s + 1
-			}`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(5)),
+				x = 1
+				{1: {"foo": "hello"}}[x + "2"]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_WhileNested_Break",
+			Name: "Stmt_Runtime_Primary_ObjectIndex_KeyNotFound",
 			Input: `
-			i = 0
-			j = 0
-			while i < 10 {
-				while true {
-					j = j + 2
-					break
-				}
-				i = i + 1
-			}`,
-			ExpectedVar: expectGlobalVarOf("j", variant.Int(20)),
+				obj = {1: 2}
+				k = 2
+				obj[k]
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Array_ByVal",
+			Name: "Stmt_Runtime_Primary_Index_NotIndexable",
 			Input: `
-			s = 0
-			for v in [1, 2, 3] {
-				s = s + v
-			}
+				n = 1
+				n[0]
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Array_ByValWithIdx",
+			Name: "Stmt_Runtime_Primary_Call_InvalidArgExpr",
 			Input: `
-			s = 0
-			for i, v in [1, 2, 3] {
-				s = s + v
-			}
+				x = 1
+				(|a| => a)(x + "2")
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Array_ByIdx",
+			Name: "Stmt_Runtime_Primary_Call_InvalidLenArgs",
 			Input: `
-			s = 0
-			arr = [1, 2, 3]
-			for i, _ in arr {
-				s = s + arr[i]
-			}
+				f = |a| => a
+				f(1, 2)
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Array_Bytes",
+			Name: "Stmt_Runtime_Primary_Call_NotFunc",
 			Input: `
-				s = 0
-				for el in arr {
-					s += el
-				}
+				f = 1
+				f()
 			`,
-			Prepare: func(vars *Vars) error {
-				arr := []byte{1, 2, 3}
-				arrReg := vars.Global.Register("arr")
-				vars.Global.DefineVar(arrReg, variant.Bytes(arr))
-				return nil
-			},
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Object_ByKey",
+			Name: "Stmt_Runtime_Binary_CmpOp_LessInvalid_DiffType",
 			Input: `
-			s = 0
-			obj = {
-				"1": 1,
-				"2": 2,
-				"3": 3,
-			}
-			for k in obj {
-				s = s + obj[k]
-			}
+				s = "1"
+				s < 1
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Object_ByVal",
+			Name: "Stmt_Runtime_Binary_CmpOp_LessOrEqInvalid_DiffType",
 			Input: `
-			s = 0
-			obj = {
-				"1": 1,
-				"2": 2,
-				"3": 3,
-			}
-			for _, v in obj {
-				s = s + v
-			}
+				s = "1"
+				s <= 1
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Continue",
+			Name: "Stmt_Runtime_Binary_CmpOp_GreaterInvalid_DiffType",
 			Input: `
-			s = 0
-			for v in [1, 2, 3] {
-				if v % 2 == 0 {
-					continue
-				}
-				s = s + v
-			}
+				s = "1"
+				s > 1
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(4)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_For_Break",
+			Name: "Stmt_Runtime_Binary_CmpOp_GreaterOrEqInvalid_DiffType",
 			Input: `
+				s = "1"
+				s >= 1
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_CmpOp_EqInvalid_DiffType",
+			Input: `
+				s = "1"
+				s == 1
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_CmpOp_NotEqInvalid_DiffType",
+			Input: `
+				s = "1"
+				s != 1
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Add_Invalid",
+			Input: `
+				x = inf
+				x + -inf
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Add_DiffType",
+			Input: `
+				x = 1
+				x + "2"
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Sub_Invalid",
+			Input: `
+				x = inf
+				x - inf
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Quo_Invalid_ZeroIntoZero",
+			Input: `
+				x = 0
+				x / 0
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Quo_Invalid_InfIntoInf",
+			Input: `
+				x = inf
+				x / inf
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Mul_Invalid_ZeroAndInf",
+			Input: `
+				x = inf
+				x * 0
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Mod_Int_InvalidInf",
+			Input: `
+				x = 4
+				x % inf
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Mod_Int_InvalidZero",
+			Input: `
+				x = 4
+				x % 0
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Mod_Float_InvalidZero",
+			Input: `
+				x = 4.123
+				x % 0
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Runtime_Binary_ArithOp_Mod_Float_InvalidInf",
+			Input: `
+				x = 4.123
+				x % inf
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_If_ConstCond",
+			Input: `
+			a = 1
+			if 1 > 2 {
+				a = 2
+			} else if "a" + "b" == "ab" {
+				a = 3
+			}`,
+			ExpectedVar: expectGlobalVarOf("a", variant.Int(3)),
+		},
+		{
+			Name: "Stmt_If_ConstCond_NotBool",
+			Input: `
+			if 1 + 2 {
+			}`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_While_ConstFalse",
+			Input: `
+			a = 1
+			while 2 < 1 {
+				a = 2
+			}`,
+			ExpectedVar: expectGlobalVarOf("a", variant.Int(1)),
+		},
+		{
+			Name: "Stmt_ConstExpr_DivByZero",
+			Input: `
+			a = 1
+			if a > 0 {
+				a = 10 % (2 - 2)
+			}`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Return_Block",
+			Input: `
+			a = block {
+				return "hello"
+			}`,
+			ExpectedVar: expectGlobalVarOf("a", variant.NewString("hello")),
+		},
+		{
+			Name: "Stmt_Return_Func",
+			Input: `
+			a = || => {
+				return "hello"
+			}()`,
+			ExpectedVar: expectGlobalVarOf("a", variant.NewString("hello")),
+		},
+		{
+			Name:           "Stmt_Return_Invalid_Global",
+			Input:          `return 1`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_While",
+			Input: `
+			i = 0
+			while i < 10 {
+				i = i + 1
+			}`,
+			ExpectedVar: expectGlobalVarOf("i", variant.Int(10)),
+		},
+		{
+			Name: "Stmt_While_Break",
+			Input: `
+			i = 0
+			while true {
+				if i == 10 {
+					break
+				}
+				i = i + 1
+			}`,
+			ExpectedVar: expectGlobalVarOf("i", variant.Int(10)),
+		},
+		{
+			Name: "Stmt_While_Continue",
+			Input: `
+			i = 0
 			s = 0
-			for v in [1, 2, 3] {
+			while i < 10 {
+				i = i + 1
+
+				if i % 2 == 0 {
+					continue
+				}
+
+				s = s + 1
+			}`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(5)),
+		},
+		{
+			Name: "Stmt_While_LocalScope",
+			Input: `
+			i = 0
+			while i < 1 {
+				x = i
+				i = i + 1
+			}
+			y = x`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_While_Closure_BodyVar",
+			Input: `
+			fns = []
+			i = 0
+			while i < 3 {
+				v = i
+				fns = fns + [|| => v]
+				i += 1
+			}
+			s = [fns[0](), fns[1](), fns[2]()]`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_While_OuterVarShared",
+			Input: `
+			fns = []
+			n = 0
+			while n < 3 {
+				n += 1
+				fns = fns + [|| => n]
+			}
+			s = [fns[0](), fns[2]()]`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(3), variant.Int(3),
+			})),
+		},
+		{
+			Name: "Stmt_WhileNested_Break",
+			Input: `
+			i = 0
+			j = 0
+			while i < 10 {
+				while true {
+					j = j + 2
+					break
+				}
+				i = i + 1
+			}`,
+			ExpectedVar: expectGlobalVarOf("j", variant.Int(20)),
+		},
+		{
+			Name: "Stmt_For_Else",
+			Input: `
+			found = none
+			for v in [1, 3, 5] {
+				if v % 2 == 0 {
+					found = v
+					break
+				}
+			} else {
+				found = "none even"
+			}`,
+			ExpectedVar: expectGlobalVarOf("found", variant.NewString("none even")),
+		},
+		{
+			Name: "Stmt_For_Else_Break",
+			Input: `
+			found = none
+			for v in [1, 4, 5] {
 				if v % 2 == 0 {
+					found = v
+					break
+				}
+			} else {
+				found = "none even"
+			}`,
+			ExpectedVar: expectGlobalVarOf("found", variant.Int(4)),
+		},
+		{
+			Name: "Stmt_While_Else",
+			Input: `
+			i = 0
+			s = ""
+			while i < 3 {
+				i += 1
+				if i == 2 {
+					continue
+				}
+			} else {
+				s = "done"
+			}`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("done")),
+		},
+		{
+			Name: "Stmt_While_Else_ConstFalse",
+			Input: `
+			s = ""
+			while false {
+			} else {
+				s = "done"
+			}`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("done")),
+		},
+		{
+			Name: "Stmt_For_Else_BreakOuter",
+			Input: `
+			n = 0
+			for i in range(5) {
+				n = i
+				for j in [1] {
+				} else {
+					if i == 2 {
+						break
+					}
+				}
+			}`,
+			ExpectedVar: expectGlobalVarOf("n", variant.Int(2)),
+		},
+		{
+			Name: "Stmt_For_Else_BreakOutsideLoop",
+			Input: `
+			for j in [1] {
+			} else {
+				break
+			}`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Loop",
+			Input: `
+			i = 0
+			s = 0
+			loop {
+				i += 1
+				if i % 2 == 0 {
+					continue
+				}
+				if i > 7 {
+					break
+				}
+				s += i
+			}`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(16)),
+		},
+		{
+			Name: "Stmt_Loop_Return",
+			Input: `
+			f = || => {
+				i = 0
+				loop {
+					i += 1
+					if i == 3 {
+						return i
+					}
+				}
+			}
+			s = f()`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(3)),
+		},
+		{
+			Name: "Stmt_DoWhile_RunsOnce",
+			Input: `
+			i = 0
+			do {
+				i += 1
+			} while false`,
+			ExpectedVar: expectGlobalVarOf("i", variant.Int(1)),
+		},
+		{
+			Name: "Stmt_DoWhile",
+			Input: `
+			i = 0
+			s = 0
+			do {
+				i += 1
+				if i % 2 == 0 {
+					continue
+				}
+				if i > 7 {
 					break
 				}
-				s = s + v
-			}
+				s += i
+			} while i < 10`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(16)),
+		},
+		{
+			Name: "Stmt_DoWhile_CondNotBool",
+			Input: `
+			do {
+			} while 1`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_For_Array_ByVal",
+			Input: `
+			s = 0
+			for v in [1, 2, 3] {
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_Array_ByValWithIdx",
+			Input: `
+			s = 0
+			for i, v in [1, 2, 3] {
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_Array_ByIdx",
+			Input: `
+			s = 0
+			arr = [1, 2, 3]
+			for i, _ in arr {
+				s = s + arr[i]
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_Array_Bytes",
+			Input: `
+				s = 0
+				for el in arr {
+					s += el
+				}
+			`,
+			Prepare: func(vars *Vars) error {
+				arr := []byte{1, 2, 3}
+				arrReg := vars.Global.Register("arr")
+				vars.Global.DefineVar(arrReg, variant.Bytes(arr))
+				return nil
+			},
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_String_ByChar",
+			Input: `
+			s = ""
+			for ch in "héllo" {
+				s = ch + s
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("olléh")),
+		},
+		{
+			Name: "Stmt_For_String_ByIdx",
+			Input: `
+			s = 0
+			for i, ch in "héllo" {
+				if ch == "l" {
+					s = s + i
+				}
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(5)),
+		},
+		{
+			Name: "Stmt_For_Iterator_Range",
+			Input: `
+			using iter
+
+			s = 0
+			for i, v in iter.range(1, 4) {
+				s = s + i * v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(8)),
+		},
+		{
+			Name: "Stmt_For_Iterator_UserDefined",
+			Input: `
+			using iter
+
+			countdown = |n| => {
+				state = {"n": n}
+				return {
+					"next": || => {
+						if state.n == 0 {
+							iter.stop()
+						}
+						n = state.n
+						state = {"n": n - 1}
+						return n
+					}
+				}
+			}
+
+			s = ""
+			for v in countdown(3) {
+				s = s + str(v)
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("321")),
+		},
+		{
+			Name: "Stmt_Yield_Generator",
+			Input: `
+			evens = |n| => {
+				i = 0
+				while i < n {
+					if i % 2 == 0 {
+						yield i
+					}
+					i += 1
+				}
+			}
+
+			s = 0
+			for v in evens(10) {
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(20)),
+		},
+		{
+			Name: "Stmt_Yield_IterChain",
+			Input: `
+			naturals = || => {
+				i = 0
+				while true {
+					i += 1
+					yield i
+				}
+			}
+
+			s = naturals().select(|v| => v * v).max(3).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(4), variant.Int(9),
+			})),
+		},
+		{
+			Name: "Stmt_Yield_Return",
+			Input: `
+			gen = || => {
+				yield 1
+				return
+			}
+
+			s = gen().count()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(1)),
+		},
+		{
+			Name: "Stmt_Yield_Interleaved",
+			Input: `
+			gen = |n| => {
+				for i in range(n) {
+					x = i * 10
+					yield x
+					yield x + 1
+				}
+			}
+
+			a = gen(2)
+			b = gen(2)
+			s = []
+			for _ in range(4) {
+				s = s + [a.next(), b.next()]
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(0), variant.Int(1), variant.Int(1),
+				variant.Int(10), variant.Int(10), variant.Int(11), variant.Int(11),
+			})),
+		},
+		{
+			Name: "Stmt_Yield_Close",
+			Input: `
+			gen = || => {
+				i = 0
+				while true {
+					i += 1
+					yield i
+				}
+			}
+
+			it = gen()
+			for v in it {
+				if v == 2 {
+					break
+				}
+			}
+			a = it.list()
+
+			it = gen()
+			b = [it.next(), it.next()]
+			it.close()
+			it.close()
+			s = [a, b, it.list()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray(nil),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2)}),
+				variant.NewArray(nil),
+			})),
+		},
+		{
+			Name:           "Stmt_Yield_OutsideFunc",
+			Input:          `yield 1`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_For_Range",
+			Input: `
+			s = 0
+			for i in range(10, 0, -2) {
+				s = s + i
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(30)),
+		},
+		{
+			Name: "Stmt_For_Object_ByKey",
+			Input: `
+			s = 0
+			obj = {
+				"1": 1,
+				"2": 2,
+				"3": 3,
+			}
+			for k in obj {
+				s = s + obj[k]
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_Object_ByVal",
+			Input: `
+			s = 0
+			obj = {
+				"1": 1,
+				"2": 2,
+				"3": 3,
+			}
+			for _, v in obj {
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(6)),
+		},
+		{
+			Name: "Stmt_For_Continue",
+			Input: `
+			s = 0
+			for v in [1, 2, 3] {
+				if v % 2 == 0 {
+					continue
+				}
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(4)),
+		},
+		{
+			Name: "Stmt_For_Break",
+			Input: `
+			s = 0
+			for v in [1, 2, 3] {
+				if v % 2 == 0 {
+					break
+				}
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(1)),
+		},
+		{
+			Name: "Stmt_ForNested_Break",
+			Input: `
+			s = 0
+			for v in [1, 2, 3] {
+				for v in [2, 1] {
+					if v % 2 != 0 {
+						break
+					}
+
+					s = s + v
+				}
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(12)),
+		},
+		{
+			Name: "Stmt_ForNested_Continue",
+			Input: `
+			s = 0
+			for v in [1, 2, 3] {
+				for v in [1, 2] {
+					if v % 2 != 0 {
+						continue
+					}
+
+					s = s + v
+				}
+				s = s + v
+			}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(12)),
+		},
+		{
+			Name: "Stmt_BytesLit",
+			Input: `
+				b = b"\x00\xffA\n\\é"
+			`,
+			ExpectedVar: expectGlobalVarOf("b", variant.Bytes([]byte("\x00\xffA\n\\é"))),
+		},
+		{
+			Name: "Stmt_BytesLit_FreshCopy",
+			Input: `
+				f = || => b"ab"
+				a = f()
+				a[0] = 122
+				s = [a, f()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Bytes([]byte("zb")), variant.Bytes([]byte("ab")),
+			})),
+		},
+		{
+			Name:           "Stmt_BytesLit_BadEscape",
+			Input:          `b = b"\xzz"`,
+			IsCompileError: true,
+		},
+		{
+			Name:        "Stmt_String_ByteEscape",
+			Input:       `s = "\x41\0\\\""`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("A\x00\\\"")),
+		},
+		{
+			Name:           "Stmt_String_UnknownEscape",
+			Input:          `s = "\q"`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Heredoc",
+			Input: `
+				q = """
+					SELECT *
+					  FROM t
+					WHERE a = "x"\t
+					"""
+			`,
+			ExpectedVar: expectGlobalVarOf("q", variant.NewString("SELECT *\n  FROM t\nWHERE a = \"x\"\t\n")),
+		},
+		{
+			Name: "Stmt_Heredoc_ClosingOnLastLine",
+			Input: `
+				q = """
+				    a
+
+				      b"""
+				s = [q, """one line"""]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("a\n\n  b"), variant.NewString("one line"),
+			})),
+		},
+		{
+			Name: "Stmt_Spread_Literals",
+			Input: `
+				a = [1, 2]
+				b = [...a, 3, ...[4]]
+				base = {"x": 1, "y": 2}
+				o = {...base, "y": 3, "z": 4}
+				s = [b, o.x, o.y, o.z]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(4)}),
+				variant.Int(1), variant.Int(3), variant.Int(4),
+			})),
+		},
+		{
+			Name: "Stmt_Spread_Call",
+			Input: `
+				f = |x, y, z| => x * 100 + y * 10 + z
+				a = [1, 2]
+				s = [f(...a, 3), f(0, ...[4, 5])]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(123), variant.Int(45),
+			})),
+		},
+		{
+			Name: "Stmt_Spread_NotArray",
+			Input: `
+				a = 1
+				b = [...a]
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Spread_ObjectNotObject",
+			Input: `
+				a = [1]
+				b = {...a}
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:           "Stmt_Spread_OutsideLiteral",
+			Input:          `a = ...[1]`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Func_Compose",
+			Input: `
+				using func
+				inc = |x| => x + 1
+				double = |x| => x * 2
+				add = |x, y| => x + y
+				s = [func.compose(inc, double)(5), func.compose(double, inc, add)(1, 2)]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(11), variant.Int(8),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Partial",
+			Input: `
+				using func
+				f = |x, y, z| => x * 100 + y * 10 + z
+				g = func.partial(f, 1, 2)
+				s = [g(3), func.partial(f)(4, 5, 6)]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(123), variant.Int(456),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Curry",
+			Input: `
+				using func
+				f = |x, y, z| => x * 100 + y * 10 + z
+				c = func.curry(f)
+				c1 = c(1)
+				s = [c1(2)(3), c1(4, 5), c(7, 8, 9), func.curry(len, 1)("abc")]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(123), variant.Int(145), variant.Int(789), variant.Int(3),
+			})),
+		},
+		{
+			Name: "Stmt_Func_ComposeNotFunc",
+			Input: `
+				using func
+				f = func.compose(|x| => x, 1)
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Inspect_Func",
+			Input: `
+				using inspect
+				handler = |req, res| => none
+				s = [
+					inspect.arity(handler), inspect.params(handler), inspect.arity(|| => 1),
+					inspect.arity(len), inspect.params(len), inspect.doc(len).signature, inspect.doc(handler),
+				]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(2),
+				variant.NewArray([]variant.Iface{variant.NewString("req"), variant.NewString("res")}),
+				variant.Int(0), variant.NewNone(), variant.NewNone(), variant.NewString("len(v)"), variant.NewNone(),
+			})),
+		},
+		{
+			Name: "Stmt_Inspect_Object",
+			Input: `
+				using inspect
+				obj = {"name": "x", "age": 1}
+				s = [inspect.keys(obj), inspect.has(obj, "age"), inspect.has(obj, "id"), inspect.type(obj.age)]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.NewString("age"), variant.NewString("name")}),
+				variant.True(), variant.False(), variant.NewString("number"),
+			})),
+		},
+		{
+			Name: "Stmt_Inspect_ArityNotFunc",
+			Input: `
+				using inspect
+				n = inspect.arity(1)
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Func_Memoize",
+			Input: `
+				calls = 0
+				sq = memoize(|x| => {
+					calls += 1
+					return x * x
+				})
+				s = [sq(2), sq(3), sq(2), sq(3), calls]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(4), variant.Int(9), variant.Int(4), variant.Int(9), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Memoize_MaxSize",
+			Input: `
+				calls = 0
+				sq = memoize(|x| => {
+					calls += 1
+					return x * x
+				}, {"max_size": 1})
+				sq(2)
+				sq(3)
+				sq(3)
+				sq(2)
+				s = calls
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(3)),
+		},
+		{
+			Name: "Stmt_Func_Memoize_Copy",
+			Input: `
+				f = memoize(|x| => [x, {"x": x}])
+				a = f(1)
+				a[0] = 9
+				b = f(1)
+				b[1].x = 9
+				s = f(1)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.FromMap(map[string]variant.Iface{"x": variant.Int(1)}),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Memoize_BadOption",
+			Input: `
+				f = memoize(|x| => x, {"ttl": 0})
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Func_Memoize_NotHashable",
+			Input: `
+				f = memoize(|x| => x)
+				f(|| => 1)
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Decimal_Arith",
+			Input: `
+				using decimal
+				price = decimal.new("19.99")
+				total = price * 3 + decimal.new(0.1) - 1
+				s = [
+					str(total), str(-total), total > 59, total == decimal.new("59.070"),
+					decimal.scale(total), decimal.is_decimal(total), {decimal.new("2.00"): 1}[2],
+				]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("59.07"), variant.NewString("-59.07"), variant.True(), variant.True(),
+				variant.Int(2), variant.True(), variant.Int(1),
+			})),
+		},
+		{
+			Name: "Stmt_Decimal_Rounding",
+			Input: `
+				using decimal
+				d = decimal.new("2.345")
+				s = [
+					str(decimal.round(d, 2, "half_even")), str(decimal.round(d, 2, "half_up")),
+					str(decimal.round(-d, 2, "floor")), str(decimal.round(d, 4, "down")),
+					str(decimal.div(10, 3, 2, "half_up")), str(decimal.div(decimal.new("-1"), 8, 2, "half_even")),
+					decimal.format(decimal.new("-1234567.50"), ","), decimal.format(decimal.new("1234.5"), " ", ","),
+				]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("2.34"), variant.NewString("2.35"),
+				variant.NewString("-2.35"), variant.NewString("2.3450"),
+				variant.NewString("3.33"), variant.NewString("-0.12"),
+				variant.NewString("-1,234,567.50"), variant.NewString("1 234,5"),
+			})),
+		},
+		{
+			Name: "Stmt_Decimal_DivOperator",
+			Input: `
+				using decimal
+				d = decimal.new("1.5") / 2
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Decimal_MixFloat",
+			Input: `
+				using decimal
+				d = decimal.new("1.5") + 0.5
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Func_Recursion",
+			Input: `
+				fib = none
+				fib = |n| => {
+					if n < 2 {
+						return n
+					}
+					return fib(n - 1) + fib(n - 2)
+				}
+				s = fib(10)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(55)),
+		},
+		{
+			Name: "Stmt_Func_Closure_LoopVar",
+			Input: `
+				fns = []
+				for i in range(3) {
+					fns = fns + [|| => i]
+				}
+				s = [fns[0](), fns[1](), fns[2]()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Closure_LoopBodyVar",
+			Input: `
+				fns = []
+				for i in range(3) {
+					sq = i * i
+					fns = fns + [|| => sq]
+				}
+				s = [fns[0](), fns[1](), fns[2]()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(1), variant.Int(4),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Closure_Counter",
+			Input: `
+				counter = || => {
+					n = 0
+					return || => {
+						n += 1
+						return n
+					}
+				}
+				a = counter()
+				b = counter()
+				a()
+				a()
+				s = [a(), b()]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(3), variant.Int(1),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Closure_ArgShadowsOuter",
+			Input: `
+				x = 1
+				f = |x| => x * 2
+				y = f(5)
+				s = [x, y]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(10),
+			})),
+		},
+		{
+			Name: "Stmt_Func_Recursion_NotAllowed",
+			Input: `
+				b = (|| => b())()
+			`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Using",
+			Input: `
+				using iter
+				s = iter.range(100).count()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Alias",
+			Input: `
+				using iter as foo
+				s = foo.range(100).count()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Multi",
+			Input: `
+				using iter, func as f
+				s = f.partial(|a, b| => a + b, 1)(iter.range(99).count())
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Again",
+			Input: `
+				using iter
+				using iter
+				s = iter.range(100).count()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Conflict",
+			Input: `
+				iter = 1
+				using iter
+			`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Using_Conflict_Alias",
+			Input: `
+				using iter
+				using func as iter
+			`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Using_Conflict_Outer",
+			Input: `
+				s = 0
+				block {
+					using iter as s
+				}
+			`,
+			IsCompileError: true,
+		},
+		{
+			Name: "Stmt_Using_Nested_Block",
+			Input: `
+				s = 0
+				block {
+					using iter
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_Func",
+			Input: `
+				s = 0
+				(|| => {
+					using iter
+					s = iter.range(100).count()
+				})()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_If",
+			Input: `
+				s = 0
+				if s == 0 {
+					using iter
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_IfElseIf",
+			Input: `
+				s = 0
+				if s == 1 {
+					s = -1
+				} else if s == 0 {
+					using iter
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_IfElseIfElse",
+			Input: `
+				s = 0
+				if s == 1 {
+					s = -1
+				} else if s == -1 {
+					s = -2
+				} else {
+					using iter
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_For",
+			Input: `
+				s = 0
+				for el in [1, 2, 3] {
+					using iter
+					s = iter.range(100).count()
+					break
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Iter_Reduce",
+			Input: `
+				using iter
+
+				s = iter.range(1, 5).reduce(1, |acc, v| => acc * v)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(24)),
+		},
+		{
+			Name: "Stmt_Using_Iter_Reduce_Empty",
+			Input: `
+				using iter
+
+				s = iter.from([]).reduce("init", |acc, v| => acc + v)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("init")),
+		},
+		{
+			Name: "Stmt_Using_Iter_Zip",
+			Input: `
+				using iter
+
+				s = iter.from([1, 2, 3]).zip(["a", "b"]).select(|p| => str(p.a) + p.b).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("1a"), variant.NewString("2b"),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_Enumerate",
+			Input: `
+				using iter
+
+				s = 0
+				for p in iter.range(10, 13).enumerate() {
+					s = s + p.index * p.value
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(35)),
+		},
+		{
+			Name: "Stmt_Using_Iter_Chain",
+			Input: `
+				using iter
+
+				s = iter.range(2).chain([5, 6]).chain(iter.range(1)).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(0), variant.Int(1), variant.Int(5), variant.Int(6), variant.Int(0),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_Flatten",
+			Input: `
+				using iter
+
+				s = iter.from([[1, 2], 3, [], iter.range(4, 6), [[7]]]).flatten().list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(4), variant.Int(5),
+				variant.NewArray([]variant.Iface{variant.Int(7)}),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_SortBy",
+			Input: `
+				using iter
+
+				s = iter.from(["ccc", "a", "bb", "d"]).sort_by(|v| => len(v)).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("a"), variant.NewString("d"), variant.NewString("bb"), variant.NewString("ccc"),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_SortBy_MixedKeys",
+			Input: `
+				using iter
+
+				s = iter.from([1, "a"]).sort_by(|v| => v).list()
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Using_Iter_SkipTakeWhile",
+			Input: `
+				using iter
+
+				s = iter.range(10).skip(1).skip_while(|v| => v < 3).take_while(|v| => v < 6).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(3), variant.Int(4), variant.Int(5),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_Count",
+			Input: `
+				using iter
+
+				s = iter.count([1, 2, 3]) + iter.count("héllo") + iter.count(iter.range(10))
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(18)),
+		},
+		{
+			Name: "Stmt_Using_Iter_From",
+			Input: `
+				using iter
+
+				s = iter.from(iter.from("abc").skip(1)).list()
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("b"), variant.NewString("c"),
+			})),
+		},
+		{
+			Name: "Stmt_Using_Iter_From_NotIterable",
+			Input: `
+				using iter
+
+				s = iter.from(1)
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_Sort",
+			Input: `
+				arr = [3, 1, 2]
+				s = sort(arr) + arr
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(2), variant.Int(3),
+				variant.Int(3), variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_Sort_Comparator",
+			Input: `
+				arr = [{"n": "b", "v": 1}, {"n": "a", "v": 2}, {"n": "c", "v": 1}]
+				s = ""
+				for el in sort(arr, |a, b| => a.v > b.v) {
+					s = s + el.n
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("abc")),
+		},
+		{
+			Name:  "Stmt_Builtin_Sort_Arrays",
+			Input: `s = sort([[2, "a"], [1, "b"], [1, "a", 0], [1, "a"]])`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.NewString("a")}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.NewString("a"), variant.Int(0)}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.NewString("b")}),
+				variant.NewArray([]variant.Iface{variant.Int(2), variant.NewString("a")}),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_At",
+			Input: `
+				using bytes
+				arr = [1, 2, 3]
+				bs = bytes.from_string("ab")
+				s = [
+					at(arr, -1), at(arr, 3), at(arr, -4, 0), at(bs, -1), at(bs, -3, "none"),
+					at("héllo", 1), at("hi", 5, ""), at({"a": 1}, "a"), at({"a": 1}, "b", 2),
+				]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(3), variant.NewNone(), variant.Int(0), variant.Int(98), variant.NewString("none"),
+				variant.NewString("é"), variant.NewString(""), variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Index_BytesNegative",
+			Input: `
+				using bytes
+				bs = bytes.from_string("ab")
+				s = bs[-2]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(97)),
+		},
+		{
+			Name: "Stmt_Index_BytesOutOfRange",
+			Input: `
+				using bytes
+				bs = bytes.from_string("ab")
+				s = bs[-3]
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:           "Stmt_Builtin_At_BadIndex",
+			Input:          `s = at([1], "0")`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_Push_Reference",
+			Input: `
+				add = |arr, el| => push(arr, el)
+				arr = [1]
+				alias = arr
+				add(arr, 2)
+				push(alias, 3, 4)
+				s = arr
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(4),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_Pop",
+			Input: `
+				arr = [1, 2]
+				last = pop(arr)
+				s = [last, arr]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(2), variant.NewArray([]variant.Iface{variant.Int(1)}),
+			})),
+		},
+		{
+			Name:           "Stmt_Builtin_Pop_Empty",
+			Input:          `s = pop([])`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:           "Stmt_Builtin_Push_NotArray",
+			Input:          `push({"a": 1}, 2)`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_Push_Bytes",
+			Input: `
+				bs = b"a"
+				push(bs, 98)
+				s = bs
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Bytes([]byte("ab"))),
+		},
+		{
+			Name:           "Stmt_Builtin_Push_BytesBadByte",
+			Input:          `push(b"a", 256)`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_Copy",
+			Input: `
+				inner = [1]
+				arr = [inner]
+				c = copy(arr)
+				push(c, 2)
+				push(inner, 3)
+				obj = {"a": 1}
+				o = copy(obj)
+				o.a = 2
+				s = [arr, c, obj.a, o.a]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{
+					variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(3)}),
+				}),
+				variant.NewArray([]variant.Iface{
+					variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(3)}),
+					variant.Int(2),
+				}),
+				variant.Int(1), variant.Int(2),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_Clone",
+			Input: `
+				obj = {"a": [1]}
+				c = clone(obj)
+				push(c.a, 2)
+				s = [obj.a, c.a]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1)}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2)}),
+			})),
+		},
+		{
+			Name: "Stmt_Array_ConcatShared",
+			Input: `
+				a = [1, 2]
+				b = a + [3]
+				c = a + [4]
+				push(b, 5)
+				a[0] = 9
+				s = [a, b, c]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(9), variant.Int(2)}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(5)}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2), variant.Int(4)}),
+			})),
+		},
+		{
+			Name: "Stmt_Array_ConcatLoop",
+			Input: `
+				acc = []
+				for i in range(4) {
+					acc = acc + [i]
+				}
+				s = [acc, acc + b"a"]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(0), variant.Int(1), variant.Int(2), variant.Int(3)}),
+				variant.NewArray([]variant.Iface{variant.Int(0), variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(97)}),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_Slice",
+			Input: `
+				a = [1, 2, 3, 4]
+				t = slice(a, 1, -1)
+				t[0] = 7
+				u = slice(a, 0, 2) + [8]
+				s = [a, t, u, slice(a, -2), slice(a, 3, 1)]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2), variant.Int(3), variant.Int(4)}),
+				variant.NewArray([]variant.Iface{variant.Int(7), variant.Int(3)}),
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2), variant.Int(8)}),
+				variant.NewArray([]variant.Iface{variant.Int(3), variant.Int(4)}),
+				variant.NewArray([]variant.Iface{}),
+			})),
+		},
+		{
+			Name: "Stmt_Builtin_Slice_Bytes",
+			Input: `
+				bs = b"abc"
+				t = slice(bs, 1) + b"d"
+				push(bs, 101)
+				s = [bs, t]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Bytes([]byte("abce")), variant.Bytes([]byte("bcd")),
+			})),
+		},
+		{
+			Name:           "Stmt_Builtin_Slice_BadIndex",
+			Input:          `s = slice([1], "a")`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_SortedKeys",
+			Input: `
+				s = sorted_keys({"b": 1, 10: 2, "a": 3, 2: 4, true: 5, false: 6, [1]: 7})
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewBool(false), variant.NewBool(true), variant.Int(2), variant.Int(10),
+				variant.NewString("a"), variant.NewString("b"), variant.NewArray([]variant.Iface{variant.Int(1)}),
+			})),
+		},
+		{
+			Name:           "Stmt_Builtin_SortedKeys_NotObject",
+			Input:          `s = sorted_keys([1])`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:           "Stmt_Builtin_Sort_MixedTypes",
+			Input:          `s = sort([1, "a"])`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_MapFilterReduce",
+			Input: `
+				arr = filter(map([1, 2, 3, 4], |v| => v * 10), |v| => v > 15)
+				s = reduce(arr, 0, |acc, v| => acc + v)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(90)),
+		},
+		{
+			Name:           "Stmt_Builtin_Filter_NotBool",
+			Input:          `s = filter([1], |v| => v)`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_ZipUnzip",
+			Input: `
+				pairs = zip([1, 2], ["a", "b"])
+				s = unzip(pairs)
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2)}),
+				variant.NewArray([]variant.Iface{variant.NewString("a"), variant.NewString("b")}),
+			})),
+		},
+		{
+			Name:           "Stmt_Builtin_Zip_LengthMismatch",
+			Input:          `s = zip([1, 2], [1])`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:        "Stmt_Builtin_Zip_Shortest",
+			Input:       `s = len(zip([1, 2], [1], true))`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(1)),
+		},
+		{
+			Name:        "Stmt_Builtin_Num",
+			Input:       `s = num("0x10") + num(" 1_000 ") + num(2)`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(1018)),
+		},
+		{
+			Name:        "Stmt_Builtin_ParseInt",
+			Input:       `s = parse_int("ff", 16) + parse_int("-12")`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(243)),
+		},
+		{
+			Name:           "Stmt_Builtin_ParseInt_Invalid",
+			Input:          `s = parse_int("1.5")`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:        "Stmt_Builtin_ParseFloat",
+			Input:       `s = parse_float("2.5e2")`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(250)),
+		},
+		{
+			Name:           "Stmt_Builtin_ParseFloat_Invalid",
+			Input:          `s = parse_float("abc")`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:        "Stmt_Builtin_FormatNum_Precision",
+			Input:       `s = format_num(1234567.891, {"precision": 2, "thousands_sep": ","})`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("1,234,567.89")),
+		},
+		{
+			Name:        "Stmt_Builtin_FormatNum_Base",
+			Input:       `s = format_num(-255, {"base": 16})`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("-ff")),
+		},
+		{
+			Name:        "Stmt_Builtin_FormatNum_Default",
+			Input:       `s = format_num(0.1) + " " + format_num(100)`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("0.1 100")),
+		},
+		{
+			Name:           "Stmt_Builtin_FormatNum_BaseNotInt",
+			Input:          `s = format_num(1.5, {"base": 2})`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:        "Stmt_Builtin_Format",
+			Input:       `s = format("%-3s|%3d|%.1f|%v", "ab", 7, 2.25, none)`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("ab |  7|2.2|none")),
+		},
+		{
+			Name:           "Stmt_Builtin_Format_NotInt",
+			Input:          `s = format("%d", 1.5)`,
+			IsRuntimeError: true,
+		},
+		{
+			Name:           "Stmt_Builtin_Format_MissingArg",
+			Input:          `s = format("%s %s", "a")`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Builtin_Type",
+			Input: `
+				s = ""
+				for v in [none, true, 1, "a", [], {}, || => 1] {
+					s = s + type(v) + " "
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("none bool number string array object func ")),
+		},
+		{
+			Name:        "Stmt_Builtin_Types",
+			Input:       `s = type(1) == types.number and type("") != types.none`,
+			ExpectedVar: expectGlobalVarOf("s", variant.True()),
+		},
+		{
+			Name: "Stmt_Using_Nested_While",
+			Input: `
+				s = 0
+				while s == 0 {
+					using iter
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_FoundInternalScope",
+			Input: `
+				using iter
+
+				s = 0
+				block {
+					s = iter.range(100).count()
+				}
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+		},
+		{
+			Name: "Stmt_Using_Nested_NotFoundOutScope",
+			Input: `
+				s = 0
+				block {
+					using iter
+					s = iter.range(100).count()
+				}
+
+				iter.range(100)
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(1)),
+			IsCompileError: true,
 		},
 		{
-			Name: "Stmt_ForNested_Break",
+			Name: "Stmt_Assign_KeywordPrefixedNames",
 			Input: `
-			s = 0
-			for v in [1, 2, 3] {
-				for v in [2, 1] {
-					if v % 2 != 0 {
-						break
-					}
+				order = 1
+				android = 2
+				notes = 3
+				info = 4
+				letter = 5
+				s = order + android + notes + info + letter
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.Int(15)),
+		},
+		{
+			Name: "Stmt_String_Runes",
+			Input: `
+				using bytes
 
-					s = s + v
+				s = "héllo"
+				r = [len(s), s[1], s[-1], substr(s, 1, 2), substr(s, -2), chars("añ"), len(bytes.from_string(s))]
+			`,
+			ExpectedVar: expectGlobalVarOf("r", variant.NewArray([]variant.Iface{
+				variant.Int(5),
+				variant.NewString("é"),
+				variant.NewString("o"),
+				variant.NewString("él"),
+				variant.NewString("lo"),
+				variant.NewArray([]variant.Iface{variant.NewString("a"), variant.NewString("ñ")}),
+				variant.Int(6),
+			})),
+		},
+		{
+			Name: "Stmt_String_Substr",
+			Input: `
+				s = "héllo"
+				r = [substr(s, 1, 3), substr(s, -2, 5), substr(s, 4, 0), substr(s, 9, 1), substr(s, -9, 2)]
+			`,
+			ExpectedVar: expectGlobalVarOf("r", variant.NewArray([]variant.Iface{
+				variant.NewString("éll"),
+				variant.NewString("lo"),
+				variant.NewString(""),
+				variant.NewString(""),
+				variant.NewString("hé"),
+			})),
+		},
+		{
+			Name: "Stmt_String_Substr_Negative",
+			Input: `
+				s = substr("héllo", 1, -1)
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_String_Index_OutOfRange",
+			Input: `
+				s = "héllo"[5]
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Object_SelectorCache",
+			Input: `
+				get = |o| => o.a.b
+				obj = {"a": {"b": 1}}
+				vals = []
+				for i in range(3) {
+					vals = vals + [get(obj)]
+					obj.a.b = i + 10
 				}
-				s = s + v
-			}
+				inner = obj.a
+				obj.a = {"b": 20}
+				s = [vals, get(obj), get({"a": {"b": 30}}), inner.b]
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(12)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(10), variant.Int(11)}),
+				variant.Int(20), variant.Int(30), variant.Int(12),
+			})),
 		},
 		{
-			Name: "Stmt_ForNested_Continue",
+			Name: "Stmt_Object_Grow",
 			Input: `
-			s = 0
-			for v in [1, 2, 3] {
-				for v in [1, 2] {
-					if v % 2 != 0 {
-						continue
+				obj = {"b": 1, "a": 2}
+				small = str(obj)
+				for i in range(12) {
+					obj[i] = i * 2
+				}
+				obj.a = 3
+				s = [small, len(obj), obj[0], obj[11], obj.a, obj.b, at(obj, 12)]
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("{a: 2, b: 1}"), variant.Int(14), variant.Int(0), variant.Int(22),
+				variant.Int(3), variant.Int(1), variant.NewNone(),
+			})),
+		},
+		{
+			Name: "Stmt_Object_OperatorOverloading",
+			Input: `
+				vec = none
+				vec = |x, y| => {
+					return {
+						"x": x,
+						"y": y,
+						"__add": |a, b| => vec(a.x + b.x, a.y + b.y),
+						"__mul": |a, k| => vec(a.x * k, a.y * k),
+						"__rmul": |a, k| => vec(a.x * k, a.y * k),
+						"__eq": |a, b| => a.x == b.x and a.y == b.y,
+						"__lt": |a, b| => a.x * a.x + a.y * a.y < b.x * b.x + b.y * b.y,
+						"__index": |a, i| => [a.x, a.y][i],
+						"__call": |a, k| => a.x * k + a.y,
 					}
-
-					s = s + v
 				}
-				s = s + v
-			}
+
+				v = 2 * (vec(1, 2) + vec(3, 4)) * 1
+				s = [v.x, v.y, v[1], v(10), v == vec(8, 12), v != vec(8, 12), vec(1, 1) < v, v > vec(1, 1)]
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(12)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(8),
+				variant.Int(12),
+				variant.Int(12),
+				variant.Int(92),
+				variant.True(),
+				variant.False(),
+				variant.True(),
+				variant.True(),
+			})),
+		},
+		{
+			Name: "Stmt_Object_OperatorOverloading_NotDefined",
+			Input: `
+				v = {"__add": |a, b| => 1}
+				s = v - v
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Func_Recursion_NotAllowed",
+			Name: "Stmt_Bytes_Manipulation",
 			Input: `
-				b = (|| => b())()
+				using bytes
+
+				b = bytes.from_string("GET /") + bytes.from_hex("0d0a")
+				s = bytes.to_string(bytes.slice(b, 0, 3)) + ":" + str(bytes.index_of(b, bytes.from_string("/")))
+				s = s + ":" + str(bytes.index_of(b, 10)) + ":" + bytes.to_hex(bytes.slice(b, -2)) + ":" + str(b[-1])
+				s = s + ":" + bytes.to_string(bytes.from_array([233]), "latin1") + ":" + str(len(b))
 			`,
-			IsCompileError: true,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("GET:4:6:0d0a:10:é:7")),
 		},
 		{
-			Name: "Stmt_Using",
+			Name: "Stmt_Bytes_PackUnpack",
 			Input: `
-				using iter
-				s = iter.range(100).count()
+				using bytes
+
+				s = [
+					bytes.to_hex(bytes.pack(258, 2)),
+					bytes.to_hex(bytes.pack(258, 4, "little")),
+					bytes.to_hex(bytes.pack(-2, 2)),
+					bytes.unpack(bytes.from_hex("0102")),
+					bytes.unpack(bytes.from_hex("0201"), "little"),
+					bytes.unpack(bytes.from_hex("fffe"), "big", true),
+					bytes.unpack(bytes.from_hex("fffe")),
+				]
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.NewString("0102"),
+				variant.NewString("02010000"),
+				variant.NewString("fffe"),
+				variant.Int(258),
+				variant.Int(258),
+				variant.Int(-2),
+				variant.Int(65534),
+			})),
+		},
+		{
+			Name: "Stmt_Bytes_Pack_Overflow",
+			Input: `
+				using bytes
+
+				bytes.pack(256, 1)
+			`,
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Using_Alias",
+			Name: "Stmt_Bytes_ToString_InvalidUTF8",
 			Input: `
-				using iter as foo
-				s = foo.range(100).count()
+				using bytes
+
+				bytes.to_string(bytes.from_hex("ff"))
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Using_Nested_Block",
+			Name: "Stmt_Toml_Decode",
 			Input: `
-				s = 0
-				block {
-					using iter
-					s = iter.range(100).count()
-				}
+				using toml
+
+				cfg = toml.decode("
+					# service config
+					title = \"demo\"
+					ports = [8000, 8_001]
+
+					[server]
+					host = 'localhost'
+					timeout = 1.5
+					tls.enabled = true
+
+					[[users]]
+					name = 'a'
+
+					[[users]]
+					name = 'b'
+				")
+				s = cfg.title + ":" + str(cfg.ports[1]) + ":" + cfg.server.host + ":" + str(cfg.server.timeout)
+				s = s + ":" + str(cfg.server.tls.enabled) + ":" + cfg.users[0].name + cfg.users[1].name
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("demo:8001:localhost:1.5:true:ab")),
 		},
 		{
-			Name: "Stmt_Using_Nested_Func",
+			Name: "Stmt_Toml_Encode",
 			Input: `
-				s = 0
-				(|| => {
-					using iter
-					s = iter.range(100).count()
-				})()
+				using toml
+
+				s = toml.encode({
+					"name": "demo",
+					"tags": ["a", "b"],
+					"db": {"port": 5432, "opts": {"ssl": false}},
+					"users": [{"id": 1}, {"id": 2}],
+				})
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString(`name = "demo"
+tags = ["a", "b"]
+
+[db]
+port = 5432
+
+[db.opts]
+ssl = false
+
+[[users]]
+id = 1
+
+[[users]]
+id = 2
+`)),
 		},
 		{
-			Name: "Stmt_Using_Nested_If",
+			Name: "Stmt_Toml_RoundTrip",
 			Input: `
-				s = 0
-				if s == 0 {
-					using iter
-					s = iter.range(100).count()
-				}
+				using toml
+
+				obj = {"a b": "x\"y", "n": -0.25, "nested": {"list": [[1, 2], {"k": "v"}]}}
+				s = toml.decode(toml.encode(obj)) == obj
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewBool(true)),
 		},
 		{
-			Name: "Stmt_Using_Nested_IfElseIf",
+			Name: "Stmt_Toml_Datetime",
 			Input: `
-				s = 0
-				if s == 1 {
-					s = -1
-				} else if s == 0 {
-					using iter
-					s = iter.range(100).count()
-				}
+				using toml
+
+				cfg = toml.decode("d = 1979-05-27\nn = nan")
+				s = cfg.d == toml.datetime("1979-05-27") and str(cfg.d) == "1979-05-27" and is_nan(cfg.n)
+				s = s and toml.encode(cfg) == "d = 1979-05-27\nn = nan\n"
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewBool(true)),
 		},
 		{
-			Name: "Stmt_Using_Nested_IfElseIfElse",
+			Name: "Stmt_Toml_Datetime_Invalid",
 			Input: `
-				s = 0
-				if s == 1 {
-					s = -1
-				} else if s == -1 {
-					s = -2
-				} else {
-					using iter
-					s = iter.range(100).count()
-				}
+				using toml
+
+				toml.datetime("1979-02-30")
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Using_Nested_For",
+			Name: "Stmt_Toml_Decode_DuplicateKey",
 			Input: `
-				s = 0
-				for el in [1, 2, 3] {
-					using iter
-					s = iter.range(100).count()
-					break
-				}
+				using toml
+
+				toml.decode("a = 1\na = 2")
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			IsRuntimeError: true,
 		},
 		{
-			Name: "Stmt_Using_Nested_While",
+			Name: "Stmt_Toml_Encode_None",
 			Input: `
-				s = 0
-				while s == 0 {
-					using iter
-					s = iter.range(100).count()
+				using toml
+
+				toml.encode({"a": none})
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Archive_RoundTrip",
+			Input: `
+				using archive
+				using bytes
+
+				entries = [{"name": "dir/"}, {"name": "dir/a.txt", "data": "hello"}, {"name": "b.bin", "data": bytes.from_hex("00ff")}]
+				s = ""
+				for read in [|| => archive.read_zip(archive.zip(entries)), || => archive.read_tar(archive.tar(entries))] {
+					for e in read() {
+						s = s + e.name + "=" + bytes.to_hex(e.data) + ";"
+					}
 				}
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("dir/=;dir/a.txt=68656c6c6f;b.bin=00ff;dir/=;dir/a.txt=68656c6c6f;b.bin=00ff;")),
 		},
 		{
-			Name: "Stmt_Using_Nested_FoundInternalScope",
+			Name: "Stmt_Archive_DirWithData",
 			Input: `
-				using iter
+				using archive
 
-				s = 0
-				block {
-					s = iter.range(100).count()
+				archive.tar([{"name": "dir/", "data": "x"}])
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Compress_RoundTrip",
+			Input: `
+				using compress
+				using bytes
+
+				s = bytes.to_string(compress.gzip_decompress(compress.gzip_compress("hello")))
+				s = s + bytes.to_string(compress.zlib_decompress(compress.zlib_compress(bytes.from_string(" world"))))
+			`,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewString("hello world")),
+		},
+		{
+			Name: "Stmt_Compress_Corrupted",
+			Input: `
+				using compress
+
+				compress.gzip_decompress("not gzip")
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Async_Closure_LoopVar",
+			Input: `
+			ps = []
+			for i in range(3) {
+				f = async || => {
+					await (async || => 0)()
+					return i * 10
 				}
+				ps = ps + [f()]
+			}
+			s = [await ps[2], await ps[0], await ps[1]]
 			`,
-			ExpectedVar: expectGlobalVarOf("s", variant.Int(100)),
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(20), variant.Int(0), variant.Int(10),
+			})),
 		},
 		{
-			Name: "Stmt_Using_Nested_NotFoundOutScope",
+			Name: "Stmt_Async_Delay_Locals",
 			Input: `
-				s = 0
-				block {
-					using iter
-					s = iter.range(100).count()
+			work = async |n| => {
+				x = n * 10
+				y = 0
+				for i in range(2) {
+					y = x + i
+					await delay(0.001 * n)
 				}
-
-				iter.range(100)
+				return y
+			}
+			a = work(2)
+			b = work(1)
+			s = [await a, await b, await delay(0, "v")]
 			`,
-			IsCompileError: true,
+			ExpectedVar: expectGlobalVarOf("s", variant.NewArray([]variant.Iface{
+				variant.Int(21), variant.Int(11), variant.NewString("v"),
+			})),
+		},
+		{
+			Name:           "Stmt_Async_Delay_Negative",
+			Input:          `delay(-1)`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Async_Rejected",
+			Input: `
+				fail = async |x| => 1 % x
+				p = fail(0)
+				await p
+			`,
+			IsRuntimeError: true,
+		},
+		{
+			Name: "Stmt_Async_Await",
+			Input: `
+				inc = async |x| => x + 1
+				twice = async |x| => await inc(await inc(x))
+				y = await twice(1)
+			`,
+			ExpectedVar: expectGlobalVarOf("y", variant.Int(3)),
+		},
+		{
+			Name: "Stmt_Await_NotPromise",
+			Input: `
+				x = 1
+				y = await x
+			`,
+			IsRuntimeError: true,
 		},
 	}
 
@@ -1679,6 +3749,61 @@ func TestStmtCode(t *testing.T) {
 	}
 }
 
+func TestStmtCode_UnreachableWarnings(t *testing.T) {
+	parser, err := participle.Build[ProgramFile](
+		participle.Lexer(lexer.Definition()),
+		participle.Elide("Comment", "Whitespace"),
+	)
+	require.NoError(t, err)
+
+	ast, err := parser.ParseString("", `
+		f = |x| => {
+			return x
+			x = x + 1
+		}
+
+		a = f(1)
+		if 1 > 2 {
+			a = 2
+		}
+
+		for i in [1, 2] {
+			break
+			a = i
+		}
+
+		g = || => {
+			loop {
+				if a > 0 {
+					break
+				}
+			}
+			loop {
+				return 1
+			}
+			a = 3
+		}
+	`)
+	require.NoError(t, err)
+
+	var warns []Warning
+	vars := NewDebugVars()
+	invoker, err := (&Program{
+		vars: vars,
+		warn: func(w Warning) { warns = append(warns, w) },
+	}).CodeGen(ast)
+	require.NoError(t, err)
+	require.NoError(t, invoker.Invoke())
+
+	require.Len(t, warns, 4)
+	assert.Equal(t, 4, warns[0].Pos.Line)
+	assert.Equal(t, 8, warns[1].Pos.Line)
+	assert.Equal(t, 14, warns[2].Pos.Line)
+	assert.Equal(t, 26, warns[3].Pos.Line)
+
+	expectGlobalVarOf("a", variant.Int(1))(t.Name(), assert.New(t), vars)
+}
+
 func BenchmarkProgram(b *testing.B) {
 	parser, err := participle.Build[ProgramFile](
 		participle.Lexer(lexer.Definition()),
@@ -1707,3 +3832,32 @@ func BenchmarkProgram(b *testing.B) {
 		program.Invoke()
 	}
 }
+
+func BenchmarkProgram_Objects(b *testing.B) {
+	parser, err := participle.Build[ProgramFile](
+		participle.Lexer(lexer.Definition()),
+		participle.Elide("Comment", "Whitespace"),
+	)
+	require.NoError(b, err)
+
+	ast, err := parser.ParseString("", `
+		obj = {"foo": 1, "bar": {"baz": 2}, 3: "qux"}
+		sum = 0
+		for i in [1, 2, 3, 4, 5, 6, 7, 8] {
+			sum = sum + obj.foo + obj.bar.baz + obj["bar", "baz"]
+			s = obj[3]
+		}
+	`)
+	require.NoError(b, err)
+
+	vars := NewDebugVars()
+	program, err := (&Program{
+		vars: vars,
+	}).CodeGen(ast)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		program.Invoke()
+	}
+}
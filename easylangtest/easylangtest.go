@@ -0,0 +1,175 @@
+// Package easylangtest runs script tests and golden tests of easylang scripts
+// from Go tests. It is separate from easylang, so hosts embedding the
+// language do not link the testing package.
+package easylangtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hikitani/easylang"
+	eltesting "github.com/hikitani/easylang/packages/testing"
+	"github.com/hikitani/easylang/variant"
+)
+
+// RunScriptTests runs every *_test.ela file found in fsys as a subtest of t.
+// Each file is run in its own Machine with the testing package registered,
+// and every test() call of the script is reported as a nested subtest.
+func RunScriptTests(t *testing.T, fsys fs.FS) {
+	t.Helper()
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(p, "_test.ela") {
+			return nil
+		}
+
+		t.Run(p, func(t *testing.T) {
+			runScriptTest(t, fsys, p)
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk test files: %s", err)
+	}
+}
+
+func runScriptTest(t *testing.T, fsys fs.FS, p string) {
+	rec := &eltesting.Recorder{}
+	vm := easylang.New()
+	vm.SetFS(fsys)
+	if err := vm.Register(eltesting.NewPackage(rec)); err != nil {
+		t.Fatalf("register testing package: %s", err)
+	}
+
+	f, err := fsys.Open(p)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer f.Close()
+
+	stmt, err := vm.Compile(path.Base(p), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stmt.Invoke(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range rec.Results {
+		t.Run(res.Name, func(t *testing.T) {
+			if res.Err != nil {
+				t.Error(res.Err)
+			}
+		})
+	}
+}
+
+// RunGoldenTests runs every .ela script of dir, except *_test.ela ones, as a
+// subtest of t. What the script printed, its published variables and its
+// error are compared with the .golden file next to the script. With update
+// the golden files are written instead.
+func RunGoldenTests(t *testing.T, dir string, update bool) {
+	t.Helper()
+
+	fsys := os.DirFS(dir)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(p, ".ela") || strings.HasSuffix(p, "_test.ela") {
+			return nil
+		}
+
+		t.Run(p, func(t *testing.T) {
+			got := runGolden(fsys, p)
+			golden := filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(p, ".ela")+".golden"))
+			if update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatalf("update golden file: %s", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file: %s", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("result differs from %s\n--- got ---\n%s--- want ---\n%s", golden, got, want)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk golden scripts: %s", err)
+	}
+}
+
+// runGolden runs the script returning its output followed by sections of
+// published variables and the error, if any.
+func runGolden(fsys fs.FS, p string) []byte {
+	var out bytes.Buffer
+	vm := easylang.New()
+	vm.SetFS(fsys)
+	vm.SetOutput(&out)
+
+	src, err := fs.ReadFile(fsys, p)
+	if err == nil {
+		var stmt easylang.StmtInvoker
+		stmt, err = vm.Compile(path.Base(p), bytes.NewReader(src))
+		if err == nil {
+			err = stmt.Invoke()
+		}
+	}
+
+	if published := vm.Published(); published.Len() > 0 {
+		out.WriteString("-- published --\n")
+		for _, key := range published.SortedKeys() {
+			v, _ := published.Get(key)
+			fmt.Fprintf(&out, "%s = %s\n", key, goldenString(v))
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(&out, "-- error --\n%s\n", err)
+	}
+
+	return out.Bytes()
+}
+
+// goldenString formats the value like String with object keys sorted, so
+// the result does not depend on the order of the object.
+func goldenString(v variant.Iface) string {
+	switch v := v.(type) {
+	case *variant.Array:
+		elems := make([]string, 0, v.Len())
+		for _, el := range v.Elems() {
+			elems = append(elems, goldenString(el))
+		}
+
+		return "[" + strings.Join(elems, ", ") + "]"
+	case *variant.Object:
+		items := make([]string, 0, v.Len())
+		for _, key := range v.SortedKeys() {
+			val, _ := v.Get(key)
+			items = append(items, goldenString(key)+": "+goldenString(val))
+		}
+
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+
+	return v.String()
+}
@@ -0,0 +1,35 @@
+package easylangtest
+
+import (
+	"flag"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunScriptTests(t *testing.T) {
+	RunScriptTests(t, fstest.MapFS{
+		"lib.ela": &fstest.MapFile{
+			Data: []byte(`pub double = |x| => x * 2`),
+		},
+		"math/double_test.ela": &fstest.MapFile{
+			Data: []byte(`
+				using testing
+
+				lib = import "lib.ela"
+				testing.test("double", || => {
+					testing.assert_eq(lib.double(2), 4)
+					testing.assert_true(lib.double(0) == 0, "zero")
+				})
+			`),
+		},
+		"helper.ela": &fstest.MapFile{
+			Data: []byte(`testing.fail()`),
+		},
+	})
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files of testdata")
+
+func TestGolden(t *testing.T) {
+	RunGoldenTests(t, "../testdata", *updateGolden)
+}
@@ -0,0 +1,238 @@
+package easylang
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/hikitani/easylang/variant"
+)
+
+// Sentinels matching errors of the kind with errors.Is, e.g.
+// errors.Is(err, ErrRuntime) for any *RuntimeError.
+var (
+	ErrParse   = errors.New("parse error")
+	ErrCompile = errors.New("compile error")
+	ErrRuntime = errors.New("runtime error")
+	ErrImport  = errors.New("import error")
+	ErrLimit   = errors.New("limit exceeded")
+)
+
+// ParseError is returned when the source is not valid syntax.
+type ParseError struct {
+	Pos lexer.Position
+	// Msg is the message of the parser without the position.
+	Msg string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parse: " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+func newParseError(err error) *ParseError {
+	perr := &ParseError{Msg: err.Error(), Err: err}
+	var pe participle.Error
+	if errors.As(err, &pe) {
+		perr.Pos, perr.Msg = pe.Position(), pe.Message()
+	}
+
+	return perr
+}
+
+// CompileError is returned when the program is syntactically valid but cannot
+// be compiled, e.g. uses an undefined variable. Pos is the position of the
+// node which cannot be compiled.
+type CompileError struct {
+	Pos lexer.Position
+	Err error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("code gen: %s: %s", e.Pos, e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CompileError) Is(target error) bool {
+	return target == ErrCompile
+}
+
+// RuntimeError is returned when running the program fails. Pos is the
+// position of the innermost failing node, e.g. the call of the host function
+// returning the error or the statement of the function body.
+type RuntimeError struct {
+	Pos lexer.Position
+	Err error
+	// Stack is the Go stack of the recovered panic, see variant.PanicError.
+	Stack []byte
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("runtime: %s: %s", e.Pos, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) Is(target error) bool {
+	return target == ErrRuntime
+}
+
+// ImportError is returned when the imported file cannot be read, compiled or
+// run. Err is the cause, e.g. *ParseError of the imported file.
+type ImportError struct {
+	Path string
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("cannot import '%s': %s", e.Path, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ImportError) Is(target error) bool {
+	return target == ErrImport
+}
+
+// LimitError is returned when the program exceeds the limit set by the host,
+// e.g. the deadline of the call.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. "timeout".
+	Limit string
+	Err   error
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimit
+}
+
+// RecursionError is returned when calls of script functions nest deeper
+// than the limit of the machine, see Machine.SetMaxCallDepth.
+type RecursionError struct {
+	Depth int
+}
+
+func (e *RecursionError) Error() string {
+	return fmt.Sprintf("maximum call depth %d exceeded", e.Depth)
+}
+
+func (e *RecursionError) Is(target error) bool {
+	return target == ErrLimit
+}
+
+// compileError wraps err with the position unless it is already wrapped by
+// the nested node or program, e.g. of the imported file.
+func compileError(pos lexer.Position, err error) error {
+	var cerr *CompileError
+	if errors.As(err, &cerr) {
+		return err
+	}
+
+	return &CompileError{Pos: pos, Err: err}
+}
+
+// compileErrorf is the error of the node at pos which cannot be compiled.
+func compileErrorf(pos lexer.Position, format string, args ...any) error {
+	return &CompileError{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+// posError marks the error with the position of the node where it happened
+// while the program runs. runtimeError reports the position, so the message
+// stays the one of err.
+type posError struct {
+	pos lexer.Position
+	err error
+}
+
+func (e *posError) Error() string {
+	return e.err.Error()
+}
+
+func (e *posError) Unwrap() error {
+	return e.err
+}
+
+// isControl reports whether err passes control to the enclosing statement
+// instead of failing, e.g. return and break.
+func isControl(err error) bool {
+	return err == ErrStmtFinished || err == ErrLoopBreak || err == ErrLoopContinue ||
+		errors.Is(err, ErrStmtFinished) || errors.Is(err, ErrLoopBreak) || errors.Is(err, ErrLoopContinue)
+}
+
+// errorAt marks err with the position of the failing node. The innermost
+// node wins, errors marked by nested nodes and programs keep their position.
+func errorAt(pos lexer.Position, err error) error {
+	if isControl(err) {
+		return err
+	}
+
+	var perr *posError
+	var rerr *RuntimeError
+	if errors.As(err, &perr) || errors.As(err, &rerr) {
+		return err
+	}
+
+	return &posError{pos: pos, err: err}
+}
+
+// runtimeError wraps err like compileError, the position is of the failing
+// node marked by errorAt if any. Control flow errors are not wrapped.
+func runtimeError(pos lexer.Position, err error) error {
+	if isControl(err) {
+		return err
+	}
+
+	var rerr *RuntimeError
+	if errors.As(err, &rerr) {
+		return err
+	}
+
+	var at *posError
+	if errors.As(err, &at) {
+		pos = at.pos
+	}
+
+	var timeout *variant.TimeoutError
+	var lerr *LimitError
+	if errors.As(err, &timeout) && !errors.As(err, &lerr) {
+		err = &LimitError{Limit: "timeout", Err: err}
+	}
+
+	rerr = &RuntimeError{Pos: pos, Err: err}
+	var perr *variant.PanicError
+	if errors.As(err, &perr) {
+		rerr.Stack = perr.Stack
+	}
+
+	return rerr
+}
+
+// safeInvoke runs the statement returning its panic as *variant.PanicError.
+func safeInvoke(stmt StmtInvoker) (err error) {
+	defer variant.Recover(&err)
+	return stmt.Invoke()
+}
@@ -0,0 +1,82 @@
+package easylang
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// EvalOptions configures Eval.
+type EvalOptions struct {
+	// Timeout stops the script running longer with *LimitError. Zero means
+	// no limit.
+	Timeout time.Duration
+	// MaxOutput stops the script printing more bytes with *LimitError. Zero
+	// means no limit.
+	MaxOutput int
+	// FS is used for imports, by default the machine has no file system.
+	FS fs.FS
+}
+
+// Eval compiles and runs the source on the new machine and returns what the
+// script printed, e.g. for playgrounds. The output is returned on errors too.
+func Eval(source string, opts EvalOptions) (string, error) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+	if opts.MaxOutput > 0 {
+		vm.SetOutput(&limitWriter{w: &out, max: opts.MaxOutput})
+	}
+	vm.SetFS(emptyFS{})
+	if opts.FS != nil {
+		vm.SetFS(opts.FS)
+	}
+	// the machine is dropped, so generators left by the script are closed
+	defer vm.gens.closeAll()
+
+	program, err := vm.Compile("main.ela", strings.NewReader(source))
+	if err != nil {
+		return out.String(), err
+	}
+
+	if opts.Timeout == 0 {
+		err = program.Invoke()
+		return out.String(), err
+	}
+
+	run := variant.NewFunc(nil, func(variant.Args) (variant.Iface, error) {
+		return variant.NewNone(), program.Invoke()
+	}).WithInterrupt(vm.interrupt)
+
+	_, err = run.CallTimeout(opts.Timeout, nil)
+	return out.String(), err
+}
+
+// emptyFS is the file system without files.
+type emptyFS struct{}
+
+func (emptyFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// limitWriter writes up to max bytes, the rest is dropped with *LimitError.
+type limitWriter struct {
+	w       io.Writer
+	max     int
+	written int
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.written+len(p) <= lw.max {
+		lw.written += len(p)
+		return lw.w.Write(p)
+	}
+
+	n, _ := lw.w.Write(p[:lw.max-lw.written])
+	lw.written = lw.max
+	return n, &LimitError{Limit: "output", Err: fmt.Errorf("output exceeds %d bytes", lw.max)}
+}
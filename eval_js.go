@@ -0,0 +1,31 @@
+//go:build js && wasm
+
+package easylang
+
+import (
+	"syscall/js"
+	"time"
+)
+
+// EvalFunc returns the JavaScript function eval(source[, timeoutMs]) running
+// Eval. It returns the object {output, error}, error is null on success.
+func EvalFunc() js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) == 0 || args[0].Type() != js.TypeString {
+			return map[string]any{"output": "", "error": "eval() first argument must be string"}
+		}
+
+		var opts EvalOptions
+		if len(args) > 1 && args[1].Type() == js.TypeNumber {
+			opts.Timeout = time.Duration(args[1].Float() * float64(time.Millisecond))
+		}
+
+		output, err := Eval(args[0].String(), opts)
+		res := map[string]any{"output": output, "error": nil}
+		if err != nil {
+			res["error"] = err.Error()
+		}
+
+		return res
+	})
+}
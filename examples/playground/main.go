@@ -0,0 +1,43 @@
+//go:build js && wasm
+
+// Playground runs easylang scripts in the browser. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o main.wasm ./examples/playground
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" examples/playground
+//
+// and serve the directory with index.html. The page calls RunScript(source),
+// which returns {output, error} of the script run with limits.
+package main
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/hikitani/easylang"
+)
+
+// limits keep the page responsive whatever the script does.
+var limits = easylang.EvalOptions{
+	Timeout:   2 * time.Second,
+	MaxOutput: 64 << 10,
+}
+
+func runScript(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return map[string]any{"output": "", "error": "RunScript() takes the source string"}
+	}
+
+	output, err := easylang.Eval(args[0].String(), limits)
+	res := map[string]any{"output": output, "error": nil}
+	if err != nil {
+		res["error"] = err.Error()
+	}
+
+	return res
+}
+
+func main() {
+	js.Global().Set("RunScript", js.FuncOf(runScript))
+	js.Global().Set("easylangEval", easylang.EvalFunc())
+	select {}
+}
@@ -0,0 +1,11 @@
+//go:build js
+
+package easylang
+
+import "io/fs"
+
+// defaultFS is empty in browsers, which have no file system. Imports and
+// the glob package need the host to call SetFS.
+func defaultFS() fs.FS {
+	return emptyFS{}
+}
@@ -0,0 +1,14 @@
+//go:build !js
+
+package easylang
+
+import (
+	"io/fs"
+	"os"
+)
+
+// defaultFS is the working directory, including WASI where it is the
+// preopened directory.
+func defaultFS() fs.FS {
+	return os.DirFS("./")
+}
@@ -0,0 +1,310 @@
+package easylang
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/hikitani/easylang/packages/iter"
+	"github.com/hikitani/easylang/variant"
+)
+
+// generator is shared by all yield statements of a single function. When at
+// least one yield statement is found, calling the function returns a lazy
+// iterator instead of running its body.
+type generator struct {
+	used       bool
+	current    *coroutine
+	coroutines *coroutines
+}
+
+// errGeneratorClosed unwinds the body of the generator closed while it waits
+// in yield.
+var errGeneratorClosed = errors.New("generator closed")
+
+type coroutineResult struct {
+	v   variant.Iface
+	err error
+}
+
+// coroutine runs one call of a generator function in its own goroutine.
+// Control is handed over explicitly, so only one side runs at a time.
+type coroutine struct {
+	gen      *generator
+	body     StmtInvoker
+	scopes   []*VarScope
+	frames   []*frame
+	started  bool
+	finished bool
+	closed   bool
+	resume   chan struct{}
+	out      chan coroutineResult
+}
+
+func (co *coroutine) run() {
+	<-co.resume
+
+	err := safeInvoke(co.body)
+	if err != nil && !errors.Is(err, ErrStmtFinished) && !errors.Is(err, errGeneratorClosed) {
+		co.out <- coroutineResult{err: err}
+		return
+	}
+
+	co.out <- coroutineResult{err: iter.ErrStopIteration}
+}
+
+// switchTo runs the body until it yields or finishes. The body sees its own
+// frames meanwhile.
+func (co *coroutine) switchTo() coroutineResult {
+	prev := co.gen.current
+	co.gen.current = co
+	frames := activate(co.scopes, co.frames)
+	co.resume <- struct{}{}
+	res := <-co.out
+	co.frames = activate(co.scopes, frames)
+	co.gen.current = prev
+	return res
+}
+
+func (co *coroutine) next(args variant.Args) (variant.Iface, error) {
+	if len(args) != 0 {
+		return nil, errors.New("next() takes no arguments")
+	}
+
+	if co.finished {
+		return nil, iter.ErrStopIteration
+	}
+
+	cs := co.gen.coroutines
+	cs.closeAbandoned()
+	if !co.started {
+		co.started = true
+		cs.track(co)
+		go co.run()
+	}
+
+	res := co.switchTo()
+	if res.err != nil {
+		co.finished = true
+		cs.forget(co)
+		return nil, res.err
+	}
+
+	return res.v, nil
+}
+
+// close finishes the iteration. The body waiting in yield is unwound, so its
+// goroutine exits.
+func (co *coroutine) close() {
+	if co.finished {
+		return
+	}
+
+	co.finished = true
+	if co.started {
+		co.closed = true
+		co.switchTo()
+	}
+}
+
+// yield hands v over to the caller of next and waits until the value is
+// requested again. It fails when the generator is closed instead.
+func (co *coroutine) yield(v variant.Iface) error {
+	co.out <- coroutineResult{v: v}
+	<-co.resume
+	if co.closed {
+		return errGeneratorClosed
+	}
+
+	return nil
+}
+
+// coroutines keeps started generators of the machine to close the ones
+// which are not finished by the script. Closing runs the body to unwind it,
+// so it must not overlap the script. Finalizers of dropped iterators only
+// queue the generators while the machine runs, the queue is closed on the
+// next call of a generator or when the run ends. If the machine is idle,
+// the generator is closed right away. Generators are closed without holding
+// mu, since the unwound body may close generators it iterates over.
+type coroutines struct {
+	mu        sync.Mutex
+	running   int
+	live      map[*coroutine]struct{}
+	abandoned []*coroutine
+}
+
+func (cs *coroutines) enter() {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.running++
+}
+
+func (cs *coroutines) leave() {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	cs.running--
+	var abandoned []*coroutine
+	if cs.running == 0 {
+		abandoned = cs.takeAbandoned()
+	}
+	cs.mu.Unlock()
+
+	for _, co := range abandoned {
+		co.close()
+	}
+}
+
+// takeAbandoned removes queued generators from the tracked ones and returns
+// them to be closed. It is called with mu held.
+func (cs *coroutines) takeAbandoned() []*coroutine {
+	abandoned := cs.abandoned
+	cs.abandoned = nil
+	for _, co := range abandoned {
+		delete(cs.live, co)
+	}
+
+	return abandoned
+}
+
+func (cs *coroutines) track(co *coroutine) {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.live == nil {
+		cs.live = map[*coroutine]struct{}{}
+	}
+	cs.live[co] = struct{}{}
+}
+
+func (cs *coroutines) forget(co *coroutine) {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.live, co)
+}
+
+func (cs *coroutines) abandon(co *coroutine) {
+	cs.mu.Lock()
+	if _, ok := cs.live[co]; !ok {
+		cs.mu.Unlock()
+		return
+	}
+
+	if cs.running > 0 {
+		cs.abandoned = append(cs.abandoned, co)
+		cs.mu.Unlock()
+		return
+	}
+
+	delete(cs.live, co)
+	cs.mu.Unlock()
+	co.close()
+}
+
+// closeAbandoned closes queued generators. It is called by the script, so
+// the generators are closed in turn with it.
+func (cs *coroutines) closeAbandoned() {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	abandoned := cs.takeAbandoned()
+	cs.mu.Unlock()
+
+	for _, co := range abandoned {
+		co.close()
+	}
+}
+
+// closeAll closes all unfinished generators, e.g. when the machine is no
+// longer used. Iterators kept in variables of the script refer to their
+// generators from the goroutines, so they are never finalized.
+func (cs *coroutines) closeAll() {
+	cs.mu.Lock()
+	live := cs.live
+	cs.live = nil
+	cs.abandoned = nil
+	cs.mu.Unlock()
+
+	for co := range live {
+		co.close()
+	}
+}
+
+// newIterator returns the iterator for a single call of the generator
+// function. The body is not run until the first value is requested, then it
+// runs with the frames of the call.
+func (gen *generator) newIterator(body StmtInvoker, scopes []*VarScope, frames []*frame) *variant.Object {
+	co := &coroutine{
+		gen:    gen,
+		body:   body,
+		scopes: scopes,
+		frames: frames,
+		resume: make(chan struct{}),
+		out:    make(chan coroutineResult),
+	}
+
+	gen.coroutines.closeAbandoned()
+	// the goroutine of the body refers to co, so the finalizer is set on
+	// the handle referred only by the iterator
+	h := &struct{ co *coroutine }{co}
+	if cs := gen.coroutines; cs != nil {
+		runtime.SetFinalizer(h, func(h *struct{ co *coroutine }) {
+			cs.abandon(h.co)
+		})
+	}
+
+	next := variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+		return h.co.next(args)
+	})
+	closeFn := variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 0 {
+			return nil, errors.New("close() takes no arguments")
+		}
+
+		gen.coroutines.forget(h.co)
+		h.co.close()
+		return variant.NewNone(), nil
+	})
+	return iter.NewClosableIterator(next, closeFn)
+}
+
+type YieldStmtCodeGen struct {
+	exprGen *ExprCodeGen
+}
+
+func (c *YieldStmtCodeGen) CodeGen(node *YieldStmt) (StmtInvoker, error) {
+	gen := c.exprGen.gen
+	if gen == nil {
+		return nil, compileErrorf(node.Pos, "yield statement cannot be used outside of a function")
+	}
+	gen.used = true
+
+	eval, err := c.exprGen.CodeGen(&node.X)
+	if err != nil {
+		return nil, err
+	}
+
+	return invoker(func() error {
+		v, err := eval.Eval()
+		if err != nil {
+			return err
+		}
+
+		return gen.current.yield(v)
+	}), nil
+}
@@ -3,6 +3,7 @@ package lexer
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 
 	"github.com/alecthomas/participle/v2/lexer"
@@ -19,18 +20,23 @@ var (
 	hexDigitsRe    = digitsRe("0(?:x|X)", "0-9a-fA-F")
 )
 
+var identRe = regexp.MustCompile(`^[a-zA-Z_](?:[a-zA-Z_]|[0-9])*$`)
+
 var lexdef = lexer.MustSimple([]lexer.SimpleRule{
 	{Name: "Whitespace", Pattern: `[ \t]+`},
 	{Name: "Comment", Pattern: `#[^\n]*\n?`},
 	{Name: "FuncSign", Pattern: "=>"},
 	{Name: "OpBinaryPrior1", Pattern: `==|!=|<=|>=`},
-	{Name: "OpBinaryPrior2", Pattern: `and|or|<|>`},
+	{Name: "OpBinaryPrior2", Pattern: `(?:and|or)\b|<|>`},
 	{Name: "OpBinaryArith", Pattern: `\+|-|\*|/|%`},
-	{Name: "OpUnary", Pattern: `-|not`},
-	{Name: "Number", Pattern: strings.Join([]string{"inf", binaryDigitsRe, octalDigitsRe, hexDigitsRe, digits10Re}, "|")},
+	{Name: "OpUnary", Pattern: `-|not\b`},
+	{Name: "Number", Pattern: strings.Join([]string{`inf\b`, binaryDigitsRe, octalDigitsRe, hexDigitsRe, digits10Re}, "|")},
+	{Name: "Heredoc", Pattern: `"""(?:\\(?s:.)|[^\\])*?"""`},
 	{Name: "String", Pattern: `"(?:\\.|[^"])*"`},
+	{Name: "Bytes", Pattern: `b"(?:\\.|[^"])*"`},
 	{Name: "Ident", Pattern: `[a-zA-Z_](?:[a-zA-Z_]|[0-9])*`},
 	{Name: "EOL", Pattern: `[\n\r]+`},
+	{Name: "Ellipsis", Pattern: `\.\.\.`},
 	{Name: "Period", Pattern: "."},
 	{Name: "Semicolon", Pattern: ","},
 	{Name: "LParen", Pattern: `\(`},
@@ -91,6 +97,11 @@ func IgnoreTokens() []string {
 	return []string{"Whitespace", "Comment"}
 }
 
+// IsIdent reports whether s can be used as a variable name.
+func IsIdent(s string) bool {
+	return identRe.MatchString(s) && !IsKeyword(s) && !IsConstValue(s) && !IsPredicateOp(s) && s != "not"
+}
+
 func IsConstValue(s string) bool {
 	switch s {
 	case ConstValueNone, ConstValueTrue, ConstValueFalse, ConstValueInf:
@@ -129,8 +140,8 @@ func IsPredicateOp(op string) bool {
 
 func IsKeyword(s string) bool {
 	switch s {
-	case "if", "else", "for", "in", "while", "using", "import",
-		"return", "break", "continue", "block", "pub":
+	case "if", "else", "for", "in", "while", "do", "loop", "using", "import",
+		"return", "break", "continue", "block", "pub", "let", "yield", "async", "await":
 		return true
 	}
 
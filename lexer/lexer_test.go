@@ -0,0 +1,44 @@
+package lexer
+
+import (
+	"testing"
+
+	plexer "github.com/alecthomas/participle/v2/lexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLex_KeywordPrefixes(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected []string
+	}{
+		{Input: "order", Expected: []string{"Ident"}},
+		{Input: "android", Expected: []string{"Ident"}},
+		{Input: "notes", Expected: []string{"Ident"}},
+		{Input: "info", Expected: []string{"Ident"}},
+		{Input: "inf", Expected: []string{"Number"}},
+		{Input: "a and b", Expected: []string{"Ident", "OpBinaryPrior2", "Ident"}},
+		{Input: "a or b", Expected: []string{"Ident", "OpBinaryPrior2", "Ident"}},
+		{Input: "not x", Expected: []string{"OpUnary", "Ident"}},
+		{Input: "log.info", Expected: []string{"Ident", "Period", "Ident"}},
+	}
+
+	symbols := plexer.SymbolsByRune(Definition())
+	for _, testCase := range testCases {
+		lex, err := LexString("", testCase.Input)
+		require.NoError(t, err, testCase.Input)
+
+		tokens, err := plexer.ConsumeAll(lex)
+		require.NoError(t, err, testCase.Input)
+
+		var types []string
+		for _, token := range tokens {
+			if token.Type != plexer.EOF && symbols[token.Type] != "Whitespace" {
+				types = append(types, symbols[token.Type])
+			}
+		}
+
+		assert.Equal(t, testCase.Expected, types, testCase.Input)
+	}
+}
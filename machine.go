@@ -1,13 +1,32 @@
 package easylang
 
 import (
+	crand "crypto/rand"
+	dbsql "database/sql"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math/rand"
 	"os"
+	"runtime"
+	"slices"
+	"sync"
 
 	"github.com/alecthomas/participle/v2"
 	"github.com/hikitani/easylang/lexer"
+	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/builtin"
+	"github.com/hikitani/easylang/packages/exec"
+	"github.com/hikitani/easylang/packages/glob"
+	"github.com/hikitani/easylang/packages/log"
+	"github.com/hikitani/easylang/packages/parallel"
 	"github.com/hikitani/easylang/packages/registry"
+	"github.com/hikitani/easylang/packages/sql"
+	"github.com/hikitani/easylang/packages/store"
+	"github.com/hikitani/easylang/packages/uuid"
+	"github.com/hikitani/easylang/variant"
 )
 
 var parser = participle.MustBuild[ProgramFile](
@@ -15,37 +34,521 @@ var parser = participle.MustBuild[ProgramFile](
 	participle.Elide(lexer.IgnoreTokens()...),
 )
 
+// Machine compiles and runs scripts. It is not safe for concurrent use:
+// compiling, running scripts and calling setters must not overlap. Use
+// Clone to get the machine per goroutine.
 type Machine struct {
-	vars     *Vars
-	parser   *participle.Parser[ProgramFile]
-	register *registry.Registry
+	vars      *Vars
+	parser    *participle.Parser[ProgramFile]
+	register  *registry.Registry
+	builtins  packages.Iface
+	io        builtin.IO
+	fsys      fs.FS
+	resolver  ImportResolver
+	modules   map[string]string
+	rand      *randSource
+	logger    *slog.Logger
+	calls     *callSite
+	depth     *callDepth
+	interrupt *variant.Interrupt
+	loop      *eventLoop
+	gens      *coroutines
+	policy    *PackagePolicy
+	audit     AuditHandler
+	workers   int
+	caps      map[Capability]struct{}
+	dbs       *sql.DBs
+	sqlLimits sql.Limits
+	store     store.Store
+	warn      WarnHandler
+	exact     bool
+	numeric   NumericPolicy
+	strict    bool
+	// packages are registered by the host and removed are names of
+	// unregistered ones, see Clone.
+	packages []packages.Iface
+	removed  map[string]struct{}
+	// capture receives the output instead of io.Stdout while Run runs.
+	capture io.Writer
+	configs map[string]any
+}
+
+// randSource is the source of random bytes shared by packages of the
+// machine and its clones.
+type randSource struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (s *randSource) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.r.Read(p)
+}
+
+// Register makes the package available for using statements.
+func (m *Machine) Register(pkg packages.Iface) error {
+	if err := m.register.Register(pkg); err != nil {
+		return err
+	}
+
+	m.packages = append(m.packages, pkg)
+	delete(m.removed, pkg.Name())
+	return nil
+}
+
+// Override registers the package replacing the one of the same name, e.g.
+// a package of the machine with the mock in tests. Other machines are not
+// affected. It must be called before Compile.
+func (m *Machine) Override(pkg packages.Iface) error {
+	if err := m.register.Override(pkg); err != nil {
+		return err
+	}
+
+	m.packages = slices.DeleteFunc(m.packages, func(p packages.Iface) bool {
+		return p.Name() == pkg.Name()
+	})
+	m.packages = append(m.packages, pkg)
+	delete(m.removed, pkg.Name())
+	return nil
+}
+
+// Unregister removes the package of the machine, e.g. to deny it in the
+// sandbox. It must be called before Compile.
+func (m *Machine) Unregister(name string) error {
+	if err := m.register.Remove(name); err != nil {
+		return err
+	}
+
+	m.packages = slices.DeleteFunc(m.packages, func(p packages.Iface) bool {
+		return p.Name() == name
+	})
+	if m.removed == nil {
+		m.removed = map[string]struct{}{}
+	}
+
+	m.removed[name] = struct{}{}
+	return nil
+}
+
+// LoadPackages registers packages of the provider, e.g. registry.Factories()
+// or pluginprovider.Plugins("ext/*.so").
+func (m *Machine) LoadPackages(p registry.PackageProvider) error {
+	pkgs, err := p.Packages()
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		if err := m.Register(pkg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetFS sets the file system used to resolve imports and searched by the
+// glob package.
+func (m *Machine) SetFS(fsys fs.FS) {
+	m.fsys = fsys
+}
+
+// SetImportResolver sets the resolver of imported files, nil restores
+// resolving by the file system of SetFS. It must be called before Compile.
+func (m *Machine) SetImportResolver(r ImportResolver) {
+	m.resolver = r
+}
+
+// Seed makes random values generated by packages deterministic.
+// By default the cryptographically secure source is used.
+func (m *Machine) Seed(seed int64) {
+	m.rand.mu.Lock()
+	defer m.rand.mu.Unlock()
+
+	m.rand.r = rand.New(rand.NewSource(seed))
+}
+
+// SetLogger sets the logger used by the log package. By default
+// slog.Default() is used, nil disables logging.
+func (m *Machine) SetLogger(logger *slog.Logger) {
+	m.logger = logger
+}
+
+// SetMaxWorkers limits the number of goroutines used by a single call of
+// the parallel package functions. By default it is GOMAXPROCS.
+func (m *Machine) SetMaxWorkers(n int) {
+	m.workers = n
+}
+
+// RegisterDB makes the database available to the sql package by name.
+func (m *Machine) RegisterDB(name string, db *dbsql.DB) {
+	m.dbs.Register(name, db)
+}
+
+// SetSQLLimits limits rows returned by queries and the duration of
+// statements run by the sql package. By default there are no limits.
+func (m *Machine) SetSQLLimits(limits sql.Limits) {
+	m.sqlLimits = limits
+}
+
+// SetStore sets the keyspace of the store package, e.g. backed by Redis, to
+// keep state between runs. By default the machine keeps it in memory.
+func (m *Machine) SetStore(s store.Store) {
+	m.store = s
+}
+
+// Configure sets the configuration passed to the package built on the first
+// using, see packages.Lazy. It must be called before Compile.
+func (m *Machine) Configure(pkg string, cfg any) {
+	if m.configs == nil {
+		m.configs = map[string]any{}
+	}
+
+	m.configs[pkg] = cfg
+}
+
+// Config returns the configuration of the package set by Configure.
+func (m *Machine) Config(pkg string) any {
+	return m.configs[pkg]
+}
+
+// SetOutput sets the writer used by print, println and printf.
+// It must be called before Compile.
+func (m *Machine) SetOutput(w io.Writer) {
+	m.io.Stdout = w
+	m.defineBuiltins()
+}
+
+// SetInput sets the reader used by input. By default reading input is
+// denied. It must be called before Compile.
+func (m *Machine) SetInput(r io.Reader) {
+	m.io.Stdin = r
+	m.defineBuiltins()
+}
+
+// WithPackagePolicy limits packages and builtins available to scripts.
+// It must be called before Compile.
+func (m *Machine) WithPackagePolicy(p PackagePolicy) *Machine {
+	m.policy = &p
+	m.register.SetFilter(p.allows)
+	m.defineBuiltins()
+	return m
+}
+
+func (m *Machine) defineBuiltins() {
+	m.builtins = builtin.NewPackage(builtin.IO{Stdout: machineOutput{m}, Stdin: m.io.Stdin, Context: m.interrupt.Context})
+	m.register.SetBuiltin(m.builtins)
+	if m.policy != nil {
+		all := m.builtins
+		m.builtins = registry.Filtered(all, m.policy.allows)
+		for name := range all.Objects() {
+			if _, ok := m.builtins.Objects()[name]; !ok {
+				m.vars.Global.Undefine(name)
+			}
+		}
+	}
+
+	if m.audit != nil {
+		m.builtins = registry.Wrapped(m.builtins, m.audit.wrap)
+	}
+
+	for name, obj := range m.builtins.Objects() {
+		r := m.vars.Global.Register(name)
+		m.vars.Global.DefineVar(r, obj)
+	}
+}
+
+// SetGlobal defines the global variable visible to compiled scripts.
+func (m *Machine) SetGlobal(name string, v variant.Iface) error {
+	if !lexer.IsIdent(name) {
+		return fmt.Errorf("invalid global name '%s'", name)
+	}
+
+	r := m.vars.Global.Register(name)
+	m.vars.Global.DefineVar(r, v)
+	return nil
+}
+
+// Globals returns the defined global variables, including builtins.
+func (m *Machine) Globals() map[string]variant.Iface {
+	globals := make(map[string]variant.Iface, len(m.vars.Global.r.m))
+	for name, r := range m.vars.Global.r.m {
+		if v, ok := m.vars.Global.GetVar(r); ok {
+			globals[name] = v
+		}
+	}
+
+	return globals
+}
+
+// Published returns the object of variables marked as pub by the invoked
+// scripts.
+func (m *Machine) Published() *variant.Object {
+	return m.vars.Published()
+}
+
+// Snapshot is the saved state of global variables of the machine.
+type Snapshot struct {
+	global *VarScope
+}
+
+// Snapshot saves the deep copy of global variables. The machine can be
+// rolled back to the saved state with Restore.
+func (m *Machine) Snapshot() *Snapshot {
+	return &Snapshot{global: m.vars.Global.Copy()}
+}
+
+// Restore rolls global variables back to the snapshot. Scripts compiled
+// after the snapshot was taken must be compiled again. The snapshot
+// can be restored many times.
+func (m *Machine) Restore(s *Snapshot) {
+	*m.vars.Global = *s.global.Copy()
+}
+
+// SetArgs sets the args global variable to the array of strings.
+func (m *Machine) SetArgs(args ...string) {
+	arr := make([]variant.Iface, 0, len(args))
+	for _, arg := range args {
+		arr = append(arr, variant.NewString(arg))
+	}
+
+	m.SetGlobal("args", variant.NewArray(arr))
+}
+
+// OnHostCall sets the handler receiving every call of builtin and package
+// functions with its arguments, duration and error, e.g. for audit logs.
+// It must be called before Compile.
+func (m *Machine) OnHostCall(fn AuditHandler) {
+	m.audit = fn
+	if fn == nil {
+		m.register.SetWrap(nil)
+	} else {
+		m.register.SetWrap(fn.wrap)
+	}
+
+	m.defineBuiltins()
+}
+
+// SetExactArithmetic makes number literals exact fractions, so that
+// 0.1 + 0.2 == 0.3 holds. Arithmetic on exact numbers gives exact results,
+// they are converted to floats only by host functions, e.g. pow, and for
+// output. It must be called before Compile.
+func (m *Machine) SetExactArithmetic(on bool) {
+	m.exact = on
+}
+
+// SetStrict makes assignments shadowing builtins or packages bound by using
+// compile errors instead of warnings. It must be called before Compile.
+func (m *Machine) SetStrict(on bool) {
+	m.strict = on
+}
+
+// DefaultMaxCallDepth is the limit of nested calls of script functions of
+// new machines.
+const DefaultMaxCallDepth = 1000
+
+// SetMaxCallDepth limits nested calls of script functions, deeper calls
+// fail with *RecursionError. Zero removes the limit, so runaway recursion
+// may crash the host by the Go stack overflow.
+func (m *Machine) SetMaxCallDepth(n int) {
+	m.depth.max = n
+}
+
+// OnWarning sets the handler for warnings reported while compiling,
+// e.g. about unreachable code. Warnings are dropped when no handler is set.
+func (m *Machine) OnWarning(fn WarnHandler) {
+	m.warn = fn
 }
 
 func (m *Machine) Compile(filename string, f io.Reader) (StmtInvoker, error) {
-	ast, err := m.parser.Parse(filename, f)
+	program, err := m.CompileProgram(filename, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+// CompileProgram compiles the script like Compile and returns it with the
+// shebang and pragmas of the header, so the host can validate the script
+// before running it.
+func (m *Machine) CompileProgram(filename string, f io.Reader) (*CompiledProgram, error) {
+	return m.compileProgram(filename, f, nil)
+}
+
+func (m *Machine) compileProgram(filename string, f io.Reader, value *variant.Iface) (*CompiledProgram, error) {
+	src, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	shebang, pragmas, err := parseHeader(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, err := m.parser.ParseBytes(filename, src)
 	if err != nil {
-		return nil, fmt.Errorf("parse: %w", err)
+		return nil, newParseError(err)
 	}
 
+	defined := m.Globals()
+	refs := newReferences()
+
 	invoker, err := (&Program{
 		vars:     m.vars,
 		register: m.register,
 		imports: importsInfo{
-			From:          os.DirFS("./"),
+			From:          m.fsys,
+			Resolver:      m.importResolver(),
+			Path:          filename,
 			ImportedPaths: map[string]struct{}{},
+			Builtins:      m.builtins,
 		},
+		warn:      m.warn,
+		calls:     m.calls,
+		depth:     m.depth,
+		interrupt: m.interrupt,
+		loop:      m.loop,
+		gens:      m.gens,
+		exact:     m.exact,
+		numeric:   m.numeric,
+		strict:    m.strict,
+		refs:      refs,
+		value:     value,
 	}).CodeGen(ast)
 	if err != nil {
-		return nil, fmt.Errorf("code gen: %w", err)
+		return nil, err
 	}
 
-	return invoker, nil
+	return &CompiledProgram{
+		StmtInvoker: m.runLoop(invoker),
+		Shebang:     shebang,
+		Pragmas:     pragmas,
+		Globals: slices.DeleteFunc(sortedNames(refs.globals), func(name string) bool {
+			_, ok := defined[name]
+			return !ok
+		}),
+		Packages: sortedNames(refs.packages),
+		Imports:  sortedNames(refs.imports),
+	}, nil
+}
+
+// runLoop finishes async calls which are not awaited by the program. When
+// the run ends, generators dropped meanwhile are closed.
+func (m *Machine) runLoop(program StmtInvoker) StmtInvoker {
+	return invoker(func() error {
+		m.gens.enter()
+		defer m.gens.leave()
+
+		err := program.Invoke()
+		if err == nil {
+			err = m.loop.run(nil)
+		}
+
+		if err != nil {
+			m.loop.cancel(err)
+		}
+
+		return err
+	})
 }
 
 func New() *Machine {
-	return &Machine{
-		vars:     NewVars(),
-		parser:   parser,
-		register: registry.New(),
+	m := &Machine{
+		vars:      NewVars(),
+		parser:    parser,
+		register:  registry.New(),
+		io:        builtin.IO{Stdout: os.Stdout},
+		fsys:      defaultFS(),
+		rand:      &randSource{r: crand.Reader},
+		logger:    slog.Default(),
+		calls:     &callSite{},
+		depth:     &callDepth{max: DefaultMaxCallDepth},
+		interrupt: &variant.Interrupt{},
+		loop:      &eventLoop{},
+		gens:      &coroutines{},
+		workers:   runtime.GOMAXPROCS(0),
+		caps:      map[Capability]struct{}{},
+		store:     store.NewMemory(),
+	}
+	m.dbs = sql.NewDBs(func() sql.Limits { return m.sqlLimits })
+	m.init()
+	m.SetArgs()
+
+	return m
+}
+
+// Clone returns the machine with the configuration and registered packages
+// of m and the copy of its global variables, so the clone runs scripts
+// concurrently with m and other clones. Values are copied deeply and script
+// functions are forked. Scripts compiled by m must be compiled again by the
+// clone. Host values, packages, databases and the store are shared, so they
+// must be safe for concurrent use, as well as the output writer and the
+// import resolver.
+func (m *Machine) Clone() *Machine {
+	c := &Machine{
+		vars:      m.vars.isolated(),
+		parser:    m.parser,
+		register:  registry.New(),
+		io:        m.io,
+		fsys:      m.fsys,
+		resolver:  m.resolver,
+		modules:   maps.Clone(m.modules),
+		rand:      &randSource{r: m.rand},
+		logger:    m.logger,
+		calls:     &callSite{},
+		depth:     m.depth.fork(),
+		interrupt: &variant.Interrupt{},
+		loop:      &eventLoop{},
+		gens:      &coroutines{},
+		policy:    m.policy,
+		audit:     m.audit,
+		workers:   m.workers,
+		caps:      maps.Clone(m.caps),
+		configs:   maps.Clone(m.configs),
+		sqlLimits: m.sqlLimits,
+		store:     m.store,
+		warn:      m.warn,
+		exact:     m.exact,
+		numeric:   m.numeric,
+		strict:    m.strict,
+	}
+	c.dbs = m.dbs.Clone(func() sql.Limits { return c.sqlLimits })
+	if c.policy != nil {
+		c.register.SetFilter(c.policy.allows)
+	}
+
+	if c.audit != nil {
+		c.register.SetWrap(c.audit.wrap)
+	}
+
+	c.init()
+	for name := range m.removed {
+		c.Unregister(name)
+	}
+
+	for _, pkg := range m.packages {
+		c.Override(pkg)
 	}
+
+	return c
+}
+
+// init defines builtins and registers packages bound to the machine.
+func (m *Machine) init() {
+	m.loop.interrupt = m.interrupt
+	m.register.SetHost(m)
+	m.defineBuiltins()
+	m.register.Register(uuid.NewPackage(m.rand))
+	m.register.Register(parallel.NewPackage(func() int { return m.workers }))
+	m.register.Register(log.NewPackage(func() *slog.Logger { return m.logger }, m.calls.Caller))
+	m.register.Register(exec.NewPackage(func() bool { return m.Granted(CapabilityExec) }, m.interrupt.Context))
+	m.register.Register(packages.Lazy("sql", func(packages.Host) (packages.Iface, error) {
+		return sql.NewPackage(m.dbs), nil
+	}))
+	m.register.Register(store.NewPackage(func() store.Store { return m.store }))
+	m.register.Register(glob.NewPackage(func() fs.FS { return m.fsys }))
 }
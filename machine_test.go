@@ -0,0 +1,2233 @@
+package easylang
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	osexec "os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/exec"
+	"github.com/hikitani/easylang/packages/registry"
+	"github.com/hikitani/easylang/packages/registry/pluginprovider"
+	elsql "github.com/hikitani/easylang/packages/sql"
+	"github.com/hikitani/easylang/packages/store"
+	"github.com/hikitani/easylang/packages/stream"
+	eltesting "github.com/hikitani/easylang/packages/testing"
+	"github.com/hikitani/easylang/variant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachine_SetOutput(t *testing.T) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		print("a", 1)
+		println()
+		printf("%s=%05.2f %d%% %v\n", "x", 3.14159, 42, [1, "b"])
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	assert.Equal(t, "a1\nx=03.14 42% [1, b]\n", out.String())
+}
+
+// seedSources returns script sources of the table tests, "Input" fields of
+// code_test.go and "Code" fields of ast_test.go, as the fuzzing corpus.
+func seedSources(f *testing.F) []string {
+	var sources []string
+	for file, field := range map[string]string{"code_test.go": "Input", "ast_test.go": "Code"} {
+		node, err := goparser.ParseFile(token.NewFileSet(), file, nil, 0)
+		require.NoError(f, err)
+
+		ast.Inspect(node, func(n ast.Node) bool {
+			kv, ok := n.(*ast.KeyValueExpr)
+			if !ok {
+				return true
+			}
+
+			key, ok := kv.Key.(*ast.Ident)
+			lit, isLit := kv.Value.(*ast.BasicLit)
+			if !ok || !isLit || key.Name != field || lit.Kind != token.STRING {
+				return true
+			}
+
+			src, err := strconv.Unquote(lit.Value)
+			require.NoError(f, err)
+			sources = append(sources, src)
+			return true
+		})
+	}
+
+	return sources
+}
+
+// FuzzEval checks that no source makes the compiler or the program panic or
+// run past the time limit.
+func FuzzEval(f *testing.F) {
+	for _, src := range seedSources(f) {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		start := time.Now()
+		_, err := Eval(src, EvalOptions{Timeout: 100 * time.Millisecond, MaxOutput: 1 << 10})
+		var perr *variant.PanicError
+		if errors.As(err, &perr) {
+			t.Fatalf("panic: %s\n%s", err, perr.Stack)
+		}
+
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("ran for %s", elapsed)
+		}
+	})
+}
+
+func TestEval(t *testing.T) {
+	out, err := Eval(`println("hi", 1 + 1)`, EvalOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "hi2\n", out)
+
+	out, err = Eval("println(\"before\")\nloop {}", EvalOptions{Timeout: 20 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrLimit)
+	assert.Equal(t, "before\n", out)
+
+	out, err = Eval("for i in range(10) { print(i) }", EvalOptions{MaxOutput: 4})
+	assert.ErrorIs(t, err, ErrLimit)
+	var lerr *LimitError
+	require.ErrorAs(t, err, &lerr)
+	assert.Equal(t, "output", lerr.Limit)
+	assert.Equal(t, "0123", out)
+
+	_, err = Eval(`x = import "lib.ela"`, EvalOptions{})
+	assert.ErrorIs(t, err, ErrImport)
+
+	out, err = Eval(`println(import "lib.ela")`, EvalOptions{FS: fstest.MapFS{
+		"lib.ela": &fstest.MapFile{Data: []byte("pub x = 1")},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "{x: 1}\n", out)
+}
+
+func TestMachine_UsingBuiltin(t *testing.T) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using builtin
+
+		builtin.println(builtin.type(builtin.range))
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, "func\n", out.String())
+
+	assert.Error(t, vm.Register(packages.New("builtin").Build()))
+}
+
+func TestMachine_Help(t *testing.T) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+	vm.OnHostCall(func(HostCall) {})
+
+	pkg := packages.New("greet").
+		AddFunc("hello", func(args variant.Args) (variant.Iface, error) {
+			return variant.NewString("hello"), nil
+		}).
+		AddFunc("bye", func(args variant.Args) (variant.Iface, error) {
+			return variant.NewString("bye"), nil
+		}).
+		AddString("name", "greet").
+		Doc("hello", "hello()", "Returns the greeting.\nNo arguments.").
+		Doc("bye", "bye()", "").
+		Doc("name", "name", "Name of the package.").
+		Build()
+	require.NoError(t, vm.Register(pkg))
+	assert.Equal(t, "Name of the package.", pkg.(packages.Documented).Docs()["name"].Text)
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using greet
+
+		help(len)
+		help(greet.hello)
+		help(greet)
+		help(|a, b| => a)
+		help(1)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	assert.Equal(t, `len(v)
+    Returns the number of elements of the array or object, or characters of the string.
+hello()
+    Returns the greeting.
+    No arguments.
+bye()
+
+hello()
+    Returns the greeting.
+    No arguments.
+function(a, b)
+number: 1
+`, out.String())
+}
+
+// factories are registered once per process, so tests can run many times
+var registerGreeting sync.Once
+
+func TestMachine_LoadPackages(t *testing.T) {
+	registerGreeting.Do(func() {
+		registry.RegisterFactory("greeting", func() packages.Iface {
+			return packages.New("greeting").AddString("hello", "hi").Build()
+		})
+	})
+	assert.Panics(t, func() {
+		registry.RegisterFactory("greeting", func() packages.Iface { return nil })
+	})
+
+	vm := New()
+	require.NoError(t, vm.LoadPackages(registry.Factories()))
+	require.NoError(t, vm.LoadPackages(registry.ProviderFunc(func() ([]packages.Iface, error) {
+		return []packages.Iface{packages.New("ext").AddInt("answer", 42).Build()}, nil
+	})))
+	assert.Error(t, vm.LoadPackages(registry.Factories()))
+	assert.NoError(t, vm.LoadPackages(pluginprovider.Plugins("testdata/missing/*.so")))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using greeting
+		using ext
+		pub s = [greeting.hello, ext.answer]
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	s, err := vm.Published().Get(variant.NewString("s"))
+	require.NoError(t, err)
+	assert.Equal(t, "[hi, 42]", s.String())
+}
+
+func TestTestingPackage_Failures(t *testing.T) {
+	rec := &eltesting.Recorder{}
+	vm := New()
+	require.NoError(t, vm.Register(eltesting.NewPackage(rec)))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using testing
+
+		testing.test("eq", || => testing.assert_eq(1, 2))
+		testing.test("true", || => testing.assert_true(false, "msg"))
+		testing.test("fail", || => testing.fail("boom"))
+		testing.test("ok", || => none)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	require.Len(t, rec.Results, 4)
+	assert.EqualError(t, rec.Results[0].Err, "assert_eq: 1 != 2")
+	assert.EqualError(t, rec.Results[1].Err, "assert_true: msg: condition is false")
+	assert.EqualError(t, rec.Results[2].Err, "fail: boom")
+	assert.NoError(t, rec.Results[3].Err)
+}
+
+func TestMachine_SetInput(t *testing.T) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+	vm.SetInput(strings.NewReader("john\r\n29"))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		name = input("name: ")
+		age = input()
+		rest = input()
+		println(name, "/", age, "/", rest)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	assert.Equal(t, "name: john/29/none\n", out.String())
+}
+
+func TestMachine_InputDenied(t *testing.T) {
+	vm := New()
+	stmt, err := vm.Compile("", strings.NewReader(`s = input()`))
+	require.NoError(t, err)
+	assert.Error(t, stmt.Invoke())
+}
+
+func TestMachine_Globals(t *testing.T) {
+	vm := New()
+	vm.SetArgs("a", "b")
+	require.NoError(t, vm.SetGlobal("limit", variant.Int(10)))
+	assert.Error(t, vm.SetGlobal("if", variant.Int(1)))
+	assert.Error(t, vm.SetGlobal("1abc", variant.Int(1)))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		res = str(len(args)) + args[1] + str(limit * 2)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	globals := vm.Globals()
+	assert.True(t, variant.DeepEqual(variant.NewString("2b20"), globals["res"]))
+	assert.True(t, variant.DeepEqual(variant.Int(10), globals["limit"]))
+}
+
+func TestMachine_ExactArithmetic(t *testing.T) {
+	src := `
+		sum = 0.1 + 0.2
+		res = [sum == 0.3, str(sum), str(1 / 3 * 3), str(-5.5 % 3), str(0.5 * 4 - 1)]
+		key = {2: "two"}[4 / 2]
+		diff = 1.1 - 1 == 0.1
+	`
+
+	vm := New()
+	vm.SetExactArithmetic(true)
+	stmt, err := vm.Compile("", strings.NewReader(src))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	globals := vm.Globals()
+	assert.Equal(t, "[true, 0.3, 1, 0.5, 1]", globals["res"].String())
+	assert.Equal(t, "two", globals["key"].String())
+	assert.Equal(t, "true", globals["diff"].String())
+	num, ok := globals["sum"].(*variant.Num)
+	require.True(t, ok)
+	f, _ := num.Value().Float64()
+	assert.Equal(t, 0.3, f)
+
+	vm = New()
+	stmt, err = vm.Compile("", strings.NewReader(src))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, "false", vm.Globals()["diff"].String())
+}
+
+func TestMachine_NumericPolicy(t *testing.T) {
+	run := func(p NumericPolicy, src string) (map[string]variant.Iface, error) {
+		vm := New()
+		vm.SetNumericPolicy(p)
+		stmt, err := vm.Compile("", strings.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+
+		err = stmt.Invoke()
+		return vm.Globals(), err
+	}
+
+	globals, err := run(NumericInf, `x = 2 / 0`)
+	require.NoError(t, err)
+	assert.Equal(t, "+Inf", globals["x"].String())
+	_, err = run(NumericInf, `zero = 0
+x = zero / zero`)
+	assert.Error(t, err)
+
+	_, err = run(NumericError, `zero = 0
+x = 2 / zero`)
+	assert.ErrorContains(t, err, "division by zero")
+
+	globals, err = run(NumericNaN, `
+		zero = 0
+		x = zero / zero
+		y = inf - inf + 1
+		z = 5 % zero
+		s = [is_nan(x), is_nan(y), is_nan(z), x == x, x < 1, x > 1, is_inf(1 / zero), is_nan(1)]
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "nan", globals["x"].String())
+	assert.Equal(t, "[true, true, true, false, false, false, true, false]", globals["s"].String())
+}
+
+func TestMachine_Pragmas(t *testing.T) {
+	vm := New()
+	program, err := vm.CompileProgram("main.ela", strings.NewReader(`#!/usr/bin/env easylang
+# plugin header
+#pragma require exec
+#pragma	require sql
+#pragma version >= 1.2
+
+#pragma entry
+x = 1
+#pragma after ignored
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "/usr/bin/env easylang", program.Shebang)
+	require.Len(t, program.Pragmas, 4)
+	assert.Equal(t, []string{"exec", "sql"}, program.Pragma("require"))
+	assert.Equal(t, []string{">= 1.2"}, program.Pragma("version"))
+	assert.Equal(t, 5, program.Pragmas[2].Pos.Line)
+	assert.Equal(t, []string{""}, program.Pragma("entry"))
+	assert.Nil(t, program.Pragma("after"))
+	require.NoError(t, program.Invoke())
+	assert.True(t, variant.DeepEqual(variant.Int(1), vm.Globals()["x"]))
+
+	_, err = vm.CompileProgram("main.ela", strings.NewReader("#pragma\nx = 1"))
+	var cerr *CompileError
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 1, cerr.Pos.Line)
+}
+
+func TestMachine_ProgramReferences(t *testing.T) {
+	vm := New()
+	vm.SetFS(fstest.MapFS{
+		"lib/util.ela": &fstest.MapFile{Data: []byte("using exec\nlib = import \"lib/deep.ela\"\npub f = || => len(\"a\")")},
+		"lib/deep.ela": &fstest.MapFile{Data: []byte("pub g = || => 1")},
+	})
+	require.NoError(t, vm.SetGlobal("host_limit", variant.Int(10)))
+	require.NoError(t, vm.SetGlobal("host_unused", variant.Int(0)))
+
+	program, err := vm.CompileProgram("main.ela", strings.NewReader(`
+		using iter
+		util = import "./lib/util.ela"
+		x = len([1]) + host_limit
+		f = || => println(x, iter)
+	`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"host_limit", "len", "println"}, program.Globals)
+	assert.Equal(t, []string{"exec", "iter"}, program.Packages)
+	assert.Equal(t, []string{"lib/deep.ela", "lib/util.ela"}, program.Imports)
+	assert.Equal(t, []Capability{CapabilityExec}, program.Capabilities())
+	assert.False(t, vm.Granted(program.Capabilities()[0]))
+}
+
+func TestMachine_LoadScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"plugin.ela": &fstest.MapFile{Data: []byte("calls = 0\nhandle = |x| => { calls += 1\nreturn x + 1 }")},
+	}
+	vm := New()
+	script, err := vm.LoadScript(fsys, "plugin.ela", "calls")
+	require.NoError(t, err)
+
+	call := func(x int) variant.Iface {
+		handle := vm.Globals()["handle"].(*variant.Func)
+		v, err := handle.Call(variant.Args{variant.Int(x)})
+		require.NoError(t, err)
+		return v
+	}
+
+	assert.True(t, variant.DeepEqual(variant.Int(2), call(1)))
+	first := script.Program()
+
+	reloaded, err := script.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+	assert.Same(t, first, script.Program())
+
+	fsys["plugin.ela"] = &fstest.MapFile{Data: []byte("calls = 0\nhandle = |x| => { calls += 1\nreturn x * 10 }")}
+	reloaded, err = script.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.NotSame(t, first, script.Program())
+	assert.True(t, variant.DeepEqual(variant.Int(20), call(2)))
+	assert.True(t, variant.DeepEqual(variant.Int(2), vm.Globals()["calls"]))
+
+	fsys["plugin.ela"] = &fstest.MapFile{Data: []byte("handle = |x| => x - 1\nz = 0\nx = 1 % z")}
+	_, err = script.Reload()
+	assert.ErrorIs(t, err, ErrRuntime)
+	assert.True(t, variant.DeepEqual(variant.Int(30), call(3)))
+
+	fsys["plugin.ela"] = &fstest.MapFile{Data: []byte("handle = (")}
+	_, err = script.Reload()
+	assert.ErrorIs(t, err, ErrParse)
+	assert.True(t, variant.DeepEqual(variant.Int(40), call(4)))
+	assert.True(t, variant.DeepEqual(variant.Int(4), vm.Globals()["calls"]))
+}
+
+func TestMachine_Published(t *testing.T) {
+	vm := New()
+	stmt, err := vm.Compile("", strings.NewReader(`
+		pub name = "john"
+		pub age = 29
+		secret = 1
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, vm.Published().Len())
+
+	require.NoError(t, stmt.Invoke())
+
+	expected := variant.FromMap(map[string]variant.Iface{
+		"name": variant.NewString("john"),
+		"age":  variant.Int(29),
+	})
+	assert.True(t, variant.DeepEqual(expected, vm.Published()))
+}
+
+func TestMachine_SnapshotRestore(t *testing.T) {
+	vm := New()
+	warmup, err := vm.Compile("", strings.NewReader(`
+		pub counter = 1
+		config = {"name": "app", "tags": [1, 2]}
+	`))
+	require.NoError(t, err)
+	require.NoError(t, warmup.Invoke())
+
+	snap := vm.Snapshot()
+	for i := 0; i < 2; i++ {
+		stmt, err := vm.Compile("", strings.NewReader(`
+			counter += 1
+			config = none
+			temp = 3
+		`))
+		require.NoError(t, err)
+		require.NoError(t, stmt.Invoke())
+
+		globals := vm.Globals()
+		assert.True(t, variant.DeepEqual(variant.Int(2), globals["counter"]))
+		assert.True(t, variant.DeepEqual(variant.NewNone(), globals["config"]))
+		assert.Contains(t, globals, "temp")
+
+		vm.Restore(snap)
+
+		globals = vm.Globals()
+		assert.True(t, variant.DeepEqual(variant.Int(1), globals["counter"]))
+		assert.NotContains(t, globals, "temp")
+		assert.True(t, variant.DeepEqual(variant.FromMap(map[string]variant.Iface{
+			"name": variant.NewString("app"),
+			"tags": variant.NewArray([]variant.Iface{variant.Int(1), variant.Int(2)}),
+		}), globals["config"]))
+		assert.Equal(t, 1, vm.Published().Len())
+	}
+}
+
+func TestMachine_Clone(t *testing.T) {
+	vm := New()
+	vm.WithPackagePolicy(PackagePolicy{Deny: []string{"builtin.input"}})
+	require.NoError(t, vm.Register(packages.New("greet").AddString("hello", "hi").Build()))
+	require.NoError(t, vm.SetGlobal("base", variant.Int(10)))
+	warmup, err := vm.Compile("", strings.NewReader(`
+		pub counter = 0
+		items = [1, 2]
+		add = |x| => x + base
+	`))
+	require.NoError(t, err)
+	require.NoError(t, warmup.Invoke())
+
+	var wg sync.WaitGroup
+	outs := make([]strings.Builder, 4)
+	errs := make([]error, len(outs))
+	for i := range outs {
+		c := vm.Clone()
+		c.SetOutput(&outs[i])
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			stmt, err := c.Compile("", strings.NewReader(`
+				using greet
+				using builtin
+
+				for i in range(100) {
+					counter += 1
+					push(items, i)
+				}
+				println(greet.hello, " ", add(counter), " ", len(items), " ", is_none(at(builtin, "input")))
+			`))
+			if err == nil {
+				err = stmt.Invoke()
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range outs {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "hi 110 102 true\n", outs[i].String())
+	}
+
+	globals := vm.Globals()
+	assert.True(t, variant.DeepEqual(variant.Int(0), globals["counter"]))
+	assert.Equal(t, 2, globals["items"].(*variant.Array).Len())
+}
+
+func TestMachine_MaxCallDepth(t *testing.T) {
+	run := func(vm *Machine, depth int) error {
+		require.NoError(t, vm.SetGlobal("depth", variant.Int(depth)))
+		stmt, err := vm.Compile("", strings.NewReader(`
+			down = none
+			down = |n| => {
+				if n == 0 {
+					return 0
+				}
+
+				return down(n - 1) + 1
+			}
+			x = down(depth - 1)
+		`))
+		require.NoError(t, err)
+		return stmt.Invoke()
+	}
+
+	vm := New()
+	vm.SetMaxCallDepth(10)
+	assert.NoError(t, run(vm, 10))
+
+	err := run(vm, 11)
+	var rerr *RecursionError
+	require.ErrorAs(t, err, &rerr)
+	assert.Equal(t, 10, rerr.Depth)
+	assert.ErrorIs(t, err, ErrLimit)
+	assert.ErrorIs(t, err, ErrRuntime)
+
+	// the depth is restored after the error
+	assert.NoError(t, run(vm, 10))
+
+	err = run(New(), DefaultMaxCallDepth+1)
+	assert.ErrorAs(t, err, &rerr)
+
+	vm = New()
+	vm.SetMaxCallDepth(0)
+	assert.NoError(t, run(vm, DefaultMaxCallDepth+1))
+
+	// calls awaiting at the same time are counted only while they run
+	vm = New()
+	vm.SetMaxCallDepth(10)
+	stmt, err := vm.Compile("", strings.NewReader(`
+		wait = async |i| => await delay(0.001, i)
+		ps = []
+		for i in range(50) {
+			ps = ps + [wait(i)]
+		}
+		s = 0
+		for p in ps {
+			s += await p
+		}
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, variant.Int(1225), vm.Globals()["s"])
+}
+
+func TestMachine_UUID(t *testing.T) {
+	run := func(seed int64) *variant.Object {
+		vm := New()
+		vm.Seed(seed)
+		stmt, err := vm.Compile("", strings.NewReader(`
+			using uuid
+			pub id = uuid.new()
+			pub other = uuid.new()
+			pub valid = uuid.is_valid(id)
+			pub parsed = uuid.parse("6BA7B810-9DAD-11D1-80B4-00C04FD430C8")
+			pub invalid = uuid.is_valid("6ba7b810-9dad-11d1-80b4")
+		`))
+		require.NoError(t, err)
+		require.NoError(t, stmt.Invoke())
+		return vm.Published()
+	}
+
+	pubs := run(42)
+	get := func(obj *variant.Object, name string) variant.Iface {
+		v, err := obj.Get(variant.NewString(name))
+		require.NoError(t, err)
+		return v
+	}
+
+	id := get(pubs, "id").String()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	assert.NotEqual(t, id, get(pubs, "other").String())
+	assert.Equal(t, "true", get(pubs, "valid").String())
+	assert.Equal(t, "false", get(pubs, "invalid").String())
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", get(pubs, "parsed").String())
+	assert.Equal(t, id, get(run(42), "id").String())
+	assert.NotEqual(t, id, get(run(43), "id").String())
+}
+
+func TestMachine_Log(t *testing.T) {
+	var buf bytes.Buffer
+	vm := New()
+	vm.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	stmt, err := vm.Compile("main.ela", strings.NewReader(`
+		using log
+
+		log.debug("hidden")
+		log.info("started", {"port": 8080})
+		f = || => log.error("failed")
+		f()
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	assert.Equal(t, "level=INFO msg=started port=8080 file=main.ela line=5\n"+
+		"level=ERROR msg=failed file=main.ela line=6\n", buf.String())
+
+	vm.SetLogger(nil)
+	buf.Reset()
+	require.NoError(t, stmt.Invoke())
+	assert.Empty(t, buf.String())
+}
+
+func TestMachine_StructObject(t *testing.T) {
+	type Address struct {
+		City string `easylang:"city"`
+	}
+
+	type User struct {
+		Name    string   `easylang:"name"`
+		Age     int      `easylang:"age"`
+		Tags    []string `easylang:"tags"`
+		Address Address  `easylang:"address"`
+		Manager *User    `easylang:"manager"`
+		Secret  string   `easylang:"-"`
+		hidden  int
+	}
+
+	user := &User{
+		Name:    "john",
+		Age:     29,
+		Tags:    []string{"admin"},
+		Address: Address{City: "Tokyo"},
+		Secret:  "x",
+		hidden:  1,
+	}
+
+	obj, err := variant.StructObject(user)
+	require.NoError(t, err)
+
+	vm := New()
+	require.NoError(t, vm.SetGlobal("user", obj))
+	stmt, err := vm.Compile("", strings.NewReader(`
+		pub summary = user.name + ":" + str(user.age) + ":" + user.tags[0] + ":" + user.address.city
+		pub manager = user.manager
+		pub size = len(user)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	summary, err := pubs.Get(variant.NewString("summary"))
+	require.NoError(t, err)
+	assert.Equal(t, "john:29:admin:Tokyo", summary.String())
+	manager, err := pubs.Get(variant.NewString("manager"))
+	require.NoError(t, err)
+	assert.Equal(t, variant.TypeNone, manager.Type())
+	size, err := pubs.Get(variant.NewString("size"))
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.Int(5), size))
+
+	// Writes go through to the struct and reads see host changes.
+	require.NoError(t, obj.Set(variant.NewString("age"), variant.Int(30)))
+	assert.Equal(t, 30, user.Age)
+	addr, err := obj.Get(variant.NewString("address"))
+	require.NoError(t, err)
+	require.NoError(t, variant.MustCast[*variant.Object](addr).Set(variant.NewString("city"), variant.NewString("Osaka")))
+	assert.Equal(t, "Osaka", user.Address.City)
+	user.Name = "jane"
+	name, err := obj.Get(variant.NewString("name"))
+	require.NoError(t, err)
+	assert.Equal(t, "jane", name.String())
+
+	assert.Error(t, obj.Set(variant.NewString("age"), variant.NewString("old")))
+	assert.Error(t, obj.Set(variant.NewString("Secret"), variant.NewString("y")))
+
+	// Slices and maps are snapshots: changing them fails instead of being
+	// lost, copies are writable.
+	stmt, err = vm.Compile("", strings.NewReader(`user.tags[0] = "root"`))
+	require.NoError(t, err)
+	assert.ErrorContains(t, stmt.Invoke(), "read-only snapshot")
+	stmt, err = vm.Compile("", strings.NewReader(`push(user.tags, "dev")`))
+	require.NoError(t, err)
+	assert.Error(t, stmt.Invoke())
+	assert.Equal(t, []string{"admin"}, user.Tags)
+	stmt, err = vm.Compile("", strings.NewReader(`
+		t = copy(user.tags)
+		t[0] = "root"
+		pub tags = t
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	tags, err := vm.Published().Get(variant.NewString("tags"))
+	require.NoError(t, err)
+	assert.Equal(t, "[root]", tags.String())
+	assert.Equal(t, []string{"admin"}, user.Tags)
+
+	ro, err := variant.StructObject(*user)
+	require.NoError(t, err)
+	assert.Error(t, ro.Set(variant.NewString("age"), variant.Int(1)))
+	assert.True(t, variant.DeepEqual(obj, ro))
+
+	_, err = variant.StructObject(1)
+	assert.Error(t, err)
+}
+
+func TestMachine_Handle(t *testing.T) {
+	type conn struct{ queries []string }
+
+	vm := New()
+	db := &conn{}
+	require.NoError(t, vm.SetGlobal("db", variant.NewHandle(db)))
+	require.NoError(t, vm.SetGlobal("query", variant.NewFunc(nil, func(args variant.Args) (variant.Iface, error) {
+		c, ok := variant.HandleValue[*conn](args[0])
+		if !ok {
+			return nil, errors.New("query() first argument must be connection")
+		}
+
+		c.queries = append(c.queries, args[1].String())
+		return variant.NewNone(), nil
+	})))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		conn = db
+		query(conn, "select 1")
+		pub info = [type(conn), str(conn), is_handle(conn), conn == db]
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, []string{"select 1"}, db.queries)
+
+	info, err := vm.Published().Get(variant.NewString("info"))
+	require.NoError(t, err)
+	assert.Equal(t, "[handle, handle, true, true]", info.String())
+
+	for _, input := range []string{
+		`query("db", "select 1")`,
+		`x = {db: 1}`,
+	} {
+		stmt, err := vm.Compile("", strings.NewReader(input))
+		require.NoError(t, err)
+		assert.Error(t, stmt.Invoke(), input)
+	}
+
+	closed := make(chan any, 1)
+	func() {
+		variant.NewHandle("conn").WithFinalizer(func(v any) { closed <- v })
+	}()
+	for i := 0; i < 10 && len(closed) == 0; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "conn", <-closed)
+}
+
+var typeVec = variant.RegisterType("vec")
+
+// vec is the host variant used to test extension hooks.
+type vec struct {
+	x, y int
+}
+
+func (v *vec) Type() variant.Type   { return typeVec }
+func (v *vec) MemReader() io.Reader { return strings.NewReader(v.String()) }
+func (v *vec) String() string       { return fmt.Sprintf("vec(%d, %d)", v.x, v.y) }
+
+func (v *vec) Equal(other variant.Iface) bool {
+	o, ok := other.(*vec)
+	return ok && *o == *v
+}
+
+func (v *vec) Index(key variant.Iface) (variant.Iface, error) {
+	switch key.String() {
+	case "x", "0":
+		return variant.Int(v.x), nil
+	case "y", "1":
+		return variant.Int(v.y), nil
+	}
+
+	return nil, fmt.Errorf("vec has no field %s", key)
+}
+
+func (v *vec) Call(args variant.Args) (variant.Iface, error) {
+	return variant.Int(v.x*v.x + v.y*v.y), nil
+}
+
+func (v *vec) Iter() variant.Iterator {
+	return &vecIter{v: v}
+}
+
+type vecIter struct {
+	v *vec
+	i int
+}
+
+func (it *vecIter) Next() (variant.Iface, bool, error) {
+	it.i++
+	switch it.i {
+	case 1:
+		return variant.Int(it.v.x), true, nil
+	case 2:
+		return variant.Int(it.v.y), true, nil
+	}
+
+	return nil, false, nil
+}
+
+func (v *vec) BinaryOp(op string, other variant.Iface, reversed bool) (variant.Iface, error) {
+	switch o := other.(type) {
+	case *vec:
+		if op == "+" {
+			return &vec{x: v.x + o.x, y: v.y + o.y}, nil
+		}
+	case *variant.Num:
+		n, err := o.AsInt64()
+		if op == "*" && err == nil {
+			return &vec{x: v.x * int(n), y: v.y * int(n)}, nil
+		}
+	}
+
+	return nil, variant.ErrUnsupportedOp
+}
+
+func TestMachine_HostType(t *testing.T) {
+	vm := New()
+	require.NoError(t, vm.SetGlobal("vec", variant.NewFunc(nil, func(args variant.Args) (variant.Iface, error) {
+		x, _ := variant.MustCast[*variant.Num](args[0]).AsInt64()
+		y, _ := variant.MustCast[*variant.Num](args[1]).AsInt64()
+		return &vec{x: int(x), y: int(y)}, nil
+	})))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		a = vec(1, 2)
+		b = 2 * (a + vec(3, 4))
+		s = 0
+		for i, c in b {
+			s += c
+		}
+		pub res = [type(b), str(b), b.x, b[1], a(), s, a == vec(1, 2), a != b]
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	res, err := vm.Published().Get(variant.NewString("res"))
+	require.NoError(t, err)
+	assert.Equal(t, "[vec, vec(8, 12), 8, 12, 5, 20, true, true]", res.String())
+
+	for _, input := range []string{
+		`x = vec(1, 2) - vec(1, 2)`,
+		`x = vec(1, 2).z`,
+	} {
+		stmt, err := vm.Compile("", strings.NewReader(input))
+		require.NoError(t, err)
+		assert.Error(t, stmt.Invoke(), input)
+	}
+}
+
+func TestMachine_FuncCallTimeout(t *testing.T) {
+	vm := New()
+	stmt, err := vm.Compile("", strings.NewReader(`
+		pub hang = || => {
+			while true {}
+		}
+		pub spin = |n| => {
+			for i in range(n) {}
+			return n
+		}
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	get := func(name string) *variant.Func {
+		fn, err := vm.Published().Get(variant.NewString(name))
+		require.NoError(t, err)
+		return variant.MustCast[*variant.Func](fn)
+	}
+
+	start := time.Now()
+	_, err = get("hang").CallTimeout(20*time.Millisecond, nil)
+	var timeoutErr *variant.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, 20*time.Millisecond, timeoutErr.Timeout)
+	assert.Less(t, time.Since(start), time.Second)
+
+	res, err := get("spin").CallTimeout(time.Second, variant.Args{variant.Int(10)})
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.Int(10), res))
+
+	// The deadline is reset after the call.
+	res, err = get("spin").Call(variant.Args{variant.Int(10)})
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.Int(10), res))
+}
+
+func TestMachine_GeneratorGoroutines(t *testing.T) {
+	// settled waits until goroutines of dropped generators exit
+	settled := func(n int) bool {
+		for i := 0; i < 100; i++ {
+			runtime.GC()
+			if runtime.NumGoroutine() <= n {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return false
+	}
+
+	const gen = `
+		gen = || => {
+			i = 0
+			while true {
+				for x in [1, 2] {
+					yield i + x
+				}
+				i += 1
+			}
+		}
+	`
+	base := runtime.NumGoroutine()
+
+	vm := New()
+	stmt, err := vm.Compile("", strings.NewReader(gen+`
+		for _ in range(100) {
+			for x in gen() {
+				break
+			}
+		}
+
+		first = || => {
+			for x in gen() {
+				return x
+			}
+		}
+		s = 0
+		for _ in range(100) {
+			s += first()
+		}
+
+		drop = || => {
+			it = gen()
+			it.next()
+			it.next()
+		}
+		for _ in range(100) {
+			drop()
+		}
+		# the inline cache of it.next keeps the last iterator
+		drop = none
+
+		it = gen()
+		it.next()
+		it.close()
+		rest = it.list()
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, variant.Int(100), vm.Globals()["s"])
+	assert.Equal(t, 0, variant.MustCast[*variant.Array](vm.Globals()["rest"]).Len())
+	assert.True(t, settled(base), "goroutines: %d, before: %d", runtime.NumGoroutine(), base)
+
+	for _, src := range []string{
+		`for x in gen() { while true {} }`,
+		`it = gen()
+		it.next()
+		while true {}`,
+	} {
+		_, err := Eval(gen+src, EvalOptions{Timeout: 20 * time.Millisecond})
+		var limitErr *LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.True(t, settled(base), "goroutines: %d, before: %d", runtime.NumGoroutine(), base)
+	}
+}
+
+func TestMachine_NestedGeneratorClose(t *testing.T) {
+	// done fails the test instead of hanging when closing deadlocks
+	done := func(fn func() error) {
+		t.Helper()
+		errc := make(chan error, 1)
+		go func() { errc <- fn() }()
+		select {
+		case err := <-errc:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock closing nested generators")
+		}
+	}
+
+	// collect runs finalizers of dropped iterators until the state of
+	// generators matches, the lock is not waited for if closing deadlocks
+	collect := func(cs *coroutines, match func() bool) {
+		for i := 0; i < 100; i++ {
+			runtime.GC()
+			if cs.mu.TryLock() {
+				ok := match()
+				cs.mu.Unlock()
+				if ok {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	const gens = `
+		inner = || => {
+			i = 0
+			while true {
+				yield i
+				i += 1
+			}
+		}
+		outer = || => {
+			for x in inner() {
+				yield x
+			}
+		}
+		drop = || => {
+			it = outer()
+			it.next()
+		}
+	`
+
+	// finalizers close dropped generators while the machine is idle
+	vm := New()
+	done(func() error {
+		stmt, err := vm.Compile("", strings.NewReader(gens+`
+			for _ in range(50) {
+				drop()
+			}
+			drop = none
+		`))
+		if err != nil {
+			return err
+		}
+
+		return stmt.Invoke()
+	})
+	collect(vm.gens, func() bool { return len(vm.gens.live) == 0 })
+	done(func() error {
+		stmt, err := vm.Compile("", strings.NewReader(`x = 1`))
+		if err != nil {
+			return err
+		}
+
+		return stmt.Invoke()
+	})
+
+	// generators dropped during the run are closed when it ends
+	vm = New()
+	require.NoError(t, vm.SetGlobal("collect", variant.NewFunc([]string{}, func(variant.Args) (variant.Iface, error) {
+		collect(vm.gens, func() bool { return len(vm.gens.abandoned) > 0 })
+		return variant.NewNone(), nil
+	})))
+	done(func() error {
+		stmt, err := vm.Compile("", strings.NewReader(gens+`
+			for _ in range(50) {
+				drop()
+			}
+			drop = none
+			collect()
+		`))
+		if err != nil {
+			return err
+		}
+
+		return stmt.Invoke()
+	})
+	require.True(t, vm.gens.mu.TryLock())
+	defer vm.gens.mu.Unlock()
+	assert.Empty(t, vm.gens.abandoned)
+}
+
+func TestMachine_PackagePolicy(t *testing.T) {
+	var out strings.Builder
+	vm := New()
+	vm.SetOutput(&out)
+	vm.WithPackagePolicy(PackagePolicy{
+		Allow: []string{"builtin", "iter.range", "bytes"},
+		Deny:  []string{"builtin.print", "bytes.pack"},
+	})
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using iter
+		using bytes
+
+		println(len(iter.range(3).list()), bytes.to_hex(bytes.from_string("a")))
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, "361\n", out.String())
+
+	for _, input := range []string{
+		`print("x")`,
+		`using uuid`,
+		"using iter\niter.count()",
+		"using bytes\nbytes.pack(1, 1)",
+	} {
+		stmt, err := vm.Compile("", strings.NewReader(input))
+		if err == nil {
+			err = stmt.Invoke()
+		}
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMachine_OnHostCall(t *testing.T) {
+	var calls []HostCall
+	vm := New()
+	vm.SetOutput(io.Discard)
+	vm.OnHostCall(func(call HostCall) {
+		calls = append(calls, call)
+	})
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using iter
+
+		f = |x| => x * 2
+		println("hello", f(1))
+		n = iter.range(2).count()
+		parse_int("x")
+	`))
+	require.NoError(t, err)
+	assert.Error(t, stmt.Invoke())
+
+	require.Len(t, calls, 3)
+	assert.Equal(t, "builtin.println", calls[0].Name)
+	assert.Equal(t, []string{`"hello"`, "2"}, calls[0].Args)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, "iter.range", calls[1].Name)
+	assert.Equal(t, []string{"2"}, calls[1].Args)
+	assert.Equal(t, "builtin.parse_int", calls[2].Name)
+	assert.Error(t, calls[2].Err)
+	for _, call := range calls {
+		assert.GreaterOrEqual(t, call.Duration, time.Duration(0))
+	}
+}
+
+func TestMachine_Parallel(t *testing.T) {
+	vm := New()
+	vm.SetMaxWorkers(4)
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using parallel
+
+		fib = none
+		fib = |n| => {
+			if n < 2 {
+				return n
+			}
+			return fib(n - 1) + fib(n - 2)
+		}
+
+		offset = 100
+		square = |x| => {
+			y = x * x
+			return y + offset
+		}
+
+		pub squares = parallel.map(range(20).list(), square)
+		pub fibs = parallel.map([10, 11, 12, 13], |n| => fib(n), {"workers": 2})
+		pub done = parallel.for_each([1, 2, 3], |x| => x)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	squares, err := pubs.Get(variant.NewString("squares"))
+	require.NoError(t, err)
+	elems := variant.MustCast[*variant.Array](squares).Elems()
+	require.Len(t, elems, 20)
+	for i, el := range elems {
+		assert.True(t, variant.DeepEqual(variant.Int(i*i+100), el), i)
+	}
+
+	fibs, err := pubs.Get(variant.NewString("fibs"))
+	require.NoError(t, err)
+	assert.Equal(t, "[55, 89, 144, 233]", fibs.String())
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using parallel
+
+		parallel.map([1, 0, 2, 0], |x| => 1 % x)
+	`))
+	require.NoError(t, err)
+	err = stmt.Invoke()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "element at 1 position")
+	assert.Contains(t, err.Error(), "element at 3 position")
+}
+
+func TestMachine_Async(t *testing.T) {
+	vm := New()
+	var out bytes.Buffer
+	vm.SetOutput(&out)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	require.NoError(t, vm.SetGlobal("fetch", variant.NewFunc([]string{"id"}, func(args variant.Args) (variant.Iface, error) {
+		id := args[0]
+		return variant.Go(func() (variant.Iface, error) {
+			started <- struct{}{}
+			<-release
+			return id, nil
+		}), nil
+	})))
+
+	go func() {
+		// both requests must be in flight before any of them is finished
+		<-started
+		<-started
+		close(release)
+	}()
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		load = async |id| => {
+			println("start ", id)
+			v = await fetch(id)
+			println("done ", id)
+			return v * 10
+		}
+
+		a = load(1)
+		b = load(2)
+		pub is_p = is_promise(a)
+		pub total = await a + await b
+
+		(async || => println("result ", await load(3)))()
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	lines := strings.Split(out.String(), "\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, []string{"start 1", "start 2"}, lines[:2])
+	assert.ElementsMatch(t, []string{"done 1", "done 2"}, lines[2:4])
+	assert.Equal(t, []string{"start 3", "done 3", "result 30", ""}, lines[4:])
+
+	pubs := vm.Published()
+	isPromise, err := pubs.Get(variant.NewString("is_p"))
+	require.NoError(t, err)
+	assert.Equal(t, "true", isPromise.String())
+	total, err := pubs.Get(variant.NewString("total"))
+	require.NoError(t, err)
+	assert.Equal(t, "30", total.String())
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		fail = async |x| => 1 % x
+		await fail(0)
+	`))
+	require.NoError(t, err)
+	require.Error(t, stmt.Invoke())
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		p = none
+		wait = async || => await p
+		p = wait()
+		await p
+	`))
+	require.NoError(t, err)
+	assert.ErrorIs(t, stmt.Invoke(), errDeadlock)
+}
+
+func TestMachine_AsyncCancel(t *testing.T) {
+	for _, src := range []string{
+		`await delay(60000)`,
+		`
+			wait = async || => await delay(60000)
+			await wait()
+		`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		start := time.Now()
+		_, err := New().Run(ctx, src)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	}
+
+	// settled waits until goroutines of unwound tasks exit
+	settled := func(n int) bool {
+		for i := 0; i < 100; i++ {
+			if runtime.NumGoroutine() <= n {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return false
+	}
+
+	base := runtime.NumGoroutine()
+	vm := New()
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := vm.Run(ctx, `
+			wait = async || => await delay(60000)
+			for _ in range(10) {
+				wait()
+			}
+			await delay(0)
+			1 % 0
+		`)
+		assert.Error(t, err)
+
+		_, err = vm.Run(ctx, `
+			p = none
+			wait = async || => await p
+			p = wait()
+			await p
+		`)
+		assert.ErrorIs(t, err, errDeadlock)
+		cancel()
+	}
+
+	assert.True(t, settled(base), "goroutines: %d, base: %d", runtime.NumGoroutine(), base)
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestMachine_Stream(t *testing.T) {
+	vm := New()
+	var out closeBuffer
+	require.NoError(t, vm.SetGlobal("input", stream.NewReader(strings.NewReader("id,name\r\n1,a\n2,b"))))
+	require.NoError(t, vm.SetGlobal("output", stream.NewWriter(&out)))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using stream
+		using bytes
+
+		pub header = input.read_line()
+		for line in stream.lines(input) {
+			output.write(line + ";")
+		}
+		pub eof = input.read_line()
+		pub empty = bytes.to_string(input.read(4))
+		output.write(bytes.from_string("!"))
+		output.close()
+		pub is_s = stream.is_stream(input) and not stream.is_stream({})
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, "1,a;2,b;!", out.String())
+	assert.True(t, out.closed)
+
+	pubs := vm.Published()
+	for name, expected := range map[string]string{"header": "id,name", "eof": "none", "empty": "", "is_s": "true"} {
+		v, err := pubs.Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+
+	var copied bytes.Buffer
+	src := strings.Repeat("x", 100_000)
+	require.NoError(t, vm.SetGlobal("src", stream.NewReader(strings.NewReader(src))))
+	require.NoError(t, vm.SetGlobal("dst", stream.NewWriter(&copied)))
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using stream
+
+		pub n = stream.copy(dst, src)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, src, copied.String())
+	n, err := vm.Published().Get(variant.NewString("n"))
+	require.NoError(t, err)
+	assert.Equal(t, "100000", n.String())
+
+	// n bounds the read, the buffer is not allocated by it
+	require.NoError(t, vm.SetGlobal("src", stream.NewReader(strings.NewReader("abc"))))
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using bytes
+
+		pub head = bytes.to_string(src.read(2))
+		pub rest = bytes.to_string(src.read(20_000_000_000))
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	for name, expected := range map[string]string{"head": "ab", "rest": "c"} {
+		v, err := vm.Published().Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+}
+
+func TestMachine_Exec(t *testing.T) {
+	if _, err := osexec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+
+	src := `
+		using exec
+
+		res = exec.run(["cat"], {"stdin": "hello"})
+		pub out = res.stdout
+		pub code = res.code
+		pub missing = exec.look_path("surely-not-a-command")
+	`
+
+	vm := New()
+	stmt, err := vm.Compile("", strings.NewReader(src))
+	require.NoError(t, err)
+	assert.ErrorIs(t, stmt.Invoke(), exec.ErrNotAllowed)
+
+	vm = New()
+	vm.Grant(CapabilityExec)
+	stmt, err = vm.Compile("", strings.NewReader(src))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	for name, expected := range map[string]string{"out": "hello", "code": "0", "missing": "none"} {
+		v, err := pubs.Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using exec
+
+		exec.run(["sleep", "5"], {"timeout": 0.05})
+	`))
+	require.NoError(t, err)
+	err = stmt.Invoke()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+
+	// the context of Run kills the command
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = vm.Run(ctx, `
+		using exec
+
+		exec.run(["sleep", "2"])
+	`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// fakeConn answers queries with n rows of (id, name, data) where n is the
+// first parameter, "sleep" blocks until the context is done and other
+// statements affect one row.
+type fakeConn struct{}
+
+func (fakeConn) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConn) Driver() driver.Driver                        { return nil }
+func (fakeConn) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                                 { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query == "sleep" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return &fakeRows{n: args[0].Value.(int64)}, nil
+}
+
+func (fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	i, n int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name", "data"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i == r.n {
+		return io.EOF
+	}
+
+	dest[0], dest[1], dest[2] = r.i, []byte(fmt.Sprintf("row%d", r.i)), nil
+	r.i++
+	return nil
+}
+
+func TestMachine_SQL(t *testing.T) {
+	db := sql.OpenDB(fakeConn{})
+	defer db.Close()
+
+	vm := New()
+	vm.RegisterDB("main", db)
+	vm.SetSQLLimits(elsql.Limits{MaxRows: 3, Timeout: 50 * time.Millisecond})
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using sql
+
+		pub s = ""
+		for row in sql.query("main", "select * from t limit ?", [2]) {
+			s = s + str(row.id) + row.name + str(row.data) + ";"
+		}
+		pub affected = sql.exec("main", "delete from t where id = ?", [1]).rows_affected
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	for name, expected := range map[string]string{"s": "0row0none;1row1none;", "affected": "1"} {
+		v, err := pubs.Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+
+	for src, msg := range map[string]string{
+		`sql.query("main", "select", [4])`:  "more than 3 rows",
+		`sql.query("main", "sleep")`:        "deadline exceeded",
+		`sql.query("other", "select", [1])`: "not registered",
+	} {
+		stmt, err := vm.Compile("", strings.NewReader("using sql\n"+src))
+		require.NoError(t, err)
+		err = stmt.Invoke()
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), msg, src)
+	}
+}
+
+func TestMachine_Store(t *testing.T) {
+	kv := store.NewMemory()
+	vm := New()
+	vm.SetStore(kv)
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using store
+		using bytes
+
+		runs = store.get("runs", 0) + 1
+		store.set("runs", runs)
+		store.set("job:a", {"done": true, "items": [1, 2.5, "x", none], "raw": bytes.from_hex("ff00")})
+		store.set("job:b", 2)
+		store.set("tmp", 1)
+		store.delete("tmp")
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	require.NoError(t, stmt.Invoke())
+
+	// the store outlives the machine
+	vm = New()
+	vm.SetStore(kv)
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using store
+		using bytes
+
+		pub runs = store.get("runs")
+		a = store.get("job:a")
+		pub job = str(a.done) + str(a.items) + bytes.to_hex(a.raw)
+		pub keys = store.list("job:")
+		pub missing = store.get("tmp")
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	for name, expected := range map[string]string{
+		"runs":    "2",
+		"job":     "true[1, 2.5, x, none]ff00",
+		"keys":    "[job:a, job:b]",
+		"missing": "none",
+	} {
+		v, err := pubs.Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using store
+
+		store.set("fn", || => 1)
+	`))
+	require.NoError(t, err)
+	assert.Error(t, stmt.Invoke())
+}
+
+func TestMachine_Glob(t *testing.T) {
+	vm := New()
+	vm.SetFS(fstest.MapFS{
+		"logs/b.log":     &fstest.MapFile{},
+		"logs/a.log":     &fstest.MapFile{},
+		"logs/a.txt":     &fstest.MapFile{},
+		"logs/old/c.log": &fstest.MapFile{},
+	})
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using glob
+
+		pub logs = glob.glob("logs/*.log")
+		pub nested = glob.glob("logs/*/*.log")
+		pub matched = glob.match("*.log", "a.log") and not glob.match("*.log", "dir/a.log")
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	pubs := vm.Published()
+	for name, expected := range map[string]string{
+		"logs":    "[logs/a.log, logs/b.log]",
+		"nested":  "[logs/old/c.log]",
+		"matched": "true",
+	} {
+		v, err := pubs.Get(variant.NewString(name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, v.String(), name)
+	}
+
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using glob
+
+		glob.match("[", "a")
+	`))
+	require.NoError(t, err)
+	assert.Error(t, stmt.Invoke())
+}
+
+func TestMachine_ArchiveStream(t *testing.T) {
+	var buf bytes.Buffer
+	vm := New()
+	require.NoError(t, vm.SetGlobal("out", stream.NewWriter(&buf)))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using archive
+
+		archive.tar([{"name": "a.txt", "data": "hello"}], out)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	require.NoError(t, vm.SetGlobal("src", stream.NewReader(&buf)))
+	stmt, err = vm.Compile("", strings.NewReader(`
+		using archive
+		using bytes
+
+		e = archive.read_tar(src)[0]
+		pub entry = e.name + ":" + bytes.to_string(e.data)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	entry, err := vm.Published().Get(variant.NewString("entry"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt:hello", entry.String())
+}
+
+func TestMachine_CompressStream(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	require.NoError(t, w.Close())
+
+	var out bytes.Buffer
+	vm := New()
+	require.NoError(t, vm.SetGlobal("src", stream.NewReader(&gz)))
+	require.NoError(t, vm.SetGlobal("dst", stream.NewWriter(&out)))
+
+	stmt, err := vm.Compile("", strings.NewReader(`
+		using compress
+		using stream
+
+		pub n = 0
+		for line in stream.lines(compress.gzip_reader(src)) {
+			n += 1
+		}
+		compress.zlib_compress("data", dst)
+	`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+
+	n, err := vm.Published().Get(variant.NewString("n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1000", n.String())
+
+	r, err := zlib.NewReader(&out)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestMachine_Errors(t *testing.T) {
+	vm := New()
+	vm.SetFS(fstest.MapFS{
+		"bad.ela":    &fstest.MapFile{Data: []byte("x = (")},
+		"broken.ela": &fstest.MapFile{Data: []byte("x = 0\ny = 1 % x")},
+	})
+
+	_, err := vm.Compile("main.ela", strings.NewReader("x = 1\ny = ("))
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.ErrorIs(t, err, ErrParse)
+	assert.Equal(t, 2, perr.Pos.Line)
+
+	_, err = vm.Compile("main.ela", strings.NewReader("x = 1\ny = undefined_var"))
+	var cerr *CompileError
+	require.ErrorAs(t, err, &cerr)
+	assert.ErrorIs(t, err, ErrCompile)
+	assert.Equal(t, 2, cerr.Pos.Line)
+	assert.Contains(t, err.Error(), "variable undefined_var not defined")
+
+	_, err = vm.Compile("main.ela", strings.NewReader("x = 1\ny = [\"ok\", \"a\\qb\"]"))
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 2, cerr.Pos.Line)
+	assert.Equal(t, 14, cerr.Pos.Column)
+	assert.Contains(t, err.Error(), "unknown escape sequence \\q")
+
+	_, err = vm.Compile("main.ela", strings.NewReader("s = \"\"\"\n  a\n  \\x4\n  \"\"\""))
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 3, cerr.Pos.Line)
+	assert.Equal(t, 3, cerr.Pos.Column)
+
+	_, err = vm.Compile("main.ela", strings.NewReader("x = 1\ny = x + undefined_var"))
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 2, cerr.Pos.Line)
+	assert.Equal(t, 9, cerr.Pos.Column)
+	assert.Contains(t, err.Error(), "variable undefined_var not defined")
+
+	_, err = vm.Compile("main.ela", strings.NewReader("f = |x| => {\n  if x {\n    break\n  }\n}"))
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 3, cerr.Pos.Line)
+	assert.Equal(t, 5, cerr.Pos.Column)
+
+	_, err = vm.Compile("main.ela", strings.NewReader(`lib = import "bad.ela"`))
+	var ierr *ImportError
+	require.ErrorAs(t, err, &ierr)
+	assert.Equal(t, "bad.ela", ierr.Path)
+	assert.ErrorIs(t, err, ErrParse)
+
+	stmt, err := vm.Compile("main.ela", strings.NewReader("\n\nlib = import \"broken.ela\""))
+	require.NoError(t, err)
+	err = stmt.Invoke()
+	assert.ErrorIs(t, err, ErrImport)
+	var rerr *RuntimeError
+	require.ErrorAs(t, err, &rerr)
+	assert.Equal(t, "broken.ela", rerr.Pos.Filename)
+	assert.Equal(t, 2, rerr.Pos.Line)
+
+	// the position is of the failing node, not of the top level statement
+	require.NoError(t, vm.SetGlobal("fail", variant.NewFunc([]string{}, func(variant.Args) (variant.Iface, error) {
+		return nil, errors.New("boom")
+	})))
+	for _, tc := range []struct {
+		src          string
+		line, column int
+	}{
+		{src: "x = 0\ny = 1 + 1 % x", line: 2, column: 11},
+		{src: "f = || => {\n  z = 0\n  return 1 % z\n}\nf()", line: 3, column: 12},
+		{src: "f = || => {\n  z = 1\n  z.a = 1\n}\nf()", line: 3, column: 3},
+		{src: "x = [\n  1,\n  fail(),\n]", line: 3, column: 7},
+		{src: "x = {\"a\": 1}\ny = x.a.b", line: 2, column: 9},
+		{src: "x = [1]\ny = x[\"a\"]", line: 2, column: 6},
+		{src: "x = 1\nfor i in x {}", line: 2, column: 10},
+	} {
+		stmt, err := vm.Compile("main.ela", strings.NewReader(tc.src))
+		require.NoError(t, err, tc.src)
+
+		err = stmt.Invoke()
+		require.ErrorAs(t, err, &rerr, tc.src)
+		assert.Equal(t, tc.line, rerr.Pos.Line, tc.src)
+		assert.Equal(t, tc.column, rerr.Pos.Column, tc.src)
+	}
+
+	for src, msg := range map[string]string{
+		`substr("abc", 0.5)`:   "substr() start must be an integer",
+		`substr("abc", 0, "")`: "substr() length must be an integer",
+	} {
+		stmt, err := vm.Compile("main.ela", strings.NewReader(src))
+		require.NoError(t, err, src)
+		assert.ErrorContains(t, stmt.Invoke(), msg, src)
+	}
+
+	require.NoError(t, vm.SetGlobal("with_timeout", variant.NewFunc([]string{"fn"}, func(args variant.Args) (variant.Iface, error) {
+		return variant.MustCast[*variant.Func](args[0]).CallTimeout(10*time.Millisecond, nil)
+	})))
+	stmt, err = vm.Compile("main.ela", strings.NewReader("with_timeout(|| => block { while true {} })"))
+	require.NoError(t, err)
+	err = stmt.Invoke()
+	assert.ErrorIs(t, err, ErrLimit)
+	assert.ErrorIs(t, err, ErrRuntime)
+}
+
+func TestMachine_RecoverPanic(t *testing.T) {
+	vm := New()
+	require.NoError(t, vm.SetGlobal("boom", variant.NewFunc([]string{}, func(variant.Args) (variant.Iface, error) {
+		var arr []int
+		return variant.Int(arr[1]), nil
+	})))
+
+	for _, src := range []string{
+		"x = 1\nboom()",
+		"x = 1\nfor x in (|| => { yield boom() })() {}",
+		"x = 1\nawait (async || => boom())()",
+	} {
+		stmt, err := vm.Compile("main.ela", strings.NewReader(src))
+		require.NoError(t, err)
+
+		err = stmt.Invoke()
+		var rerr *RuntimeError
+		require.ErrorAs(t, err, &rerr, src)
+		assert.Equal(t, 2, rerr.Pos.Line, src)
+		assert.NotEmpty(t, rerr.Stack, src)
+
+		var perr *variant.PanicError
+		require.ErrorAs(t, err, &perr, src)
+		var rtErr runtime.Error
+		assert.ErrorAs(t, err, &rtErr, src)
+	}
+}
+
+func TestMachine_Run(t *testing.T) {
+	var out bytes.Buffer
+	vm := New()
+	vm.SetOutput(&out)
+
+	res, err := vm.Run(context.Background(), `
+		pub answer = 0
+		for i in range(3) {
+			answer = answer + i
+		}
+		println("done")
+		answer * 2
+	`)
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.Int(6), res.Value))
+	v, err := res.Published.Get(variant.NewString("answer"))
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.Int(3), v))
+	assert.Equal(t, "done\n", res.Output)
+	assert.Empty(t, out.String())
+	assert.Positive(t, res.Metrics.Steps)
+	assert.Positive(t, res.Metrics.Duration)
+
+	// the output is not captured after Run
+	stmt, err := vm.Compile("", strings.NewReader(`println("after")`))
+	require.NoError(t, err)
+	require.NoError(t, stmt.Invoke())
+	assert.Equal(t, "after\n", out.String())
+
+	res, err = vm.Run(context.Background(), `x = 1`)
+	require.NoError(t, err)
+	assert.True(t, variant.DeepEqual(variant.NewNone(), res.Value))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = vm.Run(ctx, `while true {}`)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the context does not stop later runs
+	_, err = vm.Run(context.Background(), `for i in range(3) {}`)
+	assert.NoError(t, err)
+}
+
+func TestMachinePool(t *testing.T) {
+	base := New()
+	require.NoError(t, base.SetGlobal("name", variant.NewString("")))
+	require.NoError(t, base.SetGlobal("count", variant.Int(0)))
+
+	pool, err := NewMachinePool(base, "main.ela", strings.NewReader(`
+		count = count + 1
+		pub greeting = "hi " + name
+		println(greeting)
+		count
+	`), 2)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprint("user", i)
+			res, err := pool.Run(context.Background(), map[string]variant.Iface{"name": variant.NewString(name)})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// globals are reset between runs
+			assert.True(t, variant.DeepEqual(variant.Int(1), res.Value))
+			assert.Equal(t, "hi "+name+"\n", res.Output)
+			greeting, err := res.Published.Get(variant.NewString("greeting"))
+			if assert.NoError(t, err) {
+				assert.Equal(t, "hi "+name, greeting.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	a, err := pool.Get(context.Background())
+	require.NoError(t, err)
+	b, err := pool.Get(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Get(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	a.Release()
+	b.Release()
+
+	_, err = NewMachinePool(base, "main.ela", strings.NewReader("x = "), 1)
+	assert.Error(t, err)
+}
+
+func TestMachine_ImportResolver(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/v1/util.ela": &fstest.MapFile{Data: []byte(`
+			json = import "std/json"
+			pub version = "v1 " + json.name
+		`)},
+		"lib/v2/util.ela": &fstest.MapFile{Data: []byte(`pub version = "v2"`)},
+	}
+
+	var froms []string
+	vm := New()
+	vm.SetImportResolver(ImportResolverFunc(func(from, path string) (io.ReadCloser, string, error) {
+		froms = append(froms, from)
+		switch path {
+		case "std/json":
+			return io.NopCloser(strings.NewReader(`pub name = "json"`)), "std/json", nil
+		case "util":
+			// pinned to v1
+			path = "lib/v1/util.ela"
+		}
+
+		return FSResolver(fsys).Resolve(from, path)
+	}))
+
+	program, err := vm.CompileProgram("main.ela", strings.NewReader(`
+		util = import "util"
+		pub version = util.version
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.ela", "lib/v1/util.ela"}, froms)
+	assert.Equal(t, []string{"lib/v1/util.ela", "std/json"}, program.Imports)
+
+	require.NoError(t, program.Invoke())
+	version, err := vm.Published().Get(variant.NewString("version"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1 json", version.String())
+
+	_, err = vm.CompileProgram("main.ela", strings.NewReader(`x = import "lib/v3/util.ela"`))
+	var ierr *ImportError
+	require.ErrorAs(t, err, &ierr)
+	assert.Equal(t, "lib/v3/util.ela", ierr.Path)
+	assert.ErrorIs(t, err, ErrImport)
+
+	// canonical names detect cycles of aliases
+	vm.SetImportResolver(ImportResolverFunc(func(from, path string) (io.ReadCloser, string, error) {
+		return io.NopCloser(strings.NewReader(`x = import "b"`)), "self", nil
+	}))
+	_, err = vm.CompileProgram("main.ela", strings.NewReader(`x = import "a"`))
+	assert.ErrorContains(t, err, "import cycle not allowed")
+}
+
+func TestMachine_RegisterModule(t *testing.T) {
+	vm := New()
+	vm.SetFS(fstest.MapFS{
+		"utils.ela": &fstest.MapFile{Data: []byte(`pub name = "file"`)},
+		"other.ela": &fstest.MapFile{Data: []byte(`pub name = "other"`)},
+	})
+	require.NoError(t, vm.RegisterModule("utils.ela", `
+		strings = import "lib/strings.ela"
+		pub name = "module " + strings.name
+	`))
+	require.NoError(t, vm.RegisterModule("./lib/strings.ela", `pub name = "strings"`))
+	assert.Error(t, vm.RegisterModule("../utils.ela", ""))
+
+	program, err := vm.CompileProgram("main.ela", strings.NewReader(`
+		pub utils = (import "./utils.ela").name
+		pub other = (import "other.ela").name
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lib/strings.ela", "other.ela", "utils.ela"}, program.Imports)
+	require.NoError(t, program.Invoke())
+
+	expected := variant.FromMap(map[string]variant.Iface{
+		"utils": variant.NewString("module strings"),
+		"other": variant.NewString("other"),
+	})
+	assert.True(t, variant.DeepEqual(expected, vm.Published()), vm.Published().String())
+}
+
+func TestMachine_DottedPackages(t *testing.T) {
+	vm := New()
+	require.NoError(t, vm.Register(packages.New("net.http").AddString("name", "http").Build()))
+	require.NoError(t, vm.Register(packages.New("encoding.json").AddString("name", "json").Build()))
+	assert.Error(t, vm.Register(packages.New("net..http").Build()))
+	assert.Error(t, vm.Register(packages.New("net.if").Build()))
+
+	program, err := vm.CompileProgram("main.ela", strings.NewReader(`
+		using net.http
+		using encoding.json as enc
+		pub names = [http.name, enc.name]
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"encoding.json", "net.http"}, program.Packages)
+	require.NoError(t, program.Invoke())
+
+	names, err := vm.Published().Get(variant.NewString("names"))
+	require.NoError(t, err)
+	assert.Equal(t, "[http, json]", names.String())
+
+	_, err = vm.Compile("", strings.NewReader(`using net`))
+	assert.Error(t, err)
+}
+
+func TestMachine_UsingUnknown(t *testing.T) {
+	vm := New()
+	_, err := vm.Compile("", strings.NewReader(`using itre`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "package 'itre' not found, did you mean 'iter'?")
+	assert.Contains(t, err.Error(), "available: archive, builtin,")
+
+	_, err = vm.Compile("", strings.NewReader(`using zzz`))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "did you mean")
+
+	// globals of the previous program are bound again
+	_, err = vm.Compile("", strings.NewReader(`using iter`))
+	require.NoError(t, err)
+	_, err = vm.Compile("", strings.NewReader(`using iter`))
+	require.NoError(t, err)
+}
+
+func TestMachine_LazyPackage(t *testing.T) {
+	var inits atomic.Int32
+	pkg := packages.Lazy("greet", func(host packages.Host) (packages.Iface, error) {
+		inits.Add(1)
+		greeting, _ := host.Config("greet").(string)
+		if greeting == "" {
+			return nil, errors.New("greeting is not configured")
+		}
+
+		return packages.New("greet").AddString("hello", greeting).Build(), nil
+	})
+
+	vm := New()
+	require.NoError(t, vm.Register(pkg))
+
+	_, err := vm.Compile("", strings.NewReader(`x = 1`))
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), inits.Load())
+
+	_, err = vm.Compile("", strings.NewReader(`using greet`))
+	assert.ErrorContains(t, err, "greeting is not configured")
+
+	vm.Configure("greet", "hi")
+	clone := vm.Clone()
+	clone.Configure("greet", "hello")
+
+	run := func(vm *Machine) string {
+		res, err := vm.Run(context.Background(), `
+			using greet
+			greet.hello
+		`)
+		require.NoError(t, err)
+		return res.Value.String()
+	}
+
+	assert.Equal(t, "hi", run(vm))
+	assert.Equal(t, "hi", run(vm))
+	assert.Equal(t, "hello", run(clone))
+	// the failed init, then once per machine
+	assert.Equal(t, int32(3), inits.Load())
+}
+
+func TestMachine_OverridePackages(t *testing.T) {
+	mock := packages.New("sql").
+		AddFunc("query", func(args variant.Args) (variant.Iface, error) {
+			return variant.NewString("mocked"), nil
+		}).
+		Build()
+
+	vm := New()
+	require.NoError(t, vm.Override(mock))
+	require.NoError(t, vm.Unregister("exec"))
+	assert.Error(t, vm.Unregister("exec"))
+	assert.Error(t, vm.Unregister("builtin"))
+	assert.Error(t, vm.Override(packages.New("builtin").Build()))
+
+	run := func(vm *Machine, src string) (string, error) {
+		res, err := vm.Run(context.Background(), src)
+		if err != nil {
+			return "", err
+		}
+
+		return res.Value.String(), nil
+	}
+
+	clone := vm.Clone()
+	for _, m := range []*Machine{vm, clone} {
+		out, err := run(m, "using sql\nsql.query()")
+		require.NoError(t, err)
+		assert.Equal(t, "mocked", out)
+
+		_, err = run(m, "using exec")
+		assert.ErrorContains(t, err, "package 'exec' not found")
+	}
+
+	// other machines keep their packages
+	other := New()
+	_, err := run(other, "using exec")
+	assert.NoError(t, err)
+	_, err = run(other, "using sql\nsql.query()")
+	assert.Error(t, err)
+
+	require.NoError(t, vm.Register(packages.New("exec").Build()))
+	_, err = run(vm.Clone(), "using exec")
+	assert.NoError(t, err)
+}
+
+func TestMachine_ShadowWarnings(t *testing.T) {
+	src := `
+		len = |x| => 0
+		using iter
+		f = || => {
+			let print = 1
+			print = 2
+			iter = none
+		}
+		n = 1
+	`
+
+	var warns []string
+	vm := New()
+	vm.OnWarning(func(w Warning) { warns = append(warns, w.String()) })
+	_, err := vm.Compile("main.ela", strings.NewReader(src))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"main.ela:2:3: assignment to 'len' shadows the builtin",
+		"main.ela:5:4: assignment to 'print' shadows the builtin",
+		"main.ela:7:4: assignment to 'iter' shadows package 'iter'",
+	}, warns)
+
+	vm = New()
+	vm.SetStrict(true)
+	_, err = vm.Compile("main.ela", strings.NewReader(src))
+	assert.ErrorContains(t, err, "assignment to 'len' shadows the builtin")
+
+	_, err = vm.Compile("main.ela", strings.NewReader(`
+		let x = 1
+		x = 2
+	`))
+	assert.NoError(t, err)
+}
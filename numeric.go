@@ -0,0 +1,22 @@
+package easylang
+
+// NumericPolicy defines results of division by zero and invalid arithmetic
+// operations, e.g. 0 / 0 or inf - inf.
+type NumericPolicy uint8
+
+const (
+	// NumericInf makes division of a non-zero number by zero an infinity,
+	// invalid operations are errors. It is the default policy.
+	NumericInf NumericPolicy = iota
+	// NumericError makes division by zero and invalid operations errors.
+	NumericError
+	// NumericNaN makes division of a non-zero number by zero an infinity,
+	// invalid operations give NaN like IEEE 754 floats.
+	NumericNaN
+)
+
+// SetNumericPolicy sets the result of division by zero and invalid
+// arithmetic operations. It must be called before Compile.
+func (m *Machine) SetNumericPolicy(p NumericPolicy) {
+	m.numeric = p
+}
@@ -0,0 +1,64 @@
+package easylang
+
+import (
+	"fmt"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// opcode is the binary operator resolved at codegen, so evaluation
+// dispatches by binaryHandlers instead of comparing operator strings.
+type opcode uint8
+
+const (
+	opAdd opcode = iota
+	opSub
+	opMul
+	opDiv
+	opMod
+	opEq
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+	opAnd
+	opOr
+	opEnd
+)
+
+var opNames = [opEnd]string{"+", "-", "*", "/", "%", "==", "!=", "<", "<=", ">", ">=", "and", "or"}
+
+func (op opcode) String() string {
+	return opNames[op]
+}
+
+func opcodeOf(op string) (opcode, error) {
+	for i, name := range opNames {
+		if name == op {
+			return opcode(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// binaryHandler applies operators of its kind to values not overloaded by
+// host variants and objects.
+type binaryHandler func(op opcode, lval, rval variant.Iface, numeric NumericPolicy) (variant.Iface, error)
+
+var binaryHandlers = [opEnd]binaryHandler{
+	opAdd: evalAdd,
+	opSub: evalArith,
+	opMul: evalArith,
+	opDiv: evalArith,
+	opMod: evalArith,
+	opEq:  evalEquality,
+	opNe:  evalEquality,
+	opLt:  evalOrder,
+	opLe:  evalOrder,
+	opGt:  evalOrder,
+	opGe:  evalOrder,
+	opAnd: evalPredicate,
+	opOr:  evalPredicate,
+}
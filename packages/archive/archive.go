@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hikitani/easylang/packages/stream"
+	"github.com/hikitani/easylang/variant"
+)
+
+type entry struct {
+	name string
+	data []byte
+}
+
+func (e entry) isDir() bool {
+	return strings.HasSuffix(e.name, "/")
+}
+
+// source returns the reader of bytes or the stream.
+func source(name string, v variant.Iface) (io.Reader, error) {
+	if arr, ok := v.(*variant.Array); ok {
+		if bs, ok := arr.Bytes(); ok {
+			return bytes.NewReader(bs), nil
+		}
+	}
+
+	if r, ok := stream.AsReader(v); ok {
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("%s() first argument must be bytes or stream, got %s", name, v.Type())
+}
+
+func toObject(e entry) variant.Iface {
+	return variant.FromMap(map[string]variant.Iface{
+		"name": variant.NewString(e.name),
+		"data": variant.Bytes(e.data),
+		"dir":  variant.NewBool(e.isDir()),
+	})
+}
+
+// parseEntries returns entries of the array of {name, data} objects. Data is
+// string or bytes, names ending with "/" are directories without data.
+func parseEntries(name string, v variant.Iface) ([]entry, error) {
+	arr, ok := v.(*variant.Array)
+	if !ok {
+		return nil, fmt.Errorf("%s() first argument must be array of entries, got %s", name, v.Type())
+	}
+
+	var entries []entry
+	for i, el := range arr.Elems() {
+		obj, ok := el.(*variant.Object)
+		if !ok {
+			return nil, fmt.Errorf("%s(): entry at %d position must be object, got %s", name, i, el.Type())
+		}
+
+		ename, err := obj.Get(variant.NewString("name"))
+		if err != nil || ename.Type() != variant.TypeString || ename.String() == "" {
+			return nil, fmt.Errorf("%s(): entry at %d position must have non empty string name", name, i)
+		}
+
+		e := entry{name: ename.String()}
+		data, err := obj.Get(variant.NewString("data"))
+		if err != nil || data.Type() == variant.TypeNone {
+			entries = append(entries, e)
+			continue
+		}
+
+		switch data := data.(type) {
+		case *variant.String:
+			e.data = []byte(data.String())
+		case *variant.Array:
+			bs, ok := data.Bytes()
+			if !ok {
+				return nil, fmt.Errorf("%s(): data of entry '%s' must be string or bytes, got array", name, e.name)
+			}
+
+			e.data = bs
+		default:
+			return nil, fmt.Errorf("%s(): data of entry '%s' must be string or bytes, got %s", name, e.name, data.Type())
+		}
+
+		if e.isDir() && len(e.data) != 0 {
+			return nil, fmt.Errorf("%s(): directory '%s' cannot have data", name, e.name)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// output writes the archive made by fn to the stream given as the second
+// argument or returns it as bytes.
+func output(name string, args variant.Args, fn func(w io.Writer) error) (variant.Iface, error) {
+	if len(args) == 2 {
+		w, ok := stream.AsWriter(args[1])
+		if !ok {
+			return nil, fmt.Errorf("%s() second argument must be stream, got %s", name, args[1].Type())
+		}
+
+		if err := fn(w); err != nil {
+			return nil, fmt.Errorf("%s(): %w", name, err)
+		}
+
+		return variant.NewNone(), nil
+	}
+
+	var buf bytes.Buffer
+	if err := fn(&buf); err != nil {
+		return nil, fmt.Errorf("%s(): %w", name, err)
+	}
+
+	return variant.Bytes(buf.Bytes()), nil
+}
+
+// ReadZip returns entries of the zip archive as objects with name, data and
+// dir fields.
+func ReadZip(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("read_zip() takes exactly one argument")
+	}
+
+	r, err := source("read_zip", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// zip needs random access, so streams are read entirely.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read_zip(): %w", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("read_zip(): %w", err)
+	}
+
+	elems := make([]variant.Iface, 0, len(zr.File))
+	for _, f := range zr.File {
+		e := entry{name: f.Name}
+		if !e.isDir() {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("read_zip(): entry '%s': %w", f.Name, err)
+			}
+
+			e.data, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read_zip(): entry '%s': %w", f.Name, err)
+			}
+		}
+
+		elems = append(elems, toObject(e))
+	}
+
+	return variant.NewArray(elems), nil
+}
+
+// ReadTar returns entries of the tar archive like ReadZip. Only regular
+// files and directories are returned.
+func ReadTar(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("read_tar() takes exactly one argument")
+	}
+
+	r, err := source("read_tar", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var elems []variant.Iface
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read_tar(): %w", err)
+		}
+
+		e := entry{name: hdr.Name}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if !e.isDir() {
+				e.name += "/"
+			}
+		case tar.TypeReg:
+			if e.data, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("read_tar(): entry '%s': %w", hdr.Name, err)
+			}
+		default:
+			continue
+		}
+
+		elems = append(elems, toObject(e))
+	}
+
+	return variant.NewArray(elems), nil
+}
+
+// Zip creates the zip archive of entries. The archive is written to the
+// stream given as the second argument or returned as bytes.
+func Zip(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("zip() takes one or two arguments")
+	}
+
+	entries, err := parseEntries("zip", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return output("zip", args, func(w io.Writer) error {
+		zw := zip.NewWriter(w)
+		for _, e := range entries {
+			fw, err := zw.Create(e.name)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fw.Write(e.data); err != nil {
+				return err
+			}
+		}
+
+		return zw.Close()
+	})
+}
+
+// Tar creates the tar archive of entries like Zip.
+func Tar(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("tar() takes one or two arguments")
+	}
+
+	entries, err := parseEntries("tar", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return output("tar", args, func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		for _, e := range entries {
+			hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+			if e.isDir() {
+				hdr.Mode, hdr.Typeflag = 0o755, tar.TypeDir
+			}
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+
+			if _, err := tw.Write(e.data); err != nil {
+				return err
+			}
+		}
+
+		return tw.Close()
+	})
+}
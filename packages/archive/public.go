@@ -0,0 +1,11 @@
+package archive
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("archive").
+	AddFunc("read_zip", ReadZip).
+	AddFunc("read_tar", ReadTar).
+	AddFunc("zip", Zip).
+	AddFunc("tar", Tar).
+	Build()
@@ -0,0 +1,339 @@
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+func lessDefault(a, b variant.Iface) (bool, error) {
+	if a.Type() != b.Type() {
+		return false, fmt.Errorf("types mismatch: %s != %s", a.Type(), b.Type())
+	}
+
+	if a, ok := a.(*variant.Num); ok {
+		return a.LessThan(variant.MustCast[*variant.Num](b)), nil
+	}
+
+	cmp, err := variant.Compare(a, b)
+	if err != nil {
+		return false, err
+	}
+
+	return cmp < 0, nil
+}
+
+func lessFunc(cmp *variant.Func) func(a, b variant.Iface) (bool, error) {
+	return func(a, b variant.Iface) (bool, error) {
+		res, err := cmp.Call(variant.Args{a, b})
+		if err != nil {
+			return false, err
+		}
+
+		switch res := res.(type) {
+		case *variant.Bool:
+			return res.Bool(), nil
+		case *variant.Num:
+			return res.Sign() < 0, nil
+		}
+
+		return false, fmt.Errorf("comparator must return bool or number, got %s", res.Type())
+	}
+}
+
+func Sort(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("sort() takes one or two arguments")
+	}
+
+	if args[0].Type() != variant.TypeArray {
+		return nil, errors.New("sort() first argument must be array")
+	}
+
+	less := lessDefault
+	if len(args) == 2 {
+		cmp, err := funcArg("sort", "second", args[1], 2)
+		if err != nil {
+			return nil, err
+		}
+
+		less = lessFunc(cmp)
+	}
+
+	elems := variant.MustCast[*variant.Array](args[0]).Elems()
+	sorted := make([]variant.Iface, len(elems))
+	copy(sorted, elems)
+
+	var sortErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+
+		ok, err := less(sorted[i], sorted[j])
+		if err != nil {
+			sortErr = err
+		}
+
+		return ok
+	})
+	if sortErr != nil {
+		return nil, fmt.Errorf("sort(): %w", sortErr)
+	}
+
+	return variant.NewArray(sorted), nil
+}
+
+func funcArg(name string, pos string, arg variant.Iface, arity int) (*variant.Func, error) {
+	if arg.Type() != variant.TypeFunc {
+		return nil, fmt.Errorf("%s() %s argument must be function", name, pos)
+	}
+
+	fn := variant.MustCast[*variant.Func](arg)
+	if len(fn.Idents()) != arity {
+		return nil, fmt.Errorf("%s() function must take exactly %d argument(s)", name, arity)
+	}
+
+	return fn, nil
+}
+
+func Map(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("map() takes exactly two arguments")
+	}
+
+	if args[0].Type() != variant.TypeArray {
+		return nil, errors.New("map() first argument must be array")
+	}
+
+	fn, err := funcArg("map", "second", args[1], 1)
+	if err != nil {
+		return nil, err
+	}
+
+	elems := variant.MustCast[*variant.Array](args[0]).Elems()
+	res := make([]variant.Iface, 0, len(elems))
+	for _, el := range elems {
+		v, err := fn.Call(variant.Args{el})
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, v)
+	}
+
+	return variant.NewArray(res), nil
+}
+
+func Filter(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("filter() takes exactly two arguments")
+	}
+
+	if args[0].Type() != variant.TypeArray {
+		return nil, errors.New("filter() first argument must be array")
+	}
+
+	fn, err := funcArg("filter", "second", args[1], 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []variant.Iface
+	for _, el := range variant.MustCast[*variant.Array](args[0]).Elems() {
+		v, err := fn.Call(variant.Args{el})
+		if err != nil {
+			return nil, err
+		}
+
+		if v.Type() != variant.TypeBool {
+			return nil, errors.New("filter() predicate must return a bool")
+		}
+
+		if variant.MustCast[*variant.Bool](v).Bool() {
+			res = append(res, el)
+		}
+	}
+
+	return variant.NewArray(res), nil
+}
+
+func Reduce(args variant.Args) (variant.Iface, error) {
+	if len(args) != 3 {
+		return nil, errors.New("reduce() takes exactly three arguments")
+	}
+
+	if args[0].Type() != variant.TypeArray {
+		return nil, errors.New("reduce() first argument must be array")
+	}
+
+	fn, err := funcArg("reduce", "third", args[2], 2)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[1]
+	for _, el := range variant.MustCast[*variant.Array](args[0]).Elems() {
+		acc, err = fn.Call(variant.Args{acc, el})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
+
+func transpose(name string, arrs [][]variant.Iface, shortest bool) (variant.Iface, error) {
+	n := -1
+	for i, arr := range arrs {
+		switch {
+		case n == -1:
+			n = len(arr)
+		case len(arr) == n:
+		case shortest:
+			n = min(n, len(arr))
+		default:
+			return nil, fmt.Errorf("%s(): length mismatch: array at %d position has %d elements, expected %d", name, i+1, len(arr), n)
+		}
+	}
+
+	res := make([]variant.Iface, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		row := make([]variant.Iface, 0, len(arrs))
+		for _, arr := range arrs {
+			row = append(row, arr[i])
+		}
+
+		res = append(res, variant.NewArray(row))
+	}
+
+	return variant.NewArray(res), nil
+}
+
+// Zip takes arrays of equal length and returns an array of arrays, where the
+// i-th array contains the i-th element of each argument. If the last argument
+// is true, arrays of different length are allowed and the result is as long
+// as the shortest one.
+func Zip(args variant.Args) (variant.Iface, error) {
+	var shortest bool
+	if len(args) > 0 {
+		if b, ok := args[len(args)-1].(*variant.Bool); ok {
+			shortest = b.Bool()
+			args = args[:len(args)-1]
+		}
+	}
+
+	arrs := make([][]variant.Iface, 0, len(args))
+	for i, arg := range args {
+		if arg.Type() != variant.TypeArray {
+			return nil, fmt.Errorf("zip() argument at %d position must be array", i+1)
+		}
+
+		arrs = append(arrs, variant.MustCast[*variant.Array](arg).Elems())
+	}
+
+	return transpose("zip", arrs, shortest)
+}
+
+func Unzip(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("unzip() takes exactly one argument")
+	}
+
+	if args[0].Type() != variant.TypeArray {
+		return nil, errors.New("unzip() argument must be array of arrays")
+	}
+
+	elems := variant.MustCast[*variant.Array](args[0]).Elems()
+	arrs := make([][]variant.Iface, 0, len(elems))
+	for i, el := range elems {
+		if el.Type() != variant.TypeArray {
+			return nil, fmt.Errorf("unzip() element at %d position must be array", i+1)
+		}
+
+		arrs = append(arrs, variant.MustCast[*variant.Array](el).Elems())
+	}
+
+	return transpose("unzip", arrs, false)
+}
+
+// Push appends elements to the array in place, so the change is seen by all
+// holders of the array.
+func Push(args variant.Args) (variant.Iface, error) {
+	if len(args) == 0 {
+		return nil, errors.New("push() takes at least one argument")
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok {
+		return nil, errors.New("push() first argument must be array")
+	}
+
+	if err := arr.Push(args[1:]...); err != nil {
+		return nil, fmt.Errorf("push(): %w", err)
+	}
+
+	return variant.NewNone(), nil
+}
+
+// Pop removes the last element of the array in place and returns it.
+func Pop(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("pop() takes exactly one argument")
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok {
+		return nil, errors.New("pop() argument must be array")
+	}
+
+	el, err := arr.Pop()
+	if err != nil {
+		return nil, fmt.Errorf("pop(): %w", err)
+	}
+
+	return el, nil
+}
+
+// Slice returns elements of the array from start up to end. The result
+// shares elements with the array until either of them is changed.
+func Slice(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("slice() takes two or three arguments")
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok {
+		return nil, errors.New("slice() first argument must be array")
+	}
+
+	idx := func(arg variant.Iface) (int64, error) {
+		num, ok := arg.(*variant.Num)
+		if !ok {
+			return 0, errors.New("slice() indexes must be integers")
+		}
+
+		n, err := num.AsInt64()
+		if err != nil {
+			return 0, errors.New("slice() indexes must be integers")
+		}
+
+		return n, nil
+	}
+
+	start, err := idx(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	end := int64(arr.Len())
+	if len(args) == 3 {
+		if end, err = idx(args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	return arr.Sub(start, end), nil
+}
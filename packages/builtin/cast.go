@@ -2,6 +2,9 @@ package builtin
 
 import (
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 
 	"github.com/hikitani/easylang/variant"
 )
@@ -17,3 +20,70 @@ func StrBytes(args variant.Args) (variant.Iface, error) {
 
 	return variant.MustCast[*variant.String](args[0]).AsBytes(), nil
 }
+
+func parseNum(name, s string, base int) (*variant.Num, error) {
+	num, _, err := new(big.Float).Parse(strings.TrimSpace(s), base)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): cannot parse %q as number: %w", name, s, err)
+	}
+
+	return variant.NewNum(num), nil
+}
+
+func Num(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("num() takes exactly one argument")
+	}
+
+	switch arg := args[0].(type) {
+	case *variant.Num:
+		return arg, nil
+	case *variant.String:
+		return parseNum("num", arg.String(), 0)
+	}
+
+	return nil, errors.New("num() argument must be number or string")
+}
+
+func ParseInt(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("parse_int() takes one or two arguments")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, errors.New("parse_int() first argument must be string")
+	}
+
+	base := int64(10)
+	if len(args) == 2 {
+		if args[1].Type() != variant.TypeNum {
+			return nil, errors.New("parse_int() second argument must be number")
+		}
+
+		var err error
+		base, err = variant.MustCast[*variant.Num](args[1]).AsInt64()
+		if err != nil || base == 1 || base < 0 || base > 62 {
+			return nil, errors.New("parse_int() base must be 0 or integer from 2 to 62")
+		}
+	}
+
+	s := args[0].String()
+	n, ok := new(big.Int).SetString(strings.TrimSpace(s), int(base))
+	if !ok {
+		return nil, fmt.Errorf("parse_int(): cannot parse %q as integer in base %d", s, base)
+	}
+
+	return variant.NewNum(new(big.Float).SetInt(n)), nil
+}
+
+func ParseFloat(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("parse_float() takes exactly one argument")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, errors.New("parse_float() argument must be string")
+	}
+
+	return parseNum("parse_float", args[0].String(), 10)
+}
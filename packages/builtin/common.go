@@ -2,6 +2,7 @@ package builtin
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/hikitani/easylang/variant"
 )
@@ -13,7 +14,7 @@ func Len(args variant.Args) (variant.Iface, error) {
 
 	switch arg := args[0]; arg := arg.(type) {
 	case *variant.String:
-		return variant.Int(len(arg.String())), nil
+		return variant.Int(arg.Len()), nil
 	case *variant.Array:
 		return variant.Int(arg.Len()), nil
 	case *variant.Object:
@@ -23,6 +24,75 @@ func Len(args variant.Args) (variant.Iface, error) {
 	}
 }
 
+// At returns the element of the array, the character of the string or the
+// value of the object by key. Unlike indexing it returns the default, none
+// unless given, when the index is out of range or the key is not found.
+func At(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("at() takes two or three arguments")
+	}
+
+	var def variant.Iface = variant.NewNone()
+	if len(args) == 3 {
+		def = args[2]
+	}
+
+	if obj, ok := args[0].(*variant.Object); ok {
+		v, err := obj.Get(args[1])
+		if err != nil {
+			return def, nil
+		}
+
+		return v, nil
+	}
+
+	num, ok := args[1].(*variant.Num)
+	if !ok {
+		return nil, fmt.Errorf("at() index must be number, got %s", args[1].Type())
+	}
+
+	idx, err := num.AsInt64()
+	if err != nil {
+		return nil, fmt.Errorf("at() index: %w", err)
+	}
+
+	var v variant.Iface
+	switch arg := args[0].(type) {
+	case *variant.Array:
+		v, err = arg.Get(idx)
+	case *variant.String:
+		v, err = arg.Get(idx)
+	default:
+		return nil, errors.New("at() first argument must be array, string, or object")
+	}
+
+	if err != nil {
+		return def, nil
+	}
+
+	return v, nil
+}
+
+// Copy returns the shallow copy of the array or object, so changing it does
+// not change the original, while nested arrays and objects are shared.
+func Copy(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("copy() takes exactly one argument")
+	}
+
+	return variant.Copy(args[0]), nil
+}
+
+// Clone returns the deep copy of the array or object, nested arrays and
+// objects are copied too.
+func Clone(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("clone() takes exactly one argument")
+	}
+
+	return variant.DeepCopy(args[0]), nil
+}
+
 func Str(args variant.Args) (variant.Iface, error) {
 	if len(args) != 1 {
 		return nil, errors.New("str() takes exactly one argument")
@@ -30,3 +100,37 @@ func Str(args variant.Args) (variant.Iface, error) {
 
 	return variant.NewString(args[0].String()), nil
 }
+
+func Type(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("type() takes exactly one argument")
+	}
+
+	return variant.NewString(args[0].Type().String()), nil
+}
+
+// Types returns the object of type names returned by type(), keyed by
+// themselves, e.g. types.number == "number".
+func Types() map[string]variant.Iface {
+	types := make(map[string]variant.Iface, variant.TypeEnd)
+	for typ := variant.TypeNone; typ < variant.TypeEnd; typ++ {
+		types[typ.String()] = variant.NewString(typ.String())
+	}
+
+	return types
+}
+
+// SortedKeys returns keys of the object in the stable order, so the output
+// built from them does not depend on the order of the object.
+func SortedKeys(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("sorted_keys() takes exactly one argument")
+	}
+
+	obj, ok := args[0].(*variant.Object)
+	if !ok {
+		return nil, errors.New("sorted_keys() argument must be object")
+	}
+
+	return variant.NewArray(obj.SortedKeys()), nil
+}
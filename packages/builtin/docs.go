@@ -0,0 +1,59 @@
+package builtin
+
+import "github.com/hikitani/easylang/variant"
+
+// Docs describes builtin objects for help().
+var Docs = map[string]variant.Doc{
+	"print":       {Signature: "print(v...)", Text: "Writes values to the output."},
+	"println":     {Signature: "println(v...)", Text: "Writes values and the new line to the output."},
+	"printf":      {Signature: "printf(format, v...)", Text: "Writes values formatted as by format() to the output."},
+	"input":       {Signature: "input([prompt])", Text: "Reads the line from the input, the prompt is written before."},
+	"format":      {Signature: "format(format, v...)", Text: "Returns the string with %-verbs of format replaced by values."},
+	"help":        {Signature: "help(v)", Text: "Writes the documentation of the function, or of functions of the object."},
+	"all":         {Signature: "all(v...)", Text: "Reports whether all values are true by bool()."},
+	"any":         {Signature: "any(v...)", Text: "Reports whether any value is true by bool()."},
+	"sum":         {Signature: "sum(n...)", Text: "Returns the sum of numbers."},
+	"len":         {Signature: "len(v)", Text: "Returns the number of elements of the array or object, or characters of the string."},
+	"at":          {Signature: "at(v, i[, default])", Text: "Returns the element by index or key, or default (none) when it is absent."},
+	"copy":        {Signature: "copy(v)", Text: "Returns the shallow copy of the array or object."},
+	"clone":       {Signature: "clone(v)", Text: "Returns the deep copy of the array or object."},
+	"sorted_keys": {Signature: "sorted_keys(obj)", Text: "Returns keys of the object ordered by type and value."},
+	"min":         {Signature: "min(v...)", Text: "Returns the smallest of numbers or strings."},
+	"max":         {Signature: "max(v...)", Text: "Returns the largest of numbers or strings."},
+	"abs":         {Signature: "abs(n)", Text: "Returns the absolute value of the number."},
+	"iterable":    {Signature: "iterable(v)", Text: "Reports whether the value can be iterated by for loops."},
+	"bool":        {Signature: "bool(v)", Text: "Returns the truth value: none, false, zero and empty values are false."},
+	"is_none":     {Signature: "is_none(v)", Text: "Reports whether the value is none."},
+	"is_bool":     {Signature: "is_bool(v)", Text: "Reports whether the value is bool."},
+	"is_number":   {Signature: "is_number(v)", Text: "Reports whether the value is number."},
+	"is_nan":      {Signature: "is_nan(v)", Text: "Reports whether the value is the NaN number."},
+	"is_inf":      {Signature: "is_inf(v)", Text: "Reports whether the value is the infinite number."},
+	"is_string":   {Signature: "is_string(v)", Text: "Reports whether the value is string."},
+	"is_array":    {Signature: "is_array(v)", Text: "Reports whether the value is array."},
+	"is_object":   {Signature: "is_object(v)", Text: "Reports whether the value is object."},
+	"is_func":     {Signature: "is_func(v)", Text: "Reports whether the value is function."},
+	"is_handle":   {Signature: "is_handle(v)", Text: "Reports whether the value is handle."},
+	"is_promise":  {Signature: "is_promise(v)", Text: "Reports whether the value is promise."},
+	"delay":       {Signature: "delay(secs[, v])", Text: "Returns the promise resolved with v after the number of seconds."},
+	"type":        {Signature: "type(v)", Text: "Returns the type name of the value, see types."},
+	"types":       {Signature: "types", Text: "Object of type names returned by type()."},
+	"str":         {Signature: "str(v)", Text: "Returns the string form of the value."},
+	"chars":       {Signature: "chars(s)", Text: "Returns the array of characters of the string."},
+	"substr":      {Signature: "substr(s, start[, n])", Text: "Returns n characters of the string from start, or the rest of it."},
+	"num":         {Signature: "num(v)", Text: "Converts the string to the number."},
+	"parse_int":   {Signature: "parse_int(s[, base])", Text: "Parses the integer in the base, 10 by default."},
+	"parse_float": {Signature: "parse_float(s)", Text: "Parses the floating point number."},
+	"format_num":  {Signature: "format_num(n[, opts])", Text: "Formats the number with options like precision and base."},
+	"pow":         {Signature: "pow(x, y)", Text: "Returns x raised to the power y."},
+	"push":        {Signature: "push(arr, v...)", Text: "Appends values to the array in place."},
+	"pop":         {Signature: "pop(arr)", Text: "Removes the last element of the array in place and returns it."},
+	"slice":       {Signature: "slice(arr, start[, end])", Text: "Returns elements of the array from start up to end."},
+	"sort":        {Signature: "sort(arr[, less])", Text: "Returns the sorted copy of the array, less(a, b) compares elements."},
+	"map":         {Signature: "map(arr, fn)", Text: "Returns the array of fn(el) for elements of the array."},
+	"filter":      {Signature: "filter(arr, fn)", Text: "Returns elements of the array for which fn(el) is true."},
+	"reduce":      {Signature: "reduce(arr, init, fn)", Text: "Folds elements of the array with fn(acc, el) starting from init."},
+	"memoize":     {Signature: "memoize(fn[, opts])", Text: "Returns fn caching results by arguments, opts are max_size and ttl. Cached arrays and objects are returned as copies."},
+	"zip":         {Signature: "zip(arr...[, shortest])", Text: "Returns arrays of elements at the same position of the arrays."},
+	"unzip":       {Signature: "unzip(arr)", Text: "Splits the array of arrays into arrays of elements at the same position."},
+	"range":       {Signature: "range([start, ]stop[, step])", Text: "Returns the iterator of numbers from start up to stop."},
+}
@@ -0,0 +1,247 @@
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+type numFormat struct {
+	precision    int
+	base         int
+	thousandsSep string
+}
+
+func optNumber(opts *variant.Object, key string) (int, bool, error) {
+	v, err := opts.Get(variant.NewString(key))
+	if err != nil {
+		return 0, false, nil
+	}
+
+	if v.Type() != variant.TypeNum {
+		return 0, false, fmt.Errorf("option '%s' must be number", key)
+	}
+
+	n, err := variant.MustCast[*variant.Num](v).AsInt64()
+	if err != nil {
+		return 0, false, fmt.Errorf("option '%s': %w", key, err)
+	}
+
+	return int(n), true, nil
+}
+
+func parseNumFormat(opts *variant.Object) (numFormat, error) {
+	f := numFormat{precision: -1, base: 10}
+
+	prec, ok, err := optNumber(opts, "precision")
+	if err != nil {
+		return f, err
+	}
+
+	if ok {
+		if prec < 0 {
+			return f, errors.New("option 'precision' must not be negative")
+		}
+
+		f.precision = prec
+	}
+
+	base, ok, err := optNumber(opts, "base")
+	if err != nil {
+		return f, err
+	}
+
+	if ok {
+		if base < 2 || base > 62 {
+			return f, errors.New("option 'base' must be from 2 to 62")
+		}
+
+		f.base = base
+	}
+
+	if sep, err := opts.Get(variant.NewString("thousands_sep")); err == nil {
+		if sep.Type() != variant.TypeString {
+			return f, errors.New("option 'thousands_sep' must be string")
+		}
+
+		f.thousandsSep = sep.String()
+	}
+
+	return f, nil
+}
+
+func groupThousands(s, sep string) string {
+	if sep == "" {
+		return s
+	}
+
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	var sb strings.Builder
+	sb.WriteString(sign)
+	for i, ch := range intPart {
+		if i != 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteRune(ch)
+	}
+
+	if hasFrac {
+		sb.WriteByte('.')
+		sb.WriteString(frac)
+	}
+
+	return sb.String()
+}
+
+func formatNum(num *variant.Num, f numFormat) (string, error) {
+	v := num.Value()
+	if v.IsInf() {
+		if v.Sign() < 0 {
+			return "-inf", nil
+		}
+
+		return "inf", nil
+	}
+
+	var s string
+	switch {
+	case f.base != 10:
+		if !v.IsInt() {
+			return "", fmt.Errorf("base %d requires integer number", f.base)
+		}
+
+		n, _ := v.Int(nil)
+		s = n.Text(f.base)
+	case f.precision >= 0:
+		s = v.Text('f', f.precision)
+	case v.IsInt():
+		n, _ := v.Int(nil)
+		s = n.String()
+	default:
+		s = v.Text('f', -1)
+	}
+
+	return groupThousands(s, f.thousandsSep), nil
+}
+
+// FormatNum formats a number according to the options object:
+// precision (digits after the decimal point), base (for integers) and
+// thousands_sep (separator between groups of integer digits).
+func FormatNum(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("format_num() takes one or two arguments")
+	}
+
+	if args[0].Type() != variant.TypeNum {
+		return nil, errors.New("format_num() first argument must be number")
+	}
+
+	f := numFormat{precision: -1, base: 10}
+	if len(args) == 2 {
+		if args[1].Type() != variant.TypeObject {
+			return nil, errors.New("format_num() second argument must be object")
+		}
+
+		var err error
+		f, err = parseNumFormat(variant.MustCast[*variant.Object](args[1]))
+		if err != nil {
+			return nil, fmt.Errorf("format_num(): %w", err)
+		}
+	}
+
+	s, err := formatNum(variant.MustCast[*variant.Num](args[0]), f)
+	if err != nil {
+		return nil, fmt.Errorf("format_num(): %w", err)
+	}
+
+	return variant.NewString(s), nil
+}
+
+func formatArg(spec string, verb byte, arg variant.Iface) (string, error) {
+	switch verb {
+	case 's', 'v':
+		return fmt.Sprintf(spec, arg.String()), nil
+	case 'd':
+		num, ok := arg.(*variant.Num)
+		if !ok || !num.Value().IsInt() {
+			return "", fmt.Errorf("%%d expects integer number, got %s", arg.Type())
+		}
+
+		n, _ := num.Value().Int(nil)
+		return fmt.Sprintf(spec, n), nil
+	case 'f':
+		num, ok := arg.(*variant.Num)
+		if !ok {
+			return "", fmt.Errorf("%%f expects number, got %s", arg.Type())
+		}
+
+		return fmt.Sprintf(spec, num.Value()), nil
+	}
+
+	return "", fmt.Errorf("unknown verb %%%c", verb)
+}
+
+// Format substitutes %s, %d, %f and %v placeholders of the template with
+// the rest of arguments. Placeholders may have flags, width and precision
+// as in Go (e.g. %-5s, %.2f), %% produces a percent sign.
+func Format(args variant.Args) (variant.Iface, error) {
+	if len(args) == 0 {
+		return nil, errors.New("format() takes at least one argument")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, errors.New("format() first argument must be string")
+	}
+
+	tmpl, rest := args[0].String(), args[1:]
+	var sb strings.Builder
+	argi := 0
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' {
+			sb.WriteByte(tmpl[i])
+			continue
+		}
+
+		end := i + 1
+		for end < len(tmpl) && strings.IndexByte("+- #0123456789.", tmpl[end]) >= 0 {
+			end++
+		}
+
+		if end >= len(tmpl) {
+			return nil, errors.New("format(): unterminated placeholder")
+		}
+
+		verb := tmpl[end]
+		if verb == '%' && end == i+1 {
+			sb.WriteByte('%')
+			i = end
+			continue
+		}
+
+		if argi >= len(rest) {
+			return nil, fmt.Errorf("format(): missing argument for placeholder %s", tmpl[i:end+1])
+		}
+
+		s, err := formatArg(tmpl[i:end+1], verb, rest[argi])
+		if err != nil {
+			return nil, fmt.Errorf("format(): argument at %d position: %w", argi+2, err)
+		}
+
+		sb.WriteString(s)
+		argi++
+		i = end
+	}
+
+	if argi != len(rest) {
+		return nil, fmt.Errorf("format(): %d unused arguments", len(rest)-argi)
+	}
+
+	return variant.NewString(sb.String()), nil
+}
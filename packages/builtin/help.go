@@ -0,0 +1,79 @@
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// HelpTo returns help(v) printing the documentation of the function to w.
+// For objects, e.g. packages, the documented functions are listed.
+func HelpTo(w io.Writer) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 {
+			return nil, errors.New("help() takes exactly one argument")
+		}
+
+		switch v := args[0].(type) {
+		case *variant.Func:
+			writeFuncHelp(w, v)
+			return void()
+		case *variant.Object:
+			if writeObjectHelp(w, v) {
+				return void()
+			}
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", args[0].Type(), args[0])
+		return void()
+	}
+}
+
+func writeFuncHelp(w io.Writer, fn *variant.Func) {
+	doc, ok := fn.Doc()
+	if !ok {
+		if fn.Idents() == nil {
+			fmt.Fprintln(w, "function")
+			return
+		}
+
+		fmt.Fprintf(w, "function(%s)\n", strings.Join(fn.Idents(), ", "))
+		return
+	}
+
+	fmt.Fprintln(w, doc.Signature)
+	if doc.Text != "" {
+		for _, line := range strings.Split(doc.Text, "\n") {
+			fmt.Fprintln(w, "    "+line)
+		}
+	}
+}
+
+// writeObjectHelp writes help of documented functions of the object in the
+// order of keys. It reports false when there are none.
+func writeObjectHelp(w io.Writer, obj *variant.Object) bool {
+	written := false
+	for _, key := range obj.SortedKeys() {
+		val, _ := obj.Get(key)
+		fn, ok := val.(*variant.Func)
+		if !ok {
+			continue
+		}
+
+		if _, ok := fn.Doc(); !ok {
+			continue
+		}
+
+		if written {
+			fmt.Fprintln(w)
+		}
+
+		writeFuncHelp(w, fn)
+		written = true
+	}
+
+	return written
+}
@@ -1,23 +1,106 @@
 package builtin
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/hikitani/easylang/variant"
 )
 
+// IO configures the sources used by the input and output builtins.
+// A nil Stdin denies reading input. Context, if set, returns the context of
+// the running script, which cancels its delays.
+type IO struct {
+	Stdout  io.Writer
+	Stdin   io.Reader
+	Context func() context.Context
+}
+
 func void() (variant.Iface, error) {
 	return variant.NewNone(), nil
 }
 
-func Print(args variant.Args) (variant.Iface, error) {
-	args.Print(os.Stdout)
+// write writes s to w at once, so the error of the output, e.g. its limit,
+// stops the script.
+func write(w io.Writer, s string) (variant.Iface, error) {
+	if _, err := io.WriteString(w, s); err != nil {
+		return nil, err
+	}
+
 	return void()
 }
 
+func sprint(args variant.Args) string {
+	var sb strings.Builder
+	args.Print(&sb)
+	return sb.String()
+}
+
+func PrintTo(w io.Writer) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		return write(w, sprint(args))
+	}
+}
+
+func PrintlnTo(w io.Writer) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		return write(w, sprint(args)+"\n")
+	}
+}
+
+func PrintfTo(w io.Writer) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		s, err := Format(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return write(w, s.String())
+	}
+}
+
+// InputFrom returns input(prompt) reading lines from r. It writes the
+// prompt to w and returns none when r is exhausted.
+func InputFrom(r io.Reader, w io.Writer) func(args variant.Args) (variant.Iface, error) {
+	if r == nil {
+		return func(args variant.Args) (variant.Iface, error) {
+			return nil, errors.New("input() is not available")
+		}
+	}
+
+	br := bufio.NewReader(r)
+	return func(args variant.Args) (variant.Iface, error) {
+		if len(args) > 1 {
+			return nil, errors.New("input() takes at most one argument")
+		}
+
+		if len(args) == 1 {
+			io.WriteString(w, args[0].String())
+		}
+
+		line, err := br.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return void()
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("input(): %w", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		return variant.NewString(strings.TrimSuffix(line, "\r")), nil
+	}
+}
+
+func Print(args variant.Args) (variant.Iface, error) {
+	return PrintTo(os.Stdout)(args)
+}
+
 func Println(args variant.Args) (variant.Iface, error) {
-	args.Print(os.Stdout)
-	fmt.Println()
-	return void()
+	return PrintlnTo(os.Stdout)(args)
 }
@@ -3,6 +3,7 @@ package builtin
 import (
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/hikitani/easylang/variant"
 )
@@ -95,17 +96,17 @@ func Abs(args variant.Args) (variant.Iface, error) {
 }
 
 func Sum(args variant.Args) (variant.Iface, error) {
-	s := variant.Int(0)
+	s := new(big.Float)
 	for _, arg := range args {
 		if arg.Type() != variant.TypeNum {
 			return nil, errors.New("sum() arguments must be number")
 		}
 
 		a := variant.MustCast[*variant.Num](arg)
-		s.Value().Add(s.Value(), a.Value())
+		s.Add(s, a.Value())
 	}
 
-	return s, nil
+	return variant.NewNum(s), nil
 }
 
 func Pow(args variant.Args) (variant.Iface, error) {
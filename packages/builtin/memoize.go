@@ -0,0 +1,179 @@
+package builtin
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+type memoOptions struct {
+	maxSize int
+	ttl     time.Duration
+}
+
+func parseMemoOptions(v variant.Iface) (memoOptions, error) {
+	var opts memoOptions
+	obj, ok := v.(*variant.Object)
+	if !ok {
+		return opts, fmt.Errorf("memoize() second argument must be object, got %s", v.Type())
+	}
+
+	keys, vals := obj.Items()
+	for i, key := range keys {
+		num, ok := vals[i].(*variant.Num)
+		if !ok {
+			return opts, fmt.Errorf("memoize() option %s must be number, got %s", key, vals[i].Type())
+		}
+
+		switch key.String() {
+		case "max_size":
+			n, err := num.AsInt64()
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("memoize() option max_size must be positive integer, got %s", num)
+			}
+
+			opts.maxSize = int(n)
+		case "ttl":
+			secs, _ := num.Value().Float64()
+			if secs <= 0 || math.IsInf(secs, 0) {
+				return opts, fmt.Errorf("memoize() option ttl must be positive number of seconds, got %s", num)
+			}
+
+			opts.ttl = time.Duration(secs * float64(time.Second))
+		default:
+			return opts, fmt.Errorf("memoize(): unknown option '%s'", key)
+		}
+	}
+
+	return opts, nil
+}
+
+type memoEntry struct {
+	key     string
+	v       variant.Iface
+	expires time.Time
+}
+
+// memoCache keeps results of calls keyed by the memory representation of
+// arguments. The least recently used result is evicted once the cache is
+// full.
+type memoCache struct {
+	opts    memoOptions
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func (c *memoCache) get(key string) (variant.Iface, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*memoEntry)
+	if c.opts.ttl != 0 && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.v, true
+}
+
+func (c *memoCache) put(key string, v variant.Iface) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoEntry{key: key, v: v}
+	if c.opts.ttl != 0 {
+		entry.expires = time.Now().Add(c.opts.ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.opts.maxSize != 0 && c.order.Len() > c.opts.maxSize {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*memoEntry).key)
+	}
+}
+
+// Memoize returns the function caching results of fn by its arguments.
+// Errors are not cached. The cache size and the lifetime of results are
+// limited by max_size and ttl (in seconds) options.
+func Memoize(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("memoize() takes one or two arguments")
+	}
+
+	fn, ok := args[0].(*variant.Func)
+	if !ok {
+		return nil, errors.New("memoize() first argument must be function")
+	}
+
+	var opts memoOptions
+	if len(args) == 2 {
+		var err error
+		opts, err = parseMemoOptions(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cache := &memoCache{
+		opts:    opts,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+
+	return memoize(fn, cache), nil
+}
+
+// detached returns the copy of arrays and objects, so callers changing the
+// result do not change the cached value.
+func detached(v variant.Iface) variant.Iface {
+	switch v.(type) {
+	case *variant.Array, *variant.Object:
+		return variant.DeepCopy(v)
+	}
+
+	return v
+}
+
+func memoize(fn *variant.Func, cache *memoCache) *variant.Func {
+	return variant.NewFunc(fn.Idents(), func(args variant.Args) (variant.Iface, error) {
+		mem, err := variant.AppendMem(nil, variant.NewArray(args))
+		if err != nil {
+			return nil, fmt.Errorf("memoized function arguments must be hashable: %w", err)
+		}
+
+		key := string(mem)
+		if v, ok := cache.get(key); ok {
+			return detached(v), nil
+		}
+
+		v, err := fn.Call(args)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.put(key, detached(v))
+		return v, nil
+	}).WithFork(func() *variant.Func {
+		return memoize(fn.Fork(), cache)
+	})
+}
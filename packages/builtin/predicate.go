@@ -34,7 +34,7 @@ func Iterable(args variant.Args) (variant.Iface, error) {
 	}
 
 	switch args[0].Type() {
-	case variant.TypeArray, variant.TypeObject:
+	case variant.TypeArray, variant.TypeObject, variant.TypeString:
 		return variant.True(), nil
 	}
 
@@ -156,3 +156,48 @@ func IsFunc(args variant.Args) (variant.Iface, error) {
 
 	return variant.False(), nil
 }
+
+func IsHandle(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_handle() takes exactly one argument")
+	}
+
+	return variant.NewBool(args[0].Type() == variant.TypeHandle), nil
+}
+
+func IsPromise(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_promise() takes exactly one argument")
+	}
+
+	return variant.NewBool(args[0].Type() == variant.TypePromise), nil
+}
+
+// IsNaN reports whether the number is NaN, the result of invalid operations
+// under the nan numeric policy.
+func IsNaN(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_nan() takes exactly one argument")
+	}
+
+	num, ok := args[0].(*variant.Num)
+	if !ok {
+		return nil, errors.New("is_nan() argument must be number")
+	}
+
+	return variant.NewBool(num.IsNaN()), nil
+}
+
+// IsInf reports whether the number is positive or negative infinity.
+func IsInf(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_inf() takes exactly one argument")
+	}
+
+	num, ok := args[0].(*variant.Num)
+	if !ok {
+		return nil, errors.New("is_inf() argument must be number")
+	}
+
+	return variant.NewBool(num.IsInf()), nil
+}
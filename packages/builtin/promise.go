@@ -0,0 +1,62 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Delay returns the promise resolved with the value, none by default, after
+// the number of seconds. The promise is pending meanwhile, so awaiting it
+// lets other async calls run.
+func Delay(args variant.Args) (variant.Iface, error) {
+	return DelayWith(nil)(args)
+}
+
+// DelayWith returns delay(secs, value) rejecting its promise once the context
+// returned by ctx is done, so a cancelled script does not leave timers
+// behind. A nil ctx never cancels the delay.
+func DelayWith(ctx func() context.Context) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, errors.New("delay() takes one or two arguments")
+		}
+
+		num, ok := args[0].(*variant.Num)
+		if !ok {
+			return nil, fmt.Errorf("delay() first argument must be number, got %s", args[0].Type())
+		}
+
+		secs, _ := num.Value().Float64()
+		if secs < 0 || math.IsInf(secs, 0) || num.IsNaN() {
+			return nil, fmt.Errorf("delay() first argument must be non-negative number of seconds, got %s", num)
+		}
+
+		var v variant.Iface = variant.NewNone()
+		if len(args) == 2 {
+			v = args[1]
+		}
+
+		done := context.Background()
+		if ctx != nil {
+			done = ctx()
+		}
+
+		d := time.Duration(secs * float64(time.Second))
+		return variant.Go(func() (variant.Iface, error) {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				return v, nil
+			case <-done.Done():
+				return nil, done.Err()
+			}
+		}), nil
+	}
+}
@@ -1,29 +1,77 @@
 package builtin
 
 import (
+	"io"
+	"os"
+
 	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/iter"
 )
 
-var Package = packages.
-	New("builtin").
-	AddFunc("print", Print).
-	AddFunc("println", Println).
-	AddFunc("all", All).
-	AddFunc("any", Any).
-	AddFunc("sum", Sum).
-	AddFunc("len", Len).
-	AddFunc("min", Min).
-	AddFunc("max", Max).
-	AddFunc("abs", Abs).
-	AddFunc("iterable", Iterable).
-	AddFunc("bool", Bool).
-	AddFunc("is_none", IsNone).
-	AddFunc("is_bool", IsBool).
-	AddFunc("is_number", IsNumber).
-	AddFunc("is_string", IsString).
-	AddFunc("is_array", IsArray).
-	AddFunc("is_object", IsObject).
-	AddFunc("is_func", IsFunc).
-	AddFunc("str", Str).
-	AddFunc("pow", Pow).
-	Build()
+var Package = NewPackage(IO{Stdout: os.Stdout})
+
+// NewPackage builds the builtin package with input and output functions
+// bound to cfg.
+func NewPackage(cfg IO) packages.Iface {
+	w := cfg.Stdout
+	if w == nil {
+		w = io.Discard
+	}
+
+	return packages.
+		New("builtin").
+		AddFunc("print", PrintTo(w)).
+		AddFunc("println", PrintlnTo(w)).
+		AddFunc("printf", PrintfTo(w)).
+		AddFunc("input", InputFrom(cfg.Stdin, w)).
+		AddFunc("format", Format).
+		AddFunc("help", HelpTo(w)).
+		AddFunc("all", All).
+		AddFunc("any", Any).
+		AddFunc("sum", Sum).
+		AddFunc("len", Len).
+		AddFunc("at", At).
+		AddFunc("copy", Copy).
+		AddFunc("clone", Clone).
+		AddFunc("sorted_keys", SortedKeys).
+		AddFunc("min", Min).
+		AddFunc("max", Max).
+		AddFunc("abs", Abs).
+		AddFunc("iterable", Iterable).
+		AddFunc("bool", Bool).
+		AddFunc("is_none", IsNone).
+		AddFunc("is_bool", IsBool).
+		AddFunc("is_number", IsNumber).
+		AddFunc("is_nan", IsNaN).
+		AddFunc("is_inf", IsInf).
+		AddFunc("is_string", IsString).
+		AddFunc("is_array", IsArray).
+		AddFunc("is_object", IsObject).
+		AddFunc("is_func", IsFunc).
+		AddFunc("is_handle", IsHandle).
+		AddFunc("is_promise", IsPromise).
+		AddFunc("delay", DelayWith(cfg.Context)).
+		AddFunc("type", Type).
+		AddMap("types", Types()).
+		AddFunc("str", Str).
+		AddFunc("chars", Chars).
+		AddFunc("substr", Substr).
+		AddFunc("num", Num).
+		AddFunc("parse_int", ParseInt).
+		AddFunc("parse_float", ParseFloat).
+		AddFunc("format_num", FormatNum).
+		AddFunc("pow", Pow).
+		AddFunc("push", Push).
+		AddFunc("pop", Pop).
+		AddFunc("slice", Slice).
+		AddFunc("sort", Sort).
+		AddFunc("map", Map).
+		AddFunc("filter", Filter).
+		AddFunc("reduce", Reduce).
+		AddFunc("memoize", Memoize).
+		AddFunc("zip", Zip).
+		AddFunc("unzip", Unzip).
+		AddFunc("range", iter.Range).
+		AddDocs(Docs).
+		Build()
+}
@@ -0,0 +1,73 @@
+package builtin
+
+import (
+	"errors"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+func Chars(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("chars() takes exactly one argument")
+	}
+
+	s, ok := args[0].(*variant.String)
+	if !ok {
+		return nil, errors.New("chars() argument must be string")
+	}
+
+	return variant.NewArray(s.Chars()), nil
+}
+
+// Substr returns n characters of the string from start, or fewer at the end
+// of the string. Without n it returns the rest of the string. Negative start
+// counts from the end.
+func Substr(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("substr() takes two or three arguments")
+	}
+
+	s, ok := args[0].(*variant.String)
+	if !ok {
+		return nil, errors.New("substr() first argument must be string")
+	}
+
+	start, err := intArg("substr() start must be an integer", args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(s.Len())
+	n := size
+	if len(args) == 3 {
+		if n, err = intArg("substr() length must be an integer", args[2]); err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return nil, errors.New("substr() length must be non-negative")
+		}
+	}
+
+	if start < 0 {
+		start = max(0, start+size)
+	}
+
+	start = min(start, size)
+	return s.Substr(start, start+min(n, size-start)), nil
+}
+
+// intArg returns the integer value of arg, failing with msg otherwise.
+func intArg(msg string, arg variant.Iface) (int64, error) {
+	num, ok := arg.(*variant.Num)
+	if !ok {
+		return 0, errors.New(msg)
+	}
+
+	n, err := num.AsInt64()
+	if err != nil {
+		return 0, errors.New(msg)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,388 @@
+package bytes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+func bytesArg(name string, args variant.Args, i int) ([]byte, error) {
+	if arr, ok := args[i].(*variant.Array); ok {
+		if bs, ok := arr.Bytes(); ok {
+			return bs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s() argument at %d position must be bytes, got %s", name, i+1, args[i].Type())
+}
+
+func stringArg(name string, args variant.Args, i int) (string, error) {
+	if args[i].Type() != variant.TypeString {
+		return "", fmt.Errorf("%s() argument at %d position must be string, got %s", name, i+1, args[i].Type())
+	}
+
+	return args[i].String(), nil
+}
+
+func intArg(name string, args variant.Args, i int) (int64, error) {
+	num, ok := args[i].(*variant.Num)
+	if !ok {
+		return 0, fmt.Errorf("%s() argument at %d position must be number, got %s", name, i+1, args[i].Type())
+	}
+
+	n, err := num.AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("%s() argument at %d position: %w", name, i+1, err)
+	}
+
+	return n, nil
+}
+
+// byteOrder returns the byte order by name, big endian is used by default.
+func byteOrder(name string, args variant.Args, i int) (binary.ByteOrder, error) {
+	if len(args) <= i {
+		return binary.BigEndian, nil
+	}
+
+	order, err := stringArg(name, args, i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order {
+	case "big":
+		return binary.BigEndian, nil
+	case "little":
+		return binary.LittleEndian, nil
+	}
+
+	return nil, fmt.Errorf("%s(): unknown byte order '%s' (expected big or little)", name, order)
+}
+
+func IsBytes(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_bytes() takes exactly one argument")
+	}
+
+	_, err := bytesArg("is_bytes", args, 0)
+	return variant.NewBool(err == nil), nil
+}
+
+func FromString(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("from_string() takes exactly one argument")
+	}
+
+	s, err := stringArg("from_string", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.Bytes([]byte(s)), nil
+}
+
+func FromArray(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("from_array() takes exactly one argument")
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok {
+		return nil, fmt.Errorf("from_array() argument must be array, got %s", args[0].Type())
+	}
+
+	elems := arr.Elems()
+	bs := make([]byte, 0, len(elems))
+	for i, el := range elems {
+		n, err := intArg("from_array", variant.Args{el}, 0)
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("from_array(): element at %d position must be integer from 0 to 255, got %s", i, el)
+		}
+
+		bs = append(bs, byte(n))
+	}
+
+	return variant.Bytes(bs), nil
+}
+
+func FromHex(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("from_hex() takes exactly one argument")
+	}
+
+	s, err := stringArg("from_hex", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("from_hex(): %w", err)
+	}
+
+	return variant.Bytes(bs), nil
+}
+
+func ToHex(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("to_hex() takes exactly one argument")
+	}
+
+	bs, err := bytesArg("to_hex", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.NewString(hex.EncodeToString(bs)), nil
+}
+
+func ToArray(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("to_array() takes exactly one argument")
+	}
+
+	if _, err := bytesArg("to_array", args, 0); err != nil {
+		return nil, err
+	}
+
+	return variant.NewArray(variant.MustCast[*variant.Array](args[0]).Elems()), nil
+}
+
+// ToString decodes bytes to string. Supported encodings are utf-8 (default),
+// ascii and latin1.
+func ToString(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("to_string() takes one or two arguments")
+	}
+
+	bs, err := bytesArg("to_string", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := "utf-8"
+	if len(args) == 2 {
+		encoding, err = stringArg("to_string", args, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "utf-8", "utf8":
+		if !utf8.Valid(bs) {
+			return nil, errors.New("to_string(): invalid utf-8 sequence")
+		}
+
+		return variant.NewString(string(bs)), nil
+	case "ascii":
+		for i, b := range bs {
+			if b > 127 {
+				return nil, fmt.Errorf("to_string(): invalid ascii byte 0x%02x at %d position", b, i)
+			}
+		}
+
+		return variant.NewString(string(bs)), nil
+	case "latin1", "iso-8859-1":
+		runes := make([]rune, 0, len(bs))
+		for _, b := range bs {
+			runes = append(runes, rune(b))
+		}
+
+		return variant.NewString(string(runes)), nil
+	}
+
+	return nil, fmt.Errorf("to_string(): unknown encoding '%s'", encoding)
+}
+
+// Slice returns bytes from start to end (exclusive). Negative indexes count
+// from the end.
+func Slice(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("slice() takes two or three arguments")
+	}
+
+	bs, err := bytesArg("slice", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	norm := func(i int) (int64, error) {
+		idx, err := intArg("slice", args, i)
+		if err != nil {
+			return 0, err
+		}
+
+		if idx < 0 {
+			idx += int64(len(bs))
+		}
+
+		return max(0, min(idx, int64(len(bs)))), nil
+	}
+
+	start, err := norm(1)
+	if err != nil {
+		return nil, err
+	}
+
+	end := int64(len(bs))
+	if len(args) == 3 {
+		if end, err = norm(2); err != nil {
+			return nil, err
+		}
+	}
+
+	if start > end {
+		start = end
+	}
+
+	return variant.Bytes(append([]byte(nil), bs[start:end]...)), nil
+}
+
+// IndexOf returns the index of the first occurrence of bytes or a single
+// byte, or -1 if it is not found.
+func IndexOf(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("index_of() takes exactly two arguments")
+	}
+
+	bs, err := bytesArg("index_of", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if args[1].Type() == variant.TypeNum {
+		b, err := intArg("index_of", args, 1)
+		if err != nil || b < 0 || b > 255 {
+			return nil, errors.New("index_of() byte must be integer from 0 to 255")
+		}
+
+		return variant.Int(bytes.IndexByte(bs, byte(b))), nil
+	}
+
+	sub, err := bytesArg("index_of", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.Int(bytes.Index(bs, sub)), nil
+}
+
+// Pack encodes the integer to bytes of the size (1, 2, 4 or 8) in the byte
+// order. Negative integers are encoded in two's complement.
+func Pack(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("pack() takes two or three arguments")
+	}
+
+	num, ok := args[0].(*variant.Num)
+	if !ok || !num.Value().IsInt() {
+		return nil, fmt.Errorf("pack() first argument must be integer, got %s", args[0])
+	}
+
+	size, err := intArg("pack", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("pack() size must be 1, 2, 4 or 8, got %d", size)
+	}
+
+	order, err := byteOrder("pack", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := num.Value().Int(nil)
+	bits := uint(size * 8)
+	lo := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+	hi := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, fmt.Errorf("pack(): %s does not fit into %d bytes", n, size)
+	}
+
+	var u uint64
+	if n.Sign() < 0 {
+		u = uint64(n.Int64())
+	} else {
+		u = n.Uint64()
+	}
+
+	var buf [8]byte
+	switch size {
+	case 1:
+		buf[0] = byte(u)
+	case 2:
+		order.PutUint16(buf[:], uint16(u))
+	case 4:
+		order.PutUint32(buf[:], uint32(u))
+	case 8:
+		order.PutUint64(buf[:], u)
+	}
+
+	return variant.Bytes(append([]byte(nil), buf[:size]...)), nil
+}
+
+// Unpack decodes the integer from bytes of the size 1, 2, 4 or 8 in the byte
+// order. The third argument tells whether the integer is signed.
+func Unpack(args variant.Args) (variant.Iface, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, errors.New("unpack() takes from one to three arguments")
+	}
+
+	bs, err := bytesArg("unpack", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := byteOrder("unpack", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := false
+	if len(args) == 3 {
+		b, ok := args[2].(*variant.Bool)
+		if !ok {
+			return nil, fmt.Errorf("unpack() third argument must be bool, got %s", args[2].Type())
+		}
+
+		signed = b.Bool()
+	}
+
+	var u uint64
+	switch len(bs) {
+	case 1:
+		u = uint64(bs[0])
+		if signed {
+			return variant.Int(int(int8(u))), nil
+		}
+	case 2:
+		u = uint64(order.Uint16(bs))
+		if signed {
+			return variant.Int(int(int16(u))), nil
+		}
+	case 4:
+		u = uint64(order.Uint32(bs))
+		if signed {
+			return variant.Int(int(int32(u))), nil
+		}
+	case 8:
+		u = order.Uint64(bs)
+		if signed {
+			return variant.NewNum(new(big.Float).SetInt64(int64(u))), nil
+		}
+	default:
+		return nil, fmt.Errorf("unpack() bytes length must be 1, 2, 4 or 8, got %d", len(bs))
+	}
+
+	return variant.NewNum(new(big.Float).SetUint64(u)), nil
+}
@@ -0,0 +1,18 @@
+package bytes
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("bytes").
+	AddFunc("is_bytes", IsBytes).
+	AddFunc("from_string", FromString).
+	AddFunc("from_array", FromArray).
+	AddFunc("from_hex", FromHex).
+	AddFunc("to_hex", ToHex).
+	AddFunc("to_array", ToArray).
+	AddFunc("to_string", ToString).
+	AddFunc("slice", Slice).
+	AddFunc("index_of", IndexOf).
+	AddFunc("pack", Pack).
+	AddFunc("unpack", Unpack).
+	Build()
@@ -0,0 +1,127 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/hikitani/easylang/packages/stream"
+	"github.com/hikitani/easylang/variant"
+)
+
+type format struct {
+	name      string
+	newWriter func(w io.Writer) io.WriteCloser
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	gzipFormat = format{
+		name:      "gzip",
+		newWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	zlibFormat = format{
+		name:      "zlib",
+		newWriter: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		newReader: zlib.NewReader,
+	}
+)
+
+// source returns the reader of string, bytes or the stream.
+func source(name string, v variant.Iface) (io.Reader, error) {
+	switch v := v.(type) {
+	case *variant.String:
+		return bytes.NewReader([]byte(v.String())), nil
+	case *variant.Array:
+		if bs, ok := v.Bytes(); ok {
+			return bytes.NewReader(bs), nil
+		}
+	}
+
+	if r, ok := stream.AsReader(v); ok {
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("%s() first argument must be string, bytes or stream, got %s", name, v.Type())
+}
+
+// transform copies the source to the stream given as the second argument or
+// returns the result as bytes.
+func transform(name string, args variant.Args, fn func(w io.Writer, r io.Reader) error) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%s() takes one or two arguments", name)
+	}
+
+	r, err := source(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 2 {
+		w, ok := stream.AsWriter(args[1])
+		if !ok {
+			return nil, fmt.Errorf("%s() second argument must be stream, got %s", name, args[1].Type())
+		}
+
+		if err := fn(w, r); err != nil {
+			return nil, fmt.Errorf("%s(): %w", name, err)
+		}
+
+		return variant.NewNone(), nil
+	}
+
+	var buf bytes.Buffer
+	if err := fn(&buf, r); err != nil {
+		return nil, fmt.Errorf("%s(): %w", name, err)
+	}
+
+	return variant.Bytes(buf.Bytes()), nil
+}
+
+func (f format) compress(args variant.Args) (variant.Iface, error) {
+	return transform(f.name+"_compress", args, func(w io.Writer, r io.Reader) error {
+		cw := f.newWriter(w)
+		if _, err := io.Copy(cw, r); err != nil {
+			return err
+		}
+
+		return cw.Close()
+	})
+}
+
+func (f format) decompress(args variant.Args) (variant.Iface, error) {
+	return transform(f.name+"_decompress", args, func(w io.Writer, r io.Reader) error {
+		cr, err := f.newReader(r)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+
+		_, err = io.Copy(w, cr)
+		return err
+	})
+}
+
+// reader returns the stream of decompressed data of the source, so large
+// files are never decompressed into memory at once.
+func (f format) reader(args variant.Args) (variant.Iface, error) {
+	name := f.name + "_reader"
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() takes exactly one argument", name)
+	}
+
+	r, err := source(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cr, err := f.newReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", name, err)
+	}
+
+	return stream.NewReader(cr), nil
+}
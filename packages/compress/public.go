@@ -0,0 +1,13 @@
+package compress
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("compress").
+	AddFunc("gzip_compress", gzipFormat.compress).
+	AddFunc("gzip_decompress", gzipFormat.decompress).
+	AddFunc("gzip_reader", gzipFormat.reader).
+	AddFunc("zlib_compress", zlibFormat.compress).
+	AddFunc("zlib_decompress", zlibFormat.decompress).
+	AddFunc("zlib_reader", zlibFormat.reader).
+	Build()
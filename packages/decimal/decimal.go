@@ -0,0 +1,235 @@
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// fromNum converts the number to decimal. Exact numbers must have the
+// finite decimal representation, floats are taken by their shortest
+// representation, so 0.1 is 0.1.
+func fromNum(num *variant.Num) (*variant.Decimal, error) {
+	if num.IsInf() {
+		return nil, errors.New("infinity cannot be decimal")
+	}
+
+	if !num.IsExact() {
+		return variant.ParseDecimal(num.Value().Text('f', -1))
+	}
+
+	r, _ := num.AsRat()
+	v, den := new(big.Int).Set(r.Num()), r.Denom()
+	ten := big.NewInt(10)
+	// the denominator 2^a * 5^b needs at most max(a, b) fraction digits
+	for scale := 0; scale <= den.BitLen(); scale++ {
+		q, m := new(big.Int).QuoRem(v, den, new(big.Int))
+		if m.Sign() == 0 {
+			return variant.NewDecimal(q, scale), nil
+		}
+
+		v.Mul(v, ten)
+	}
+
+	return nil, fmt.Errorf("number %s has no exact decimal representation", num)
+}
+
+func decimalArg(name string, args variant.Args, i int) (*variant.Decimal, error) {
+	switch arg := args[i].(type) {
+	case *variant.Decimal:
+		return arg, nil
+	case *variant.Num:
+		if arg.IsInt() && !arg.IsInf() {
+			return fromNum(arg)
+		}
+	}
+
+	return nil, fmt.Errorf("%s() argument at %d position must be decimal or integer, got %s", name, i+1, args[i].Type())
+}
+
+func scaleArg(name string, args variant.Args, i int) (int, error) {
+	num, ok := args[i].(*variant.Num)
+	if !ok {
+		return 0, fmt.Errorf("%s() argument at %d position must be number, got %s", name, i+1, args[i].Type())
+	}
+
+	n, err := num.AsInt64()
+	if err != nil || n < 0 || n > 1000 {
+		return 0, fmt.Errorf("%s() scale must be integer from 0 to 1000, got %s", name, num)
+	}
+
+	return int(n), nil
+}
+
+func modeArg(name string, args variant.Args, i int) (variant.RoundingMode, error) {
+	if args[i].Type() != variant.TypeString {
+		return 0, fmt.Errorf("%s() argument at %d position must be string, got %s", name, i+1, args[i].Type())
+	}
+
+	mode, err := variant.ParseRoundingMode(args[i].String())
+	if err != nil {
+		return 0, fmt.Errorf("%s(): %w", name, err)
+	}
+
+	return mode, nil
+}
+
+// New returns the decimal of the string like "12.30" or the number.
+func New(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("new() takes exactly one argument")
+	}
+
+	switch arg := args[0].(type) {
+	case *variant.Decimal:
+		return arg, nil
+	case *variant.String:
+		return variant.ParseDecimal(arg.String())
+	case *variant.Num:
+		return fromNum(arg)
+	}
+
+	return nil, fmt.Errorf("new() argument must be string or number, got %s", args[0].Type())
+}
+
+func IsDecimal(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_decimal() takes exactly one argument")
+	}
+
+	return variant.NewBool(args[0].Type() == variant.TypeDecimal), nil
+}
+
+// Round returns the decimal rounded to the scale by the mode, e.g.
+// round(d, 2, "half_even").
+func Round(args variant.Args) (variant.Iface, error) {
+	if len(args) != 3 {
+		return nil, errors.New("round() takes exactly three arguments")
+	}
+
+	d, err := decimalArg("round", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	scale, err := scaleArg("round", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := modeArg("round", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Round(scale, mode), nil
+}
+
+// Div returns x / y rounded to the scale by the mode.
+func Div(args variant.Args) (variant.Iface, error) {
+	if len(args) != 4 {
+		return nil, errors.New("div() takes exactly four arguments")
+	}
+
+	x, err := decimalArg("div", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decimalArg("div", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	scale, err := scaleArg("div", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := modeArg("div", args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return x.Quo(y, scale, mode)
+}
+
+func Scale(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("scale() takes exactly one argument")
+	}
+
+	d, err := decimalArg("scale", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.Int(d.Scale()), nil
+}
+
+// ToNumber returns the exact number of the decimal.
+func ToNumber(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("to_number() takes exactly one argument")
+	}
+
+	d, err := decimalArg("to_number", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.NewRat(d.Rat()), nil
+}
+
+// Format returns the decimal with digits of the integer part grouped by
+// three with the separator, e.g. format(d, ",") is "1,234.50". The decimal
+// point can be replaced by the third argument.
+func Format(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("format() takes two or three arguments")
+	}
+
+	d, err := decimalArg("format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if args[1].Type() != variant.TypeString {
+		return nil, fmt.Errorf("format() argument at 2 position must be string, got %s", args[1].Type())
+	}
+
+	point := "."
+	if len(args) == 3 {
+		if args[2].Type() != variant.TypeString {
+			return nil, fmt.Errorf("format() argument at 3 position must be string, got %s", args[2].Type())
+		}
+
+		point = args[2].String()
+	}
+
+	s := d.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	var sb strings.Builder
+	sb.WriteString(sign)
+	for i, ch := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(args[1].String())
+		}
+
+		sb.WriteRune(ch)
+	}
+
+	if hasFrac {
+		sb.WriteString(point + frac)
+	}
+
+	return variant.NewString(sb.String()), nil
+}
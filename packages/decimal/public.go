@@ -0,0 +1,14 @@
+package decimal
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("decimal").
+	AddFunc("new", New).
+	AddFunc("is_decimal", IsDecimal).
+	AddFunc("round", Round).
+	AddFunc("div", Div).
+	AddFunc("scale", Scale).
+	AddFunc("to_number", ToNumber).
+	AddFunc("format", Format).
+	Build()
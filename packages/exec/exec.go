@@ -0,0 +1,201 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+var ErrNotAllowed = errors.New("running commands is not allowed")
+
+// Runner runs external commands. Commands are started directly, no shell is
+// involved, so arguments never need quoting.
+type Runner struct {
+	allowed func() bool
+	ctx     func() context.Context
+}
+
+type options struct {
+	dir     string
+	env     []string
+	stdin   []byte
+	timeout time.Duration
+}
+
+func parseOptions(v variant.Iface) (options, error) {
+	var opts options
+	obj, ok := v.(*variant.Object)
+	if !ok {
+		return opts, fmt.Errorf("run() second argument must be object, got %s", v.Type())
+	}
+
+	keys, vals := obj.Items()
+	for i, key := range keys {
+		val := vals[i]
+		switch key.String() {
+		case "dir":
+			if val.Type() != variant.TypeString {
+				return opts, fmt.Errorf("run() option dir must be string, got %s", val.Type())
+			}
+
+			opts.dir = val.String()
+		case "env":
+			env, ok := val.(*variant.Object)
+			if !ok {
+				return opts, fmt.Errorf("run() option env must be object, got %s", val.Type())
+			}
+
+			names, values := env.Items()
+			for j, name := range names {
+				if values[j].Type() != variant.TypeString {
+					return opts, fmt.Errorf("run() env variable '%s' must be string, got %s", name, values[j].Type())
+				}
+
+				opts.env = append(opts.env, name.String()+"="+values[j].String())
+			}
+		case "stdin":
+			switch val := val.(type) {
+			case *variant.String:
+				opts.stdin = []byte(val.String())
+			case *variant.Array:
+				bs, ok := val.Bytes()
+				if !ok {
+					return opts, errors.New("run() option stdin must be string or bytes, got array")
+				}
+
+				opts.stdin = bs
+			default:
+				return opts, fmt.Errorf("run() option stdin must be string or bytes, got %s", val.Type())
+			}
+		case "timeout":
+			num, ok := val.(*variant.Num)
+			if !ok {
+				return opts, fmt.Errorf("run() option timeout must be number, got %s", val.Type())
+			}
+
+			secs, _ := num.Value().Float64()
+			if secs <= 0 || math.IsInf(secs, 0) {
+				return opts, fmt.Errorf("run() option timeout must be positive number of seconds, got %s", num)
+			}
+
+			opts.timeout = time.Duration(secs * float64(time.Second))
+		default:
+			return opts, fmt.Errorf("run(): unknown option '%s'", key)
+		}
+	}
+
+	return opts, nil
+}
+
+// Run runs the command given as the array of the program and its arguments.
+// The result object holds the exit code, stdout and stderr. A non-zero exit
+// code is not an error. The command is killed when the script is stopped or
+// the timeout option passes.
+func (r *Runner) Run(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("run() takes one or two arguments")
+	}
+
+	if !r.allowed() {
+		return nil, fmt.Errorf("run(): %w", ErrNotAllowed)
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok || arr.Len() == 0 {
+		return nil, errors.New("run() first argument must be non empty array of strings")
+	}
+
+	cmdline := make([]string, 0, arr.Len())
+	for i, el := range arr.Elems() {
+		if el.Type() != variant.TypeString {
+			return nil, fmt.Errorf("run(): command element at %d position must be string, got %s", i, el.Type())
+		}
+
+		cmdline = append(cmdline, el.String())
+	}
+
+	var opts options
+	if len(args) == 2 {
+		var err error
+		if opts, err = parseOptions(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	if r.ctx != nil {
+		ctx = r.ctx()
+	}
+
+	parent := ctx
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cmdline[0], cmdline[1:]...)
+	cmd.Dir = opts.dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if opts.env != nil {
+		cmd.Env = opts.env
+	}
+
+	if opts.stdin != nil {
+		cmd.Stdin = bytes.NewReader(opts.stdin)
+	}
+
+	err := cmd.Run()
+	if err := parent.Err(); err != nil {
+		return nil, fmt.Errorf("run(): command '%s' stopped: %w", strings.Join(cmdline, " "), err)
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("run(): command '%s' timed out after %s", strings.Join(cmdline, " "), opts.timeout)
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return nil, fmt.Errorf("run(): %w", err)
+	}
+
+	return variant.FromMap(map[string]variant.Iface{
+		"code":   variant.Int(code),
+		"stdout": variant.NewString(stdout.String()),
+		"stderr": variant.NewString(stderr.String()),
+	}), nil
+}
+
+// LookPath returns the path of the executable found in PATH or none.
+func (r *Runner) LookPath(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("look_path() takes exactly one argument")
+	}
+
+	if !r.allowed() {
+		return nil, fmt.Errorf("look_path(): %w", ErrNotAllowed)
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, fmt.Errorf("look_path() argument must be string, got %s", args[0].Type())
+	}
+
+	path, err := exec.LookPath(args[0].String())
+	if err != nil {
+		return variant.NewNone(), nil
+	}
+
+	return variant.NewString(path), nil
+}
@@ -0,0 +1,19 @@
+package exec
+
+import (
+	"context"
+
+	"github.com/hikitani/easylang/packages"
+)
+
+// NewPackage builds the exec package. Its functions fail with ErrNotAllowed
+// unless allowed() reports true. Commands are killed once the context
+// returned by ctx, the one of the running script, is done. ctx may be nil.
+func NewPackage(allowed func() bool, ctx func() context.Context) packages.Iface {
+	r := &Runner{allowed: allowed, ctx: ctx}
+	return packages.
+		New("exec").
+		AddFunc("run", r.Run).
+		AddFunc("look_path", r.LookPath).
+		Build()
+}
@@ -0,0 +1,155 @@
+package funcs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+func funcArg(name string, args variant.Args, i int) (*variant.Func, error) {
+	fn, ok := args[i].(*variant.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s() argument at %d position must be function, got %s", name, i+1, args[i].Type())
+	}
+
+	return fn, nil
+}
+
+// Compose returns the function calling the given functions from right to
+// left, so compose(f, g)(x) is f(g(x)). The rightmost function takes the
+// arguments of the call, others take the single result of the previous one.
+func Compose(args variant.Args) (variant.Iface, error) {
+	if len(args) == 0 {
+		return nil, errors.New("compose() takes at least one argument")
+	}
+
+	fns := make([]*variant.Func, len(args))
+	for i := range args {
+		fn, err := funcArg("compose", args, i)
+		if err != nil {
+			return nil, err
+		}
+
+		fns[i] = fn
+	}
+
+	return compose(fns), nil
+}
+
+func compose(fns []*variant.Func) *variant.Func {
+	last := fns[len(fns)-1]
+	return variant.NewFunc(last.Idents(), func(args variant.Args) (variant.Iface, error) {
+		v, err := last.Call(args)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(fns) - 2; i >= 0; i-- {
+			v, err = fns[i].Call(variant.Args{v})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return v, nil
+	}).WithFork(func() *variant.Func {
+		return compose(forkAll(fns))
+	})
+}
+
+// Partial returns the function calling fn with the bound arguments followed
+// by the arguments of the call.
+func Partial(args variant.Args) (variant.Iface, error) {
+	if len(args) == 0 {
+		return nil, errors.New("partial() takes at least one argument")
+	}
+
+	fn, err := funcArg("partial", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return partial(fn, slices.Clone(args[1:])), nil
+}
+
+func partial(fn *variant.Func, bound variant.Args) *variant.Func {
+	return variant.NewFunc(restIdents(fn, len(bound)), func(args variant.Args) (variant.Iface, error) {
+		return fn.Call(append(slices.Clip(bound), args...))
+	}).WithFork(func() *variant.Func {
+		return partial(fn.Fork(), bound)
+	})
+}
+
+// Curry returns the function collecting arguments over several calls until
+// there are as many as fn takes, then fn is called with them. The number of
+// arguments is taken from fn unless it is given as the second argument,
+// e.g. for host functions.
+func Curry(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("curry() takes one or two arguments")
+	}
+
+	fn, err := funcArg("curry", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(fn.Idents())
+	if len(args) == 2 {
+		num, ok := args[1].(*variant.Num)
+		if !ok {
+			return nil, fmt.Errorf("curry() argument at 2 position must be number, got %s", args[1].Type())
+		}
+
+		i, err := num.AsInt64()
+		if err != nil || i < 0 {
+			return nil, errors.New("curry() number of arguments must be non-negative integer")
+		}
+
+		n = int(i)
+	}
+
+	if n == 0 {
+		return fn, nil
+	}
+
+	return curry(fn, n, nil), nil
+}
+
+func curry(fn *variant.Func, n int, bound variant.Args) *variant.Func {
+	return variant.NewFunc(restIdents(fn, len(bound)), func(args variant.Args) (variant.Iface, error) {
+		if len(args) == 0 {
+			return nil, errors.New("curried function takes at least one argument")
+		}
+
+		all := append(slices.Clip(bound), args...)
+		if len(all) >= n {
+			return fn.Call(all)
+		}
+
+		return curry(fn, n, all), nil
+	}).WithFork(func() *variant.Func {
+		return curry(fn.Fork(), n, bound)
+	})
+}
+
+// restIdents returns names of arguments of fn which are not bound yet.
+func restIdents(fn *variant.Func, bound int) []string {
+	idents := fn.Idents()
+	if idents == nil {
+		return nil
+	}
+
+	return idents[min(bound, len(idents)):]
+}
+
+func forkAll(fns []*variant.Func) []*variant.Func {
+	forks := make([]*variant.Func, len(fns))
+	for i, fn := range fns {
+		forks[i] = fn.Fork()
+	}
+
+	return forks
+}
@@ -0,0 +1,10 @@
+package funcs
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("func").
+	AddFunc("compose", Compose).
+	AddFunc("partial", Partial).
+	AddFunc("curry", Curry).
+	Build()
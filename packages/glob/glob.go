@@ -0,0 +1,72 @@
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Globber finds files of the file system returned by the function. Patterns
+// use the syntax of path.Match: *, ?, [a-z] and \ for escaping.
+type Globber struct {
+	fsys func() fs.FS
+}
+
+func stringArgs(name string, args variant.Args) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		if arg.Type() != variant.TypeString {
+			return nil, fmt.Errorf("%s() argument at %d position must be string, got %s", name, i+1, arg.Type())
+		}
+
+		strs[i] = arg.String()
+	}
+
+	return strs, nil
+}
+
+// Match reports whether the name matches the pattern.
+func Match(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("match() takes exactly two arguments")
+	}
+
+	strs, err := stringArgs("match", args)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := path.Match(strs[0], strs[1])
+	if err != nil {
+		return nil, fmt.Errorf("match(): invalid pattern '%s'", strs[0])
+	}
+
+	return variant.NewBool(ok), nil
+}
+
+// Glob returns sorted paths of files matching the pattern.
+func (g *Globber) Glob(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("glob() takes exactly one argument")
+	}
+
+	strs, err := stringArgs("glob", args)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := fs.Glob(g.fsys(), strs[0])
+	if err != nil {
+		return nil, fmt.Errorf("glob(): %w", err)
+	}
+
+	elems := make([]variant.Iface, len(names))
+	for i, name := range names {
+		elems[i] = variant.NewString(name)
+	}
+
+	return variant.NewArray(elems), nil
+}
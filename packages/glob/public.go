@@ -0,0 +1,18 @@
+package glob
+
+import (
+	"io/fs"
+
+	"github.com/hikitani/easylang/packages"
+)
+
+// NewPackage builds the glob package searching the file system returned by
+// the function.
+func NewPackage(fsys func() fs.FS) packages.Iface {
+	g := &Globber{fsys: fsys}
+	return packages.
+		New("glob").
+		AddFunc("match", Match).
+		AddFunc("glob", g.Glob).
+		Build()
+}
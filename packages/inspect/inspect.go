@@ -0,0 +1,118 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+func funcArg(name string, args variant.Args) (*variant.Func, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() takes exactly one argument", name)
+	}
+
+	fn, ok := args[0].(*variant.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s() argument must be function, got %s", name, args[0].Type())
+	}
+
+	return fn, nil
+}
+
+func objectArg(name string, args variant.Args, n int) (*variant.Object, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("%s() takes exactly %d arguments", name, n)
+	}
+
+	obj, ok := args[0].(*variant.Object)
+	if !ok {
+		return nil, fmt.Errorf("%s() first argument must be object, got %s", name, args[0].Type())
+	}
+
+	return obj, nil
+}
+
+// Arity returns the number of parameters of the function. Host functions
+// take any arguments, so none is returned for them.
+func Arity(args variant.Args) (variant.Iface, error) {
+	fn, err := funcArg("arity", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fn.Idents() == nil {
+		return variant.NewNone(), nil
+	}
+
+	return variant.Int(len(fn.Idents())), nil
+}
+
+// Params returns parameter names of the function, or none for host
+// functions.
+func Params(args variant.Args) (variant.Iface, error) {
+	fn, err := funcArg("params", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fn.Idents() == nil {
+		return variant.NewNone(), nil
+	}
+
+	names := make([]variant.Iface, len(fn.Idents()))
+	for i, ident := range fn.Idents() {
+		names[i] = variant.NewString(ident)
+	}
+
+	return variant.NewArray(names), nil
+}
+
+func Type(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("type() takes exactly one argument")
+	}
+
+	return variant.NewString(args[0].Type().String()), nil
+}
+
+// Keys returns keys of the object in the stable order, see
+// variant.Object.SortedKeys.
+func Keys(args variant.Args) (variant.Iface, error) {
+	obj, err := objectArg("keys", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.NewArray(obj.SortedKeys()), nil
+}
+
+// Has reports whether the object has the key.
+func Has(args variant.Args) (variant.Iface, error) {
+	obj, err := objectArg("has", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = obj.Get(args[1])
+	return variant.NewBool(err == nil), nil
+}
+
+// Doc returns the object with signature and text of the documented host
+// function, or none.
+func Doc(args variant.Args) (variant.Iface, error) {
+	fn, err := funcArg("doc", args)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := fn.Doc()
+	if !ok {
+		return variant.NewNone(), nil
+	}
+
+	return variant.FromMap(map[string]variant.Iface{
+		"signature": variant.NewString(doc.Signature),
+		"text":      variant.NewString(doc.Text),
+	}), nil
+}
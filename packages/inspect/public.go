@@ -0,0 +1,13 @@
+package inspect
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("inspect").
+	AddFunc("arity", Arity).
+	AddFunc("params", Params).
+	AddFunc("type", Type).
+	AddFunc("keys", Keys).
+	AddFunc("has", Has).
+	AddFunc("doc", Doc).
+	Build()
@@ -2,13 +2,73 @@ package iter
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/hikitani/easylang/variant"
 )
 
 var ErrStopIteration = errors.New("StopIteration")
 
+var (
+	nextKey  = variant.NewString("next")
+	closeKey = variant.NewString("close")
+)
+
+// AsIterator returns the next function of v if v is an object implementing
+// the iterator protocol, i.e. exposing a "next" function without arguments
+// which fails with ErrStopIteration when the sequence is exhausted.
+func AsIterator(v variant.Iface) (*variant.Func, bool) {
+	obj, ok := v.(*variant.Object)
+	if !ok {
+		return nil, false
+	}
+
+	next, err := obj.Get(nextKey)
+	if err != nil {
+		return nil, false
+	}
+
+	fn, ok := next.(*variant.Func)
+	return fn, ok
+}
+
+// Stop ends the iteration when called from a next function.
+func Stop(args variant.Args) (variant.Iface, error) {
+	if len(args) != 0 {
+		return nil, errors.New("stop() takes no arguments")
+	}
+
+	return nil, ErrStopIteration
+}
+
+// Close calls the close function of the iterator v, if it has one, to
+// release what the iteration holds when it ends early, e.g. on break.
+func Close(v variant.Iface) error {
+	obj, ok := v.(*variant.Object)
+	if !ok {
+		return nil
+	}
+
+	closeV, err := obj.Get(closeKey)
+	if err != nil {
+		return nil
+	}
+
+	fn, ok := closeV.(*variant.Func)
+	if !ok {
+		return nil
+	}
+
+	_, err = fn.Call(nil)
+	return err
+}
+
 func NextIterator(v variant.Iface) (*variant.Func, error) {
+	if next, ok := AsIterator(v); ok {
+		return next, nil
+	}
+
 	switch v := v.(type) {
 	case *variant.Array:
 		i := int64(0)
@@ -31,6 +91,24 @@ func NextIterator(v variant.Iface) (*variant.Func, error) {
 				return elem, nil
 			},
 		), nil
+	case *variant.String:
+		runes := []rune(v.String())
+		i := 0
+		return variant.NewFunc(
+			[]string{}, func(args variant.Args) (variant.Iface, error) {
+				if len(args) != 0 {
+					return nil, errors.New("next() takes no arguments")
+				}
+
+				if i >= len(runes) {
+					return nil, ErrStopIteration
+				}
+
+				ch := runes[i]
+				i++
+				return variant.NewString(string(ch)), nil
+			},
+		), nil
 	case *variant.Object:
 		keys, vals := v.Items()
 		i := 0
@@ -57,7 +135,7 @@ func NextIterator(v variant.Iface) (*variant.Func, error) {
 		), nil
 	}
 
-	return nil, errors.New("argument must be an array or object")
+	return nil, errors.New("argument must be an array, object, string or iterator")
 }
 
 func iterList(nextFn *variant.Func) *variant.Func {
@@ -193,15 +271,52 @@ func iterSelect(nextFn *variant.Func) variant.Iface {
 	})
 }
 
+func countAll(nextFn *variant.Func) (variant.Iface, error) {
+	cnt := variant.Int(0).Copy()
+	for {
+		_, err := nextFn.Call(nil)
+		if errors.Is(err, ErrStopIteration) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		cnt.Add(variant.Int(1))
+	}
+
+	return cnt, nil
+}
+
 func iterCount(nextFn *variant.Func) variant.Iface {
 	return variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
 		if len(args) != 0 {
 			return nil, errors.New("count() takes no arguments")
 		}
 
-		cnt := variant.Int(0)
+		return countAll(nextFn)
+	})
+}
+
+func iterReduce(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"initial", "reducer"}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 2 {
+			return nil, errors.New("reduce() takes exactly two arguments")
+		}
+
+		if args[1].Type() != variant.TypeFunc {
+			return nil, errors.New("reduce() takes a reducer function as second argument")
+		}
+
+		reducer := variant.MustCast[*variant.Func](args[1])
+		if len(reducer.Idents()) != 2 {
+			return nil, errors.New("reducer must take exactly two arguments")
+		}
+
+		acc := args[0]
 		for {
-			_, err := nextFn.Call(nil)
+			elem, err := nextFn.Call(nil)
 			if errors.Is(err, ErrStopIteration) {
 				break
 			}
@@ -210,30 +325,370 @@ func iterCount(nextFn *variant.Func) variant.Iface {
 				return nil, err
 			}
 
-			cnt.Add(variant.Int(1))
+			acc, err = reducer.Call(variant.Args{acc, elem})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return acc, nil
+	})
+}
+
+func iterZip(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"other"}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 {
+			return nil, errors.New("zip() takes exactly one argument")
+		}
+
+		otherFn, err := NextIterator(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("zip(): %w", err)
+		}
+
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			a, err := nextFn.Call(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			b, err := otherFn.Call(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			return variant.FromMap(map[string]variant.Iface{
+				"a": a,
+				"b": b,
+			}), nil
+		})), nil
+	})
+}
+
+func iterEnumerate(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 0 {
+			return nil, errors.New("enumerate() takes no arguments")
+		}
+
+		i := 0
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			elem, err := nextFn.Call(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			idx := variant.Int(i)
+			i++
+			return variant.FromMap(map[string]variant.Iface{
+				"index": idx,
+				"value": elem,
+			}), nil
+		})), nil
+	})
+}
+
+func iterChain(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"other"}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 {
+			return nil, errors.New("chain() takes exactly one argument")
+		}
+
+		otherFn, err := NextIterator(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("chain(): %w", err)
+		}
+
+		current := nextFn
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			elem, err := current.Call(nil)
+			if errors.Is(err, ErrStopIteration) && current != otherFn {
+				current = otherFn
+				return current.Call(nil)
+			}
+
+			return elem, err
+		})), nil
+	})
+}
+
+func iterFlatten(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 0 {
+			return nil, errors.New("flatten() takes no arguments")
+		}
+
+		var inner *variant.Func
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			for {
+				if inner != nil {
+					elem, err := inner.Call(nil)
+					if !errors.Is(err, ErrStopIteration) {
+						return elem, err
+					}
+
+					inner = nil
+				}
+
+				elem, err := nextFn.Call(nil)
+				if err != nil {
+					return nil, err
+				}
+
+				if _, ok := AsIterator(elem); !ok && elem.Type() != variant.TypeArray {
+					return elem, nil
+				}
+
+				inner, err = NextIterator(elem)
+				if err != nil {
+					return nil, err
+				}
+			}
+		})), nil
+	})
+}
+
+func iterSkip(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"n"}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 {
+			return nil, errors.New("skip() takes exactly one argument")
+		}
+
+		if args[0].Type() != variant.TypeNum {
+			return nil, errors.New("skip() takes a number")
+		}
+
+		n, err := variant.MustCast[*variant.Num](args[0]).AsInt64()
+		if err != nil {
+			return nil, err
+		}
+
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			for ; n > 0; n-- {
+				if _, err := nextFn.Call(nil); err != nil {
+					return nil, err
+				}
+			}
+
+			return nextFn.Call(nil)
+		})), nil
+	})
+}
+
+func callPredicate(predicate *variant.Func, elem variant.Iface) (bool, error) {
+	res, err := predicate.Call(variant.Args{elem})
+	if err != nil {
+		return false, err
+	}
+
+	if res.Type() != variant.TypeBool {
+		return false, errors.New("predicate must return a bool")
+	}
+
+	return variant.MustCast[*variant.Bool](res).Bool(), nil
+}
+
+func predicateArg(name string, args variant.Args) (*variant.Func, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() takes exactly one argument", name)
+	}
+
+	if args[0].Type() != variant.TypeFunc {
+		return nil, fmt.Errorf("%s() takes a function", name)
+	}
+
+	predicate := variant.MustCast[*variant.Func](args[0])
+	if len(predicate.Idents()) != 1 {
+		return nil, errors.New("predicate must take exactly one argument")
+	}
+
+	return predicate, nil
+}
+
+func iterTakeWhile(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"predicate"}, func(args variant.Args) (variant.Iface, error) {
+		predicate, err := predicateArg("take_while", args)
+		if err != nil {
+			return nil, err
+		}
+
+		done := false
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			if done {
+				return nil, ErrStopIteration
+			}
+
+			elem, err := nextFn.Call(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := callPredicate(predicate, elem)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				done = true
+				return nil, ErrStopIteration
+			}
+
+			return elem, nil
+		})), nil
+	})
+}
+
+func iterSkipWhile(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"predicate"}, func(args variant.Args) (variant.Iface, error) {
+		predicate, err := predicateArg("skip_while", args)
+		if err != nil {
+			return nil, err
 		}
 
-		return cnt, nil
+		skipped := false
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			for {
+				elem, err := nextFn.Call(nil)
+				if err != nil {
+					return nil, err
+				}
+
+				if skipped {
+					return elem, nil
+				}
+
+				ok, err := callPredicate(predicate, elem)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					skipped = true
+					return elem, nil
+				}
+			}
+		})), nil
+	})
+}
+
+// lessKey compares sort keys, which must be both numbers or both strings.
+func lessKey(a, b variant.Iface) (bool, error) {
+	if a.Type() != b.Type() {
+		return false, fmt.Errorf("types mismatch: %s != %s", a.Type(), b.Type())
+	}
+
+	switch a := a.(type) {
+	case *variant.Num:
+		return a.LessThan(variant.MustCast[*variant.Num](b)), nil
+	case *variant.String:
+		return a.String() < b.String(), nil
+	}
+
+	return false, fmt.Errorf("sort key must be number or string, got %s", a.Type())
+}
+
+func iterSortBy(nextFn *variant.Func) variant.Iface {
+	return variant.NewFunc([]string{"key"}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 1 {
+			return nil, errors.New("sort_by() takes exactly one argument")
+		}
+
+		if args[0].Type() != variant.TypeFunc {
+			return nil, errors.New("sort_by() takes a key function")
+		}
+
+		keyFn := variant.MustCast[*variant.Func](args[0])
+		if len(keyFn.Idents()) != 1 {
+			return nil, errors.New("key function must take exactly one argument")
+		}
+
+		var sorted *variant.Func
+		return iterObject(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+			if sorted != nil {
+				return sorted.Call(nil)
+			}
+
+			var elems, keys []variant.Iface
+			for {
+				elem, err := nextFn.Call(nil)
+				if errors.Is(err, ErrStopIteration) {
+					break
+				}
+
+				if err != nil {
+					return nil, err
+				}
+
+				key, err := keyFn.Call(variant.Args{elem})
+				if err != nil {
+					return nil, err
+				}
+
+				elems = append(elems, elem)
+				keys = append(keys, key)
+			}
+
+			idx := make([]int, len(elems))
+			for i := range idx {
+				idx[i] = i
+			}
+
+			var sortErr error
+			sort.SliceStable(idx, func(i, j int) bool {
+				less, err := lessKey(keys[idx[i]], keys[idx[j]])
+				if err != nil && sortErr == nil {
+					sortErr = err
+				}
+				return less
+			})
+			if sortErr != nil {
+				return nil, fmt.Errorf("sort_by(): %w", sortErr)
+			}
+
+			res := make([]variant.Iface, 0, len(elems))
+			for _, i := range idx {
+				res = append(res, elems[i])
+			}
+
+			sorted, _ = NextIterator(variant.NewArray(res))
+			return sorted.Call(nil)
+		})), nil
 	})
 }
 
+// NewIterator wraps the next function into an iterator object supporting the
+// iterator protocol and the chain methods of the iter package.
+func NewIterator(next *variant.Func) *variant.Object {
+	return iterObject(next)
+}
+
+// NewClosableIterator returns the iterator which has the close function
+// besides next, see Close.
+func NewClosableIterator(next, closeFn *variant.Func) *variant.Object {
+	obj := iterObject(next)
+	// string keys are always hashable
+	_ = obj.Set(closeKey, closeFn)
+	return obj
+}
+
 func iterObject(nextV *variant.Func) *variant.Object {
-	return variant.MustNewObject(
-		[]variant.Iface{
-			variant.NewString("list"),
-			variant.NewString("max"),
-			variant.NewString("where"),
-			variant.NewString("select"),
-			variant.NewString("count"),
-		},
-		[]variant.Iface{
-			iterList(nextV),
-			iterMax(nextV),
-			iterWhere(nextV),
-			iterSelect(nextV),
-			iterCount(nextV),
-		},
-	)
+	return variant.FromMap(map[string]variant.Iface{
+		"next":       nextV,
+		"list":       iterList(nextV),
+		"max":        iterMax(nextV),
+		"where":      iterWhere(nextV),
+		"select":     iterSelect(nextV),
+		"count":      iterCount(nextV),
+		"reduce":     iterReduce(nextV),
+		"zip":        iterZip(nextV),
+		"enumerate":  iterEnumerate(nextV),
+		"chain":      iterChain(nextV),
+		"flatten":    iterFlatten(nextV),
+		"skip":       iterSkip(nextV),
+		"take_while": iterTakeWhile(nextV),
+		"skip_while": iterSkipWhile(nextV),
+		"sort_by":    iterSortBy(nextV),
+	})
 }
 
 func Range(args variant.Args) (variant.Iface, error) {
@@ -294,6 +749,9 @@ func rangeIterator(start, stop, step *variant.Num) (*variant.Func, error) {
 		return nil, errors.New("step cannot be zero")
 	}
 
+	// start is advanced in place, so it must not alias the caller's number
+	start = start.Copy()
+
 	var condition func(*variant.Num) bool
 	if step.LessThan(variant.Int(0)) {
 		if start.LessThan(stop) {
@@ -326,19 +784,26 @@ func rangeIterator(start, stop, step *variant.Num) (*variant.Func, error) {
 
 func Iter(args variant.Args) (variant.Iface, error) {
 	if len(args) != 1 {
-		return nil, errors.New("iter() takes exactly one argument")
+		return nil, errors.New("from() takes exactly one argument")
 	}
 
-	switch args[0].Type() {
-	case variant.TypeArray, variant.TypeObject:
-	default:
-		return nil, errors.New("first argument must be an array or object")
+	nextV, err := NextIterator(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("from(): %w", err)
+	}
+
+	return iterObject(nextV), nil
+}
+
+func Count(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("count() takes exactly one argument")
 	}
 
 	nextV, err := NextIterator(args[0])
 	if err != nil {
-		panic("unreachable")
+		return nil, fmt.Errorf("count(): %w", err)
 	}
 
-	return iterObject(nextV), nil
+	return countAll(nextV)
 }
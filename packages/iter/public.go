@@ -6,4 +6,6 @@ var Package = packages.
 	New("iter").
 	AddFunc("from", Iter).
 	AddFunc("range", Range).
+	AddFunc("count", Count).
+	AddFunc("stop", Stop).
 	Build()
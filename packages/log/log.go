@@ -0,0 +1,79 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Caller returns the script position of the current call.
+type Caller func() (file string, line int)
+
+// Logger forwards script messages to the host logger.
+type Logger struct {
+	logger func() *slog.Logger
+	caller Caller
+}
+
+func attrValue(v variant.Iface) slog.Value {
+	switch v := v.(type) {
+	case *variant.Bool:
+		return slog.BoolValue(v.Bool())
+	case *variant.Num:
+		if n, err := v.AsInt64(); err == nil {
+			return slog.Int64Value(n)
+		}
+
+		f, _ := v.Value().Float64()
+		return slog.Float64Value(f)
+	}
+
+	return slog.StringValue(v.String())
+}
+
+func (l *Logger) log(name string, level slog.Level, args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%s() takes one or two arguments", name)
+	}
+
+	var attrs []slog.Attr
+	if len(args) == 2 {
+		obj, ok := args[1].(*variant.Object)
+		if !ok {
+			return nil, fmt.Errorf("%s() second argument must be object, got %s", name, args[1].Type())
+		}
+
+		obj.IterFunc(func(k, v variant.Iface) (cont, brk bool) {
+			attrs = append(attrs, slog.Attr{Key: k.String(), Value: attrValue(v)})
+			return false, false
+		})
+	}
+
+	logger := l.logger()
+	if logger == nil {
+		return variant.NewNone(), nil
+	}
+
+	file, line := l.caller()
+	attrs = append(attrs, slog.String("file", file), slog.Int("line", line))
+	logger.LogAttrs(context.Background(), level, args[0].String(), attrs...)
+	return variant.NewNone(), nil
+}
+
+func (l *Logger) Debug(args variant.Args) (variant.Iface, error) {
+	return l.log("debug", slog.LevelDebug, args)
+}
+
+func (l *Logger) Info(args variant.Args) (variant.Iface, error) {
+	return l.log("info", slog.LevelInfo, args)
+}
+
+func (l *Logger) Warn(args variant.Args) (variant.Iface, error) {
+	return l.log("warn", slog.LevelWarn, args)
+}
+
+func (l *Logger) Error(args variant.Args) (variant.Iface, error) {
+	return l.log("error", slog.LevelError, args)
+}
@@ -0,0 +1,20 @@
+package log
+
+import (
+	"log/slog"
+
+	"github.com/hikitani/easylang/packages"
+)
+
+// NewPackage builds the log package writing records to the logger returned
+// by logger. Records get file and line of the script call as attributes.
+func NewPackage(logger func() *slog.Logger, caller Caller) packages.Iface {
+	l := &Logger{logger: logger, caller: caller}
+	return packages.
+		New("log").
+		AddFunc("debug", l.Debug).
+		AddFunc("info", l.Info).
+		AddFunc("warn", l.Warn).
+		AddFunc("error", l.Error).
+		Build()
+}
@@ -9,13 +9,46 @@ import (
 type Constructor struct {
 	name    string
 	objects map[string]variant.Iface
+	docs    map[string]variant.Doc
 }
 
 func (p *Constructor) AddVariant(name string, obj variant.Iface) *Constructor {
 	p.objects[name] = obj
+	if doc, ok := p.docs[name]; ok {
+		attachDoc(obj, doc)
+	}
+
 	return p
 }
 
+// Doc attaches the signature and description to the object of the package.
+// Functions show it with help(), the docs of all objects are returned by
+// Docs, e.g. to generate documentation.
+func (p *Constructor) Doc(name, signature, text string) *Constructor {
+	doc := variant.Doc{Signature: signature, Text: text}
+	p.docs[name] = doc
+	if obj, ok := p.objects[name]; ok {
+		attachDoc(obj, doc)
+	}
+
+	return p
+}
+
+// AddDocs attaches docs to objects by name, see Doc.
+func (p *Constructor) AddDocs(docs map[string]variant.Doc) *Constructor {
+	for name, doc := range docs {
+		p.Doc(name, doc.Signature, doc.Text)
+	}
+
+	return p
+}
+
+func attachDoc(obj variant.Iface, doc variant.Doc) {
+	if fn, ok := obj.(*variant.Func); ok {
+		fn.WithDoc(doc)
+	}
+}
+
 func (p *Constructor) AddNone(name string) *Constructor {
 	return p.AddVariant(name, variant.NewNone())
 }
@@ -100,6 +133,10 @@ func (p *Constructor) Objects() map[string]variant.Iface {
 	return p.objects
 }
 
+func (p *Constructor) Docs() map[string]variant.Doc {
+	return p.docs
+}
+
 func (p *Constructor) Build() Iface {
 	return p
 }
@@ -108,6 +145,7 @@ func New(name string) *Constructor {
 	return &Constructor{
 		name:    name,
 		objects: map[string]variant.Iface{},
+		docs:    map[string]variant.Doc{},
 	}
 }
 
@@ -115,3 +153,46 @@ type Iface interface {
 	Name() string
 	Objects() map[string]variant.Iface
 }
+
+// Documented is implemented by packages with docs of their objects.
+type Documented interface {
+	Docs() map[string]variant.Doc
+}
+
+// Host is the machine running scripts as seen by packages built on the
+// first using.
+type Host interface {
+	// Config returns the configuration of the package set by the host, nil
+	// when it is not set.
+	Config(pkg string) any
+}
+
+// Initializer is implemented by packages built on the first using of the
+// machine, so scripts which do not use them do not pay for the construction.
+// The package returned by Init replaces it in the registry.
+type Initializer interface {
+	Iface
+	Init(host Host) (Iface, error)
+}
+
+// Lazy returns the package built by init on the first using.
+func Lazy(name string, init func(host Host) (Iface, error)) Iface {
+	return &lazy{name: name, init: init}
+}
+
+type lazy struct {
+	name string
+	init func(host Host) (Iface, error)
+}
+
+func (p *lazy) Name() string {
+	return p.name
+}
+
+func (p *lazy) Objects() map[string]variant.Iface {
+	return map[string]variant.Iface{}
+}
+
+func (p *lazy) Init(host Host) (Iface, error) {
+	return p.init(host)
+}
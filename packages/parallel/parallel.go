@@ -0,0 +1,117 @@
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Pool runs script functions over array elements in goroutines. Every worker
+// calls its own fork of the function, see variant.Func.Fork.
+type Pool struct {
+	maxWorkers func() int
+}
+
+func (p *Pool) parseArgs(name string, args variant.Args) ([]variant.Iface, *variant.Func, int, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, nil, 0, fmt.Errorf("%s() takes two or three arguments", name)
+	}
+
+	arr, ok := args[0].(*variant.Array)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s() first argument must be array", name)
+	}
+
+	fn, ok := args[1].(*variant.Func)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s() second argument must be function", name)
+	}
+
+	workers := p.maxWorkers()
+	if len(args) == 3 {
+		opts, ok := args[2].(*variant.Object)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("%s() third argument must be object", name)
+		}
+
+		if v, err := opts.Get(variant.NewString("workers")); err == nil {
+			num, ok := v.(*variant.Num)
+			if !ok {
+				return nil, nil, 0, fmt.Errorf("%s() workers must be number", name)
+			}
+
+			n, err := num.AsInt64()
+			if err != nil || n < 1 {
+				return nil, nil, 0, fmt.Errorf("%s() workers must be positive integer", name)
+			}
+
+			workers = min(workers, int(n))
+		}
+	}
+
+	return arr.Elems(), fn, max(workers, 1), nil
+}
+
+// run calls fn for each element and returns results in the order of
+// elements. Errors of all failed calls are joined.
+func run(elems []variant.Iface, fn *variant.Func, workers int) ([]variant.Iface, error) {
+	res := make([]variant.Iface, len(elems))
+	errs := make([]error, len(elems))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(elems)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			f := fn.Fork()
+			for j := range jobs {
+				v, err := f.Call(variant.Args{elems[j]})
+				if err != nil {
+					errs[j] = fmt.Errorf("element at %d position: %w", j, err)
+					continue
+				}
+
+				res[j] = v
+			}
+		}()
+	}
+
+	for i := range elems {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return res, errors.Join(errs...)
+}
+
+func (p *Pool) Map(args variant.Args) (variant.Iface, error) {
+	elems, fn, workers, err := p.parseArgs("map", args)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := run(elems, fn, workers)
+	if err != nil {
+		return nil, fmt.Errorf("map(): %w", err)
+	}
+
+	return variant.NewArray(res), nil
+}
+
+func (p *Pool) ForEach(args variant.Args) (variant.Iface, error) {
+	elems, fn, workers, err := p.parseArgs("for_each", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := run(elems, fn, workers); err != nil {
+		return nil, fmt.Errorf("for_each(): %w", err)
+	}
+
+	return variant.NewNone(), nil
+}
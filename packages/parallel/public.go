@@ -0,0 +1,14 @@
+package parallel
+
+import "github.com/hikitani/easylang/packages"
+
+// NewPackage builds the parallel package running at most maxWorkers()
+// goroutines per call.
+func NewPackage(maxWorkers func() int) packages.Iface {
+	p := &Pool{maxWorkers: maxWorkers}
+	return packages.
+		New("parallel").
+		AddFunc("map", p.Map).
+		AddFunc("for_each", p.ForEach).
+		Build()
+}
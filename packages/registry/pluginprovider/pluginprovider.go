@@ -0,0 +1,70 @@
+// Package pluginprovider loads packages from Go plugins. It is separate from
+// the registry, so hosts which do not load plugins do not link the plugin
+// package, which disables dead code elimination of the linker.
+package pluginprovider
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"plugin"
+
+	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/registry"
+)
+
+// Plugins returns the provider of packages from Go plugins (.so files)
+// matching the glob pattern. A plugin exports Package of packages.Iface or
+// NewPackage of func() packages.Iface. Plugins are supported only by some
+// platforms, see the plugin package.
+func Plugins(pattern string) registry.PackageProvider {
+	return registry.ProviderFunc(func() ([]packages.Iface, error) {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		pkgs := make([]packages.Iface, 0, len(paths))
+		for _, path := range paths {
+			pkg, err := openPlugin(path)
+			if err != nil {
+				return nil, fmt.Errorf("plugin '%s': %w", path, err)
+			}
+
+			pkgs = append(pkgs, pkg)
+		}
+
+		return pkgs, nil
+	})
+}
+
+func openPlugin(path string) (packages.Iface, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sym, err := p.Lookup("Package"); err == nil {
+		// exported variables are looked up as pointers
+		switch pkg := sym.(type) {
+		case *packages.Iface:
+			return *pkg, nil
+		case packages.Iface:
+			return pkg, nil
+		}
+
+		return nil, fmt.Errorf("Package is %T, expected packages.Iface", sym)
+	}
+
+	sym, err := p.Lookup("NewPackage")
+	if err != nil {
+		return nil, errors.New("neither Package nor NewPackage is exported")
+	}
+
+	newPackage, ok := sym.(func() packages.Iface)
+	if !ok {
+		return nil, fmt.Errorf("NewPackage is %T, expected func() packages.Iface", sym)
+	}
+
+	return newPackage(), nil
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hikitani/easylang/packages"
+)
+
+// PackageProvider gives packages discovered at run time, so third parties
+// can ship packages without changing the registry.
+type PackageProvider interface {
+	Packages() ([]packages.Iface, error)
+}
+
+// ProviderFunc is the function used as PackageProvider.
+type ProviderFunc func() ([]packages.Iface, error)
+
+func (f ProviderFunc) Packages() ([]packages.Iface, error) {
+	return f()
+}
+
+// Load registers packages of the provider. Packages are registered until the
+// first error, e.g. the name which is already registered.
+func (reg *Registry) Load(p PackageProvider) error {
+	pkgs, err := p.Packages()
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		if err := reg.Register(pkg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Factory builds the package, it is called by every Load of the factories
+// provider.
+type Factory func() packages.Iface
+
+var factories = struct {
+	sync.Mutex
+	m map[string]Factory
+}{m: map[string]Factory{}}
+
+// RegisterFactory makes the package available by Factories, e.g. from init
+// of the package shipping it. It panics when the name is registered twice.
+func RegisterFactory(name string, factory Factory) {
+	factories.Lock()
+	defer factories.Unlock()
+
+	if _, ok := factories.m[name]; ok {
+		panic("registry: factory '" + name + "' is already registered")
+	}
+
+	factories.m[name] = factory
+}
+
+// Factories returns the provider of packages built by registered factories
+// in the order of names.
+func Factories() PackageProvider {
+	return ProviderFunc(func() ([]packages.Iface, error) {
+		factories.Lock()
+		defer factories.Unlock()
+
+		names := make([]string, 0, len(factories.m))
+		for name := range factories.m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		pkgs := make([]packages.Iface, 0, len(names))
+		for _, name := range names {
+			pkg := factories.m[name]()
+			if pkg.Name() != name {
+				return nil, fmt.Errorf("factory '%s' built package '%s'", name, pkg.Name())
+			}
+
+			pkgs = append(pkgs, pkg)
+		}
+
+		return pkgs, nil
+	})
+}
@@ -2,30 +2,168 @@ package registry
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/hikitani/easylang/lexer"
 	"github.com/hikitani/easylang/packages"
+	"github.com/hikitani/easylang/packages/archive"
 	"github.com/hikitani/easylang/packages/builtin"
+	"github.com/hikitani/easylang/packages/bytes"
+	"github.com/hikitani/easylang/packages/compress"
+	"github.com/hikitani/easylang/packages/decimal"
+	"github.com/hikitani/easylang/packages/funcs"
+	"github.com/hikitani/easylang/packages/inspect"
 	"github.com/hikitani/easylang/packages/iter"
+	"github.com/hikitani/easylang/packages/stream"
+	"github.com/hikitani/easylang/packages/toml"
+	"github.com/hikitani/easylang/variant"
 )
 
+// Filter reports whether the object of the package is available. The
+// package itself is checked with the empty object name.
+type Filter func(pkg, name string) bool
+
+// Wrap replaces the object of the package returned by Get, e.g. to observe
+// function calls.
+type Wrap func(pkg, name string, obj variant.Iface) variant.Iface
+
 type Registry struct {
 	packages map[string]packages.Iface
+	filter   Filter
+	wrap     Wrap
+	host     packages.Host
+}
+
+// SetHost sets the host passed to Init of packages.Initializer.
+func (reg *Registry) SetHost(host packages.Host) {
+	reg.host = host
+}
+
+// Init builds the package implementing packages.Initializer, which is kept
+// for next calls. Packages which are unknown or unavailable by the filter
+// are not built.
+func (reg *Registry) Init(name string) error {
+	pkg, ok := reg.packages[name].(packages.Initializer)
+	if !ok || reg.filter != nil && !reg.filter(name, "") {
+		return nil
+	}
+
+	built, err := pkg.Init(reg.host)
+	if err != nil {
+		return err
+	}
+
+	if built.Name() != name {
+		return fmt.Errorf("package '%s' initialized as '%s'", name, built.Name())
+	}
+
+	reg.packages[name] = built
+	return nil
+}
+
+// SetFilter limits packages and their objects returned by Get.
+func (reg *Registry) SetFilter(filter Filter) {
+	reg.filter = filter
+}
+
+// SetWrap sets the wrapper of package objects returned by Get.
+func (reg *Registry) SetWrap(wrap Wrap) {
+	reg.wrap = wrap
 }
 
 func (reg *Registry) Get(name string) (packages.Iface, bool) {
 	pkg, ok := reg.packages[name]
-	return pkg, ok
+	if !ok {
+		return nil, false
+	}
+
+	if reg.filter != nil {
+		if !reg.filter(name, "") {
+			return nil, false
+		}
+
+		pkg = Filtered(pkg, reg.filter)
+	}
+
+	if reg.wrap != nil {
+		pkg = Wrapped(pkg, reg.wrap)
+	}
+
+	return pkg, true
+}
+
+// Names returns sorted names of packages available by the filter.
+func (reg *Registry) Names() []string {
+	names := make([]string, 0, len(reg.packages))
+	for name := range reg.packages {
+		if reg.filter == nil || reg.filter(name, "") {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Wrapped returns the package with objects replaced by the wrapper.
+func Wrapped(pkg packages.Iface, wrap Wrap) packages.Iface {
+	p := packages.New(pkg.Name())
+	for objname, obj := range pkg.Objects() {
+		p.AddVariant(objname, wrap(pkg.Name(), objname, obj))
+	}
+
+	return withDocs(p, pkg).Build()
+}
+
+// Filtered returns the package with objects available by the filter.
+func Filtered(pkg packages.Iface, filter Filter) packages.Iface {
+	p := packages.New(pkg.Name())
+	for objname, obj := range pkg.Objects() {
+		if filter(pkg.Name(), objname) {
+			p.AddVariant(objname, obj)
+		}
+	}
+
+	return withDocs(p, pkg).Build()
+}
+
+// withDocs copies docs of the package objects kept by p.
+func withDocs(p *packages.Constructor, pkg packages.Iface) *packages.Constructor {
+	documented, ok := pkg.(packages.Documented)
+	if !ok {
+		return p
+	}
+
+	for objname, doc := range documented.Docs() {
+		if _, ok := p.Objects()[objname]; ok {
+			p.Doc(objname, doc.Signature, doc.Text)
+		}
+	}
+
+	return p
+}
+
+// SetBuiltin replaces the builtin package, e.g. with one bound to the output
+// of the machine, so using builtin gives the same objects as builtins.
+func (reg *Registry) SetBuiltin(pkg packages.Iface) {
+	reg.packages[builtin.Package.Name()] = pkg
 }
 
 func (reg *Registry) Register(pkg packages.Iface) error {
 	if pkg.Name() == builtin.Package.Name() {
-		if pkg != builtin.Package {
+		if pkg != reg.packages[pkg.Name()] {
 			return errors.New("package name 'builtin' is reserved")
 		}
 
 		return nil
 	}
 
+	if !ValidName(pkg.Name()) {
+		return errors.New("invalid package name '" + pkg.Name() + "'")
+	}
+
 	if _, ok := reg.packages[pkg.Name()]; ok {
 		return errors.New("package name '" + pkg.Name() + "' is already registered")
 	}
@@ -34,11 +172,60 @@ func (reg *Registry) Register(pkg packages.Iface) error {
 	return nil
 }
 
+// Override registers the package replacing the one of the same name, e.g.
+// with the mock in tests.
+func (reg *Registry) Override(pkg packages.Iface) error {
+	if pkg.Name() == builtin.Package.Name() {
+		return errors.New("package name 'builtin' is reserved")
+	}
+
+	if !ValidName(pkg.Name()) {
+		return errors.New("invalid package name '" + pkg.Name() + "'")
+	}
+
+	reg.packages[pkg.Name()] = pkg
+	return nil
+}
+
+// Remove unregisters the package, so using statements do not find it.
+func (reg *Registry) Remove(name string) error {
+	if name == builtin.Package.Name() {
+		return errors.New("package name 'builtin' is reserved")
+	}
+
+	if _, ok := reg.packages[name]; !ok {
+		return errors.New("package name '" + name + "' is not registered")
+	}
+
+	delete(reg.packages, name)
+	return nil
+}
+
+// ValidName reports whether the package name is identifiers separated by
+// dots, e.g. "json" or "encoding.json".
+func ValidName(name string) bool {
+	for _, elem := range strings.Split(name, ".") {
+		if !lexer.IsIdent(elem) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func New() *Registry {
 	return &Registry{
 		packages: map[string]packages.Iface{
-			builtin.Package.Name(): builtin.Package,
-			iter.Package.Name():    iter.Package,
+			archive.Package.Name():  archive.Package,
+			builtin.Package.Name():  builtin.Package,
+			bytes.Package.Name():    bytes.Package,
+			compress.Package.Name(): compress.Package,
+			decimal.Package.Name():  decimal.Package,
+			funcs.Package.Name():    funcs.Package,
+			inspect.Package.Name():  inspect.Package,
+			iter.Package.Name():     iter.Package,
+			stream.Package.Name():   stream.Package,
+			toml.Package.Name():     toml.Package,
 		},
 	}
 }
@@ -0,0 +1,12 @@
+package sql
+
+import "github.com/hikitani/easylang/packages"
+
+// NewPackage builds the sql package running statements on the databases.
+func NewPackage(dbs *DBs) packages.Iface {
+	return packages.
+		New("sql").
+		AddFunc("query", dbs.Query).
+		AddFunc("exec", dbs.Exec).
+		Build()
+}
@@ -0,0 +1,261 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Limits restrict statements run by scripts.
+type Limits struct {
+	// MaxRows is the maximum number of rows returned by a query, zero means
+	// no limit. Queries returning more rows fail.
+	MaxRows int
+	// Timeout is the maximum duration of a statement, zero means no timeout.
+	Timeout time.Duration
+}
+
+// DBs holds databases available to scripts by name.
+type DBs struct {
+	mu     sync.RWMutex
+	dbs    map[string]*dbsql.DB
+	limits func() Limits
+}
+
+func NewDBs(limits func() Limits) *DBs {
+	return &DBs{dbs: map[string]*dbsql.DB{}, limits: limits}
+}
+
+// Clone returns databases available by the same names with other limits,
+// e.g. for the clone of the machine.
+func (d *DBs) Clone(limits func() Limits) *DBs {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return &DBs{dbs: maps.Clone(d.dbs), limits: limits}
+}
+
+// Register makes the database available by name, nil removes it.
+func (d *DBs) Register(name string, db *dbsql.DB) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if db == nil {
+		delete(d.dbs, name)
+		return
+	}
+
+	d.dbs[name] = db
+}
+
+func (d *DBs) parseArgs(fname string, args variant.Args) (*dbsql.DB, string, []any, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, "", nil, fmt.Errorf("%s() takes two or three arguments", fname)
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, "", nil, fmt.Errorf("%s() first argument must be string, got %s", fname, args[0].Type())
+	}
+
+	d.mu.RLock()
+	db, ok := d.dbs[args[0].String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, "", nil, fmt.Errorf("%s(): database '%s' is not registered", fname, args[0])
+	}
+
+	if args[1].Type() != variant.TypeString {
+		return nil, "", nil, fmt.Errorf("%s() second argument must be string, got %s", fname, args[1].Type())
+	}
+
+	var params []any
+	if len(args) == 3 {
+		arr, ok := args[2].(*variant.Array)
+		if !ok {
+			return nil, "", nil, fmt.Errorf("%s() third argument must be array, got %s", fname, args[2].Type())
+		}
+
+		for i, el := range arr.Elems() {
+			p, err := toParam(el)
+			if err != nil {
+				return nil, "", nil, fmt.Errorf("%s(): parameter at %d position: %w", fname, i, err)
+			}
+
+			params = append(params, p)
+		}
+	}
+
+	return db, args[1].String(), params, nil
+}
+
+func (d *DBs) context() (context.Context, context.CancelFunc, Limits) {
+	limits := d.limits()
+	if limits.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+		return ctx, cancel, limits
+	}
+
+	return context.Background(), func() {}, limits
+}
+
+func toParam(v variant.Iface) (any, error) {
+	switch v := v.(type) {
+	case *variant.None:
+		return nil, nil
+	case *variant.Bool:
+		return v.Bool(), nil
+	case *variant.Num:
+		if v.Value().IsInt() {
+			if n, err := v.AsInt64(); err == nil {
+				return n, nil
+			}
+		}
+
+		f, _ := v.Value().Float64()
+		return f, nil
+	case *variant.String:
+		return v.String(), nil
+	case *variant.Array:
+		if bs, ok := v.Bytes(); ok {
+			return bs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s cannot be passed to the database", v.Type())
+}
+
+func fromColumn(v any) (variant.Iface, error) {
+	switch v := v.(type) {
+	case nil:
+		return variant.NewNone(), nil
+	case bool:
+		return variant.NewBool(v), nil
+	case int64:
+		return variant.NewNum(new(big.Float).SetInt64(v)), nil
+	case float64:
+		if math.IsNaN(v) {
+			return nil, errors.New("NaN is not supported")
+		}
+
+		return variant.Float(v), nil
+	case string:
+		return variant.NewString(v), nil
+	case []byte:
+		// Many drivers return text columns as bytes.
+		if utf8.Valid(v) {
+			return variant.NewString(string(v)), nil
+		}
+
+		return variant.Bytes(append([]byte(nil), v...)), nil
+	case time.Time:
+		return variant.NewString(v.Format(time.RFC3339Nano)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported column type %T", v)
+}
+
+// Query runs the query with parameters and returns rows as the array of
+// objects keyed by column names.
+func (d *DBs) Query(args variant.Args) (variant.Iface, error) {
+	db, query, params, err := d.parseArgs("query", args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, limits := d.context()
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query(): %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("query(): %w", err)
+	}
+
+	keys := make([]variant.Iface, len(cols))
+	for i, col := range cols {
+		keys[i] = variant.NewString(col)
+	}
+
+	var result []variant.Iface
+	for rows.Next() {
+		if limits.MaxRows > 0 && len(result) == limits.MaxRows {
+			return nil, fmt.Errorf("query(): more than %d rows returned", limits.MaxRows)
+		}
+
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("query(): %w", err)
+		}
+
+		row := make([]variant.Iface, len(cols))
+		for i, v := range vals {
+			if row[i], err = fromColumn(v); err != nil {
+				return nil, fmt.Errorf("query(): column '%s': %w", cols[i], err)
+			}
+		}
+
+		obj, err := variant.NewObject(keys, row)
+		if err != nil {
+			return nil, fmt.Errorf("query(): %w", err)
+		}
+
+		result = append(result, obj)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query(): %w", err)
+	}
+
+	return variant.NewArray(result), nil
+}
+
+// Exec runs the statement with parameters and returns the object with the
+// number of affected rows and the last inserted id, none when the driver
+// does not support them.
+func (d *DBs) Exec(args variant.Args) (variant.Iface, error) {
+	db, query, params, err := d.parseArgs("exec", args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, _ := d.context()
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("exec(): %w", err)
+	}
+
+	var affected, lastID variant.Iface = variant.NewNone(), variant.NewNone()
+	if n, err := res.RowsAffected(); err == nil {
+		affected = variant.NewNum(new(big.Float).SetInt64(n))
+	}
+
+	if n, err := res.LastInsertId(); err == nil {
+		lastID = variant.NewNum(new(big.Float).SetInt64(n))
+	}
+
+	return variant.FromMap(map[string]variant.Iface{
+		"rows_affected":  affected,
+		"last_insert_id": lastID,
+	}), nil
+}
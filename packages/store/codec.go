@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// bytesKey marks objects holding base64 encoded bytes.
+const bytesKey = "$bytes"
+
+func toJSON(v variant.Iface) (any, error) {
+	switch v := v.(type) {
+	case *variant.None:
+		return nil, nil
+	case *variant.Bool:
+		return v.Bool(), nil
+	case *variant.Num:
+		if v.Value().IsInf() {
+			return nil, errors.New("inf cannot be stored")
+		}
+
+		if v.Value().IsInt() {
+			n, _ := v.Value().Int(nil)
+			return json.Number(n.String()), nil
+		}
+
+		return json.Number(v.Value().Text('g', -1)), nil
+	case *variant.String:
+		return v.String(), nil
+	case *variant.Array:
+		if bs, ok := v.Bytes(); ok {
+			return map[string]any{bytesKey: base64.StdEncoding.EncodeToString(bs)}, nil
+		}
+
+		elems := v.Elems()
+		arr := make([]any, len(elems))
+		for i, el := range elems {
+			var err error
+			if arr[i], err = toJSON(el); err != nil {
+				return nil, err
+			}
+		}
+
+		return arr, nil
+	case *variant.Object:
+		keys, vals := v.Items()
+		obj := make(map[string]any, len(keys))
+		for i, k := range keys {
+			if k.Type() != variant.TypeString {
+				return nil, fmt.Errorf("object key must be string, got %s", k.Type())
+			}
+
+			val, err := toJSON(vals[i])
+			if err != nil {
+				return nil, err
+			}
+
+			obj[k.String()] = val
+		}
+
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("%s cannot be stored", v.Type())
+}
+
+func fromJSON(v any) (variant.Iface, error) {
+	switch v := v.(type) {
+	case nil:
+		return variant.NewNone(), nil
+	case bool:
+		return variant.NewBool(v), nil
+	case json.Number:
+		if n, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return variant.NewNum(new(big.Float).SetInt(n)), nil
+		}
+
+		f, _, err := new(big.Float).SetPrec(64).Parse(v.String(), 10)
+		if err != nil {
+			return nil, err
+		}
+
+		return variant.NewNum(f), nil
+	case string:
+		return variant.NewString(v), nil
+	case []any:
+		elems := make([]variant.Iface, len(v))
+		for i, el := range v {
+			var err error
+			if elems[i], err = fromJSON(el); err != nil {
+				return nil, err
+			}
+		}
+
+		return variant.NewArray(elems), nil
+	case map[string]any:
+		if s, ok := v[bytesKey].(string); ok && len(v) == 1 {
+			bs, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, err
+			}
+
+			return variant.Bytes(bs), nil
+		}
+
+		obj := make(map[string]variant.Iface, len(v))
+		for k, el := range v {
+			val, err := fromJSON(el)
+			if err != nil {
+				return nil, err
+			}
+
+			obj[k] = val
+		}
+
+		return variant.FromMap(obj), nil
+	}
+
+	return nil, fmt.Errorf("unexpected value %T", v)
+}
+
+// Encode returns the representation of the value kept by stores. Functions,
+// handles and promises cannot be encoded.
+func Encode(v variant.Iface) ([]byte, error) {
+	data, err := toJSON(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(data)
+}
+
+// Decode returns the value encoded by Encode.
+func Decode(data []byte) (variant.Iface, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("corrupted value: %w", err)
+	}
+
+	return fromJSON(v)
+}
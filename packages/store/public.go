@@ -0,0 +1,16 @@
+package store
+
+import "github.com/hikitani/easylang/packages"
+
+// NewPackage builds the store package over the store returned by the
+// function.
+func NewPackage(store func() Store) packages.Iface {
+	ks := &Keyspace{store: store}
+	return packages.
+		New("store").
+		AddFunc("get", ks.Get).
+		AddFunc("set", ks.Set).
+		AddFunc("delete", ks.Delete).
+		AddFunc("list", ks.List).
+		Build()
+}
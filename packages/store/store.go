@@ -0,0 +1,186 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Store is the keyspace kept by the host between script runs. Values are
+// encoded by the package, so implementations only keep bytes, e.g. in Redis
+// or bolt.
+type Store interface {
+	// Get returns the value by key, ok is false if the key is not found.
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte) error
+	// Delete removes the key, removing a missing key is not an error.
+	Delete(key string) error
+	// List returns keys starting with the prefix in any order.
+	List(prefix string) ([]string, error)
+}
+
+// Memory is the Store keeping values in memory.
+type Memory struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{m: map[string][]byte{}}
+}
+
+func (s *Memory) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.m[key]
+	return v, ok, nil
+}
+
+func (s *Memory) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *Memory) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.m, key)
+	return nil
+}
+
+func (s *Memory) List(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+// Keyspace exposes the store returned by the function to scripts.
+type Keyspace struct {
+	store func() Store
+}
+
+func keyArg(name string, args variant.Args) (string, error) {
+	if args[0].Type() != variant.TypeString {
+		return "", fmt.Errorf("%s() key must be string, got %s", name, args[0].Type())
+	}
+
+	return args[0].String(), nil
+}
+
+// Get returns the value by key. The second argument, none by default, is
+// returned when the key is not found.
+func (ks *Keyspace) Get(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("get() takes one or two arguments")
+	}
+
+	key, err := keyArg("get", args)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok, err := ks.store().Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("get(): %w", err)
+	}
+
+	if !ok {
+		if len(args) == 2 {
+			return args[1], nil
+		}
+
+		return variant.NewNone(), nil
+	}
+
+	v, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("get(): key '%s': %w", key, err)
+	}
+
+	return v, nil
+}
+
+func (ks *Keyspace) Set(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("set() takes exactly two arguments")
+	}
+
+	key, err := keyArg("set", args)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := Encode(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("set(): %w", err)
+	}
+
+	if err := ks.store().Set(key, data); err != nil {
+		return nil, fmt.Errorf("set(): %w", err)
+	}
+
+	return variant.NewNone(), nil
+}
+
+func (ks *Keyspace) Delete(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("delete() takes exactly one argument")
+	}
+
+	key, err := keyArg("delete", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ks.store().Delete(key); err != nil {
+		return nil, fmt.Errorf("delete(): %w", err)
+	}
+
+	return variant.NewNone(), nil
+}
+
+// List returns sorted keys starting with the prefix, all keys by default.
+func (ks *Keyspace) List(args variant.Args) (variant.Iface, error) {
+	if len(args) > 1 {
+		return nil, errors.New("list() takes at most one argument")
+	}
+
+	prefix := ""
+	if len(args) == 1 {
+		if args[0].Type() != variant.TypeString {
+			return nil, fmt.Errorf("list() prefix must be string, got %s", args[0].Type())
+		}
+
+		prefix = args[0].String()
+	}
+
+	keys, err := ks.store().List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list(): %w", err)
+	}
+
+	sort.Strings(keys)
+	elems := make([]variant.Iface, len(keys))
+	for i, k := range keys {
+		elems[i] = variant.NewString(k)
+	}
+
+	return variant.NewArray(elems), nil
+}
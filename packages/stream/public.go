@@ -0,0 +1,10 @@
+package stream
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("stream").
+	AddFunc("is_stream", IsStream).
+	AddFunc("lines", Lines).
+	AddFunc("copy", Copy).
+	Build()
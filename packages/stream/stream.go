@@ -0,0 +1,317 @@
+package stream
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hikitani/easylang/packages/iter"
+	"github.com/hikitani/easylang/variant"
+)
+
+// chunkSize is the size of chunks moved by copy.
+const chunkSize = 32 * 1024
+
+type reader struct {
+	r *bufio.Reader
+}
+
+// Read returns up to n bytes. Empty bytes are returned at the end of the
+// stream. The buffer grows with the data read, not by n, so large n does not
+// allocate ahead.
+func (s *reader) Read(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("read() takes exactly one argument")
+	}
+
+	num, ok := args[0].(*variant.Num)
+	if !ok {
+		return nil, fmt.Errorf("read() argument must be number, got %s", args[0].Type())
+	}
+
+	n, err := num.AsInt64()
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("read() argument must be positive integer, got %s", num)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(s.r, n))
+	if err != nil {
+		return nil, fmt.Errorf("read(): %w", err)
+	}
+
+	return variant.Bytes(buf), nil
+}
+
+// ReadLine returns the next line without the line ending or none at the end
+// of the stream.
+func (s *reader) ReadLine(args variant.Args) (variant.Iface, error) {
+	if len(args) != 0 {
+		return nil, errors.New("read_line() takes no arguments")
+	}
+
+	line, err := s.r.ReadString('\n')
+	if errors.Is(err, io.EOF) {
+		if line == "" {
+			return variant.NewNone(), nil
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("read_line(): %w", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return variant.NewString(line), nil
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Write writes the string or bytes and returns the number of written bytes.
+func (s *writer) Write(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("write() takes exactly one argument")
+	}
+
+	var data []byte
+	switch v := args[0].(type) {
+	case *variant.String:
+		data = []byte(v.String())
+	case *variant.Array:
+		bs, ok := v.Bytes()
+		if !ok {
+			return nil, errors.New("write() argument must be string or bytes, got array")
+		}
+
+		data = bs
+	default:
+		return nil, fmt.Errorf("write() argument must be string or bytes, got %s", args[0].Type())
+	}
+
+	n, err := s.w.Write(data)
+	if err != nil {
+		return nil, fmt.Errorf("write(): %w", err)
+	}
+
+	return variant.Int(n), nil
+}
+
+func closer(v any) func(args variant.Args) (variant.Iface, error) {
+	return func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 0 {
+			return nil, errors.New("close() takes no arguments")
+		}
+
+		if c, ok := v.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return nil, fmt.Errorf("close(): %w", err)
+			}
+		}
+
+		return variant.NewNone(), nil
+	}
+}
+
+// NewReader returns the stream object reading from r with read(n),
+// read_line() and close() functions. close closes r if it is io.Closer.
+func NewReader(r io.Reader) *variant.Object {
+	s := &reader{r: bufio.NewReader(r)}
+	return variant.FromMap(map[string]variant.Iface{
+		"read":      variant.NewFunc([]string{"n"}, s.Read),
+		"read_line": variant.NewFunc([]string{}, s.ReadLine),
+		"close":     variant.NewFunc([]string{}, closer(r)),
+	})
+}
+
+// NewWriter returns the stream object writing to w with write(s) and close()
+// functions. close closes w if it is io.Closer.
+func NewWriter(w io.Writer) *variant.Object {
+	s := &writer{w: w}
+	return variant.FromMap(map[string]variant.Iface{
+		"write": variant.NewFunc([]string{"s"}, s.Write),
+		"close": variant.NewFunc([]string{}, closer(w)),
+	})
+}
+
+// NewReadWriter returns the stream object with functions of both reader and
+// writer streams.
+func NewReadWriter(rw io.ReadWriter) *variant.Object {
+	r, w := &reader{r: bufio.NewReader(rw)}, &writer{w: rw}
+	return variant.FromMap(map[string]variant.Iface{
+		"read":      variant.NewFunc([]string{"n"}, r.Read),
+		"read_line": variant.NewFunc([]string{}, r.ReadLine),
+		"write":     variant.NewFunc([]string{"s"}, w.Write),
+		"close":     variant.NewFunc([]string{}, closer(rw)),
+	})
+}
+
+func method(fname string, v variant.Iface, name string) (*variant.Func, error) {
+	obj, ok := v.(*variant.Object)
+	if !ok {
+		return nil, fmt.Errorf("%s() argument must be stream, got %s", fname, v.Type())
+	}
+
+	fn, err := obj.Get(variant.NewString(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s() stream has no %s function", fname, name)
+	}
+
+	f, ok := fn.(*variant.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s() stream has no %s function", fname, name)
+	}
+
+	return f, nil
+}
+
+// IsStream reports whether the object has read or write function.
+func IsStream(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("is_stream() takes exactly one argument")
+	}
+
+	_, rerr := method("is_stream", args[0], "read")
+	_, werr := method("is_stream", args[0], "write")
+	return variant.NewBool(rerr == nil || werr == nil), nil
+}
+
+// Lines returns the iterator over lines of the stream, so the stream is never
+// read into memory at once.
+func Lines(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("lines() takes exactly one argument")
+	}
+
+	readLine, err := method("lines", args[0], "read_line")
+	if err != nil {
+		return nil, err
+	}
+
+	return iter.NewIterator(variant.NewFunc([]string{}, func(args variant.Args) (variant.Iface, error) {
+		if len(args) != 0 {
+			return nil, errors.New("next() takes no arguments")
+		}
+
+		line, err := readLine.Call(variant.Args{})
+		if err != nil {
+			return nil, err
+		}
+
+		if line.Type() == variant.TypeNone {
+			return nil, iter.ErrStopIteration
+		}
+
+		return line, nil
+	})), nil
+}
+
+// Copy moves data from the source stream to the destination one by chunks
+// and returns the number of copied bytes.
+func Copy(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("copy() takes exactly two arguments")
+	}
+
+	write, err := method("copy", args[0], "write")
+	if err != nil {
+		return nil, err
+	}
+
+	read, err := method("copy", args[1], "read")
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for {
+		chunk, err := read.Call(variant.Args{variant.Int(chunkSize)})
+		if err != nil {
+			return nil, err
+		}
+
+		arr, ok := chunk.(*variant.Array)
+		if !ok {
+			return nil, fmt.Errorf("copy(): read() must return bytes, got %s", chunk.Type())
+		}
+
+		if arr.Len() == 0 {
+			return variant.Int(total), nil
+		}
+
+		if _, err := write.Call(variant.Args{chunk}); err != nil {
+			return nil, err
+		}
+
+		total += arr.Len()
+	}
+}
+
+type funcReader struct {
+	read *variant.Func
+}
+
+func (r *funcReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	chunk, err := r.read.Call(variant.Args{variant.Int(len(p))})
+	if err != nil {
+		return 0, err
+	}
+
+	arr, ok := chunk.(*variant.Array)
+	if !ok {
+		return 0, fmt.Errorf("read() must return bytes, got %s", chunk.Type())
+	}
+
+	bs, ok := arr.Bytes()
+	if !ok && arr.Len() != 0 {
+		return 0, errors.New("read() must return bytes, got array")
+	}
+
+	if len(bs) == 0 {
+		return 0, io.EOF
+	}
+
+	if len(bs) > len(p) {
+		return 0, fmt.Errorf("read() returned %d bytes, more than %d requested", len(bs), len(p))
+	}
+
+	return copy(p, bs), nil
+}
+
+type funcWriter struct {
+	write *variant.Func
+}
+
+func (w *funcWriter) Write(p []byte) (int, error) {
+	if _, err := w.write.Call(variant.Args{variant.Bytes(append([]byte(nil), p...))}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// AsReader returns the reader calling read of the stream object, so host
+// functions can consume streams made by scripts as well as by the host.
+func AsReader(v variant.Iface) (io.Reader, bool) {
+	read, err := method("", v, "read")
+	if err != nil {
+		return nil, false
+	}
+
+	return &funcReader{read: read}, true
+}
+
+// AsWriter returns the writer calling write of the stream object.
+func AsWriter(v variant.Iface) (io.Writer, bool) {
+	write, err := method("", v, "write")
+	if err != nil {
+		return nil, false
+	}
+
+	return &funcWriter{write: write}, true
+}
@@ -0,0 +1,14 @@
+package testing
+
+import "github.com/hikitani/easylang/packages"
+
+// NewPackage builds the testing package recording test results in rec.
+func NewPackage(rec *Recorder) packages.Iface {
+	return packages.
+		New("testing").
+		AddFunc("assert_eq", AssertEq).
+		AddFunc("assert_true", AssertTrue).
+		AddFunc("fail", Fail).
+		AddFunc("test", rec.Test).
+		Build()
+}
@@ -0,0 +1,92 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Result is the outcome of a single test() call.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Recorder collects results of tests run by a script.
+type Recorder struct {
+	Results []Result
+}
+
+func message(name string, args variant.Args, n int, format string, a ...any) error {
+	msg := fmt.Sprintf(format, a...)
+	if len(args) > n {
+		msg = args[n].String() + ": " + msg
+	}
+
+	return fmt.Errorf("%s: %s", name, msg)
+}
+
+func AssertEq(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("assert_eq() takes two or three arguments")
+	}
+
+	if !variant.DeepEqual(args[0], args[1]) {
+		return nil, message("assert_eq", args, 2, "%s != %s", args[0], args[1])
+	}
+
+	return variant.NewNone(), nil
+}
+
+func AssertTrue(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("assert_true() takes one or two arguments")
+	}
+
+	if args[0].Type() != variant.TypeBool {
+		return nil, fmt.Errorf("assert_true() first argument must be bool, got %s", args[0].Type())
+	}
+
+	if !variant.MustCast[*variant.Bool](args[0]).Bool() {
+		return nil, message("assert_true", args, 1, "condition is false")
+	}
+
+	return variant.NewNone(), nil
+}
+
+func Fail(args variant.Args) (variant.Iface, error) {
+	if len(args) > 1 {
+		return nil, errors.New("fail() takes at most one argument")
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("fail")
+	}
+
+	return nil, errors.New("fail: " + args[0].String())
+}
+
+// Test runs the test function immediately and records its outcome in rec.
+// A failed test doesn't stop the script.
+func (rec *Recorder) Test(args variant.Args) (variant.Iface, error) {
+	if len(args) != 2 {
+		return nil, errors.New("test() takes exactly two arguments")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, errors.New("test() first argument must be string")
+	}
+
+	if args[1].Type() != variant.TypeFunc {
+		return nil, errors.New("test() second argument must be function")
+	}
+
+	_, err := variant.MustCast[*variant.Func](args[1]).Call(nil)
+	rec.Results = append(rec.Results, Result{
+		Name: args[0].String(),
+		Err:  err,
+	})
+
+	return variant.NewBool(err == nil), nil
+}
@@ -0,0 +1,74 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+var typeDatetime = variant.RegisterType("datetime")
+
+// datetimeLayouts are the forms of TOML date and time values: offset
+// date-time, local date-time, local date and local time. Fractional seconds
+// are accepted by time.Parse after the seconds field.
+var datetimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+	time.TimeOnly,
+}
+
+// Datetime is the TOML date or time value. It keeps the source text, so
+// encode writes it back unquoted and round trips preserve the value.
+type Datetime struct {
+	s string
+}
+
+// ParseDatetime validates s as one of TOML date and time forms. The date
+// and time may be separated by space, 'T' or 't'.
+func ParseDatetime(s string) (*Datetime, error) {
+	norm := strings.ToUpper(s)
+	if len(norm) > 10 && norm[10] == ' ' {
+		norm = norm[:10] + "T" + norm[11:]
+	}
+
+	for _, layout := range datetimeLayouts {
+		if _, err := time.Parse(layout, norm); err == nil {
+			return &Datetime{s: norm}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid datetime '%s'", s)
+}
+
+func (v *Datetime) Type() variant.Type   { return typeDatetime }
+func (v *Datetime) MemReader() io.Reader { return strings.NewReader(v.s) }
+func (v *Datetime) String() string       { return v.s }
+
+func (v *Datetime) Equal(other variant.Iface) bool {
+	o, ok := other.(*Datetime)
+	return ok && o.s == v.s
+}
+
+// NewDatetime is toml.datetime(s), the constructor of values to be encoded
+// as TOML dates and times.
+func NewDatetime(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("datetime() takes exactly one argument")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, fmt.Errorf("datetime() argument must be string, got %s", args[0].Type())
+	}
+
+	dt, err := ParseDatetime(args[0].String())
+	if err != nil {
+		return nil, fmt.Errorf("datetime(): %w", err)
+	}
+
+	return dt, nil
+}
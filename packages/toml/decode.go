@@ -0,0 +1,721 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// table is the TOML table under construction. Values are variants, nested
+// tables, arrays of tables or plain arrays of values.
+type table struct {
+	m       map[string]any
+	defined bool
+	inline  bool
+}
+
+func newTable() *table {
+	return &table{m: map[string]any{}}
+}
+
+type tableArray struct {
+	tables []*table
+}
+
+type decoder struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (d *decoder) errorf(format string, a ...any) error {
+	return fmt.Errorf("line %d: %s", d.line, fmt.Sprintf(format, a...))
+}
+
+func (d *decoder) eof() bool {
+	return d.pos >= len(d.src)
+}
+
+func (d *decoder) peek() byte {
+	if d.eof() {
+		return 0
+	}
+
+	return d.src[d.pos]
+}
+
+func (d *decoder) hasPrefix(s string) bool {
+	return strings.HasPrefix(d.src[d.pos:], s)
+}
+
+func (d *decoder) skipSpaces() {
+	for !d.eof() && (d.peek() == ' ' || d.peek() == '\t') {
+		d.pos++
+	}
+}
+
+func (d *decoder) skipComment() {
+	if d.peek() != '#' {
+		return
+	}
+
+	for !d.eof() && d.peek() != '\n' {
+		d.pos++
+	}
+}
+
+// skipBlank skips whitespace, comments and newlines.
+func (d *decoder) skipBlank() {
+	for {
+		d.skipSpaces()
+		d.skipComment()
+		if d.hasPrefix("\r\n") {
+			d.pos += 2
+			d.line++
+		} else if d.peek() == '\n' {
+			d.pos++
+			d.line++
+		} else {
+			return
+		}
+	}
+}
+
+// endLine expects the end of line after the value or the table header.
+func (d *decoder) endLine() error {
+	d.skipSpaces()
+	d.skipComment()
+	switch {
+	case d.eof():
+		return nil
+	case d.hasPrefix("\r\n"):
+		d.pos += 2
+	case d.peek() == '\n':
+		d.pos++
+	default:
+		return d.errorf("expected newline, got %q", d.peek())
+	}
+
+	d.line++
+	return nil
+}
+
+func (d *decoder) expect(ch byte) error {
+	if d.peek() != ch {
+		if d.eof() {
+			return d.errorf("expected %q, got end of input", ch)
+		}
+
+		return d.errorf("expected %q, got %q", ch, d.peek())
+	}
+
+	d.pos++
+	return nil
+}
+
+func (d *decoder) decode() (*table, error) {
+	root := newTable()
+	current := root
+	for {
+		d.skipBlank()
+		if d.eof() {
+			return root, nil
+		}
+
+		var err error
+		if d.hasPrefix("[[") {
+			current, err = d.arrayTableHeader(root)
+		} else if d.peek() == '[' {
+			current, err = d.tableHeader(root)
+		} else {
+			err = d.keyValue(current)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.endLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *decoder) tableHeader(root *table) (*table, error) {
+	d.pos++
+	d.skipSpaces()
+	keys, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+
+	d.skipSpaces()
+	if err := d.expect(']'); err != nil {
+		return nil, err
+	}
+
+	parent, err := d.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := keys[len(keys)-1]
+	switch v := parent.m[name].(type) {
+	case nil:
+		t := newTable()
+		t.defined = true
+		parent.m[name] = t
+		return t, nil
+	case *table:
+		if v.defined || v.inline {
+			return nil, d.errorf("table '%s' already defined", strings.Join(keys, "."))
+		}
+
+		v.defined = true
+		return v, nil
+	}
+
+	return nil, d.errorf("key '%s' already defined", strings.Join(keys, "."))
+}
+
+func (d *decoder) arrayTableHeader(root *table) (*table, error) {
+	d.pos += 2
+	d.skipSpaces()
+	keys, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+
+	d.skipSpaces()
+	if !d.hasPrefix("]]") {
+		return nil, d.errorf("expected ']]'")
+	}
+	d.pos += 2
+
+	parent, err := d.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := keys[len(keys)-1]
+	t := newTable()
+	t.defined = true
+	switch v := parent.m[name].(type) {
+	case nil:
+		parent.m[name] = &tableArray{tables: []*table{t}}
+		return t, nil
+	case *tableArray:
+		v.tables = append(v.tables, t)
+		return t, nil
+	}
+
+	return nil, d.errorf("key '%s' already defined", strings.Join(keys, "."))
+}
+
+// descend walks the tables by keys creating implicit tables. For arrays of
+// tables the last element is used.
+func (d *decoder) descend(t *table, keys []string) (*table, error) {
+	for i, key := range keys {
+		switch v := t.m[key].(type) {
+		case nil:
+			next := newTable()
+			t.m[key] = next
+			t = next
+		case *table:
+			if v.inline {
+				return nil, d.errorf("inline table '%s' cannot be extended", strings.Join(keys[:i+1], "."))
+			}
+
+			t = v
+		case *tableArray:
+			t = v.tables[len(v.tables)-1]
+		default:
+			return nil, d.errorf("key '%s' is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+
+	return t, nil
+}
+
+func (d *decoder) keyValue(t *table) error {
+	keys, err := d.key()
+	if err != nil {
+		return err
+	}
+
+	d.skipSpaces()
+	if err := d.expect('='); err != nil {
+		return err
+	}
+
+	d.skipSpaces()
+	val, err := d.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := d.descend(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	name := keys[len(keys)-1]
+	if _, ok := parent.m[name]; ok {
+		return d.errorf("key '%s' already defined", strings.Join(keys, "."))
+	}
+
+	parent.m[name] = val
+	return nil
+}
+
+func isBareKeyChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '-'
+}
+
+func (d *decoder) key() ([]string, error) {
+	var keys []string
+	for {
+		var (
+			key string
+			err error
+		)
+		switch d.peek() {
+		case '"':
+			key, err = d.basicString()
+		case '\'':
+			key, err = d.literalString()
+		default:
+			start := d.pos
+			for !d.eof() && isBareKeyChar(d.peek()) {
+				d.pos++
+			}
+
+			if start == d.pos {
+				return nil, d.errorf("expected key")
+			}
+
+			key = d.src[start:d.pos]
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		d.skipSpaces()
+		if d.peek() != '.' {
+			return keys, nil
+		}
+
+		d.pos++
+		d.skipSpaces()
+	}
+}
+
+func (d *decoder) value() (any, error) {
+	switch {
+	case d.hasPrefix(`"""`):
+		s, err := d.multilineBasicString()
+		return variant.NewString(s), err
+	case d.hasPrefix(`'''`):
+		s, err := d.multilineLiteralString()
+		return variant.NewString(s), err
+	case d.peek() == '"':
+		s, err := d.basicString()
+		return variant.NewString(s), err
+	case d.peek() == '\'':
+		s, err := d.literalString()
+		return variant.NewString(s), err
+	case d.peek() == '[':
+		return d.array()
+	case d.peek() == '{':
+		return d.inlineTable()
+	}
+
+	return d.scalar()
+}
+
+func (d *decoder) array() (any, error) {
+	d.pos++
+	var arr []any
+	for {
+		d.skipBlank()
+		if d.peek() == ']' {
+			d.pos++
+			return arr, nil
+		}
+
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, v)
+		d.skipBlank()
+		if d.peek() == ',' {
+			d.pos++
+			continue
+		}
+
+		if err := d.expect(']'); err != nil {
+			return nil, err
+		}
+
+		return arr, nil
+	}
+}
+
+func (d *decoder) inlineTable() (any, error) {
+	d.pos++
+	t := newTable()
+	d.skipSpaces()
+	if d.peek() == '}' {
+		d.pos++
+		t.inline = true
+		return t, nil
+	}
+
+	for {
+		d.skipSpaces()
+		if err := d.keyValue(t); err != nil {
+			return nil, err
+		}
+
+		d.skipSpaces()
+		if d.peek() == ',' {
+			d.pos++
+			continue
+		}
+
+		if err := d.expect('}'); err != nil {
+			return nil, err
+		}
+
+		t.inline = true
+		return t, nil
+	}
+}
+
+func (d *decoder) escape(sb *strings.Builder) error {
+	d.pos++
+	if d.eof() {
+		return d.errorf("unterminated escape sequence")
+	}
+
+	ch := d.peek()
+	d.pos++
+	switch ch {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if ch == 'U' {
+			n = 8
+		}
+
+		if d.pos+n > len(d.src) {
+			return d.errorf("invalid unicode escape")
+		}
+
+		code, err := strconv.ParseUint(d.src[d.pos:d.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return d.errorf("invalid unicode escape")
+		}
+
+		d.pos += n
+		sb.WriteRune(rune(code))
+	default:
+		return d.errorf("invalid escape sequence '\\%c'", ch)
+	}
+
+	return nil
+}
+
+func (d *decoder) basicString() (string, error) {
+	d.pos++
+	var sb strings.Builder
+	for {
+		if d.eof() || d.peek() == '\n' {
+			return "", d.errorf("unterminated string")
+		}
+
+		switch d.peek() {
+		case '"':
+			d.pos++
+			return sb.String(), nil
+		case '\\':
+			if err := d.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(d.peek())
+			d.pos++
+		}
+	}
+}
+
+func (d *decoder) literalString() (string, error) {
+	d.pos++
+	start := d.pos
+	for {
+		if d.eof() || d.peek() == '\n' {
+			return "", d.errorf("unterminated string")
+		}
+
+		if d.peek() == '\'' {
+			s := d.src[start:d.pos]
+			d.pos++
+			return s, nil
+		}
+
+		d.pos++
+	}
+}
+
+// skipFirstNewline trims the newline immediately following the opening
+// delimiter of multi-line strings.
+func (d *decoder) skipFirstNewline() {
+	if d.hasPrefix("\r\n") {
+		d.pos += 2
+		d.line++
+	} else if d.peek() == '\n' {
+		d.pos++
+		d.line++
+	}
+}
+
+func (d *decoder) multilineBasicString() (string, error) {
+	d.pos += 3
+	d.skipFirstNewline()
+	var sb strings.Builder
+	for {
+		if d.eof() {
+			return "", d.errorf("unterminated string")
+		}
+
+		if d.hasPrefix(`"""`) {
+			d.pos += 3
+			// Up to two quotes are allowed right before the closing delimiter.
+			for i := 0; i < 2 && d.peek() == '"'; i++ {
+				sb.WriteByte('"')
+				d.pos++
+			}
+
+			return sb.String(), nil
+		}
+
+		switch ch := d.peek(); ch {
+		case '\\':
+			rest := strings.TrimLeft(d.src[d.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				// Line ending backslash trims all whitespace up to the next
+				// non-whitespace character.
+				d.pos++
+				for !d.eof() && strings.IndexByte(" \t\r\n", d.peek()) >= 0 {
+					if d.peek() == '\n' {
+						d.line++
+					}
+					d.pos++
+				}
+				continue
+			}
+
+			if err := d.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			if ch == '\n' {
+				d.line++
+			}
+
+			sb.WriteByte(ch)
+			d.pos++
+		}
+	}
+}
+
+func (d *decoder) multilineLiteralString() (string, error) {
+	d.pos += 3
+	d.skipFirstNewline()
+	end := strings.Index(d.src[d.pos:], `'''`)
+	if end < 0 {
+		return "", d.errorf("unterminated string")
+	}
+
+	end += d.pos
+	for i := 0; i < 2 && end+3 < len(d.src) && d.src[end+3] == '\''; i++ {
+		end++
+	}
+
+	s := d.src[d.pos:end]
+	d.line += strings.Count(s, "\n")
+	d.pos = end + 3
+	return s, nil
+}
+
+func isScalarEnd(ch byte) bool {
+	return strings.IndexByte(" \t\r\n,]}#", ch) >= 0
+}
+
+func isDate(s string) bool {
+	return len(s) == 10 && s[4] == '-' && s[7] == '-'
+}
+
+func (d *decoder) scalar() (any, error) {
+	start := d.pos
+	for !d.eof() && !isScalarEnd(d.peek()) {
+		d.pos++
+	}
+
+	tok := d.src[start:d.pos]
+	// Date and time may be separated by space.
+	if isDate(tok) && d.peek() == ' ' && d.pos+3 < len(d.src) && d.src[d.pos+3] == ':' {
+		d.pos++
+		for !d.eof() && !isScalarEnd(d.peek()) {
+			d.pos++
+		}
+
+		tok = d.src[start:d.pos]
+	}
+
+	switch tok {
+	case "":
+		return nil, d.errorf("expected value")
+	case "true":
+		return variant.NewBool(true), nil
+	case "false":
+		return variant.NewBool(false), nil
+	case "inf", "+inf":
+		return variant.Inf(), nil
+	case "-inf":
+		return variant.NegInf(), nil
+	case "nan", "+nan", "-nan":
+		return variant.NaN(), nil
+	}
+
+	if len(tok) >= 8 && (tok[2] == ':' || isDate(tok[:min(10, len(tok))])) {
+		dt, err := ParseDatetime(tok)
+		if err != nil {
+			return nil, d.errorf("%s", err)
+		}
+
+		return dt, nil
+	}
+
+	num, err := parseNumber(tok)
+	if err != nil {
+		return nil, d.errorf("invalid value '%s'", tok)
+	}
+
+	return num, nil
+}
+
+func parseNumber(tok string) (*variant.Num, error) {
+	if strings.HasPrefix(tok, "_") || strings.HasSuffix(tok, "_") || strings.Contains(tok, "__") {
+		return nil, errors.New("invalid underscore")
+	}
+
+	s := strings.ReplaceAll(tok, "_", "")
+	for _, prefix := range []struct {
+		p    string
+		base int
+	}{{"0x", 16}, {"0o", 8}, {"0b", 2}} {
+		if strings.HasPrefix(s, prefix.p) {
+			n, ok := new(big.Int).SetString(s[2:], prefix.base)
+			if !ok {
+				return nil, errors.New("invalid integer")
+			}
+
+			return variant.NewNum(new(big.Float).SetInt(n)), nil
+		}
+	}
+
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, errors.New("leading zeros")
+	}
+
+	if strings.ContainsAny(s, ".eE") {
+		f, _, err := new(big.Float).SetPrec(64).Parse(s, 10)
+		if err != nil {
+			return nil, err
+		}
+
+		return variant.NewNum(f), nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, errors.New("invalid integer")
+	}
+
+	return variant.NewNum(new(big.Float).SetInt(n)), nil
+}
+
+func toVariant(v any) variant.Iface {
+	switch v := v.(type) {
+	case *table:
+		keys := make([]variant.Iface, 0, len(v.m))
+		vals := make([]variant.Iface, 0, len(v.m))
+		for k, val := range v.m {
+			keys = append(keys, variant.NewString(k))
+			vals = append(vals, toVariant(val))
+		}
+
+		return variant.MustNewObject(keys, vals)
+	case *tableArray:
+		elems := make([]variant.Iface, 0, len(v.tables))
+		for _, t := range v.tables {
+			elems = append(elems, toVariant(t))
+		}
+
+		return variant.NewArray(elems)
+	case []any:
+		elems := make([]variant.Iface, 0, len(v))
+		for _, el := range v {
+			elems = append(elems, toVariant(el))
+		}
+
+		return variant.NewArray(elems)
+	case variant.Iface:
+		return v
+	}
+
+	panic("unreachable")
+}
+
+// Decode parses the TOML document into the object.
+func Decode(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("decode() takes exactly one argument")
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return nil, fmt.Errorf("decode() argument must be string, got %s", args[0].Type())
+	}
+
+	d := &decoder{src: args[0].String(), line: 1}
+	root, err := d.decode()
+	if err != nil {
+		return nil, fmt.Errorf("decode(): %w", err)
+	}
+
+	return toVariant(root), nil
+}
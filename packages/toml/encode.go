@@ -0,0 +1,234 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+type entry struct {
+	key string
+	val variant.Iface
+}
+
+func sortedEntries(obj *variant.Object) ([]entry, error) {
+	keys, vals := obj.Items()
+	entries := make([]entry, 0, len(keys))
+	for i, k := range keys {
+		if k.Type() != variant.TypeString {
+			return nil, fmt.Errorf("object key must be string, got %s", k.Type())
+		}
+
+		entries = append(entries, entry{key: k.String(), val: vals[i]})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	return entries, nil
+}
+
+// isTableArray reports whether v is encoded as the array of tables.
+func isTableArray(v variant.Iface) bool {
+	arr, ok := v.(*variant.Array)
+	if !ok || arr.Len() == 0 {
+		return false
+	}
+
+	for _, el := range arr.Elems() {
+		if el.Type() != variant.TypeObject {
+			return false
+		}
+	}
+
+	return true
+}
+
+func encodeKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return encodeString(key)
+		}
+	}
+
+	return key
+}
+
+func encodeString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if ch < 0x20 || ch == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, ch)
+			} else {
+				sb.WriteRune(ch)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func encodeNum(num *variant.Num) string {
+	f := num.Value()
+	switch {
+	case num.IsNaN():
+		return "nan"
+	case f.IsInf() && f.Sign() > 0:
+		return "inf"
+	case f.IsInf():
+		return "-inf"
+	case f.IsInt():
+		n, _ := f.Int(nil)
+		return n.String()
+	}
+
+	s := f.Text('g', -1)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func encodeValue(v variant.Iface) (string, error) {
+	switch v := v.(type) {
+	case *variant.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case *variant.Num:
+		return encodeNum(v), nil
+	case *variant.String:
+		return encodeString(v.String()), nil
+	case *Datetime:
+		return v.String(), nil
+	case *variant.Array:
+		elems := v.Elems()
+		parts := make([]string, 0, len(elems))
+		for _, el := range elems {
+			s, err := encodeValue(el)
+			if err != nil {
+				return "", err
+			}
+
+			parts = append(parts, s)
+		}
+
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *variant.Object:
+		entries, err := sortedEntries(v)
+		if err != nil {
+			return "", err
+		}
+
+		parts := make([]string, 0, len(entries))
+		for _, e := range entries {
+			s, err := encodeValue(e.val)
+			if err != nil {
+				return "", err
+			}
+
+			parts = append(parts, encodeKey(e.key)+" = "+s)
+		}
+
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+
+	return "", fmt.Errorf("%s cannot be encoded", v.Type())
+}
+
+// encodeTable writes key/value pairs of the object followed by its
+// subtables and arrays of tables.
+func encodeTable(sb *strings.Builder, path []string, obj *variant.Object) error {
+	entries, err := sortedEntries(obj)
+	if err != nil {
+		return err
+	}
+
+	var tables []entry
+	for _, e := range entries {
+		if e.val.Type() == variant.TypeObject || isTableArray(e.val) {
+			tables = append(tables, e)
+			continue
+		}
+
+		s, err := encodeValue(e.val)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", e.key, err)
+		}
+
+		sb.WriteString(encodeKey(e.key) + " = " + s + "\n")
+	}
+
+	for _, e := range tables {
+		sub := append(path[:len(path):len(path)], encodeKey(e.key))
+		header := strings.Join(sub, ".")
+		if obj, ok := e.val.(*variant.Object); ok {
+			if sb.Len() > 0 {
+				sb.WriteByte('\n')
+			}
+
+			sb.WriteString("[" + header + "]\n")
+			if err := encodeTable(sb, sub, obj); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, el := range e.val.(*variant.Array).Elems() {
+			if sb.Len() > 0 {
+				sb.WriteByte('\n')
+			}
+
+			sb.WriteString("[[" + header + "]]\n")
+			if err := encodeTable(sb, sub, el.(*variant.Object)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Encode formats the object as the TOML document. Keys are sorted.
+func Encode(args variant.Args) (variant.Iface, error) {
+	if len(args) != 1 {
+		return nil, errors.New("encode() takes exactly one argument")
+	}
+
+	obj, ok := args[0].(*variant.Object)
+	if !ok {
+		return nil, fmt.Errorf("encode() argument must be object, got %s", args[0].Type())
+	}
+
+	var sb strings.Builder
+	if err := encodeTable(&sb, nil, obj); err != nil {
+		return nil, fmt.Errorf("encode(): %w", err)
+	}
+
+	return variant.NewString(sb.String()), nil
+}
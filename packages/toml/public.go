@@ -0,0 +1,10 @@
+package toml
+
+import "github.com/hikitani/easylang/packages"
+
+var Package = packages.
+	New("toml").
+	AddFunc("decode", Decode).
+	AddFunc("encode", Encode).
+	AddFunc("datetime", NewDatetime).
+	Build()
@@ -0,0 +1,143 @@
+package toml
+
+import (
+	"testing"
+
+	"github.com/hikitani/easylang/variant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, src string) (*variant.Object, error) {
+	t.Helper()
+
+	v, err := Decode(variant.Args{variant.NewString(src)})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*variant.Object), nil
+}
+
+func encode(t *testing.T, v variant.Iface) string {
+	t.Helper()
+
+	s, err := Encode(variant.Args{v})
+	require.NoError(t, err)
+	return s.String()
+}
+
+func get(t *testing.T, obj *variant.Object, key string) variant.Iface {
+	t.Helper()
+
+	v, err := obj.Get(variant.NewString(key))
+	require.NoError(t, err)
+	return v
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Input    string
+		Expected string
+	}{
+		{Name: "Int", Input: "v = 1_000", Expected: "1000"},
+		{Name: "Hex", Input: "v = 0xff", Expected: "255"},
+		{Name: "Float", Input: "v = 6.25e-1", Expected: "0.625"},
+		{Name: "Inf", Input: "v = -inf", Expected: "-Inf"},
+		{Name: "NaN", Input: "v = nan", Expected: "nan"},
+		{Name: "SignedNaN", Input: "v = -nan", Expected: "nan"},
+		{Name: "String", Input: `v = "a\tb"`, Expected: "a\tb"},
+		{Name: "LiteralString", Input: `v = 'C:\dir'`, Expected: `C:\dir`},
+		{Name: "OffsetDatetime", Input: "v = 1979-05-27T07:32:00Z", Expected: "1979-05-27T07:32:00Z"},
+		{Name: "OffsetDatetime_Fraction", Input: "v = 1979-05-27T00:32:00.999999-07:00", Expected: "1979-05-27T00:32:00.999999-07:00"},
+		{Name: "LocalDatetime_Space", Input: "v = 1979-05-27 07:32:00", Expected: "1979-05-27T07:32:00"},
+		{Name: "LocalDate", Input: "v = 1979-05-27", Expected: "1979-05-27"},
+		{Name: "LocalTime", Input: "v = 07:32:00", Expected: "07:32:00"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			obj, err := decode(t, tc.Input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Expected, get(t, obj, "v").String())
+		})
+	}
+}
+
+func TestDecode_Datetime(t *testing.T) {
+	obj, err := decode(t, "v = 1979-05-27")
+	require.NoError(t, err)
+
+	v := get(t, obj, "v")
+	assert.Equal(t, typeDatetime, v.Type())
+	assert.True(t, variant.DeepEqual(v, &Datetime{s: "1979-05-27"}))
+	assert.False(t, variant.DeepEqual(v, variant.NewString("1979-05-27")))
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Input string
+	}{
+		{Name: "MissingValue", Input: "v ="},
+		{Name: "MissingEquals", Input: "v 1"},
+		{Name: "DuplicateKey", Input: "v = 1\nv = 2"},
+		{Name: "DuplicateTable", Input: "[a]\n[a]"},
+		{Name: "TableOverValue", Input: "a = 1\n[a]"},
+		{Name: "UnterminatedString", Input: `v = "abc`},
+		{Name: "UnterminatedArray", Input: "v = [1, 2"},
+		{Name: "BadEscape", Input: `v = "\q"`},
+		{Name: "LeadingZeros", Input: "v = 012"},
+		{Name: "TrailingUnderscore", Input: "v = 1_"},
+		{Name: "BareWord", Input: "v = yes"},
+		{Name: "InvalidDate", Input: "v = 1979-13-27"},
+		{Name: "InvalidTime", Input: "v = 25:00:00"},
+		{Name: "InvalidOffset", Input: "v = 1979-05-27T07:32:00+25"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := decode(t, tc.Input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	dt, err := ParseDatetime("1979-05-27t07:32:00z")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		Name     string
+		Input    variant.Iface
+		Expected string
+	}{
+		{Name: "NaN", Input: variant.NaN(), Expected: "v = nan\n"},
+		{Name: "Inf", Input: variant.Inf(), Expected: "v = inf\n"},
+		{Name: "Float", Input: variant.Float(2.5), Expected: "v = 2.5\n"},
+		{Name: "Datetime", Input: dt, Expected: "v = 1979-05-27T07:32:00Z\n"},
+		{Name: "String", Input: variant.NewString("2024-01-01"), Expected: "v = \"2024-01-01\"\n"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			obj := variant.MustNewObject([]variant.Iface{variant.NewString("v")}, []variant.Iface{tc.Input})
+			assert.Equal(t, tc.Expected, encode(t, obj))
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Input string
+	}{
+		{Name: "Scalars", Input: "b = true\nf = 0.5\nn = -3\ns = \"x\\\"y\"\n"},
+		{Name: "Special", Input: "a = inf\nb = -inf\nc = nan\n"},
+		{Name: "Datetimes", Input: "d = 1979-05-27\nl = 1979-05-27T07:32:00\no = 1979-05-27T07:32:00.5+01:00\nt = 07:32:00\n"},
+		{Name: "Arrays", Input: "a = [1, [2, 3], { k = \"v\" }]\n"},
+		{Name: "Tables", Input: "[a]\nx = 1\n\n[a.b]\ny = 2\n"},
+		{Name: "TableArrays", Input: "[[u]]\nid = 1\n\n[[u]]\nid = 2\n"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			obj, err := decode(t, tc.Input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Input, encode(t, obj))
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package uuid
+
+import (
+	"io"
+
+	"github.com/hikitani/easylang/packages"
+)
+
+// NewPackage builds the uuid package generating UUIDs from random bytes
+// read from rand.
+func NewPackage(rand io.Reader) packages.Iface {
+	g := &Generator{rand: rand}
+	return packages.
+		New("uuid").
+		AddFunc("new", g.New).
+		AddFunc("parse", Parse).
+		AddFunc("is_valid", IsValid).
+		AddString("nil", "00000000-0000-0000-0000-000000000000").
+		Build()
+}
@@ -0,0 +1,101 @@
+package uuid
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Generator generates UUIDs reading random bytes from the source.
+type Generator struct {
+	rand io.Reader
+}
+
+func (g *Generator) New(args variant.Args) (variant.Iface, error) {
+	if len(args) != 0 {
+		return nil, errors.New("new() takes no arguments")
+	}
+
+	var u [16]byte
+	if _, err := io.ReadFull(g.rand, u[:]); err != nil {
+		return nil, fmt.Errorf("new(): read random: %w", err)
+	}
+
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+
+	return variant.NewString(format(u)), nil
+}
+
+func format(u [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+func parse(s string) ([16]byte, error) {
+	var u [16]byte
+	if len(s) != 36 {
+		return u, fmt.Errorf("invalid length %d", len(s))
+	}
+
+	if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, errors.New("invalid format")
+	}
+
+	src := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(src)); err != nil {
+		return u, errors.New("invalid hex digit")
+	}
+
+	return u, nil
+}
+
+func stringArg(name string, args variant.Args) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s() takes exactly one argument", name)
+	}
+
+	if args[0].Type() != variant.TypeString {
+		return "", fmt.Errorf("%s() argument must be string, got %s", name, args[0].Type())
+	}
+
+	return args[0].String(), nil
+}
+
+// Parse returns the UUID in the canonical lowercase form.
+func Parse(args variant.Args) (variant.Iface, error) {
+	s, err := stringArg("parse", args)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := parse(strings.ToLower(s))
+	if err != nil {
+		return nil, fmt.Errorf("parse(): invalid uuid '%s': %w", s, err)
+	}
+
+	return variant.NewString(format(u)), nil
+}
+
+func IsValid(args variant.Args) (variant.Iface, error) {
+	s, err := stringArg("is_valid", args)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = parse(s)
+	return variant.NewBool(err == nil), nil
+}
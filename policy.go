@@ -0,0 +1,48 @@
+package easylang
+
+import "strings"
+
+// PackagePolicy limits packages and functions available to scripts. Entries
+// are package names, e.g. "iter", or qualified object names, e.g.
+// "builtin.print". Builtins belong to the "builtin" package.
+type PackagePolicy struct {
+	// Allow lists available entries. Everything is available when empty.
+	Allow []string
+	// Deny lists unavailable entries. It takes precedence over Allow.
+	Deny []string
+}
+
+func policyHas(entries []string, pkg, name string) bool {
+	for _, entry := range entries {
+		if entry == pkg || name != "" && entry == pkg+"."+name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allows reports whether the object of the package is available. The package
+// itself is checked with the empty name and is available if any of its
+// objects is allowed.
+func (p PackagePolicy) allows(pkg, name string) bool {
+	if policyHas(p.Deny, pkg, name) {
+		return false
+	}
+
+	if len(p.Allow) == 0 || policyHas(p.Allow, pkg, name) {
+		return true
+	}
+
+	if name != "" {
+		return false
+	}
+
+	for _, entry := range p.Allow {
+		if strings.HasPrefix(entry, pkg+".") {
+			return true
+		}
+	}
+
+	return false
+}
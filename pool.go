@@ -0,0 +1,100 @@
+package easylang
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// MachinePool keeps clones of the machine with the program compiled ahead,
+// so hosts running the script on every request, e.g. HTTP handlers, skip
+// cloning and compiling. Machines are reset to the state after compiling when
+// they are put back.
+type MachinePool struct {
+	ready chan *PooledMachine
+}
+
+// PooledMachine is the machine of the pool with its program. It is used by
+// one goroutine until Release.
+type PooledMachine struct {
+	*Machine
+	// Program is the program compiled by the machine.
+	Program  *CompiledProgram
+	value    variant.Iface
+	snapshot *Snapshot
+	pool     *MachinePool
+}
+
+// NewMachinePool compiles the source by size clones of the base machine.
+// Globals set by the host per request, e.g. the request object, must be
+// defined by the base before, so the program can refer to them.
+func NewMachinePool(base *Machine, filename string, src io.Reader, size int) (*MachinePool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("invalid pool size %d", size)
+	}
+
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &MachinePool{ready: make(chan *PooledMachine, size)}
+	for i := 0; i < size; i++ {
+		pm := &PooledMachine{Machine: base.Clone(), pool: p}
+		pm.Program, err = pm.compileProgram(filename, bytes.NewReader(b), &pm.value)
+		if err != nil {
+			return nil, err
+		}
+
+		pm.snapshot = pm.Snapshot()
+		p.ready <- pm
+	}
+
+	return p, nil
+}
+
+// Get takes the ready machine, waiting for one to be released while all are
+// in use.
+func (p *MachinePool) Get(ctx context.Context) (*PooledMachine, error) {
+	select {
+	case pm := <-p.ready:
+		return pm, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Run runs the program by the machine of the pool with globals set, see
+// Machine.Run. Values of globals must not be shared with other runs, e.g.
+// objects are copied by the host.
+func (p *MachinePool) Run(ctx context.Context, globals map[string]variant.Iface) (Result, error) {
+	pm, err := p.Get(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer pm.Release()
+
+	for name, v := range globals {
+		if err := pm.SetGlobal(name, v); err != nil {
+			return Result{}, err
+		}
+	}
+
+	return pm.Run(ctx)
+}
+
+// Run runs the program, see Machine.Run.
+func (pm *PooledMachine) Run(ctx context.Context) (Result, error) {
+	return pm.run(ctx, pm.Program, &pm.value)
+}
+
+// Release resets global variables of the machine and puts it back to the
+// pool. The machine must not be used after.
+func (pm *PooledMachine) Release() {
+	pm.Restore(pm.snapshot)
+	pm.value = nil
+	pm.pool.ready <- pm
+}
@@ -0,0 +1,107 @@
+package easylang
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Pragma is the "#pragma key value" comment of the script header, e.g.
+// "#pragma require exec". The value is the rest of the line and may be empty.
+type Pragma struct {
+	Pos   lexer.Position
+	Key   string
+	Value string
+}
+
+// CompiledProgram is the compiled script with its metadata: the header of
+// leading comments and blank lines before the first statement, and what the
+// program depends on.
+type CompiledProgram struct {
+	StmtInvoker
+	// Shebang is the "#!" line of the script without the prefix.
+	Shebang string
+	Pragmas []Pragma
+	// Globals are names of global variables defined before compiling, e.g.
+	// builtins and ones set by the host, which the program reads.
+	Globals []string
+	// Packages are names of packages of using statements, including ones of
+	// imported files.
+	Packages []string
+	// Imports are paths of files imported by the program and its imports.
+	Imports []string
+}
+
+// Capabilities returns capabilities needed by packages of the program, so
+// the host can deny the script before running it.
+func (p *CompiledProgram) Capabilities() []Capability {
+	var caps []Capability
+	for _, pkg := range p.Packages {
+		if c, ok := packageCapabilities[pkg]; ok {
+			caps = append(caps, c)
+		}
+	}
+
+	return caps
+}
+
+// Pragma returns values of pragmas with the key in the order of the header.
+func (p *CompiledProgram) Pragma(key string) []string {
+	var vals []string
+	for _, pragma := range p.Pragmas {
+		if pragma.Key == key {
+			vals = append(vals, pragma.Value)
+		}
+	}
+
+	return vals
+}
+
+var pragmaKeyRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+
+// parseHeader reads the shebang and pragmas of the script header.
+func parseHeader(filename string, src []byte) (shebang string, pragmas []Pragma, err error) {
+	pos := lexer.Position{Filename: filename}
+	for rest := src; len(rest) > 0; {
+		var raw []byte
+		raw, rest, _ = bytes.Cut(rest, []byte("\n"))
+		pos.Line++
+
+		line := strings.TrimSpace(string(raw))
+		if pos.Line == 1 && strings.HasPrefix(line, "#!") {
+			shebang = strings.TrimSpace(line[2:])
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		body, ok := strings.CutPrefix(line, "#pragma")
+		if !ok || body != "" && body[0] != ' ' && body[0] != '\t' {
+			continue
+		}
+
+		body = strings.TrimSpace(body)
+		key, value := body, ""
+		if i := strings.IndexAny(body, " \t"); i >= 0 {
+			key, value = body[:i], strings.TrimSpace(body[i:])
+		}
+
+		pos.Column = bytes.IndexByte(raw, '#') + 1
+		if !pragmaKeyRe.MatchString(key) {
+			return "", nil, compileError(pos, fmt.Errorf("invalid pragma key '%s'", key))
+		}
+
+		pragmas = append(pragmas, Pragma{Pos: pos, Key: key, Value: value})
+	}
+
+	return shebang, pragmas, nil
+}
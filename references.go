@@ -0,0 +1,61 @@
+package easylang
+
+import "slices"
+
+// references collects what the program depends on while it is compiled.
+// Functions compiled again at run time, e.g. forks, do not record anything.
+type references struct {
+	globals  map[string]struct{}
+	packages map[string]struct{}
+	imports  map[string]struct{}
+}
+
+func newReferences() *references {
+	return &references{
+		globals:  map[string]struct{}{},
+		packages: map[string]struct{}{},
+		imports:  map[string]struct{}{},
+	}
+}
+
+// imported returns references of the imported file. Its globals are its
+// own, packages and imports are added to the importing program.
+func (r *references) imported() *references {
+	if r == nil {
+		return nil
+	}
+
+	return &references{
+		globals:  map[string]struct{}{},
+		packages: r.packages,
+		imports:  r.imports,
+	}
+}
+
+func (r *references) addGlobal(name string) {
+	if r != nil {
+		r.globals[name] = struct{}{}
+	}
+}
+
+func (r *references) addPackage(name string) {
+	if r != nil {
+		r.packages[name] = struct{}{}
+	}
+}
+
+func (r *references) addImport(path string) {
+	if r != nil {
+		r.imports[path] = struct{}{}
+	}
+}
+
+func sortedNames(m map[string]struct{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package easylang
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Script is the script file of the machine which is compiled again by
+// Reload when its source changes, e.g. a plugin of the long-running host.
+type Script struct {
+	m       *Machine
+	fsys    fs.FS
+	path    string
+	keep    []string
+	src     []byte
+	program atomic.Pointer[CompiledProgram]
+}
+
+// LoadScript compiles and invokes the script file. It does not watch the
+// file, the host picks up changes by calling Reload. Global variables named
+// by keep hold their values over reloads, e.g. counters and caches of the
+// plugin, other globals are defined again by the new source.
+func (m *Machine) LoadScript(fsys fs.FS, path string, keep ...string) (*Script, error) {
+	s := &Script{m: m, fsys: fsys, path: path, keep: keep}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Program returns the program of the last successful load. It is swapped
+// atomically, so it can be read while Reload runs.
+func (s *Script) Program() *CompiledProgram {
+	return s.program.Load()
+}
+
+// Reload compiles and invokes the script again when its source differs from
+// the loaded one and reports whether it did. When the new source fails to
+// compile or run, the previous program and global variables stay in place.
+// Reload must not run concurrently with scripts of the machine, the host
+// calls it between runs, e.g. by a ticker.
+func (s *Script) Reload() (bool, error) {
+	src, err := fs.ReadFile(s.fsys, s.path)
+	if err != nil {
+		return false, fmt.Errorf("reload '%s': %w", s.path, err)
+	}
+
+	if s.program.Load() != nil && bytes.Equal(src, s.src) {
+		return false, nil
+	}
+
+	globals := s.m.Globals()
+	snapshot := s.m.Snapshot()
+	program, err := s.m.CompileProgram(s.path, bytes.NewReader(src))
+	if err == nil {
+		err = program.Invoke()
+	}
+
+	if err != nil {
+		s.m.Restore(snapshot)
+		return false, err
+	}
+
+	if s.program.Load() != nil {
+		s.restoreKept(globals)
+	}
+
+	s.src = src
+	s.program.Store(program)
+	return true, nil
+}
+
+func (s *Script) restoreKept(globals map[string]variant.Iface) {
+	for _, name := range s.keep {
+		if v, ok := globals[name]; ok {
+			s.m.SetGlobal(name, v)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package easylang
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// ImportResolver finds files of import expressions, so hosts can serve
+// virtual modules, aliases like "std/json" or pinned versions of files.
+type ImportResolver interface {
+	// Resolve opens the file imported by importPath from the file fromPath,
+	// which is the filename of the program for its own imports. The name is
+	// the canonical path of the file: importing it twice is the cycle, and
+	// it is the path reported by CompiledProgram.Imports and used as
+	// fromPath of its imports.
+	Resolve(fromPath, importPath string) (f io.ReadCloser, name string, err error)
+}
+
+// ImportResolverFunc is the function used as ImportResolver.
+type ImportResolverFunc func(fromPath, importPath string) (io.ReadCloser, string, error)
+
+func (f ImportResolverFunc) Resolve(fromPath, importPath string) (io.ReadCloser, string, error) {
+	return f(fromPath, importPath)
+}
+
+// FSResolver returns the resolver of files of the file system, which is
+// used by default with the file system of SetFS. Paths are relative to the
+// root of the file system, "." and ".." elements are not allowed.
+func FSResolver(fsys fs.FS) ImportResolver {
+	return ImportResolverFunc(func(_, importPath string) (io.ReadCloser, string, error) {
+		return openImport(fsys, importPath)
+	})
+}
+
+// RegisterModule makes the source importable by the name without the file
+// system, e.g. helper modules shipped by the host. Modules are looked up
+// before the import resolver.
+func (m *Machine) RegisterModule(name string, src string) error {
+	path, err := cleanImportPath(name)
+	if err != nil {
+		return fmt.Errorf("module '%s': %w", name, err)
+	}
+
+	if m.modules == nil {
+		m.modules = map[string]string{}
+	}
+
+	m.modules[path] = src
+	return nil
+}
+
+// importResolver returns the resolver of imports of programs compiled by
+// the machine.
+func (m *Machine) importResolver() ImportResolver {
+	resolver := m.resolver
+	if resolver == nil {
+		resolver = FSResolver(m.fsys)
+	}
+
+	if len(m.modules) == 0 {
+		return resolver
+	}
+
+	modules := m.modules
+	return ImportResolverFunc(func(fromPath, importPath string) (io.ReadCloser, string, error) {
+		if path, err := cleanImportPath(importPath); err == nil {
+			if src, ok := modules[path]; ok {
+				return io.NopCloser(strings.NewReader(src)), path, nil
+			}
+		}
+
+		return resolver.Resolve(fromPath, importPath)
+	})
+}
+
+// cleanImportPath returns the slash separated path without the leading "./".
+func cleanImportPath(importPath string) (string, error) {
+	toCheck := filepath.FromSlash(importPath)
+	if len(toCheck) >= 2 && toCheck[0] == '.' && toCheck[1] == os.PathSeparator {
+		toCheck = toCheck[2:]
+	}
+
+	if err := module.CheckFilePath(toCheck); err != nil {
+		return "", fmt.Errorf("invalid path: %s", err)
+	}
+
+	return filepath.ToSlash(toCheck), nil
+}
+
+func openImport(fsys fs.FS, importPath string) (io.ReadCloser, string, error) {
+	path, err := cleanImportPath(importPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if fsys == nil {
+		return nil, "", fmt.Errorf("file '%s' does not exist", importPath)
+	}
+
+	f, err := fsys.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("file '%s' does not exist", importPath)
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	if s, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, "", err
+	} else if !s.Mode().IsRegular() {
+		f.Close()
+		return nil, "", fmt.Errorf("path '%s' does not point to a file", importPath)
+	}
+
+	return f, path, nil
+}
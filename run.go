@@ -0,0 +1,93 @@
+package easylang
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hikitani/easylang/variant"
+)
+
+// Result is the outcome of Run.
+type Result struct {
+	// Value is the value of the last statement of the script when it is an
+	// expression, e.g. "x * 2", otherwise none.
+	Value variant.Iface
+	// Published is the object of variables marked as pub.
+	Published *variant.Object
+	// Output is what the script printed.
+	Output  string
+	Metrics Metrics
+}
+
+// Metrics measure the run of the script.
+type Metrics struct {
+	// Steps are loop iterations and calls of script functions, the points
+	// where the script can be stopped.
+	Steps    int64
+	Duration time.Duration
+	// Allocs is the number of heap allocations of the whole process during
+	// the run, so it is approximate when other goroutines allocate too.
+	Allocs uint64
+}
+
+// Run compiles and runs the source, the script is stopped with the error of
+// the context once it is done. The output is captured into the result
+// instead of the writer of the machine. The result is returned on errors
+// too, with what was done before the error.
+func (m *Machine) Run(ctx context.Context, src string) (Result, error) {
+	var value variant.Iface
+	program, err := m.compileProgram("main.ela", strings.NewReader(src), &value)
+	if err != nil {
+		return Result{Value: variant.NewNone(), Published: m.Published()}, err
+	}
+
+	return m.run(ctx, program, &value)
+}
+
+// run invokes the program compiled with the value receiving its last
+// expression.
+func (m *Machine) run(ctx context.Context, program StmtInvoker, value *variant.Iface) (Result, error) {
+	var out strings.Builder
+	m.capture = &out
+	defer func() { m.capture = nil }()
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start, steps := time.Now(), m.interrupt.Steps()
+
+	*value = variant.NewNone()
+	m.interrupt.SetContext(ctx)
+	err := program.Invoke()
+	m.interrupt.SetContext(nil)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	return Result{
+		Value:     *value,
+		Published: m.Published(),
+		Output:    out.String(),
+		Metrics: Metrics{
+			Steps:    m.interrupt.Steps() - steps,
+			Duration: time.Since(start),
+			Allocs:   after.Mallocs - before.Mallocs,
+		},
+	}, err
+}
+
+// machineOutput is the output of builtins, it writes to the capture of Run
+// or to the output set by SetOutput.
+type machineOutput struct {
+	m *Machine
+}
+
+func (o machineOutput) Write(p []byte) (int, error) {
+	var w io.Writer = o.m.io.Stdout
+	if o.m.capture != nil {
+		w = o.m.capture
+	}
+
+	return w.Write(p)
+}
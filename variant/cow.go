@@ -0,0 +1,77 @@
+package variant
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// arrayBuf is the backing storage shared by arrays. end is the offset after
+// the last element used by any of them: only the array ending there may
+// append in place, other ones copy. Arrays without arrayBuf own their
+// storage.
+type arrayBuf struct {
+	end atomic.Int64
+}
+
+// shared returns the storage of v, marking it as shared.
+func (v *Array) shared() *arrayBuf {
+	if buf := v.buf.Load(); buf != nil {
+		return buf
+	}
+
+	buf := &arrayBuf{}
+	buf.end.Store(int64(v.off + v.Len()))
+	if !v.buf.CompareAndSwap(nil, buf) {
+		return v.buf.Load()
+	}
+
+	return buf
+}
+
+// reserve claims n elements following v in the storage, so they can be
+// written in place. It fails when v is not the tail of the storage or there
+// is no room.
+func (v *Array) reserve(n int) (*arrayBuf, bool) {
+	size := cap(v.v)
+	if v.bmode {
+		size = cap(v.bs)
+	}
+
+	if size-v.Len() < n {
+		return nil, false
+	}
+
+	buf := v.shared()
+	end := int64(v.off + v.Len())
+	return buf, buf.end.CompareAndSwap(end, end+int64(n))
+}
+
+// view returns elements from i to j of the storage of v, they may be beyond
+// the length of v.
+func (v *Array) view(buf *arrayBuf, i, j int) *Array {
+	arr := &Array{bmode: v.bmode, off: v.off + i}
+	if v.bmode {
+		arr.bs = v.bs[i:j]
+	} else {
+		arr.v = v.v[i:j]
+	}
+
+	arr.buf.Store(buf)
+	return arr
+}
+
+// own copies the shared storage before v is changed.
+func (v *Array) own() {
+	if v.buf.Load() == nil {
+		return
+	}
+
+	if v.bmode {
+		v.bs = slices.Clone(v.bs)
+	} else {
+		v.v = slices.Clone(v.v)
+	}
+
+	v.off = 0
+	v.buf.Store(nil)
+}
@@ -0,0 +1,315 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+var (
+	_ Iface          = &Decimal{}
+	_ Equaler        = &Decimal{}
+	_ BinaryOperator = &Decimal{}
+)
+
+// RoundingMode is the way of rounding decimals to the smaller scale.
+type RoundingMode uint8
+
+const (
+	// RoundHalfEven rounds to the nearest neighbor, ties to the even one.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest neighbor, ties away from zero.
+	RoundHalfUp
+	// RoundDown rounds towards zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+	// RoundFloor rounds towards negative infinity.
+	RoundFloor
+	// RoundCeil rounds towards positive infinity.
+	RoundCeil
+)
+
+var roundingNames = map[string]RoundingMode{
+	"half_even": RoundHalfEven,
+	"half_up":   RoundHalfUp,
+	"down":      RoundDown,
+	"up":        RoundUp,
+	"floor":     RoundFloor,
+	"ceil":      RoundCeil,
+}
+
+// ParseRoundingMode returns the rounding mode by name, e.g. half_even.
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	mode, ok := roundingNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown rounding mode '%s' (expected half_even, half_up, down, up, floor or ceil)", name)
+	}
+
+	return mode, nil
+}
+
+// Decimal is the fixed-point number, the integer scaled by 10^-scale. The
+// scale is kept by arithmetic, e.g. 1.50 + 1 is 2.50, and is only reduced by
+// rounding with the explicit mode.
+type Decimal struct {
+	v     *big.Int
+	scale int
+}
+
+// NewDecimal returns the decimal v * 10^-scale.
+func NewDecimal(v *big.Int, scale int) *Decimal {
+	if scale < 0 {
+		v = new(big.Int).Mul(v, pow10(-scale))
+		scale = 0
+	}
+
+	return &Decimal{v: v, scale: scale}
+}
+
+// ParseDecimal parses the decimal like "-12.30", the scale is the number of
+// fraction digits.
+func ParseDecimal(s string) (*Decimal, error) {
+	digits := strings.ReplaceAll(s, "_", "")
+	scale := 0
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = len(digits) - i - 1
+		digits = digits[:i] + digits[i+1:]
+	}
+
+	unsigned := strings.TrimLeft(digits, "+-")
+	if unsigned == "" || len(digits)-len(unsigned) > 1 || strings.Trim(unsigned, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid decimal '%s'", s)
+	}
+
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal '%s'", s)
+	}
+
+	return &Decimal{v: v, scale: scale}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Unscaled returns the integer of the decimal.
+func (v *Decimal) Unscaled() *big.Int {
+	return v.v
+}
+
+// Scale returns the number of fraction digits.
+func (v *Decimal) Scale() int {
+	return v.scale
+}
+
+// Rat returns the decimal as fraction.
+func (v *Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(v.v, pow10(v.scale))
+}
+
+// IsInt reports whether the decimal has no fraction.
+func (v *Decimal) IsInt() bool {
+	return new(big.Int).Rem(v.v, pow10(v.scale)).Sign() == 0
+}
+
+// rescale returns the unscaled integer of the decimal at the larger scale.
+func (v *Decimal) rescale(scale int) *big.Int {
+	if scale == v.scale {
+		return v.v
+	}
+
+	return new(big.Int).Mul(v.v, pow10(scale-v.scale))
+}
+
+func (v *Decimal) Add(other *Decimal) *Decimal {
+	scale := max(v.scale, other.scale)
+	return &Decimal{v: new(big.Int).Add(v.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+func (v *Decimal) Sub(other *Decimal) *Decimal {
+	scale := max(v.scale, other.scale)
+	return &Decimal{v: new(big.Int).Sub(v.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+func (v *Decimal) Mul(other *Decimal) *Decimal {
+	return &Decimal{v: new(big.Int).Mul(v.v, other.v), scale: v.scale + other.scale}
+}
+
+func (v *Decimal) Neg() *Decimal {
+	return &Decimal{v: new(big.Int).Neg(v.v), scale: v.scale}
+}
+
+func (v *Decimal) Cmp(other *Decimal) int {
+	scale := max(v.scale, other.scale)
+	return v.rescale(scale).Cmp(other.rescale(scale))
+}
+
+// Round returns the decimal with the given scale. Fraction digits are
+// dropped by the rounding mode, the smaller scale is padded with zeros.
+func (v *Decimal) Round(scale int, mode RoundingMode) *Decimal {
+	if scale >= v.scale {
+		return &Decimal{v: v.rescale(scale), scale: scale}
+	}
+
+	return &Decimal{v: roundQuo(v.v, pow10(v.scale-scale), mode), scale: scale}
+}
+
+// Quo returns v / other rounded to the scale by the mode.
+func (v *Decimal) Quo(other *Decimal, scale int, mode RoundingMode) (*Decimal, error) {
+	if other.v.Sign() == 0 {
+		return nil, errors.New("decimal division by zero")
+	}
+
+	// v / other * 10^scale as the fraction of integers
+	num, den := new(big.Int).Set(v.v), new(big.Int).Set(other.v)
+	if exp := scale + other.scale - v.scale; exp >= 0 {
+		num.Mul(num, pow10(exp))
+	} else {
+		den.Mul(den, pow10(-exp))
+	}
+
+	return &Decimal{v: roundQuo(num, den, mode), scale: scale}, nil
+}
+
+// roundQuo returns num / den rounded to the integer by the mode.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	neg := (num.Sign() < 0) != (den.Sign() < 0)
+	var away bool
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundFloor:
+		away = neg
+	case RoundCeil:
+		away = !neg
+	case RoundHalfUp, RoundHalfEven:
+		half := new(big.Int).Abs(r)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(new(big.Int).Abs(den))
+		away = cmp > 0 || cmp == 0 && (mode == RoundHalfUp || q.Bit(0) == 1)
+	}
+
+	if !away {
+		return q
+	}
+
+	if neg {
+		return q.Sub(q, big.NewInt(1))
+	}
+
+	return q.Add(q, big.NewInt(1))
+}
+
+// decimalOperand converts the other operand of the binary operator. Only
+// integer numbers are mixed with decimals to not bring in float errors.
+func decimalOperand(op string, other Iface) (*Decimal, error) {
+	switch other := other.(type) {
+	case *Decimal:
+		return other, nil
+	case *Num:
+		if other.IsInf() || !other.IsInt() {
+			return nil, fmt.Errorf("op '%s': decimal can be mixed only with integer numbers, got %s", op, other)
+		}
+
+		r, _ := other.AsRat()
+		return &Decimal{v: new(big.Int).Set(r.Num())}, nil
+	}
+
+	return nil, ErrUnsupportedOp
+}
+
+// BinaryOp implements arithmetic and comparison of decimals. Division needs
+// the explicit scale and rounding, so / and % are not supported.
+func (v *Decimal) BinaryOp(op string, other Iface, reversed bool) (Iface, error) {
+	d, err := decimalOperand(op, other)
+	if err != nil {
+		return nil, err
+	}
+
+	x, y := v, d
+	if reversed {
+		x, y = d, v
+	}
+
+	switch op {
+	case "+":
+		return x.Add(y), nil
+	case "-":
+		return x.Sub(y), nil
+	case "*":
+		return x.Mul(y), nil
+	case "/", "%":
+		return nil, fmt.Errorf("op '%s': decimals are divided with the explicit scale and rounding, see decimal.div", op)
+	case "==":
+		return NewBool(x.Cmp(y) == 0), nil
+	case "!=":
+		return NewBool(x.Cmp(y) != 0), nil
+	case "<":
+		return NewBool(x.Cmp(y) < 0), nil
+	case "<=":
+		return NewBool(x.Cmp(y) <= 0), nil
+	case ">":
+		return NewBool(x.Cmp(y) > 0), nil
+	case ">=":
+		return NewBool(x.Cmp(y) >= 0), nil
+	}
+
+	return nil, ErrUnsupportedOp
+}
+
+// Equal reports whether the decimal has the same value as the other decimal
+// or integer number regardless of scales, e.g. 1.50 == 1.5.
+func (v *Decimal) Equal(other Iface) bool {
+	d, err := decimalOperand("==", other)
+	return err == nil && v.Cmp(d) == 0
+}
+
+// normalized returns the decimal without trailing zeros of the fraction.
+func (v *Decimal) normalized() *Decimal {
+	d := &Decimal{v: new(big.Int).Set(v.v), scale: v.scale}
+	ten, r := big.NewInt(10), new(big.Int)
+	for d.scale > 0 {
+		q, _ := new(big.Int).QuoRem(d.v, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+
+		d.v, d.scale = q, d.scale-1
+	}
+
+	return d
+}
+
+func (v *Decimal) MemReader() io.Reader {
+	return newMemReader(v)
+}
+
+func (v *Decimal) Type() Type {
+	return TypeDecimal
+}
+
+func (v *Decimal) String() string {
+	s := new(big.Int).Abs(v.v).String()
+	if v.scale > 0 {
+		if len(s) <= v.scale {
+			s = strings.Repeat("0", v.scale-len(s)+1) + s
+		}
+
+		s = s[:len(s)-v.scale] + "." + s[len(s)-v.scale:]
+	}
+
+	if v.v.Sign() < 0 {
+		return "-" + s
+	}
+
+	return s
+}
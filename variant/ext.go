@@ -0,0 +1,79 @@
+package variant
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnsupportedOp is returned by BinaryOperator when the operation is not
+// defined for the operands, so the default behavior is used.
+var ErrUnsupportedOp = errors.New("unsupported operation")
+
+// Indexer is implemented by host variants supporting v[key] and v.key.
+type Indexer interface {
+	Index(key Iface) (Iface, error)
+}
+
+// IndexSetter is implemented by host variants supporting v[key] = x and
+// v.key = x.
+type IndexSetter interface {
+	SetIndex(key, v Iface) error
+}
+
+// Caller is implemented by host variants which can be called as functions.
+type Caller interface {
+	Call(args Args) (Iface, error)
+}
+
+// Iterator produces elements of Iterable. Next returns false when there
+// are no more elements.
+type Iterator interface {
+	Next() (v Iface, ok bool, err error)
+}
+
+// Iterable is implemented by host variants usable in for loops.
+type Iterable interface {
+	Iter() Iterator
+}
+
+// Equaler is implemented by host variants with custom equality.
+type Equaler interface {
+	Equal(other Iface) bool
+}
+
+// BinaryOperator is implemented by host variants supporting binary operators.
+// The variant is the left operand, or the right one if reversed is true.
+type BinaryOperator interface {
+	BinaryOp(op string, other Iface, reversed bool) (Iface, error)
+}
+
+var extTypes struct {
+	sync.RWMutex
+	names []string
+}
+
+// RegisterType registers the host variant type by name and returns its
+// identifier to be returned by Type() of the host variant.
+func RegisterType(name string) Type {
+	extTypes.Lock()
+	defer extTypes.Unlock()
+
+	if int(TypeEnd)+len(extTypes.names) > 255 {
+		panic("register type: too many types")
+	}
+
+	extTypes.names = append(extTypes.names, name)
+	return TypeEnd + Type(len(extTypes.names)-1)
+}
+
+func extTypeName(typ Type) string {
+	extTypes.RLock()
+	defer extTypes.RUnlock()
+
+	i := int(typ - TypeEnd)
+	if i >= len(extTypes.names) {
+		return "unknown"
+	}
+
+	return extTypes.names[i]
+}
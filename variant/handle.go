@@ -0,0 +1,54 @@
+package variant
+
+import (
+	"io"
+	"runtime"
+)
+
+// Handle is an opaque host value. Scripts can pass handles around and give
+// them back to host functions but cannot look inside.
+type Handle struct {
+	v any
+}
+
+// Value returns the wrapped host value.
+func (v *Handle) Value() any {
+	return v.v
+}
+
+// WithFinalizer sets fn to be called with the wrapped value once the handle
+// becomes unreachable, e.g. to close a connection leaked by a script.
+func (v *Handle) WithFinalizer(fn func(v any)) *Handle {
+	runtime.SetFinalizer(v, func(h *Handle) {
+		fn(h.v)
+	})
+	return v
+}
+
+func (v *Handle) MemReader() io.Reader {
+	return memReaderErr{err: errHandleNoMemory}
+}
+
+func (v *Handle) Type() Type {
+	return TypeHandle
+}
+
+func (v *Handle) String() string {
+	return "handle"
+}
+
+func NewHandle(v any) *Handle {
+	return &Handle{v: v}
+}
+
+// HandleValue returns the value of type T wrapped by the handle.
+func HandleValue[T any](v Iface) (T, bool) {
+	h, ok := v.(*Handle)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	val, ok := h.v.(T)
+	return val, ok
+}
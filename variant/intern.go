@@ -0,0 +1,32 @@
+package variant
+
+import "math/big"
+
+// Range of integers that are preallocated and shared between all callers
+// of Int and UInt.
+const (
+	internIntMin = -128
+	internIntMax = 256
+)
+
+var (
+	internNone        = &None{}
+	internTrue        = &Bool{v: true}
+	internFalse       = &Bool{v: false}
+	internEmptyString = &String{}
+	internInts        [internIntMax - internIntMin + 1]*Num
+)
+
+func init() {
+	for i := range internInts {
+		internInts[i] = &Num{v: new(big.Float).SetInt64(int64(i + internIntMin))}
+	}
+}
+
+func internedInt(v int64) (*Num, bool) {
+	if v < internIntMin || v > internIntMax {
+		return nil, false
+	}
+
+	return internInts[v-internIntMin], true
+}
@@ -0,0 +1,108 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutError is returned by Func.CallTimeout when the call runs past its
+// deadline.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("call timed out after %s", e.Timeout)
+}
+
+// Interrupt stops script code running past the deadline or after its
+// context is done. Script functions check it on every loop iteration and
+// call, the number of checks is counted as steps.
+type Interrupt struct {
+	deadline atomic.Int64 // unix nanoseconds, zero means no deadline
+	timeout  atomic.Int64
+	ctx      atomic.Pointer[context.Context]
+	steps    atomic.Int64
+}
+
+// Check returns *TimeoutError if the deadline is exceeded, or the error of
+// the done context.
+func (i *Interrupt) Check() error {
+	if i == nil {
+		return nil
+	}
+
+	i.steps.Add(1)
+	if ctx := i.ctx.Load(); ctx != nil {
+		select {
+		case <-(*ctx).Done():
+			return (*ctx).Err()
+		default:
+		}
+	}
+
+	deadline := i.deadline.Load()
+	if deadline == 0 || time.Now().UnixNano() < deadline {
+		return nil
+	}
+
+	return &TimeoutError{Timeout: time.Duration(i.timeout.Load())}
+}
+
+// SetContext makes Check fail once the context is done, nil removes it.
+func (i *Interrupt) SetContext(ctx context.Context) {
+	if ctx == nil || ctx.Done() == nil {
+		i.ctx.Store(nil)
+		return
+	}
+
+	i.ctx.Store(&ctx)
+}
+
+// Context returns the context set by SetContext or the background one, so
+// hosts stop their operations together with the script, e.g. commands.
+func (i *Interrupt) Context() context.Context {
+	if i != nil {
+		if ctx := i.ctx.Load(); ctx != nil {
+			return *ctx
+		}
+	}
+
+	return context.Background()
+}
+
+// Done returns the channel closed once Check fails because of the context
+// or the deadline, so blocking waits of the script are stopped too. stop
+// releases the channel when the wait ends. Without both the channel is nil.
+func (i *Interrupt) Done() (done <-chan struct{}, stop func()) {
+	ctx := i.Context()
+	if i == nil || i.deadline.Load() == 0 {
+		return ctx.Done(), func() {}
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, time.Unix(0, i.deadline.Load()))
+	return ctx.Done(), cancel
+}
+
+// Steps returns the number of checks.
+func (i *Interrupt) Steps() int64 {
+	return i.steps.Load()
+}
+
+// limit sets the deadline unless the earlier one is already set and returns
+// the function restoring the previous deadline.
+func (i *Interrupt) limit(timeout time.Duration) (restore func()) {
+	prevDeadline, prevTimeout := i.deadline.Load(), i.timeout.Load()
+	deadline := time.Now().Add(timeout).UnixNano()
+	if prevDeadline == 0 || deadline < prevDeadline {
+		i.deadline.Store(deadline)
+		i.timeout.Store(int64(timeout))
+	}
+
+	return func() {
+		i.deadline.Store(prevDeadline)
+		i.timeout.Store(prevTimeout)
+	}
+}
@@ -1,63 +1,163 @@
 package variant
 
 import (
+	"bytes"
 	"errors"
 	"io"
-	"unsafe"
+	"math/big"
+	"sort"
+	"sync"
 )
 
 var (
-	_ io.Reader = &readerWithType{}
-	_ io.Reader = memReaderBool{}
-	_ io.Reader = memReaderFunc{}
+	_ io.Reader = memReaderErr{}
 )
 
-type readerWithType struct {
-	readed bool
-	Type   Type
-	Parent io.Reader
+var (
+	errFuncNoMemory    = errors.New("function has no memory")
+	errHandleNoMemory  = errors.New("handle has no memory")
+	errPromiseNoMemory = errors.New("promise has no memory")
+)
+
+var memBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 64)
+		return &buf
+	},
 }
 
-func (r *readerWithType) Read(p []byte) (n int, err error) {
-	if len(p) == 0 {
-		return
-	}
+// AppendMem appends the memory representation of v to dst. Values with equal
+// memory representation are considered the same object key.
+func AppendMem(dst []byte, v Iface) ([]byte, error) {
+	switch v := v.(type) {
+	case *None:
+		return append(dst, byte(TypeNone)), nil
+	case *Bool:
+		dst = append(dst, byte(TypeBool))
+		if v.v {
+			return append(dst, 1), nil
+		}
+
+		return append(dst, 0), nil
+	case *Num:
+		return v.appendMem(dst), nil
+	case *String:
+		dst = append(dst, byte(TypeString))
+		return append(dst, v.v...), nil
+	case *Array:
+		dst = append(dst, byte(TypeArray))
+		if v.bmode {
+			for _, b := range v.bs {
+				dst = UInt(b).appendMem(dst)
+			}
+
+			return dst, nil
+		}
+
+		var err error
+		for _, el := range v.v {
+			dst, err = AppendMem(dst, el)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return dst, nil
+	case *Object:
+		v = v.plain()
+		dst = append(dst, byte(TypeObject))
+
+		keys := make([]string, 0, v.size())
+		v.each(func(mem string, _, _ Iface) bool {
+			keys = append(keys, mem)
+			return true
+		})
+		sort.Strings(keys)
+
+		var err error
+		for _, k := range keys {
+			val, _ := v.lookup(k)
+			dst = append(dst, k...)
+			dst, err = AppendMem(dst, val)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	if !r.readed {
-		p[0] = byte(r.Type)
-		r.readed = true
-		p = p[1:]
-		n++
+		return dst, nil
+	case *Decimal:
+		// decimals equal to integers are the same keys as numbers
+		v = v.normalized()
+		if v.scale == 0 {
+			return NewNum(new(big.Float).SetInt(v.v)).appendMem(dst), nil
+		}
+
+		dst = append(dst, byte(TypeDecimal))
+		return append(dst, v.String()...), nil
+	case *Func:
+		return nil, errFuncNoMemory
+	case *Handle:
+		return nil, errHandleNoMemory
+	case *Promise:
+		return nil, errPromiseNoMemory
 	}
 
-	if r.Parent == nil {
-		return n, io.EOF
+	b, err := io.ReadAll(v.MemReader())
+	if err != nil {
+		return nil, err
 	}
 
-	nn, err := r.Parent.Read(p)
-	return n + nn, err
+	return append(dst, b...), nil
 }
 
-type memReaderBool struct {
-	v bool
+func (v *Num) appendMem(dst []byte) []byte {
+	dst = append(dst, byte(TypeNum))
+	if v.nan {
+		return append(dst, "nan"...)
+	}
+
+	if v.r != nil {
+		// exact integers are the same keys as float ones
+		if v.r.IsInt() {
+			f := new(big.Float).SetInt(v.r.Num())
+			return f.Append(dst, 'g', int(f.Prec()))
+		}
+
+		return append(dst, v.r.String()...)
+	}
+
+	return v.v.Append(dst, 'g', int(v.v.Prec()))
 }
 
-// Read implements io.Reader.
-func (m memReaderBool) Read(p []byte) (n int, err error) {
-	if len(p) == 0 {
-		return
+// withMem calls fn with the memory representation of v. The slice passed to
+// fn is only valid until fn returns.
+func withMem(v Iface, fn func(mem []byte)) error {
+	buf := memBufPool.Get().(*[]byte)
+	defer memBufPool.Put(buf)
+
+	mem, err := AppendMem((*buf)[:0], v)
+	if err != nil {
+		return err
 	}
 
-	boolread(&p[0], &m.v)
-	return n, io.EOF
+	*buf = mem
+	fn(mem)
+	return nil
 }
 
-func boolread(dst *byte, src *bool) {
-	*dst = *(*byte)(unsafe.Pointer(src))
+func newMemReader(v Iface) io.Reader {
+	mem, err := AppendMem(nil, v)
+	if err != nil {
+		return memReaderErr{err: err}
+	}
+
+	return bytes.NewReader(mem)
 }
 
-type memReaderFunc struct{}
+type memReaderErr struct {
+	err error
+}
 
-func (m memReaderFunc) Read(p []byte) (n int, err error) {
-	return 0, errors.New("function has no memory")
+func (m memReaderErr) Read(p []byte) (n int, err error) {
+	return 0, m.err
 }
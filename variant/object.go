@@ -0,0 +1,112 @@
+package variant
+
+import (
+	"slices"
+	"strings"
+)
+
+// smallObjectMax is the number of entries kept in the sorted slice of the
+// object before it switches to maps.
+const smallObjectMax = 8
+
+// objectEntry is the entry of the small object, mem is the memory
+// representation of the key.
+type objectEntry struct {
+	mem string
+	key Iface
+	val Iface
+}
+
+func newObject(size int) *Object {
+	if size <= smallObjectMax {
+		return &Object{small: make([]objectEntry, 0, size)}
+	}
+
+	return &Object{v: make(map[string]Iface, size), keys: make(map[string]Iface, size)}
+}
+
+func (v *Object) size() int {
+	if v.v != nil {
+		return len(v.v)
+	}
+
+	return len(v.small)
+}
+
+func (v *Object) search(mem string) (int, bool) {
+	return slices.BinarySearchFunc(v.small, mem, func(e objectEntry, mem string) int {
+		return strings.Compare(e.mem, mem)
+	})
+}
+
+func (v *Object) lookup(mem string) (Iface, bool) {
+	if v.v != nil {
+		val, ok := v.v[mem]
+		return val, ok
+	}
+
+	if i, ok := v.search(mem); ok {
+		return v.small[i].val, true
+	}
+
+	return nil, false
+}
+
+func (v *Object) store(mem string, key, val Iface) {
+	if v.v != nil {
+		v.v[mem] = val
+		v.keys[mem] = key
+		return
+	}
+
+	i, ok := v.search(mem)
+	if ok {
+		v.small[i].key, v.small[i].val = key, val
+		return
+	}
+
+	if len(v.small) < smallObjectMax {
+		v.small = slices.Insert(v.small, i, objectEntry{mem: mem, key: key, val: val})
+		return
+	}
+
+	v.v = make(map[string]Iface, len(v.small)+1)
+	v.keys = make(map[string]Iface, len(v.small)+1)
+	for _, e := range v.small {
+		v.v[e.mem], v.keys[e.mem] = e.val, e.key
+	}
+
+	v.v[mem], v.keys[mem] = val, key
+	v.small = nil
+}
+
+// each calls fn for entries until it returns false. Small objects are
+// iterated in the order of keys memory.
+func (v *Object) each(fn func(mem string, key, val Iface) bool) {
+	if v.v == nil {
+		for _, e := range v.small {
+			if !fn(e.mem, e.key, e.val) {
+				return
+			}
+		}
+
+		return
+	}
+
+	for mem, val := range v.v {
+		if !fn(mem, v.keys[mem], val) {
+			return
+		}
+	}
+}
+
+// clone returns the object with the same keys and values mapped by fn.
+func (v *Object) clone(fn func(Iface) Iface) *Object {
+	obj := newObject(v.size())
+	v.each(func(mem string, key, val Iface) bool {
+		obj.store(mem, key, fn(val))
+		return true
+	})
+
+	return obj
+}
@@ -0,0 +1,31 @@
+package variant
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned instead of the panic raised while running the
+// function, so a broken script or host function never crashes the host.
+type PanicError struct {
+	Value any
+	// Stack is the Go stack of the goroutine at the moment of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recover stores the panic as *PanicError to err. It must be deferred.
+func Recover(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
@@ -0,0 +1,101 @@
+package variant
+
+import (
+	"io"
+	"sync"
+)
+
+// Promise is the result of an async operation which may not be ready yet.
+// It is settled once, with a value or an error, and is safe for concurrent
+// use, so host goroutines can settle promises awaited by scripts.
+type Promise struct {
+	mu   sync.Mutex
+	done chan struct{}
+	v    Iface
+	err  error
+}
+
+// Resolve settles the promise with the value. It reports false if the
+// promise is already settled.
+func (v *Promise) Resolve(val Iface) bool {
+	return v.settle(val, nil)
+}
+
+// Reject settles the promise with the error. It reports false if the promise
+// is already settled.
+func (v *Promise) Reject(err error) bool {
+	return v.settle(nil, err)
+}
+
+func (v *Promise) settle(val Iface, err error) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	select {
+	case <-v.done:
+		return false
+	default:
+	}
+
+	v.v, v.err = val, err
+	close(v.done)
+	return true
+}
+
+// Done returns the channel closed once the promise is settled.
+func (v *Promise) Done() <-chan struct{} {
+	return v.done
+}
+
+// Settled reports whether the promise is resolved or rejected.
+func (v *Promise) Settled() bool {
+	select {
+	case <-v.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the promise is settled and returns its result.
+func (v *Promise) Wait() (Iface, error) {
+	<-v.done
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v, v.err
+}
+
+func (v *Promise) MemReader() io.Reader {
+	return memReaderErr{err: errPromiseNoMemory}
+}
+
+func (v *Promise) Type() Type {
+	return TypePromise
+}
+
+func (v *Promise) String() string {
+	return "promise"
+}
+
+func NewPromise() *Promise {
+	return &Promise{done: make(chan struct{})}
+}
+
+// Go runs fn in a new goroutine and returns the promise settled with its
+// result. Host functions use it to run blocking operations, e.g. network
+// requests, while scripts keep running.
+func Go(fn func() (Iface, error)) *Promise {
+	p := NewPromise()
+	go func() {
+		v, err := fn()
+		if err != nil {
+			p.Reject(err)
+			return
+		}
+
+		p.Resolve(v)
+	}()
+
+	return p
+}
@@ -0,0 +1,80 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Key is the object key with the memory representation computed once, e.g.
+// the constant selector of the script.
+type Key struct {
+	v   Iface
+	mem string
+}
+
+func NewKey(v Iface) (Key, error) {
+	mem, err := AppendMem(nil, v)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s is not hashable", v.Type())
+	}
+
+	return Key{v: v, mem: string(mem)}, nil
+}
+
+// Value returns the key variant.
+func (k Key) Value() Iface {
+	return k.v
+}
+
+// GetKey is Get by the precomputed key.
+func (v *Object) GetKey(k Key) (Iface, error) {
+	if v.host != nil {
+		return v.host.get(k.v)
+	}
+
+	val, ok := v.lookup(k.mem)
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+
+	return val, nil
+}
+
+// PropCache is the inline cache of the property access site, e.g. obj.field
+// of the script. It remembers the last object and the value of the key, so
+// reading the unchanged object again skips the lookup. It is not safe for
+// concurrent use, every copy of the compiled code has its own caches.
+type PropCache struct {
+	key Key
+	obj *Object
+	gen uint64
+	val Iface
+}
+
+func NewPropCache(k Key) *PropCache {
+	return &PropCache{key: k}
+}
+
+// Key returns the key of the site.
+func (c *PropCache) Key() Key {
+	return c.key
+}
+
+// Get returns the value of the key of the object.
+func (c *PropCache) Get(obj *Object) (Iface, error) {
+	if obj == c.obj && obj.gen == c.gen {
+		return c.val, nil
+	}
+
+	val, err := obj.GetKey(c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	// host objects are changed by the host without notice
+	if obj.host == nil {
+		c.obj, c.gen, c.val = obj, obj.gen, val
+	}
+
+	return val, nil
+}
@@ -0,0 +1,309 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ifaceType = reflect.TypeOf((*Iface)(nil)).Elem()
+
+// errSnapshot is returned by changes of arrays and objects converted from
+// slices and maps of the host. They are copies, so changes would be lost.
+var errSnapshot = errors.New("read-only snapshot of host data, use copy() to change it")
+
+// structFields caches exported fields of struct types by their object key.
+var structFields sync.Map // map[reflect.Type]*fieldSet
+
+type fieldSet struct {
+	names []string
+	index map[string]int
+}
+
+func fieldsOf(typ reflect.Type) *fieldSet {
+	if fs, ok := structFields.Load(typ); ok {
+		return fs.(*fieldSet)
+	}
+
+	fs := &fieldSet{index: map[string]int{}}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("easylang"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		if _, ok := fs.index[name]; ok {
+			continue
+		}
+
+		fs.names = append(fs.names, name)
+		fs.index[name] = i
+	}
+
+	structFields.Store(typ, fs)
+	return fs
+}
+
+// structBinding exposes fields of the Go struct as object entries. Values are
+// converted on access, so the struct is never copied.
+type structBinding struct {
+	v        reflect.Value
+	writable bool
+	*fieldSet
+}
+
+func (b *structBinding) field(key Iface) (reflect.Value, error) {
+	if key.Type() != TypeString {
+		return reflect.Value{}, errors.New("key not found")
+	}
+
+	i, ok := b.index[key.String()]
+	if !ok {
+		return reflect.Value{}, errors.New("key not found")
+	}
+
+	return b.v.Field(i), nil
+}
+
+func (b *structBinding) get(key Iface) (Iface, error) {
+	field, err := b.field(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromReflect(field, b.writable)
+}
+
+func (b *structBinding) set(key, val Iface) error {
+	if !b.writable {
+		return errors.New("object is read-only")
+	}
+
+	field, err := b.field(key)
+	if err != nil {
+		return err
+	}
+
+	if err := assignReflect(field, val); err != nil {
+		return fmt.Errorf("cannot set '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+// plain returns the object itself or, for objects bound to host data, the
+// snapshot of its entries. Fields which cannot be converted are omitted.
+func (v *Object) plain() *Object {
+	if v.host == nil {
+		return v
+	}
+
+	keys := make([]Iface, 0, len(v.host.names))
+	vals := make([]Iface, 0, len(v.host.names))
+	for _, name := range v.host.names {
+		key := NewString(name)
+		val, err := v.host.get(key)
+		if err != nil {
+			continue
+		}
+
+		keys = append(keys, key)
+		vals = append(vals, val)
+	}
+
+	return MustNewObject(keys, vals)
+}
+
+func fromReflect(rv reflect.Value, writable bool) (Iface, error) {
+	if rv.Type().Implements(ifaceType) {
+		if rv.IsNil() {
+			return NewNone(), nil
+		}
+
+		return rv.Interface().(Iface), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return NewBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNum(new(big.Float).SetInt64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewNum(new(big.Float).SetUint64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) {
+			return nil, errors.New("NaN is not supported")
+		}
+
+		return Float(f), nil
+	case reflect.String:
+		return NewString(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			arr := Bytes(append([]byte(nil), rv.Bytes()...))
+			arr.readonly = true
+			return arr, nil
+		}
+
+		elems := make([]Iface, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			el, err := fromReflect(rv.Index(i), writable)
+			if err != nil {
+				return nil, fmt.Errorf("element at %d position: %w", i, err)
+			}
+
+			elems = append(elems, el)
+		}
+
+		arr := NewArray(elems)
+		arr.readonly = true
+		return arr, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+
+		keys := make([]Iface, 0, rv.Len())
+		vals := make([]Iface, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			val, err := fromReflect(iter.Value(), false)
+			if err != nil {
+				return nil, fmt.Errorf("value by key '%s': %w", iter.Key(), err)
+			}
+
+			keys = append(keys, NewString(iter.Key().String()))
+			vals = append(vals, val)
+		}
+
+		obj, err := NewObject(keys, vals)
+		if err != nil {
+			return nil, err
+		}
+
+		obj.readonly = true
+		return obj, nil
+	case reflect.Struct:
+		return &Object{host: &structBinding{
+			v:        rv,
+			writable: writable && rv.CanSet(),
+			fieldSet: fieldsOf(rv.Type()),
+		}}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return NewNone(), nil
+		}
+
+		return fromReflect(rv.Elem(), writable)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", rv.Type())
+}
+
+func assignReflect(dst reflect.Value, val Iface) error {
+	typ := dst.Type()
+	if reflect.TypeOf(val).AssignableTo(typ) {
+		dst.Set(reflect.ValueOf(val))
+		return nil
+	}
+
+	mismatch := fmt.Errorf("cannot assign %s to %s", val.Type(), typ)
+	switch typ.Kind() {
+	case reflect.Bool:
+		b, ok := val.(*Bool)
+		if !ok {
+			return mismatch
+		}
+
+		dst.SetBool(b.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, ok := val.(*Num)
+		if !ok {
+			return mismatch
+		}
+
+		n, err := num.AsInt64()
+		if err != nil || dst.OverflowInt(n) {
+			return fmt.Errorf("%s does not fit into %s", num, typ)
+		}
+
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		num, ok := val.(*Num)
+		if !ok {
+			return mismatch
+		}
+
+		n, err := num.AsUInt64()
+		if err != nil || dst.OverflowUint(n) {
+			return fmt.Errorf("%s does not fit into %s", num, typ)
+		}
+
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		num, ok := val.(*Num)
+		if !ok {
+			return mismatch
+		}
+
+		f, _ := num.Value().Float64()
+		dst.SetFloat(f)
+	case reflect.String:
+		s, ok := val.(*String)
+		if !ok {
+			return mismatch
+		}
+
+		dst.SetString(s.String())
+	default:
+		return mismatch
+	}
+
+	return nil
+}
+
+// StructObject exposes the Go struct as an object without copying it. Keys
+// are field names or names from `easylang:"name"` tags, fields tagged with
+// "-" and unexported fields are skipped. Nested structs are exposed the same
+// way, while slices and maps are converted on every access to read-only
+// snapshots: changing their elements fails, copy() of them is writable.
+// Structs in slices stay bound to the elements. The object is writable with
+// Set when v is a pointer to the struct, otherwise it is read-only.
+func StructObject(v any) (*Object, error) {
+	rv := reflect.ValueOf(v)
+	writable := false
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, errors.New("struct object: nil pointer")
+		}
+
+		rv, writable = rv.Elem(), true
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struct object: expected struct, got %s", rv.Type())
+	}
+
+	return &Object{host: &structBinding{
+		v:        rv,
+		writable: writable,
+		fieldSet: fieldsOf(rv.Type()),
+	}}, nil
+}
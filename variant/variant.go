@@ -2,12 +2,17 @@ package variant
 
 import (
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ALTree/bigfloat"
 )
@@ -15,10 +20,14 @@ import (
 type Type uint8
 
 var typNames = [TypeEnd]string{
-	"null", "bool", "number", "string", "array", "object", "func",
+	"none", "bool", "number", "string", "array", "object", "func", "handle", "promise", "decimal",
 }
 
 func (typ Type) String() string {
+	if typ >= TypeEnd {
+		return extTypeName(typ)
+	}
+
 	return typNames[typ]
 }
 
@@ -30,6 +39,9 @@ const (
 	TypeArray
 	TypeObject
 	TypeFunc
+	TypeHandle
+	TypePromise
+	TypeDecimal
 
 	TypeEnd
 )
@@ -42,6 +54,9 @@ var (
 	_ Iface = &Array{}
 	_ Iface = &Object{}
 	_ Iface = &Func{}
+	_ Iface = &Handle{}
+	_ Iface = &Promise{}
+	_ Iface = &Decimal{}
 )
 
 type Iface interface {
@@ -62,7 +77,7 @@ func MustCast[T Iface](v Iface) T {
 type None struct{}
 
 func (v *None) MemReader() io.Reader {
-	return &readerWithType{Type: TypeNone}
+	return newMemReader(v)
 }
 
 func (v *None) Type() Type {
@@ -82,10 +97,7 @@ func (v *Bool) Bool() bool {
 }
 
 func (v *Bool) MemReader() io.Reader {
-	return &readerWithType{
-		Type:   TypeBool,
-		Parent: memReaderBool{v: v.v},
-	}
+	return newMemReader(v)
 }
 
 func (v *Bool) Type() Type {
@@ -100,73 +112,235 @@ func (v *Bool) String() string {
 	return "false"
 }
 
+// Num is the number. Numbers created by NewRat are exact: arithmetic on
+// them is done with fractions and v only keeps the float approximation.
+// NaN is not a value of big.Float, so it is marked by nan and v is zero.
 type Num struct {
-	v *big.Float
+	v   *big.Float
+	r   *big.Rat
+	nan bool
 }
 
+// Value returns the number as float. Exact numbers are approximated, NaN is
+// returned as zero, see IsNaN.
 func (v *Num) Value() *big.Float {
 	return v.v
 }
 
+// IsNaN reports whether the number is NaN, the result of invalid operations
+// like 0 / 0 under the nan numeric policy.
+func (v *Num) IsNaN() bool {
+	return v.nan
+}
+
+// Rat returns the fraction of the exact number.
+func (v *Num) Rat() (*big.Rat, bool) {
+	return v.r, v.r != nil
+}
+
+// IsExact reports whether the number is created by NewRat.
+func (v *Num) IsExact() bool {
+	return v.r != nil
+}
+
+// AsRat returns the number as fraction, floats are converted exactly. It
+// reports false for infinities and NaN.
+func (v *Num) AsRat() (*big.Rat, bool) {
+	if v.r != nil {
+		return v.r, true
+	}
+
+	if v.nan || v.v.IsInf() {
+		return nil, false
+	}
+
+	r, _ := v.v.Rat(nil)
+	return r, true
+}
+
+// exactPair returns fractions of both numbers if at least one of them is
+// exact and both are finite.
+func exactPair(x, y *Num) (*big.Rat, *big.Rat, bool) {
+	if x.r == nil && y.r == nil {
+		return nil, nil, false
+	}
+
+	xr, ok := x.AsRat()
+	if !ok {
+		return nil, nil, false
+	}
+
+	yr, ok := y.AsRat()
+	if !ok {
+		return nil, nil, false
+	}
+
+	return xr, yr, true
+}
+
 func (v *Num) Copy() *Num {
+	if v.nan {
+		return NaN()
+	}
+
+	if v.r != nil {
+		return NewRat(new(big.Rat).Set(v.r))
+	}
+
 	return NewNum(new(big.Float).Set(v.v))
 }
 
 func (v *Num) Pow(exp *Num) *Num {
+	if v.nan || exp.nan {
+		return NaN()
+	}
+
 	return NewNum(bigfloat.Pow(v.v, exp.v))
 }
 
+// Add adds other to v in place. It must not be called on numbers returned by
+// Int or UInt, because small integers are interned and shared.
 func (v *Num) Add(other *Num) {
+	if other.nan {
+		v.nan, v.r = true, nil
+		v.v.SetInt64(0)
+		return
+	}
+
+	if v.r != nil {
+		if r, ok := other.AsRat(); ok {
+			v.r.Add(v.r, r)
+			v.v.SetRat(v.r)
+			return
+		}
+
+		v.r = nil
+	}
+
 	v.v.Add(v.v, other.v)
 }
 
 func (v *Num) Neg() *Num {
+	if v.nan {
+		return v
+	}
+
+	if v.r != nil {
+		return NewRat(new(big.Rat).Neg(v.r))
+	}
+
 	return NewNum(new(big.Float).Neg(v.v))
 }
 
 func (v *Num) IsZero() bool {
+	if v.nan {
+		return false
+	}
+
+	if v.r != nil {
+		return v.r.Sign() == 0
+	}
+
 	n, acc := v.v.Int64()
 	return n == 0 && acc == big.Exact
 }
 
+// IsInt reports whether the number is integer.
+func (v *Num) IsInt() bool {
+	if v.nan {
+		return false
+	}
+
+	if v.r != nil {
+		return v.r.IsInt()
+	}
+
+	return v.v.IsInt()
+}
+
 func (v *Num) IsInf() bool {
 	return v.v.IsInf()
 }
 
 func (v *Num) Sign() int {
+	if v.r != nil {
+		return v.r.Sign()
+	}
+
 	return v.v.Sign()
 }
 
+// Cmp compares numbers like big.Float.Cmp. Exact numbers are compared
+// without rounding. NaN is unordered, so comparison predicates are false for
+// it, and Cmp must not be called with it.
+func (v *Num) Cmp(other *Num) int {
+	if x, y, ok := exactPair(v, other); ok {
+		return x.Cmp(y)
+	}
+
+	return v.v.Cmp(other.v)
+}
+
+func (v *Num) unordered(other *Num) bool {
+	return v.nan || other.nan
+}
+
 func (v *Num) LessThan(than *Num) bool {
-	return v.v.Cmp(than.v) == -1
+	return !v.unordered(than) && v.Cmp(than) == -1
 }
 
 func (v *Num) LessOrEqualTo(to *Num) bool {
-	return v.v.Cmp(to.v) <= 0
+	return !v.unordered(to) && v.Cmp(to) <= 0
 }
 
 func (v *Num) GreaterThan(than *Num) bool {
-	return v.v.Cmp(than.v) == 1
+	return !v.unordered(than) && v.Cmp(than) == 1
 }
 
 func (v *Num) GreaterOrEqualTo(to *Num) bool {
-	return v.v.Cmp(to.v) >= 0
+	return !v.unordered(to) && v.Cmp(to) >= 0
 }
 
 func (v *Num) EqualTo(to *Num) bool {
-	return v.v.Cmp(to.v) == 0
+	return !v.unordered(to) && v.Cmp(to) == 0
 }
 
 func (v *Num) Abs() *Num {
+	if v.nan {
+		return v
+	}
+
+	if v.r != nil {
+		return NewRat(new(big.Rat).Abs(v.r))
+	}
+
 	return NewNum(new(big.Float).Abs(v.v))
 }
 
+// integer returns the float holding the integer value of the number.
+func (v *Num) integer() (*big.Float, bool) {
+	if v.nan {
+		return nil, false
+	}
+
+	if v.r != nil {
+		if !v.r.IsInt() {
+			return nil, false
+		}
+
+		return new(big.Float).SetInt(v.r.Num()), true
+	}
+
+	return v.v, v.v.IsInt()
+}
+
 func (v *Num) AsUInt64() (uint64, error) {
-	if !v.v.IsInt() {
+	f, ok := v.integer()
+	if !ok {
 		return 0, errors.New("number is not integer")
 	}
 
-	num, acc := v.v.Uint64()
+	num, acc := f.Uint64()
 	if acc == big.Above {
 		return 0, errors.New("number is negative")
 	}
@@ -179,11 +353,12 @@ func (v *Num) AsUInt64() (uint64, error) {
 }
 
 func (v *Num) AsInt64() (int64, error) {
-	if !v.v.IsInt() {
+	f, ok := v.integer()
+	if !ok {
 		return 0, errors.New("number is not integer")
 	}
 
-	num, acc := v.v.Int64()
+	num, acc := f.Int64()
 	if acc == big.Above && num == math.MinInt64 {
 		return 0, errors.New("number less than -2^63 (min int64)")
 	}
@@ -196,13 +371,7 @@ func (v *Num) AsInt64() (int64, error) {
 }
 
 func (v *Num) MemReader() io.Reader {
-	prec := v.v.Prec()
-	cap := 10 + prec
-	repr := v.v.Append(make([]byte, 0, cap), 'g', int(prec))
-	return &readerWithType{
-		Type:   TypeNum,
-		Parent: bytes.NewBuffer(repr),
-	}
+	return newMemReader(v)
 }
 
 func (v *Num) Type() Type {
@@ -210,9 +379,51 @@ func (v *Num) Type() Type {
 }
 
 func (v *Num) String() string {
+	if v.nan {
+		return "nan"
+	}
+
+	if v.r != nil {
+		if s, ok := ratString(v.r); ok {
+			return s
+		}
+	}
+
 	return v.v.String()
 }
 
+// ratString formats the fraction as decimal if it has the finite decimal
+// representation, i.e. its denominator has no prime factors but 2 and 5.
+func ratString(r *big.Rat) (string, bool) {
+	if r.IsInt() {
+		return r.Num().String(), true
+	}
+
+	d := new(big.Int).Set(r.Denom())
+	var twos, fives int
+	for _, f := range []struct {
+		p int64
+		n *int
+	}{{2, &twos}, {5, &fives}} {
+		p, m := big.NewInt(f.p), new(big.Int)
+		for {
+			q, rem := new(big.Int).QuoRem(d, p, m)
+			if rem.Sign() != 0 {
+				break
+			}
+
+			d = q
+			*f.n++
+		}
+	}
+
+	if !d.IsInt64() || d.Int64() != 1 {
+		return "", false
+	}
+
+	return r.FloatString(max(twos, fives)), true
+}
+
 type String struct {
 	v string
 }
@@ -222,10 +433,7 @@ func (v *String) String() string {
 }
 
 func (v *String) MemReader() io.Reader {
-	return &readerWithType{
-		Type:   TypeString,
-		Parent: strings.NewReader(v.v),
-	}
+	return newMemReader(v)
 }
 
 func (v *String) Type() Type {
@@ -236,10 +444,73 @@ func (v *String) AsBytes() *Array {
 	return Bytes([]byte(v.String()))
 }
 
+// Len returns the number of characters (unicode code points) in the string.
+func (v *String) Len() int {
+	return utf8.RuneCountInString(v.v)
+}
+
+// Chars returns the characters of the string.
+func (v *String) Chars() []Iface {
+	chars := make([]Iface, 0, len(v.v))
+	for _, ch := range v.v {
+		chars = append(chars, NewString(string(ch)))
+	}
+
+	return chars
+}
+
+// Get returns the character at the index. Negative index counts from the end.
+func (v *String) Get(idx int64) (*String, error) {
+	norm := idx
+	if idx < 0 {
+		norm = int64(v.Len()) + idx
+	}
+
+	if norm >= 0 {
+		var i int64
+		for _, ch := range v.v {
+			if i == norm {
+				return NewString(string(ch)), nil
+			}
+			i++
+		}
+	}
+
+	return nil, fmt.Errorf("index %d out of range", idx)
+}
+
+// Substr returns characters from start to end (exclusive). Indexes are
+// clamped to the string bounds, negative indexes count from the end.
+func (v *String) Substr(start, end int64) *String {
+	runes := []rune(v.v)
+	norm := func(idx int64) int64 {
+		if idx < 0 {
+			idx += int64(len(runes))
+		}
+
+		return max(0, min(idx, int64(len(runes))))
+	}
+
+	start, end = norm(start), norm(end)
+	if start >= end {
+		return NewString("")
+	}
+
+	return NewString(string(runes[start:end]))
+}
+
+// Array is the generic or byte array. Arrays made by concatenation and
+// slicing share the backing storage and copy it on the first change, see
+// arrayBuf.
 type Array struct {
 	bmode bool
 	v     []Iface
 	bs    []byte
+	// off is the offset of the array in the shared backing.
+	off int
+	buf atomic.Pointer[arrayBuf]
+	// readonly marks snapshots of host data, see StructObject.
+	readonly bool
 }
 
 func (v *Array) Len() int {
@@ -250,32 +521,72 @@ func (v *Array) Len() int {
 }
 
 func (v *Array) Slice() ([]Iface, bool) {
-	return v.v, !v.bmode
+	return slices.Clip(v.v), !v.bmode
+}
+
+// Elems returns the elements of the array. Byte arrays are converted into
+// numbers, generic arrays return the underlying slice.
+func (v *Array) Elems() []Iface {
+	if !v.bmode {
+		return slices.Clip(v.v)
+	}
+
+	elems := make([]Iface, 0, len(v.bs))
+	for _, b := range v.bs {
+		elems = append(elems, UInt(b))
+	}
+
+	return elems
 }
 
+// Concat returns the array of elements of both arrays. It appends in place
+// when v is the tail of its backing with enough room, so building the array
+// by "a = a + [x]" takes amortized constant time.
 func (v *Array) Concat(other *Array) *Array {
 	if v.bmode && other.bmode {
-		bs := make([]byte, 0, len(v.bs)+len(other.bs))
-		return Bytes(append(append(bs, v.bs...), other.bs...))
+		if buf, ok := v.reserve(len(other.bs)); ok {
+			n := copy(v.bs[len(v.bs):cap(v.bs)], other.bs)
+			return v.view(buf, 0, len(v.bs)+n)
+		}
+
+		return Bytes(append(slices.Clip(v.bs), other.bs...))
 	}
 
-	larr := v.v
 	if v.bmode {
-		larr = make([]Iface, 0, len(v.bs))
-		for _, b := range v.bs {
-			larr = append(larr, UInt(b))
+		return NewArray(append(v.Elems(), other.Elems()...))
+	}
+
+	relems := other.Elems()
+	if buf, ok := v.reserve(len(relems)); ok {
+		n := copy(v.v[len(v.v):cap(v.v)], relems)
+		return v.view(buf, 0, len(v.v)+n)
+	}
+
+	return NewArray(append(slices.Clip(v.v), relems...))
+}
+
+// Sub returns elements from start to end (exclusive) sharing the storage of
+// v. Indexes are clamped to the array bounds, negative indexes count from
+// the end.
+func (v *Array) Sub(start, end int64) *Array {
+	norm := func(idx int64) int {
+		if idx < 0 {
+			idx += int64(v.Len())
 		}
+
+		return int(max(0, min(idx, int64(v.Len()))))
 	}
 
-	rarr := other.v
-	if other.bmode {
-		rarr = make([]Iface, 0, len(other.bs))
-		for _, b := range other.bs {
-			rarr = append(rarr, UInt(b))
+	i, j := norm(start), norm(end)
+	if i >= j {
+		if v.bmode {
+			return Bytes([]byte{})
 		}
+
+		return NewArray([]Iface{})
 	}
 
-	return NewArray(append(larr, rarr...))
+	return v.view(v.shared(), i, j)
 }
 
 func (v *Array) Bytes() ([]byte, bool) {
@@ -292,11 +603,11 @@ func (v *Array) GetByte(idx int64) (byte, error) {
 		norm = int64(len(v.bs)) + idx
 	}
 
-	if norm >= int64(len(v.bs)) {
+	if norm < 0 || norm >= int64(len(v.bs)) {
 		return 0, fmt.Errorf("index %d out of range", idx)
 	}
 
-	return v.bs[idx], nil
+	return v.bs[norm], nil
 }
 
 func (v *Array) Get(idx int64) (Iface, error) {
@@ -314,33 +625,116 @@ func (v *Array) Get(idx int64) (Iface, error) {
 		norm = int64(len(v.v)) + idx
 	}
 
-	if norm >= int64(len(v.v)) {
+	if norm < 0 || norm >= int64(len(v.v)) {
 		return nil, fmt.Errorf("index %d out of range", idx)
 	}
 
 	return v.v[norm], nil
 }
 
+// Set replaces the element by index, negative index counts from the end.
+// Elements of byte arrays must be numbers from 0 to 255.
+func (v *Array) Set(idx int64, el Iface) error {
+	if v.readonly {
+		return errSnapshot
+	}
+
+	norm := idx
+	if idx < 0 {
+		norm = int64(v.Len()) + idx
+	}
+
+	if norm < 0 || norm >= int64(v.Len()) {
+		return fmt.Errorf("index %d out of range", idx)
+	}
+
+	if !v.bmode {
+		v.own()
+		v.v[norm] = el
+		return nil
+	}
+
+	b, err := byteOf(el)
+	if err != nil {
+		return err
+	}
+
+	v.own()
+	v.bs[norm] = b
+	return nil
+}
+
+func byteOf(el Iface) (byte, error) {
+	num, ok := el.(*Num)
+	if !ok {
+		return 0, fmt.Errorf("byte array element must be number, got %s", el.Type())
+	}
+
+	b, err := num.AsUInt64()
+	if err != nil || b > 255 {
+		return 0, fmt.Errorf("byte array element must be from 0 to 255, got %s", num)
+	}
+
+	return byte(b), nil
+}
+
 func (v *Array) Append(el ...Iface) {
+	v.own()
 	v.v = append(v.v, el...)
 }
 
-func (v Array) MemReader() io.Reader {
-	r := readerWithType{
-		Type: TypeArray,
+// Push appends elements to the array in place. Elements of byte arrays must
+// be numbers from 0 to 255, otherwise the array is not changed.
+func (v *Array) Push(el ...Iface) error {
+	if v.readonly {
+		return errSnapshot
+	}
+
+	if !v.bmode {
+		v.Append(el...)
+		return nil
+	}
+
+	bs := make([]byte, len(el))
+	for i, e := range el {
+		b, err := byteOf(e)
+		if err != nil {
+			return err
+		}
+
+		bs[i] = b
+	}
+
+	v.own()
+	v.bs = append(v.bs, bs...)
+	return nil
+}
+
+// Pop removes the last element of the array and returns it.
+func (v *Array) Pop() (Iface, error) {
+	if v.readonly {
+		return nil, errSnapshot
 	}
 
-	if len(v.v) == 0 {
-		return &r
+	if v.Len() == 0 {
+		return nil, errors.New("array is empty")
 	}
 
-	rr := make([]io.Reader, 0, len(v.v))
-	for _, v := range v.v {
-		rr = append(rr, v.MemReader())
+	v.own()
+	if v.bmode {
+		b := v.bs[len(v.bs)-1]
+		v.bs = v.bs[:len(v.bs)-1]
+		return UInt(b), nil
 	}
 
-	r.Parent = io.MultiReader(rr...)
-	return &r
+	el := v.v[len(v.v)-1]
+	v.v[len(v.v)-1] = nil
+	v.v = v.v[:len(v.v)-1]
+	return el, nil
+}
+
+func (v *Array) MemReader() io.Reader {
+	return newMemReader(v)
 }
 
 func (v *Array) Type() Type {
@@ -351,9 +745,10 @@ func (v *Array) String() string {
 	var sb strings.Builder
 	sb.WriteByte('[')
 
-	for i, el := range v.v {
+	elems := v.Elems()
+	for i, el := range elems {
 		sb.WriteString(el.String())
-		if i != len(v.v)-1 {
+		if i != len(elems)-1 {
 			sb.WriteString(", ")
 		}
 	}
@@ -362,29 +757,63 @@ func (v *Array) String() string {
 	return sb.String()
 }
 
+// Object maps hashable keys to values. Objects of up to smallObjectMax
+// entries keep them in the slice sorted by the key memory, which is
+// cheaper to build and iterates in the stable order, larger ones use maps.
 type Object struct {
-	v    map[string]Iface
-	keys map[string]Iface
+	small []objectEntry
+	v     map[string]Iface
+	keys  map[string]Iface
+	host  *structBinding
+	// gen counts changes of the object, see PropCache.
+	gen uint64
+	// readonly marks snapshots of host data, see StructObject.
+	readonly bool
 }
 
 func (v *Object) Items() (keys []Iface, vals []Iface) {
-	keys = make([]Iface, 0, len(v.keys))
-	vals = make([]Iface, 0, len(v.v))
-	for s, k := range v.keys {
-		keys = append(keys, k)
-		vals = append(vals, v.v[s])
-	}
+	v = v.plain()
+	keys = make([]Iface, 0, v.size())
+	vals = make([]Iface, 0, v.size())
+	v.each(func(_ string, key, val Iface) bool {
+		keys = append(keys, key)
+		vals = append(vals, val)
+		return true
+	})
 	return keys, vals
 }
 
+// SortedKeys returns keys in the stable order: by type first, then by value
+// for ordered types and by the string form for others.
+func (v *Object) SortedKeys() []Iface {
+	keys, _ := v.Items()
+	slices.SortStableFunc(keys, func(x, y Iface) int {
+		if x.Type() != y.Type() {
+			return cmp.Compare(x.Type(), y.Type())
+		}
+
+		if c, err := Compare(x, y); err == nil {
+			return c
+		}
+
+		return strings.Compare(x.String(), y.String())
+	})
+	return keys
+}
+
 func (v *Object) Get(key Iface) (val Iface, err error) {
-	kb, err := io.ReadAll(key.MemReader())
+	if v.host != nil {
+		return v.host.get(key)
+	}
+
+	var ok bool
+	err = withMem(key, func(mem []byte) {
+		val, ok = v.lookup(string(mem))
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%s is not hashable", key.Type())
 	}
 
-	var ok bool
-	val, ok = v.v[string(kb)]
 	if !ok {
 		return nil, errors.New("key not found")
 	}
@@ -393,50 +822,43 @@ func (v *Object) Get(key Iface) (val Iface, err error) {
 }
 
 func (obj *Object) Set(k, v Iface) error {
-	kb, err := io.ReadAll(k.MemReader())
+	if obj.host != nil {
+		return obj.host.set(k, v)
+	}
+
+	if obj.readonly {
+		return errSnapshot
+	}
+
+	err := withMem(k, func(mem []byte) {
+		obj.store(string(mem), k, v)
+	})
+	obj.gen++
 	if err != nil {
 		return fmt.Errorf("%s is not hashable", k.Type())
 	}
 
-	obj.v[string(kb)] = v
-	obj.keys[string(kb)] = k
 	return nil
 }
 
 func (v *Object) IterFunc(it func(k, v Iface) (cont, brk bool)) {
-	for k, val := range v.v {
-		cont, brk := it(v.keys[k], val)
-		if cont {
-			continue
-		}
-
-		if brk {
-			break
-		}
-	}
+	v = v.plain()
+	v.each(func(_ string, key, val Iface) bool {
+		cont, brk := it(key, val)
+		return cont || !brk
+	})
 }
 
 func (v *Object) Len() int {
-	return len(v.v)
-}
-
-func (v *Object) MemReader() io.Reader {
-	r := readerWithType{
-		Type: TypeObject,
+	if v.host != nil {
+		return len(v.host.names)
 	}
 
-	if len(v.v) == 0 {
-		return &r
-	}
-
-	rr := make([]io.Reader, 0, len(v.v)*2)
-	for k, v := range v.v {
-		rr = append(rr, strings.NewReader(k))
-		rr = append(rr, v.MemReader())
-	}
+	return v.size()
+}
 
-	r.Parent = io.MultiReader(rr...)
-	return &r
+func (v *Object) MemReader() io.Reader {
+	return newMemReader(v)
 }
 
 func (v *Object) Type() Type {
@@ -444,20 +866,20 @@ func (v *Object) Type() Type {
 }
 
 func (v *Object) String() string {
+	v = v.plain()
 	var sb strings.Builder
 	sb.WriteByte('{')
 
 	i := 0
-	for k := range v.keys {
-		key, val := v.keys[k], v.v[k]
-
+	v.each(func(_ string, key, val Iface) bool {
 		sb.WriteString(key.String() + ": " + val.String())
-		if i != len(v.keys)-1 {
+		if i != v.size()-1 {
 			sb.WriteString(", ")
 		}
 
 		i++
-	}
+		return true
+	})
 
 	sb.WriteByte('}')
 	return sb.String()
@@ -472,20 +894,84 @@ func (args *Args) Print(w io.Writer) {
 }
 
 type Func struct {
-	idents []string
-	v      func(args Args) (Iface, error)
+	idents    []string
+	v         func(args Args) (Iface, error)
+	interrupt *Interrupt
+	fork      func() *Func
+	doc       *Doc
+}
+
+// Doc describes the host function or value, e.g. for help().
+type Doc struct {
+	// Signature is the call form, e.g. "len(v)".
+	Signature string
+	Text      string
 }
 
 func (v *Func) Idents() []string {
 	return v.idents
 }
 
-func (v *Func) Call(args Args) (Iface, error) {
+// Call calls the function. A panic of the function is returned as
+// *PanicError.
+func (v *Func) Call(args Args) (_ Iface, err error) {
+	defer Recover(&err)
+	return v.v(args)
+}
+
+// WithInterrupt makes the function stoppable by CallTimeout. Script
+// functions check the interrupt while running.
+func (v *Func) WithInterrupt(i *Interrupt) *Func {
+	v.interrupt = i
+	return v
+}
+
+// WithFork sets the constructor of function copies returned by Fork.
+func (v *Func) WithFork(fork func() *Func) *Func {
+	v.fork = fork
+	return v
+}
+
+// WithDoc attaches the documentation shown by help().
+func (v *Func) WithDoc(doc Doc) *Func {
+	v.doc = &doc
+	return v
+}
+
+// Doc returns the documentation attached by WithDoc.
+func (v *Func) Doc() (Doc, bool) {
+	if v.doc == nil {
+		return Doc{}, false
+	}
+
+	return *v.doc, true
+}
+
+// Fork returns the copy of the function which can be called concurrently
+// with the original. Functions without fork constructor, e.g. host
+// functions, are returned as is and must be safe for concurrent use.
+func (v *Func) Fork() *Func {
+	if v.fork == nil {
+		return v
+	}
+
+	return v.fork()
+}
+
+// CallTimeout calls the function with the deadline. Script functions are
+// stopped with *TimeoutError once the timeout elapses. Functions without
+// interrupt, e.g. host functions, are not stopped.
+func (v *Func) CallTimeout(timeout time.Duration, args Args) (Iface, error) {
+	if v.interrupt == nil {
+		return v.v(args)
+	}
+
+	defer v.interrupt.limit(timeout)()
 	return v.v(args)
 }
 
 func (v *Func) MemReader() io.Reader {
-	return memReaderFunc{}
+	return memReaderErr{err: errFuncNoMemory}
 }
 
 func (v *Func) Type() Type {
@@ -503,6 +989,14 @@ func DeepEqual(x, y Iface) bool {
 		return false
 	}
 
+	if eq, ok := x.(Equaler); ok {
+		return eq.Equal(y)
+	}
+
+	if eq, ok := y.(Equaler); ok {
+		return eq.Equal(x)
+	}
+
 	if x.Type() != y.Type() {
 		return false
 	}
@@ -515,18 +1009,23 @@ func DeepEqual(x, y Iface) bool {
 		return lb.v == rb.v
 	case TypeNum:
 		lnum, rnum := MustCast[*Num](x), MustCast[*Num](y)
-		return lnum.v.Cmp(rnum.v) == 0
+		return lnum.EqualTo(rnum)
 	case TypeString:
 		ls, rs := MustCast[*String](x), MustCast[*String](y)
 		return ls.v == rs.v
 	case TypeArray:
 		larr, rarr := MustCast[*Array](x), MustCast[*Array](y)
-		if len(larr.v) != len(rarr.v) {
+		if larr.bmode && rarr.bmode {
+			return string(larr.bs) == string(rarr.bs)
+		}
+
+		lelems, relems := larr.Elems(), rarr.Elems()
+		if len(lelems) != len(relems) {
 			return false
 		}
 
-		for i := 0; i < len(larr.v); i++ {
-			lv, rv := larr.v[i], rarr.v[i]
+		for i := 0; i < len(lelems); i++ {
+			lv, rv := lelems[i], relems[i]
 			if !DeepEqual(lv, rv) {
 				return false
 			}
@@ -534,55 +1033,135 @@ func DeepEqual(x, y Iface) bool {
 
 		return true
 	case TypeObject:
-		lobj, robj := MustCast[*Object](x), MustCast[*Object](y)
-		if lobj.v == nil && robj.v == nil {
-			return true
+		lobj, robj := MustCast[*Object](x).plain(), MustCast[*Object](y).plain()
+		if lobj.size() != robj.size() {
+			return false
 		}
 
-		var llen, rlen int
-		if lobj.v != nil {
-			llen = len(lobj.v)
-		}
+		eq := true
+		lobj.each(func(mem string, _, lv Iface) bool {
+			rv, ok := robj.lookup(mem)
+			eq = ok && DeepEqual(lv, rv)
+			return eq
+		})
+
+		return eq
+	case TypeFunc:
+		return false
+	case TypeHandle, TypePromise:
+		return x == y
+	}
+
+	if x.Type() >= TypeEnd {
+		return x == y
+	}
+
+	panic("is equal: unknown type " + x.Type().String())
+}
+
+// Compare orders numbers, strings and arrays of the same type. Arrays are
+// compared lexicographically element by element, a shorter prefix goes
+// first. NaN is not ordered.
+func Compare(x, y Iface) (int, error) {
+	if x.Type() != y.Type() {
+		return 0, fmt.Errorf("types mismatch: %s != %s", x.Type(), y.Type())
+	}
 
-		if robj.v != nil {
-			rlen = len(robj.v)
+	switch x := x.(type) {
+	case *Num:
+		y := y.(*Num)
+		if x.unordered(y) {
+			return 0, errors.New("nan is not ordered")
 		}
 
-		if llen != rlen {
-			return false
+		return x.Cmp(y), nil
+	case *String:
+		return strings.Compare(x.v, y.(*String).v), nil
+	case *Array:
+		y := y.(*Array)
+		if x.bmode && y.bmode {
+			return bytes.Compare(x.bs, y.bs), nil
 		}
 
-		for k, lv := range lobj.v {
-			rv, ok := robj.v[k]
-			if !ok {
-				return false
+		xelems, yelems := x.Elems(), y.Elems()
+		for i := 0; i < min(len(xelems), len(yelems)); i++ {
+			c, err := Compare(xelems[i], yelems[i])
+			if err != nil {
+				return 0, fmt.Errorf("element at %d position: %w", i, err)
 			}
 
-			if !DeepEqual(lv, rv) {
-				return false
+			if c != 0 {
+				return c, nil
 			}
 		}
 
-		return true
-	case TypeFunc:
-		return false
+		return cmp.Compare(len(xelems), len(yelems)), nil
 	}
-	panic("is equal: unknown type " + x.Type().String())
+
+	return 0, fmt.Errorf("%s is not ordered (expected number, string or array)", x.Type())
+}
+
+// Copy returns the shallow copy of arrays and objects, their elements are
+// shared. Other variants are returned as is.
+func Copy(v Iface) Iface {
+	switch v := v.(type) {
+	case *Array:
+		return v.view(v.shared(), 0, v.Len())
+	case *Object:
+		return v.plain().clone(func(val Iface) Iface { return val })
+	}
+
+	return v
+}
+
+// DeepCopy returns the copy of v where arrays and objects are copied
+// recursively. Immutable variants and functions are shared.
+func DeepCopy(v Iface) Iface {
+	switch v := v.(type) {
+	case *Array:
+		if v.bmode {
+			return Bytes(append([]byte(nil), v.bs...))
+		}
+
+		elems := make([]Iface, len(v.v))
+		for i, el := range v.v {
+			elems[i] = DeepCopy(el)
+		}
+
+		return NewArray(elems)
+	case *Object:
+		return v.plain().clone(DeepCopy)
+	}
+
+	return v
 }
 
 func NewNone() *None {
-	return &None{}
+	return internNone
 }
 
 func NewBool(v bool) *Bool {
-	return &Bool{v: v}
+	if v {
+		return internTrue
+	}
+
+	return internFalse
 }
 
 func NewNum(v *big.Float) *Num {
 	return &Num{v: v}
 }
 
+// NewRat returns the exact number, see Num.
+func NewRat(r *big.Rat) *Num {
+	return &Num{v: new(big.Float).SetRat(r), r: r}
+}
+
 func NewString(v string) *String {
+	if v == "" {
+		return internEmptyString
+	}
+
 	return &String{v: v}
 }
 
@@ -594,20 +1173,18 @@ func NewObject(keys []Iface, values []Iface) (*Object, error) {
 	if len(keys) != len(values) {
 		return nil, errors.New("the number of keys does not match the number of values")
 	}
-	m := make(map[string]Iface, len(keys))
-	ks := make(map[string]Iface, len(keys))
+	obj := newObject(len(keys))
 	for i := 0; i < len(keys); i++ {
 		k, v := keys[i], values[i]
-		kb, err := io.ReadAll(k.MemReader())
+		err := withMem(k, func(mem []byte) {
+			obj.store(string(mem), k, v)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("read key mem: %w", err)
 		}
-
-		m[string(kb)] = v
-		ks[string(kb)] = k
 	}
 
-	return &Object{v: m, keys: ks}, nil
+	return obj, nil
 }
 
 func MustNewObject(keys []Iface, values []Iface) *Object {
@@ -633,11 +1210,20 @@ func NewFunc(argIdents []string, v func(args Args) (Iface, error)) *Func {
 }
 
 func Int[T ~int](v T) *Num {
+	if num, ok := internedInt(int64(v)); ok {
+		return num
+	}
+
 	f := new(big.Float).SetInt64(int64(v))
 	return &Num{v: f}
 }
 
 func UInt[T ~uint | ~byte](v T) *Num {
+	if uint64(v) <= internIntMax {
+		num, _ := internedInt(int64(v))
+		return num
+	}
+
 	f := new(big.Float).SetUint64(uint64(v))
 	return &Num{v: f}
 }
@@ -660,6 +1246,10 @@ func NegInf() *Num {
 	return &Num{v: f}
 }
 
+func NaN() *Num {
+	return &Num{v: new(big.Float), nan: true}
+}
+
 func True() *Bool {
 	return NewBool(true)
 }
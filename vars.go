@@ -2,7 +2,10 @@ package easylang
 
 import (
 	"fmt"
+	"maps"
+	"sync"
 
+	"github.com/hikitani/easylang/packages"
 	"github.com/hikitani/easylang/packages/builtin"
 	"github.com/hikitani/easylang/variant"
 )
@@ -16,7 +19,9 @@ const (
 type varmapper struct {
 	m    map[string]Register
 	pubs map[string]struct{}
-	i    Register
+	// using maps variables bound by using statements to package names.
+	using map[string]string
+	i     Register
 }
 
 func (v *varmapper) RegisterPub(name string) Register {
@@ -35,20 +40,136 @@ func (v *varmapper) Register(name string) Register {
 	return v.i
 }
 
+// VarScope is the scope of variables. Names are resolved to registers at
+// compile time, values are kept in slots of the active frame indexed by the
+// register, so running code does not look variables up by name.
 type VarScope struct {
-	r varmapper
-	m map[Register]variant.Iface
+	r     varmapper
+	frame *frame
+}
+
+// frame holds values of a single activation of the scope, e.g. one call of
+// the function or one iteration of the loop.
+type frame struct {
+	slots []variant.Iface
+}
+
+// enter activates the fresh frame and returns the previous one to be
+// activated back with leave.
+func (scope *VarScope) enter() *frame {
+	prev := scope.frame
+	scope.frame = &frame{}
+	return prev
+}
+
+func (scope *VarScope) leave(prev *frame) {
+	scope.frame = prev
+}
+
+// renew activates the fresh frame for the next iteration of the loop.
+func (scope *VarScope) renew() {
+	scope.frame = &frame{}
+}
+
+// framesOf returns active frames of the scopes.
+func framesOf(scopes []*VarScope) []*frame {
+	frames := make([]*frame, len(scopes))
+	for i, scope := range scopes {
+		frames[i] = scope.frame
+	}
+
+	return frames
+}
+
+// activate activates frames of the scopes and returns the previous ones.
+func activate(scopes []*VarScope, frames []*frame) []*frame {
+	prev := framesOf(scopes)
+	for i, scope := range scopes {
+		scope.frame = frames[i]
+	}
+
+	return prev
+}
+
+// closure is the function value bound to frames of the scopes enclosing the
+// function at the time it was created, so it sees variables of that
+// activation, e.g. of the loop iteration, when called later.
+type closure struct {
+	scopes []*VarScope
+	frames []*frame
+}
+
+// newClosure captures active frames of the scopes. The last scope is the
+// own scope of the function, which gets the fresh frame on every call.
+func newClosure(scopes []*VarScope) *closure {
+	return &closure{
+		scopes: scopes,
+		frames: framesOf(scopes[:len(scopes)-1]),
+	}
+}
+
+// enter activates captured frames for the call and returns the previous
+// ones to be activated back with activate.
+func (c *closure) enter() []*frame {
+	frames := append(c.frames[:len(c.frames):len(c.frames)], &frame{})
+	return activate(c.scopes, frames)
+}
+
+// startFrames returns frames of the scopes for the call which is started
+// later, e.g. the generator. Scopes after the own one get fresh frames too.
+func (c *closure) startFrames(scopes []*VarScope) []*frame {
+	frames := make([]*frame, len(scopes))
+	copy(frames, c.frames)
+	for i := len(c.frames); i < len(frames); i++ {
+		frames[i] = &frame{}
+	}
+
+	return frames
 }
 
 func NewVarScope() *VarScope {
 	return &VarScope{
 		r: varmapper{
-			i:    1, // i = 0 reserved for return value
-			m:    map[string]Register{},
-			pubs: map[string]struct{}{},
+			i:     1, // i = 0 reserved for return value
+			m:     map[string]Register{},
+			pubs:  map[string]struct{}{},
+			using: map[string]string{},
+		},
+		frame: &frame{},
+	}
+}
+
+// Copy returns the deep copy of the scope, see variant.DeepCopy.
+func (scope *VarScope) Copy() *VarScope {
+	return scope.copyWith(variant.DeepCopy)
+}
+
+func (scope *VarScope) copyWith(copyValue func(variant.Iface) variant.Iface) *VarScope {
+	cp := &VarScope{
+		r: varmapper{
+			i:     scope.r.i,
+			m:     make(map[string]Register, len(scope.r.m)),
+			pubs:  make(map[string]struct{}, len(scope.r.pubs)),
+			using: maps.Clone(scope.r.using),
 		},
-		m: map[Register]variant.Iface{},
+		frame: &frame{slots: make([]variant.Iface, len(scope.frame.slots))},
+	}
+
+	for name, r := range scope.r.m {
+		cp.r.m[name] = r
 	}
+
+	for name := range scope.r.pubs {
+		cp.r.pubs[name] = struct{}{}
+	}
+
+	for r, v := range scope.frame.slots {
+		if v != nil {
+			cp.frame.slots[r] = copyValue(v)
+		}
+	}
+
+	return cp
 }
 
 func (scope *VarScope) SetReturn(v variant.Iface) {
@@ -73,8 +194,13 @@ func (scope *VarScope) RegisterPub(name string) Register {
 }
 
 func (scope *VarScope) GetVar(r Register) (variant.Iface, bool) {
-	v, ok := scope.m[r]
-	return v, ok
+	slots := scope.frame.slots
+	if int(r) >= len(slots) {
+		return nil, false
+	}
+
+	v := slots[r]
+	return v, v != nil
 }
 
 func (scope *VarScope) VarByName(name string) variant.Iface {
@@ -83,7 +209,8 @@ func (scope *VarScope) VarByName(name string) variant.Iface {
 		panic("var '" + name + "' not found")
 	}
 
-	return scope.m[r]
+	v, _ := scope.GetVar(r)
+	return v
 }
 
 func (scope *VarScope) LookupRegister(name string) (Register, bool) {
@@ -97,7 +224,27 @@ func (scope *VarScope) IsPublic(name string) bool {
 }
 
 func (scope *VarScope) DefineVar(r Register, value variant.Iface) {
-	scope.m[r] = value
+	f := scope.frame
+	if int(r) >= len(f.slots) {
+		// grow to all registered variables at once
+		slots := make([]variant.Iface, max(int(r), int(scope.r.i)-1)+1)
+		copy(slots, f.slots)
+		f.slots = slots
+	}
+
+	f.slots[r] = value
+}
+
+// Undefine removes the variable, so it is not visible to compiled code.
+func (scope *VarScope) Undefine(name string) {
+	if r, ok := scope.r.m[name]; ok {
+		if int(r) < len(scope.frame.slots) {
+			scope.frame.slots[r] = nil
+		}
+		delete(scope.r.m, name)
+		delete(scope.r.pubs, name)
+		delete(scope.r.using, name)
+	}
 }
 
 type Vars struct {
@@ -105,6 +252,9 @@ type Vars struct {
 	Locals           []*VarScope
 	ParentBlockScope *VarScope
 
+	// created collects scopes created by WithScope, see collecting.
+	created *[]*VarScope
+
 	debug       bool
 	debugChilds []*Vars
 }
@@ -117,6 +267,11 @@ func (vars *Vars) WithScope() *Vars {
 		Global:           vars.Global,
 		Locals:           locals,
 		ParentBlockScope: vars.ParentBlockScope,
+		created:          vars.created,
+	}
+
+	if vars.created != nil {
+		*vars.created = append(*vars.created, locals[len(locals)-1])
 	}
 
 	if vars.debug {
@@ -126,6 +281,14 @@ func (vars *Vars) WithScope() *Vars {
 	return child
 }
 
+// collecting returns vars adding scopes created by WithScope to created,
+// e.g. to switch frames of all scopes of the generator body.
+func (vars *Vars) collecting(created *[]*VarScope) *Vars {
+	child := *vars
+	child.created = created
+	return &child
+}
+
 func (vars *Vars) Unscope() *Vars {
 	if len(vars.Locals) == 0 {
 		panic("local vars not created, impossible to unscope")
@@ -185,6 +348,29 @@ func (vars *Vars) Register(name string) (*VarScope, Register) {
 	return vars.LastScope(), vars.LastScope().Register(name)
 }
 
+// Lookup returns the scope where the variable is registered.
+func (vars *Vars) Lookup(name string) (*VarScope, bool) {
+	for i := len(vars.Locals) - 1; i >= 0; i-- {
+		if _, ok := vars.Locals[i].LookupRegister(name); ok {
+			return vars.Locals[i], true
+		}
+	}
+
+	_, ok := vars.Global.LookupRegister(name)
+	return vars.Global, ok
+}
+
+// Declare registers the variable in the innermost scope, hiding variables of
+// the same name defined by outer scopes.
+func (vars *Vars) Declare(name string) (*VarScope, Register) {
+	if len(vars.Locals) == 0 {
+		return vars.Global, vars.Global.Register(name)
+	}
+
+	scope := vars.LastScope()
+	return scope, scope.Register(name)
+}
+
 func (vars *Vars) RegisterPub(name string) (*VarScope, Register, error) {
 	_, ok := vars.Global.LookupRegister(name)
 	if !ok {
@@ -198,8 +384,13 @@ func (vars *Vars) RegisterPub(name string) (*VarScope, Register, error) {
 func (vars *Vars) Published() *variant.Object {
 	var keys, vals []variant.Iface
 	for pubname := range vars.Global.r.pubs {
+		v, ok := vars.Global.GetVar(vars.Global.r.m[pubname])
+		if !ok {
+			continue
+		}
+
 		keys = append(keys, variant.NewString(pubname))
-		vals = append(vals, vars.Global.VarByName(pubname))
+		vals = append(vals, v)
 	}
 
 	return variant.MustNewObject(keys, vals)
@@ -218,12 +409,67 @@ func (vars *Vars) LookupRegister(name string) (*VarScope, Register, bool) {
 	return vars.Global, r, ok
 }
 
+// isolated returns the copy of vars, so code compiled with it does not share
+// variables with the original. Functions are replaced with their forks.
+func (vars *Vars) isolated() *Vars {
+	copies := map[*VarScope]*VarScope{}
+	isolate := func(scope *VarScope) *VarScope {
+		if scope == nil {
+			return nil
+		}
+
+		if cp, ok := copies[scope]; ok {
+			return cp
+		}
+
+		cp := scope.copyWith(func(v variant.Iface) variant.Iface {
+			if fn, ok := v.(*variant.Func); ok {
+				return lazyFork(fn)
+			}
+
+			return variant.DeepCopy(v)
+		})
+		copies[scope] = cp
+		return cp
+	}
+
+	locals := make([]*VarScope, len(vars.Locals))
+	for i, scope := range vars.Locals {
+		locals[i] = isolate(scope)
+	}
+
+	return &Vars{
+		Global:           isolate(vars.Global),
+		Locals:           locals,
+		ParentBlockScope: isolate(vars.ParentBlockScope),
+	}
+}
+
+// lazyFork returns the function forking fn on the first call. Forking is
+// deferred, because forks of recursive functions would never end otherwise.
+func lazyFork(fn *variant.Func) *variant.Func {
+	var (
+		once   sync.Once
+		forked *variant.Func
+	)
+	return variant.NewFunc(fn.Idents(), func(args variant.Args) (variant.Iface, error) {
+		once.Do(func() { forked = fn.Fork() })
+		return forked.Call(args)
+	}).WithFork(fn.Fork)
+}
+
 func NewVars() *Vars {
+	return NewVarsWith(builtin.Package)
+}
+
+// NewVarsWith creates variables with objects of the builtins package
+// defined in the global scope.
+func NewVarsWith(builtins packages.Iface) *Vars {
 	vars := &Vars{
 		Global: NewVarScope(),
 	}
 
-	for name, obj := range builtin.Package.Objects() {
+	for name, obj := range builtins.Objects() {
 		r := vars.Global.Register(name)
 		vars.Global.DefineVar(r, obj)
 	}
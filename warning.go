@@ -0,0 +1,28 @@
+package easylang
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Warning is a non-fatal diagnostic reported during code generation.
+type Warning struct {
+	Pos lexer.Position
+	Msg string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Pos, w.Msg)
+}
+
+// WarnHandler receives warnings reported during code generation.
+type WarnHandler func(w Warning)
+
+func (h WarnHandler) warnf(pos lexer.Position, format string, args ...any) {
+	if h == nil {
+		return
+	}
+
+	h(Warning{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}